@@ -2,58 +2,84 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
-	"github.com/liao/style-bot/internal/ai"
-	"github.com/liao/style-bot/internal/bot"
+	"github.com/liao/style-bot/internal/app"
 	"github.com/liao/style-bot/internal/chat"
 	"github.com/liao/style-bot/internal/config"
-	"github.com/liao/style-bot/internal/persona"
+	"github.com/liao/style-bot/internal/coord"
+	"github.com/liao/style-bot/internal/logging"
+	"github.com/liao/style-bot/internal/platform/webhook"
 	"github.com/liao/style-bot/internal/rag"
 )
 
 func main() {
 	configPath := flag.String("config", "configs/config.yaml", "config file path")
+	apiKeysJSON := flag.String("api-keys-json", "", `Gemini API keys as a JSON array, e.g. '["key1","key2"]', added to gemini.api_keys`)
+	dryRun := flag.Bool("dry-run", false, "generate replies and forward them to the owner instead of the target (same as bot.dry_run)")
+	generateConfig := flag.Bool("generate-config", false, "print the default config as YAML and exit")
 	flag.Parse()
 
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	if *generateConfig {
+		out, err := config.Defaults().YAML()
+		if err != nil {
+			slog.Error("generate config failed", "error", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(slog.LevelDebug)
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})))
 
 	cfg, err := config.Load(*configPath)
 	if err != nil {
 		slog.Error("load config failed", "error", err)
 		os.Exit(1)
 	}
+	var logOut io.Writer = os.Stdout
+	if cfg.Logging.File != "" {
+		f, err := logging.OpenRotatingFile(cfg.Logging.File, int64(cfg.Logging.MaxSizeMB)<<20)
+		if err != nil {
+			slog.Error("open log file failed", "error", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		logOut = f
+	}
+	handler, err := logging.NewHandler(logOut, cfg.Logging.Format, logLevel)
+	if err != nil {
+		slog.Error("configure logging failed", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(slog.New(handler))
+	if err := logging.Configure(handler, cfg.Logging.Level, cfg.Logging.Levels); err != nil {
+		slog.Error("configure logging failed", "error", err)
+		os.Exit(1)
+	}
+	logging.SetRedactContent(cfg.Logging.RedactContent)
+	if *dryRun {
+		cfg.Bot.DryRun = true
+	}
+	level, _ := logging.ParseLevel(cfg.Logging.Level)
+	logLevel.Set(level)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Gemini 客户端（多模型轮换）
-	chatModels := cfg.Gemini.ChatModels
-	if len(chatModels) == 0 && cfg.Gemini.ChatModel != "" {
-		chatModels = []string{cfg.Gemini.ChatModel}
-	}
-	apiKeys := []string{cfg.Gemini.APIKey}
-	if key2 := os.Getenv("GEMINI_API_KEY2"); key2 != "" {
-		apiKeys = append(apiKeys, key2)
-	}
-	aiClient, err := ai.NewClient(ctx,
-		apiKeys,
-		chatModels,
-		cfg.Gemini.EmbeddingModel,
-		cfg.Gemini.OllamaURL,
-		cfg.Gemini.Temperature,
-		cfg.Gemini.MaxOutputTokens,
-		cfg.Gemini.RPMLimit,
-	)
+	extraKeys, err := config.ParseAPIKeys(*apiKeysJSON)
 	if err != nil {
-		slog.Error("create AI client failed", "error", err)
+		slog.Error("invalid -api-keys-json", "error", err)
 		os.Exit(1)
 	}
-	slog.Info("AI client initialized", "model", cfg.Gemini.ChatModel)
 
 	// 会话管理
 	chatMgr, err := chat.NewManager(cfg.Bot.MaxContextTurns, cfg.Data.SessionsDir)
@@ -62,25 +88,38 @@ func main() {
 		os.Exit(1)
 	}
 
-	// 向量存储 + RAG
-	store, err := rag.NewStore(cfg.RAG.VectorsDir, aiClient.EmbedFunc())
-	if err != nil {
-		slog.Warn("load vector store failed, RAG disabled", "error", err)
-		store = nil
-	}
-	ragPipeline := rag.NewPipeline(store, cfg.RAG.TopK, cfg.RAG.MinSimilarity)
-
-	// Persona
-	var p *persona.Persona
-	if cfg.Data.PersonaFile != "" {
-		p, err = persona.LoadFromFile(cfg.Data.PersonaFile)
+	// 多实例协调
+	var coordinator coord.Coordinator = coord.Noop{}
+	if cfg.NATS.URL != "" {
+		nc, err := coord.NewNATS(cfg.NATS.URL)
 		if err != nil {
-			slog.Warn("load persona failed, using default", "error", err)
+			slog.Error("connect nats failed", "error", err)
+			os.Exit(1)
 		}
+		coordinator = nc
+	}
+
+	// Bot：AI 客户端（多模型轮换）、向量存储 + RAG、persona、system prompt 模板（启动时校验）
+	built, err := app.NewBot(ctx, cfg, chatMgr, coordinator, extraKeys)
+	if errors.Is(err, rag.ErrEmbeddingMismatch) {
+		slog.Error("vector store does not match the embedding model", "error", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		slog.Error("create bot failed", "error", err)
+		os.Exit(1)
 	}
+	slog.Info("AI client initialized", "model", cfg.Gemini.ChatModel)
+	b := built.Bot
 
-	// Bot
-	b := bot.New(cfg, aiClient, chatMgr, ragPipeline, p)
+	// 管理 HTTP 服务：健康检查、指标、暂停/恢复
+	adminDone := make(chan struct{})
+	go func() {
+		defer close(adminDone)
+		if err := b.ServeAdmin(ctx); err != nil {
+			slog.Error("admin server stopped", "error", err)
+		}
+	}()
 
 	// 优雅关闭
 	go func() {
@@ -90,8 +129,26 @@ func main() {
 		slog.Info("shutting down...")
 		b.Stop()
 		cancel()
+		<-adminDone // 等管理服务处理完进行中的请求
 		os.Exit(0)
 	}()
 
+	// HTTP webhook：没有 NapCat 时只跑 webhook
+	if cfg.Webhook.ListenAddr != "" {
+		wh := webhook.New(cfg.Webhook.ListenAddr, cfg.Webhook.Secret)
+		if cfg.NapCat.WSURL == "" {
+			if err := wh.Run(ctx, b.HandlePlatformMessage); err != nil {
+				slog.Error("webhook stopped", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
+		go func() {
+			if err := wh.Run(ctx, b.HandlePlatformMessage); err != nil {
+				slog.Error("webhook stopped", "error", err)
+			}
+		}()
+	}
+
 	b.Run(ctx)
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liao/style-bot/internal/app"
+	"github.com/liao/style-bot/internal/bot"
+	"github.com/liao/style-bot/internal/chat"
+	"github.com/liao/style-bot/internal/config"
+	"github.com/liao/style-bot/internal/logging"
+)
+
+// chat-cli 不连 QQ（不需要 NapCat），从标准输入读消息（当作 target 发来的），打印 bot 的回复，用来离线调 persona、prompt 和 RAG。
+// 会话只在内存里，不碰线上的会话文件
+func main() {
+	configPath := flag.String("config", "configs/config.yaml", "config file path")
+	logLevel := flag.String("log-level", "warn", "log level (debug, info, warn, error)")
+	flag.Parse()
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		slog.Error("load config failed", "error", err)
+		os.Exit(1)
+	}
+	if err := logging.Configure(slog.Default().Handler(), *logLevel, nil); err != nil {
+		slog.Error("configure logging failed", "error", err)
+		os.Exit(1)
+	}
+
+	// 配额、待发箱等状态写到临时目录，不写审计和 live log，也不自动刷新 persona
+	stateDir, err := os.MkdirTemp("", "chat-cli-")
+	if err != nil {
+		slog.Error("create state dir failed", "error", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(stateDir)
+	cfg.Data.SessionsDir = stateDir
+	cfg.Data.AuditDir = ""
+	cfg.Data.LiveLog = ""
+	cfg.Bot.PersonaRefreshAfterMessages = 0
+
+	ctx := context.Background()
+	chatMgr := chat.NewMemoryManager(cfg.Bot.MaxContextTurns)
+	// 和 cmd/bot 相同的 AI 客户端、RAG、persona 和 prompt 模板
+	built, err := app.NewBot(ctx, cfg, chatMgr, nil, nil)
+	if err != nil {
+		slog.Error("init bot failed", "error", err)
+		os.Exit(1)
+	}
+
+	r := &repl{bot: built.Bot, chat: chatMgr, peer: cfg.Bot.TargetQQ}
+	fmt.Fprintf(os.Stderr, "chatting as %s (QQ %d); commands: %s; Ctrl-D to quit\n", cfg.Bot.TargetName, cfg.Bot.TargetQQ, commandHelp)
+	in := bufio.NewScanner(os.Stdin)
+	for fmt.Print("> "); in.Scan(); fmt.Print("> ") {
+		line := strings.TrimSpace(in.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "/"):
+			r.command(line)
+		default:
+			r.send(ctx, line)
+		}
+	}
+	fmt.Println()
+}
+
+const commandHelp = "/history, /reset, /prompt, /topk N"
+
+// repl 一次交互会话的状态
+type repl struct {
+	bot        *bot.Bot
+	chat       *chat.Manager
+	peer       int64
+	lastPrompt string // 最近一次生成用的 system prompt
+}
+
+// send 把 text 当作对方的消息走完整流程，打印各条回复和检索数、耗时
+func (r *repl) send(ctx context.Context, text string) {
+	start := time.Now()
+	resp, err := r.bot.RespondDetailed(ctx, r.peer, text)
+	if err != nil {
+		slog.Error("respond failed", "error", err)
+		return
+	}
+	if resp.Prompt != "" {
+		r.lastPrompt = resp.Prompt
+	}
+	if len(resp.Parts) == 0 {
+		fmt.Println("(no reply)")
+	}
+	for _, part := range resp.Parts {
+		fmt.Println(part)
+	}
+	fmt.Fprintf(os.Stderr, "  [%d examples, %s, %.1fs]\n", resp.Examples, resp.Model, time.Since(start).Seconds())
+}
+
+// command 处理 / 开头的本地命令
+func (r *repl) command(line string) {
+	args := strings.Fields(line)
+	switch args[0] {
+	case "/history":
+		for _, l := range r.chat.Transcript() {
+			fmt.Println(l)
+		}
+	case "/reset":
+		r.chat.Reset()
+		r.lastPrompt = ""
+		fmt.Println("session cleared")
+	case "/prompt":
+		if r.lastPrompt == "" {
+			fmt.Println("no prompt yet")
+			return
+		}
+		fmt.Println(r.lastPrompt)
+	case "/topk":
+		n := 0
+		if len(args) == 2 {
+			n, _ = strconv.Atoi(args[1])
+		}
+		if n <= 0 {
+			r.bot.SetTopK(0)
+			fmt.Println("usage: /topk N (N > 0); top_k back to config")
+			return
+		}
+		r.bot.SetTopK(n)
+		fmt.Printf("top_k = %d\n", n)
+	default:
+		fmt.Println("unknown command; available: " + commandHelp)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// chunkConversation 按行把过长的对话切成多段：每段不超过 maxLen 个字符，相邻两段重叠末尾不超过 overlap 个字符的整行。
+// 单行超过 maxLen 时按字符硬切（同样带 overlap）。maxLen <= 0 时不切分
+func chunkConversation(text string, maxLen, overlap int) []string {
+	if maxLen <= 0 || utf8.RuneCountInString(text) <= maxLen {
+		return []string{text}
+	}
+	overlap = min(max(overlap, 0), maxLen/2)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, splitLongLine(line, maxLen, overlap)...)
+	}
+
+	var chunks []string
+	var cur []string // 当前段的行
+	size := 0        // 当前段的字符数（含换行）
+	for _, line := range lines {
+		n := utf8.RuneCountInString(line)
+		if len(cur) > 0 && size+1+n > maxLen {
+			chunks = append(chunks, strings.Join(cur, "\n"))
+			cur, size = overlapTail(cur, overlap)
+			// 重叠部分加上这一行仍然放不下时不重叠
+			if len(cur) > 0 && size+1+n > maxLen {
+				cur, size = nil, 0
+			}
+		}
+		if len(cur) > 0 {
+			size++
+		}
+		cur = append(cur, line)
+		size += n
+	}
+	if len(cur) > 0 {
+		chunks = append(chunks, strings.Join(cur, "\n"))
+	}
+	return chunks
+}
+
+// overlapTail 取末尾总长不超过 overlap 的整行，作为下一段的开头；至少丢掉一行，保证往前推进
+func overlapTail(lines []string, overlap int) ([]string, int) {
+	size := 0
+	start := len(lines)
+	for start > 1 {
+		n := utf8.RuneCountInString(lines[start-1])
+		if start < len(lines) {
+			n++ // 换行
+		}
+		if size+n > overlap {
+			break
+		}
+		size += n
+		start--
+	}
+	return append([]string(nil), lines[start:]...), size
+}
+
+// splitLongLine 超过 maxLen 的单行按字符切开，相邻两片重叠 overlap 个字符
+func splitLongLine(line string, maxLen, overlap int) []string {
+	r := []rune(line)
+	if len(r) <= maxLen {
+		return []string{line}
+	}
+	var parts []string
+	for start := 0; ; start += maxLen - overlap {
+		end := min(start+maxLen, len(r))
+		parts = append(parts, string(r[start:end]))
+		if end == len(r) {
+			return parts
+		}
+	}
+}
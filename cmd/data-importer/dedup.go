@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log/slog"
+	"math"
+	"strings"
+
+	"github.com/liao/style-bot/internal/parser"
+	"github.com/liao/style-bot/internal/rag"
+)
+
+// metaDupCount 文档 metadata 里这段对话代表的原对话数（去重时合并了重复的对话，大于 1 才写）
+const metaDupCount = "count"
+
+// dedupResult 去重结果，下标都是对话在原切片里的位置：文档 ID、进度文件和失败列表都按原位置编号，
+// 开不开去重、阈值怎么变，同一段对话的 ID 都不变，续传和 -retry-failed 不会错位
+type dedupResult struct {
+	counts  map[int]int  // 保留的对话代表的原对话数（只记大于 1 的）
+	dropped map[int]bool // 作为重复跳过的对话
+	exact   int          // 内容完全相同被跳过的对话数
+	near    int          // 相似度达到阈值被合并的对话数
+}
+
+func (r dedupResult) total() int {
+	return r.exact + r.near
+}
+
+// dedupConversations 向量化前找出重复的对话（大量重复的寒暄既浪费 embedding 额度又会挤占检索结果）：
+// 规范化后内容相同的只保留第一段；nearThreshold > 0 时，字符二元组的 Jaccard 相似度不低于它的也并入先出现的那段
+func dedupConversations(conversations []parser.Conversation, nearThreshold float64) dedupResult {
+	r := dedupResult{counts: make(map[int]int), dropped: make(map[int]bool)}
+	seen := make(map[[sha256.Size]byte]int)
+	// bySize 保留对话按二元组个数分桶：Jaccard >= t 时两边的个数之比也 >= t，只需比较个数相近的
+	bySize := make(map[int][]int)
+	grams := make(map[int]map[string]bool)
+	for i, c := range conversations {
+		text := normalizedConversation(c)
+		sum := sha256.Sum256([]byte(text))
+		if k, ok := seen[sum]; ok {
+			r.counts[k] = max(r.counts[k], 1) + 1
+			r.dropped[i] = true
+			r.exact++
+			continue
+		}
+		if nearThreshold > 0 {
+			g := bigrams(text)
+			if k, ok := findNear(g, grams, bySize, nearThreshold); ok {
+				r.counts[k] = max(r.counts[k], 1) + 1
+				r.dropped[i] = true
+				r.near++
+				continue
+			}
+			grams[i] = g
+			bySize[len(g)] = append(bySize[len(g)], i)
+		}
+		seen[sum] = i
+	}
+	return r
+}
+
+// dedupForVectors -dedup 关闭时不去重，否则去重并记录日志
+func dedupForVectors(conversations []parser.Conversation, enabled bool, nearThreshold float64) dedupResult {
+	if !enabled {
+		return dedupResult{}
+	}
+	r := dedupConversations(conversations, nearThreshold)
+	if r.total() > 0 {
+		slog.Info("deduplicated conversations", "exact", r.exact, "near", r.near, "kept", len(conversations)-r.total())
+	}
+	return r
+}
+
+// removeDuplicateDocuments 删掉这次作为重复跳过、但之前的导入（没开去重或阈值不同）已写入的文档，返回删除数
+func removeDuplicateDocuments(ctx context.Context, store rag.VectorStore, conversations []parser.Conversation, dedup dedupResult, myName, targetName, sourceTag string, maxChunkLen, chunkOverlap int) int {
+	removed := 0
+	for i := range dedup.dropped {
+		for _, d := range conversationDocuments(i, conversations[i], myName, targetName, sourceTag, maxChunkLen, chunkOverlap, "", 0) {
+			err := store.Remove(ctx, d.ID)
+			switch {
+			case err == nil:
+				removed++
+			case !errors.Is(err, rag.ErrNotFound):
+				slog.Warn("remove duplicate document failed", "id", d.ID, "error", err)
+			}
+		}
+	}
+	return removed
+}
+
+// normalizedConversation 去重用的对话文本：每条消息一行，标明是不是我说的，内容转小写、合并空白
+func normalizedConversation(c parser.Conversation) string {
+	var b strings.Builder
+	for _, m := range c.Messages {
+		if m.IsMe {
+			b.WriteString("me:")
+		} else {
+			b.WriteString("them:")
+		}
+		b.WriteString(strings.Join(strings.Fields(strings.ToLower(m.Content)), " "))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// bigrams 文本的字符二元组集合
+func bigrams(text string) map[string]bool {
+	runes := []rune(text)
+	set := make(map[string]bool, len(runes))
+	for i := 0; i+1 < len(runes); i++ {
+		set[string(runes[i:i+2])] = true
+	}
+	return set
+}
+
+// findNear 在已保留的对话里找与 g 的 Jaccard 相似度不低于 threshold 的第一段
+func findNear(g map[string]bool, grams map[int]map[string]bool, bySize map[int][]int, threshold float64) (int, bool) {
+	best := -1
+	lo := int(math.Ceil(float64(len(g)) * threshold))
+	hi := int(math.Floor(float64(len(g)) / threshold))
+	for size := lo; size <= hi; size++ {
+		for _, i := range bySize[size] {
+			if (best < 0 || i < best) && jaccard(g, grams[i]) >= threshold {
+				best = i
+				break
+			}
+		}
+	}
+	return best, best >= 0
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	inter := 0
+	for k := range a {
+		if b[k] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
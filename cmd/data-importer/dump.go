@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/liao/style-bot/internal/parser"
+)
+
+// conversationsFile -dump-conversations 写出的切分后的对话，可以直接作为 -input 重新向量化
+const conversationsFile = "conversations.jsonl"
+
+// dumpConversations 覆盖写入 path
+func dumpConversations(path string, conversations []parser.Conversation) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("create conversations file: %w", err)
+	}
+	if err := parser.WriteJSONLConversations(f, conversations); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/liao/style-bot/internal/rag"
+)
+
+// failedIDsFile 向量目录下记录写入失败的文档 ID，-retry-failed 时只重试这些
+const failedIDsFile = ".failed_ids.jsonl"
+
+// failedDoc failedIDsFile 的一行
+type failedDoc struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// addDocuments 整批写入；整批失败时逐条重新提交，返回最终失败的文档
+func addDocuments(ctx context.Context, store rag.VectorStore, docs []rag.Document, minDocLen int) []failedDoc {
+	err := rag.AddDocuments(ctx, store, docs, minDocLen)
+	if err == nil {
+		return nil
+	}
+	slog.Warn("batch failed, retrying documents one by one", "count", len(docs), "error", err)
+	var failed []failedDoc
+	for _, d := range docs {
+		if err := rag.AddDocuments(ctx, store, []rag.Document{d}, minDocLen); err != nil {
+			slog.Warn("document failed", "id", d.ID, "error", err)
+			failed = append(failed, failedDoc{ID: d.ID, Error: err.Error()})
+		}
+	}
+	return failed
+}
+
+// appendFailed 把失败的文档追加到 path
+func appendFailed(path string, failed []failedDoc) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open failed ids file: %w", err)
+	}
+	enc := json.NewEncoder(f)
+	for _, d := range failed {
+		if err := enc.Encode(d); err != nil {
+			f.Close()
+			return fmt.Errorf("write failed ids file: %w", err)
+		}
+	}
+	return f.Close()
+}
+
+// readFailedIDs 读取 path 里记录的失败文档 ID（去重）
+func readFailedIDs(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open failed ids file: %w", err)
+	}
+	defer f.Close()
+
+	ids := make(map[string]bool)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var d failedDoc
+		if err := json.Unmarshal(sc.Bytes(), &d); err != nil {
+			return nil, fmt.Errorf("parse failed ids file: %w", err)
+		}
+		if d.ID != "" {
+			ids[d.ID] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read failed ids file: %w", err)
+	}
+	return ids, nil
+}
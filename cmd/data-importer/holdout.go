@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/liao/style-bot/internal/parser"
+)
+
+// splitHoldout 按固定间隔挑出约 fraction 比例的对话（分散在整个时间线上，重复导入结果一致）
+func splitHoldout(conversations []parser.Conversation, fraction float64) (kept, held []parser.Conversation) {
+	if fraction <= 0 || len(conversations) == 0 {
+		return conversations, nil
+	}
+	every := max(int(math.Round(1/fraction)), 1)
+	for i, c := range conversations {
+		if i%every == every-1 {
+			held = append(held, c)
+		} else {
+			kept = append(kept, c)
+		}
+	}
+	return kept, held
+}
+
+// withoutConversations 从消息时间线里去掉 held 中的消息（风格分析也不应该看到留出的对话）
+func withoutConversations(messages []parser.ChatMessage, held []parser.Conversation) []parser.ChatMessage {
+	drop := make(map[parser.ChatMessage]int)
+	for _, c := range held {
+		for _, m := range c.Messages {
+			drop[m]++
+		}
+	}
+	out := make([]parser.ChatMessage, 0, len(messages))
+	for _, m := range messages {
+		if drop[m] > 0 {
+			drop[m]--
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// writeHoldout 留出的对话写成 JSONL，每行一个 parser.Conversation
+func writeHoldout(path string, held []parser.Conversation) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("create holdout file: %w", err)
+	}
+	enc := json.NewEncoder(f)
+	for _, c := range held {
+		if err := enc.Encode(c); err != nil {
+			f.Close()
+			return fmt.Errorf("write holdout: %w", err)
+		}
+	}
+	return f.Close()
+}
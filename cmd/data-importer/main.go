@@ -2,47 +2,118 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/philippgille/chromem-go"
 	"google.golang.org/genai"
 
+	"github.com/liao/style-bot/internal/ai"
+	"github.com/liao/style-bot/internal/config"
 	"github.com/liao/style-bot/internal/parser"
 	"github.com/liao/style-bot/internal/persona"
+	"github.com/liao/style-bot/internal/rag"
 )
 
 func main() {
-	inputFile := flag.String("input", "", "chat history file (encrypted .enc or plain .jsonl/.txt/.html)")
+	inputFile := flag.String("input", "", "chat history file (encrypted .enc or plain .jsonl/.txt/.html/.csv), a directory of them, or a glob")
 	outputDir := flag.String("output", "./data", "output directory")
 	myName := flag.String("me", "我", "my display name in chat history")
 	targetName := flag.String("target", "", "target person's display name")
 	apiKey := flag.String("api-key", "", "Gemini API key (or set GEMINI_API_KEY env)")
-	format := flag.String("format", "auto", "input format: enc-jsonl, jsonl, text, html, auto")
+	format := flag.String("format", "auto", "input format: enc-jsonl, jsonl, text, html, csv, dingtalk, a registered plugin name, or auto")
 	decryptKey := flag.String("decrypt-key", "", "decryption password for .enc files (from env DECRYPT_KEY if not set)")
 	userIsMe := flag.Bool("user-is-me", true, "in JSONL, role=user is me (default true)")
 	apiKey2 := flag.String("api-key2", "", "second Gemini API key for rotation (or GEMINI_API_KEY2 env)")
+	thinkingBudget := flag.Int("thinking-budget", 0, "thinking token budget for style analysis (gemini.analysis_thinking_budget), 0 = off")
+	apiKeysFile := flag.String("api-keys-file", "", "CSV file with one Gemini API key per line (# for comments), or a JSON array of keys")
+	apiKeysJSON := flag.String("api-keys-json", "", `Gemini API keys as a JSON array, e.g. '["key1","key2"]'`)
+	minDocLen := flag.Int("min-doc-len", config.Defaults().RAG.MinDocumentLength, "skip conversations shorter than this many characters when vectorizing (rag.min_document_length)")
+	minDuration := flag.Duration("min-duration", 2*time.Minute, "skip conversations shorter than this (e.g. 2m); JSONL conversations without timestamps are kept")
+	embedRetryDefaults := config.Defaults().Gemini.EmbedRetry
+	embedAttempts := flag.Int("embed-attempts", embedRetryDefaults.MaxAttempts, "embedding attempts per document (gemini.embed_retry.max_attempts)")
+	embedBaseDelay := flag.Duration("embed-base-delay", embedRetryDefaults.BaseDelay, "initial embedding retry delay, doubled each attempt (gemini.embed_retry.base_delay)")
+	embedMaxDelay := flag.Duration("embed-max-delay", embedRetryDefaults.MaxDelay, "longest embedding retry delay (gemini.embed_retry.max_delay)")
+	embedJitter := flag.Float64("embed-jitter", embedRetryDefaults.Jitter, "random jitter of embedding retry delays, 0.2 = ±20% (gemini.embed_retry.jitter)")
+	embeddingModel := flag.String("embedding-model", "nomic-embed-text", "embedding model, must match the bot's gemini.embedding_model")
+	ollamaURL := flag.String("ollama-url", defaultOllamaURL(), "Ollama API for embedding (gemini.ollama_url); empty = embed with the Gemini API")
+	embeddingDim := flag.Int("embedding-dim", 0, "Gemini embedding output dimension (gemini.embedding_dim), only used without -ollama-url; 0 = model default")
+	myStaffID := flag.String("my-staff-id", "", "my DingTalk staffId, required for DingTalk exports")
+	encoding := flag.String("encoding", "auto", "character encoding of text/html/csv exports: gbk, utf8, or auto (HTML <meta charset>, otherwise GBK if most non-ASCII bytes are not valid UTF-8); a leading BOM is always stripped")
+	csvTimeCol := flag.Int("csv-time-col", parser.DefaultCSVColumns.Time, "0-based timestamp column in CSV exports")
+	csvSenderCol := flag.Int("csv-sender-col", parser.DefaultCSVColumns.Sender, "0-based sender column in CSV exports")
+	csvContentCol := flag.Int("csv-content-col", parser.DefaultCSVColumns.Content, "0-based message content column in CSV exports")
+	zeroTimePolicy := flag.String("zero-time", "interleave", "where messages without timestamps go when sorting: interleave (after the previous message) or last")
+	minMsgLen := flag.Int("min-msg-len", 2, "leave messages shorter than this many characters out of style analysis")
+	maxMsgLen := flag.Int("max-msg-len", 500, "leave messages longer than this many characters (pasted articles) out of style analysis, 0 = no limit")
+	minConvMessages := flag.Int("min-conv-messages", 2, "skip conversations with fewer messages than this")
+	minConvChars := flag.Int("min-conv-chars", 0, "skip conversations with fewer characters than this in total, 0 = off")
+	sampleStrategy := flag.String("sample-strategy", string(persona.SampleByIndex), "how to sample my messages for style analysis: uniform-by-index or uniform-by-time (even across time windows)")
+	timeWindows := flag.Int("time-windows", 1, "split history into N time windows, analyze them concurrently and merge the personas (1 = analyze everything at once)")
+	analysisConcurrency := flag.Int("analysis-concurrency", 2, "max concurrent style analysis requests with -time-windows")
+	analysisStop := flag.String("analysis-stop", "", "comma-separated stop sequences for style analysis (gemini.analysis_stop_sequences), e.g. ```")
+	maxChunkLen := flag.Int("max-chunk-len", 2000, "split conversations longer than this many characters into overlapping chunks on line boundaries, each its own vector document")
+	chunkOverlap := flag.Int("chunk-overlap", 200, "characters of whole lines repeated at the start of the next chunk")
+	stripEmoji := flag.Bool("strip-emoji", true, "remove emoji before embedding (must match rag.strip_emoji); @mentions and extra whitespace are always removed")
+	sentimentModel := flag.String("sentiment-model", config.Defaults().Gemini.SentimentModel, "model for -annotate-sentiment, same as the bot's gemini.sentiment_model")
+	annotateSentiment := flag.Bool("annotate-sentiment", false, "label each conversation positive/neutral/negative/playful with Gemini (10 per request) and store it as vector metadata (rag.sentiment_boost)")
+	retryFailed := flag.Bool("retry-failed", false, "only re-vectorize the documents listed in <output>/vectors/.failed_ids.jsonl by a previous run (same input and flags)")
+	holdout := flag.Float64("holdout", 0, "fraction of conversations (e.g. 0.05) kept out of style analysis and the vector store and written to <output>/holdout.jsonl for cmd/eval")
+	dumpConvs := flag.Bool("dump-conversations", false, "write the split conversations to <output>/conversations.jsonl (JSONL format, role user = me) so they can be re-vectorized with -input later without re-parsing or decrypting the source")
+	parseConcurrency := flag.Int("parse-concurrency", 4, "max input files parsed at the same time when -input is a directory or glob")
+	targetMultiple := flag.Bool("target-multiple", false, "group chat export: build a separate persona and vector store for every other sender in <output>/<sender>/ (instead of -target)")
+	minPerTarget := flag.Int("min-messages-per-target", 20, "with -target-multiple, skip senders with fewer messages than this")
+	dedup := flag.Bool("dedup", true, "skip conversations whose normalized text exactly repeats an earlier one before vectorizing")
+	dedupSimilarity := flag.Float64("dedup-similarity", 0, "with -dedup, also merge conversations whose character-bigram similarity to an earlier one is at least this (e.g. 0.9) into it, 0 = exact duplicates only")
+	sourceTag := flag.String("source-tag", "", "tag stored as vector metadata \"source\" (rag.filter.source); default: the -input file or directory name without extension")
+	parserPlugins := flag.String("parser-plugin", "", "comma-separated Go plugin (.so) files that register custom parsers via parser.Register")
 	flag.Parse()
 
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
 
-	if *inputFile == "" || *targetName == "" {
-		fmt.Fprintf(os.Stderr, "Usage: data-importer -input <file> -target <name> [-me <name>] [-decrypt-key <key>]\n")
+	if *inputFile == "" || (*targetName == "" && !*targetMultiple) {
+		fmt.Fprintf(os.Stderr, "Usage: data-importer -input <file> {-target <name> | -target-multiple} [-me <name>] [-decrypt-key <key>]\n")
 		os.Exit(1)
 	}
 
+	var fileKeys []string
+	if *apiKeysFile != "" {
+		var err error
+		fileKeys, err = ai.ReadAPIKeysFile(*apiKeysFile)
+		if err != nil {
+			slog.Error("read api keys file failed", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("loaded api keys from file", "count", len(fileKeys))
+	}
+
 	key := *apiKey
 	if key == "" {
 		key = os.Getenv("GEMINI_API_KEY")
 	}
+	// -api-key / GEMINI_API_KEY 也可以是 JSON 数组
+	mainKeys, err := config.ParseAPIKeys(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -api-key: %v\n", err)
+		os.Exit(1)
+	}
+	jsonKeys, err := config.ParseAPIKeys(*apiKeysJSON)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -api-keys-json: %v\n", err)
+		os.Exit(1)
+	}
+	key = ""
+	if keys := config.MergeAPIKeys(mainKeys, jsonKeys, fileKeys); len(keys) > 0 {
+		key, fileKeys = keys[0], keys[1:]
+	}
 	if key == "" {
-		fmt.Fprintf(os.Stderr, "Error: Gemini API key required (-api-key or GEMINI_API_KEY env)\n")
+		fmt.Fprintf(os.Stderr, "Error: Gemini API key required (-api-key, -api-keys-json, -api-keys-file or GEMINI_API_KEY env)\n")
 		os.Exit(1)
 	}
 
@@ -58,85 +129,157 @@ func main() {
 	var conversations []parser.Conversation
 	var messages []parser.ChatMessage
 
-	detectedFormat := *format
-	if detectedFormat == "auto" {
-		ext := strings.ToLower(filepath.Ext(*inputFile))
-		switch {
-		case ext == ".enc":
-			detectedFormat = "enc-jsonl"
-		case ext == ".jsonl":
-			detectedFormat = "jsonl"
-		case ext == ".html" || ext == ".htm":
-			detectedFormat = "html"
-		default:
-			detectedFormat = "text"
-		}
-	}
-
-	switch detectedFormat {
-	case "enc-jsonl":
-		if dk == "" {
-			fmt.Fprintf(os.Stderr, "Error: -decrypt-key required for .enc files\n")
-			os.Exit(1)
+	// 外部解析插件（.so），在 init 中注册到 parser
+	if *parserPlugins != "" {
+		for _, path := range strings.Split(*parserPlugins, ",") {
+			if err := parser.LoadPlugin(strings.TrimSpace(path)); err != nil {
+				slog.Error("load parser plugin failed", "error", err)
+				os.Exit(1)
+			}
 		}
-		plaintext, err := parser.DecryptFile(*inputFile, dk)
-		if err != nil {
-			slog.Error("decrypt failed", "error", err)
-			os.Exit(1)
+		for _, p := range parser.Registered() {
+			slog.Info("parser plugin registered", "name", p.Name())
 		}
-		slog.Info("decrypted successfully", "bytes", len(plaintext))
+	}
+	policy, err := parser.ParseZeroTimePolicy(*zeroTimePolicy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	strategy, err := persona.ParseSampleStrategy(*sampleStrategy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	enc, err := parser.ParseEncoding(*encoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	minConv := parser.MinConversation{Messages: *minConvMessages, Runes: *minConvChars}
+	builtins := []parser.Plugin{
+		parser.JSONLPlugin{UserIsMe: *userIsMe, MinConversation: minConv},
+		parser.DingTalkPlugin{MyStaffID: *myStaffID},
+		parser.HTMLPlugin{Encoding: enc},
+		parser.TextPlugin{Encoding: enc},
+		parser.CSVPlugin{Columns: parser.CSVColumns{Time: *csvTimeCol, Sender: *csvSenderCol, Content: *csvContentCol}, Encoding: enc},
+	}
 
-		conversations, err = parser.ParseJSONLToConversations(plaintext, *myName, *targetName, *userIsMe)
-		if err != nil {
-			slog.Error("parse JSONL failed", "error", err)
-			os.Exit(1)
-		}
+	if *format == "dingtalk" && *myStaffID == "" {
+		fmt.Fprintf(os.Stderr, "-my-staff-id is required for -format dingtalk\n")
+		os.Exit(1)
+	}
 
-		// 同时提取扁平消息列表（用于风格分析）
-		messages, err = parser.ParseJSONLBytes(plaintext, *myName, *targetName, *userIsMe)
-		if err != nil {
-			slog.Error("parse messages failed", "error", err)
-			os.Exit(1)
-		}
+	if *dedupSimilarity < 0 || *dedupSimilarity > 1 {
+		fmt.Fprintf(os.Stderr, "-dedup-similarity must be between 0 and 1\n")
+		os.Exit(1)
+	}
 
-		// 清除内存中的明文
-		for i := range plaintext {
-			plaintext[i] = 0
-		}
+	if *sourceTag == "" {
+		*sourceTag = defaultSourceTag(*inputFile)
+	}
 
-	case "jsonl":
-		data, err := os.ReadFile(*inputFile)
-		if err != nil {
-			slog.Error("read file failed", "error", err)
-			os.Exit(1)
+	// -input 可以是单个文件、目录或 glob，多个文件的消息合并排序去重后再切分对话
+	files, err := inputFiles(*inputFile)
+	if err != nil {
+		slog.Error("list input files failed", "error", err)
+		os.Exit(1)
+	}
+	parsed, err := parseFiles(files, *parseConcurrency, func(path string) (parsedFile, error) {
+		return parseInput(path, *format, dk, builtins, len(files) == 1, *myName, *targetName)
+	})
+	if err != nil {
+		slog.Error("parse failed", "error", err)
+		os.Exit(1)
+	}
+	var fileStats []string
+	var merged [][]parser.ChatMessage
+	for i, pf := range parsed {
+		path := files[i]
+		if pf.format == "" {
+			slog.Warn("unrecognized file, skipping", "file", path)
+			continue
 		}
-		conversations, err = parser.ParseJSONLToConversations(data, *myName, *targetName, *userIsMe)
-		if err != nil {
-			slog.Error("parse JSONL failed", "error", err)
+		slog.Info("parsed file", "file", path, "format", pf.format, "messages", len(pf.messages))
+		fileStats = append(fileStats, fmt.Sprintf("  %s: %s, %d messages", filepath.Base(path), pf.format, len(pf.messages)))
+		if pf.bounded {
+			// 自带对话边界的格式（JSONL）直接用解析出的对话
+			conversations = append(conversations, pf.conversations...)
+			messages = append(messages, pf.messages...)
+			continue
+		}
+		merged = append(merged, pf.messages)
+	}
+	if len(merged) > 0 {
+		timeline := parser.MergeMessages(policy, merged...)
+		conversations = append(conversations, parser.SplitConversations(timeline, 30, minConv)...)
+		messages = append(messages, timeline...)
+	}
+
+	// 外部插件自带的对话边界也按同样的门槛过滤
+	before := len(conversations)
+	conversations = parser.FilterConversations(conversations, minConv)
+	if removed := before - len(conversations); removed > 0 {
+		slog.Info("filtered small conversations", "min_messages", minConv.Messages, "min_chars", minConv.Runes, "removed", removed)
+	}
+
+	if *minDuration > 0 {
+		before := len(conversations)
+		conversations = parser.FilterByMinDuration(conversations, *minDuration)
+		slog.Info("filtered short conversations", "min_duration", *minDuration, "removed", before-len(conversations))
+	}
+
+	// 过短（"k"、"."）和过长（粘贴的文章）的消息不参与风格分析；对话内容不变，向量化时仍完整保留
+	before = len(messages)
+	messages = parser.FilterByLength(messages, *minMsgLen, *maxMsgLen)
+	filteredByLength := before - len(messages)
+	if filteredByLength > 0 {
+		slog.Info("filtered messages by length", "min_chars", *minMsgLen, "max_chars", *maxMsgLen, "messages_filtered_by_length", filteredByLength)
+	}
+
+	slog.Info("parsed", "messages", len(messages), "conversations", len(conversations))
+
+	// 留出一部分对话给 cmd/eval，不参与风格分析和向量化，否则评估时检索会直接命中原话
+	if *holdout > 0 {
+		if err := os.MkdirAll(*outputDir, 0755); err != nil {
+			slog.Error("create output dir failed", "error", err)
 			os.Exit(1)
 		}
-		messages, err = parser.ParseJSONLBytes(data, *myName, *targetName, *userIsMe)
-		if err != nil {
-			slog.Error("parse messages failed", "error", err)
+		var held []parser.Conversation
+		conversations, held = splitHoldout(conversations, *holdout)
+		messages = withoutConversations(messages, held)
+		holdoutPath := filepath.Join(*outputDir, "holdout.jsonl")
+		if err := writeHoldout(holdoutPath, held); err != nil {
+			slog.Error("write holdout failed", "error", err)
 			os.Exit(1)
 		}
+		slog.Info("held out conversations for evaluation", "count", len(held), "path", holdoutPath)
+	}
 
-	case "html", "text":
-		var err error
-		if detectedFormat == "html" {
-			messages, err = parser.ParseHTMLFile(*inputFile, *myName)
-		} else {
-			messages, err = parser.ParseTextFile(*inputFile, *myName)
+	// 切分后的对话单独保存，换 embedding 模型时可以直接从这里重新向量化
+	if *dumpConvs {
+		if err := os.MkdirAll(*outputDir, 0755); err != nil {
+			slog.Error("create output dir failed", "error", err)
+			os.Exit(1)
 		}
-		if err != nil {
-			slog.Error("parse failed", "error", err)
+		convPath := filepath.Join(*outputDir, conversationsFile)
+		if err := dumpConversations(convPath, conversations); err != nil {
+			slog.Error("dump conversations failed", "error", err)
 			os.Exit(1)
 		}
-		messages = parser.FilterTextOnly(messages)
-		conversations = parser.SplitConversations(messages, 30)
+		slog.Info("dumped conversations", "count", len(conversations), "path", convPath)
 	}
 
-	slog.Info("parsed", "messages", len(messages), "conversations", len(conversations))
+	// -me / -target 传反是常见错误，会得到对方的人设；按双方消息数粗略检查
+	meCount, targetCount := countSides(messages)
+	swapWarning := ""
+	if !*targetMultiple {
+		swapWarning = nameSwapWarning(meCount, targetCount, *myName, *targetName)
+	}
+	if swapWarning != "" {
+		slog.Warn("me/target names may be swapped", "me", meCount, "target", targetCount)
+		fmt.Fprintf(os.Stderr, "\n!!! WARNING: %s\n\n", swapWarning)
+	}
 
 	// 2. 初始化 Gemini 客户端
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
@@ -148,57 +291,113 @@ func main() {
 		os.Exit(1)
 	}
 
-	// 3. 风格分析（如果 persona.json 已存在则跳过）
-	personaPath := filepath.Join(*outputDir, "persona.json")
 	if err := os.MkdirAll(*outputDir, 0755); err != nil {
 		slog.Error("create output dir failed", "error", err)
 		os.Exit(1)
 	}
-	if _, err := os.Stat(personaPath); err == nil {
-		slog.Info("persona.json already exists, skipping style analysis")
-	} else {
-		slog.Info("analyzing speaking style...")
-		p, err := analyzeStyle(ctx, client, messages, conversations, *myName, *targetName)
-		if err != nil {
-			slog.Error("style analysis failed", "error", err)
-			os.Exit(1)
-		}
-		personaData, _ := json.MarshalIndent(p, "", "  ")
-		if err := os.WriteFile(personaPath, personaData, 0644); err != nil {
-			slog.Error("write persona.json failed", "error", err)
-			os.Exit(1)
-		}
-		slog.Info("saved persona", "path", personaPath)
+	opts := analysisOptions{
+		myName:         *myName,
+		targetName:     *targetName,
+		thinkingBudget: int32(*thinkingBudget),
+		stopSequences:  splitList(*analysisStop),
+		strategy:       strategy,
 	}
+	var sentiment *sentimentAnnotator
+	if *annotateSentiment {
+		sentiment = &sentimentAnnotator{client: client, model: *sentimentModel}
+	}
+	embedRetry := ai.RetryPolicy{MaxAttempts: *embedAttempts, BaseDelay: *embedBaseDelay, MaxDelay: *embedMaxDelay, Jitter: *embedJitter}
 
-	// 4. 构建 embedding 客户端池（多 key 轮换）
-	var embedClients []*genai.Client
-	embedClients = append(embedClients, client)
-
+	// embedding 和 bot 走同一个客户端，模型、维度、文档/查询任务类型都与线上检索一致
 	key2 := *apiKey2
 	if key2 == "" {
 		key2 = os.Getenv("GEMINI_API_KEY2")
 	}
+	embedKeys := append([]string{key}, fileKeys...)
 	if key2 != "" {
-		c2, err := genai.NewClient(ctx, &genai.ClientConfig{
-			APIKey:  key2,
-			Backend: genai.BackendGeminiAPI,
-		})
-		if err == nil {
-			embedClients = append(embedClients, c2)
+		embedKeys = append(embedKeys, key2)
+	}
+	embedClient, err := ai.NewClient(ctx, ai.ClientOptions{
+		APIKeys:    embedKeys,
+		EmbedModel: *embeddingModel,
+		OllamaURL:  *ollamaURL,
+		EmbedDim:   int32(*embeddingDim),
+		EmbedRetry: embedRetry,
+	})
+	if err != nil {
+		slog.Error("create embedding client failed", "error", err)
+		os.Exit(1)
+	}
+	embedFunc := rag.NormalizedEmbedding(embedClient.EmbedFunc(), *stripEmoji)
+	embedModel := embedClient.EmbeddingModel()
+
+	// 群聊：每个发言够多的人单独一套 persona 和向量库，写到 <output>/<发送人>/
+	if *targetMultiple {
+		targets, skipped := targetSenders(messages, *minPerTarget)
+		if len(targets) == 0 {
+			slog.Error("no sender has enough messages", "min_messages_per_target", *minPerTarget, "skipped", skipped)
+			os.Exit(1)
+		}
+		slog.Info("importing multiple targets", "targets", len(targets), "skipped", skipped, "min_messages_per_target", *minPerTarget)
+		var lines []string
+		for _, target := range targets {
+			dir := filepath.Join(*outputDir, targetDirName(target))
+			convs := conversationsWith(conversations, target, minConv)
+			msgs := parser.FilterByLength(flattenConversations(convs), *minMsgLen, *maxMsgLen)
+			opts.targetName = target
+			opts.personaTarget = target
+			personaPath := filepath.Join(dir, "persona.json")
+			p, err := buildPersona(ctx, client, personaPath, msgs, convs, *timeWindows, *analysisConcurrency, opts)
+			if err != nil {
+				slog.Error("style analysis failed", "target", target, "error", err)
+				os.Exit(1)
+			}
+			quality, warning := personaQuality(p)
+			if warning != "" {
+				slog.Warn("low persona quality", "target", target, "score", p.Score())
+			}
+			dedupped := dedupForVectors(convs, *dedup, *dedupSimilarity)
+			if _, err := vectorize(ctx, convs, dedupped, filepath.Join(dir, "vectors"), *myName, target, *sourceTag, embedFunc, embedModel, *minDocLen, *maxChunkLen, *chunkOverlap, *retryFailed, sentiment); err != nil {
+				slog.Error("vectorize failed", "target", target, "error", err)
+				os.Exit(1)
+			}
+			lines = append(lines, fmt.Sprintf("  %s: %d conversations (%d deduplicated), %d messages, persona quality %s -> %s", target, len(convs), dedupped.total(), len(msgs), quality, dir))
 		}
+		report := fmt.Sprintf(`Import Report (multiple targets)
+================================
+Targets:       %d (%d senders below %d messages skipped)
+%s
+Files:
+%s
+
+Rename each directory to the person's QQ number (e.g. %s) so the bot loads its persona and vectors for that peer.
+`, len(targets), skipped, *minPerTarget, strings.Join(lines, "\n"), strings.Join(fileStats, "\n"), filepath.Join(*outputDir, "<qq>", "persona.json"))
+		if err := os.WriteFile(filepath.Join(*outputDir, "import_report.txt"), []byte(report), 0644); err != nil {
+			slog.Warn("write import report failed", "error", err)
+		}
+		fmt.Println(report)
+		slog.Info("done!")
+		return
 	}
 
-	slog.Info("embedding clients ready", "count", len(embedClients))
+	// 3. 风格分析（如果 persona.json 已存在则跳过）
+	personaPath := filepath.Join(*outputDir, "persona.json")
+	p, err := buildPersona(ctx, client, personaPath, messages, conversations, *timeWindows, *analysisConcurrency, opts)
+	if err != nil {
+		slog.Error("style analysis failed", "error", err)
+		os.Exit(1)
+	}
+	quality, qualityWarning := personaQuality(p)
+	if qualityWarning != "" {
+		slog.Warn("low persona quality", "score", p.Score())
+	}
 
-	// 5. 向量化对话片段
+	// 4. 向量化对话片段
 	slog.Info("vectorizing conversations...")
 	vectorsDir := filepath.Join(*outputDir, "vectors")
-	ollamaURL := os.Getenv("OLLAMA_URL")
-	if ollamaURL == "" {
-		ollamaURL = "http://127.0.0.1:11434/api"
-	}
-	if err := vectorize(ctx, conversations, vectorsDir, *myName, *targetName, ollamaURL); err != nil {
+	dedupped := dedupForVectors(conversations, *dedup, *dedupSimilarity)
+	sentimentCounts, err := vectorize(ctx, conversations, dedupped, vectorsDir, *myName, *targetName, *sourceTag, embedFunc, embedModel, *minDocLen, *maxChunkLen, *chunkOverlap, *retryFailed, sentiment)
+	if err != nil {
 		slog.Error("vectorize failed", "error", err)
 		os.Exit(1)
 	}
@@ -208,179 +407,505 @@ func main() {
 =============
 Conversations: %d
 Messages:      %d
+Me messages:   %d (%s)
+Target msgs:   %d (%s)
+Length filter: %d messages (messages_filtered_by_length, -min-msg-len %d, -max-msg-len %d)
+Deduplicated:  %d conversations (%d exact, %d near-duplicate, -dedup-similarity %g)
 Vectors dir:   %s
 Persona file:  %s
-`, len(conversations), len(messages), vectorsDir, personaPath)
+Persona quality: %s
+Files:
+%s
+`, len(conversations), len(messages), meCount, *myName, targetCount, *targetName, filteredByLength, *minMsgLen, *maxMsgLen, dedupped.total(), dedupped.exact, dedupped.near, *dedupSimilarity, vectorsDir, personaPath, quality, strings.Join(fileStats, "\n"))
+	if sentimentCounts != nil {
+		report += "Sentiment:     " + formatSentimentCounts(sentimentCounts) + "\n"
+	}
+	if swapWarning != "" {
+		report += "\nWARNING: " + swapWarning + "\n"
+	}
+	if qualityWarning != "" {
+		report += "\nWARNING: " + qualityWarning + "\n"
+	}
 
 	reportPath := filepath.Join(*outputDir, "import_report.txt")
-	os.WriteFile(reportPath, []byte(report), 0644)
+	if err := os.WriteFile(reportPath, []byte(report), 0644); err != nil {
+		slog.Warn("write import report failed", "file", reportPath, "error", err)
+	}
 	fmt.Println(report)
 	slog.Info("done!")
 }
 
-func analyzeStyle(ctx context.Context, client *genai.Client, messages []parser.ChatMessage, conversations []parser.Conversation, myName, targetName string) (*persona.Persona, error) {
-	var myMessages []string
-	for _, m := range messages {
-		if m.IsMe {
-			myMessages = append(myMessages, m.Content)
-		}
-	}
+// analysisOptions 风格分析的参数
+type analysisOptions struct {
+	myName, targetName string
+	thinkingBudget     int32
+	stopSequences      []string
+	strategy           persona.SampleStrategy
+	personaTarget      string // 写进 persona.json 的 target_name：-target-multiple 时为发送人，bot 用它称呼对方
+}
 
-	// 采样（最多500条）
-	sample := myMessages
-	if len(sample) > 500 {
-		step := len(sample) / 500
-		var sampled []string
-		for i := 0; i < len(sample); i += step {
-			sampled = append(sampled, sample[i])
-		}
-		sample = sampled
+// buildPersona 风格分析并写入 personaPath；文件已存在时跳过分析、读取已有的。windows > 1 时按时间窗口并发分析后合并
+func buildPersona(ctx context.Context, client *genai.Client, personaPath string, messages []parser.ChatMessage, conversations []parser.Conversation, windows, concurrency int, opts analysisOptions) (*persona.Persona, error) {
+	if _, err := os.Stat(personaPath); err == nil {
+		slog.Info("persona.json already exists, skipping style analysis", "path", personaPath)
+		return persona.LoadFromFile(personaPath)
 	}
-
-	var convSamples []string
-	for i, c := range conversations {
-		if i >= 50 {
-			break
-		}
-		convSamples = append(convSamples, c.FormatAsExample(myName, targetName))
+	dir := filepath.Dir(personaPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create output dir: %w", err)
+	}
+	slog.Info("analyzing speaking style...", "target", opts.targetName, "windows", windows)
+	var p *persona.Persona
+	var err error
+	if windows > 1 {
+		p, err = analyzeWindows(ctx, client, messages, conversations, windows, concurrency, dir, opts)
+	} else {
+		p, err = analyzeStyle(ctx, client, messages, conversations, opts)
 	}
+	if err != nil {
+		return nil, err
+	}
+	p.TargetName = opts.personaTarget
+	if err := persona.SaveToFile(personaPath, p); err != nil {
+		return nil, fmt.Errorf("write persona.json: %w", err)
+	}
+	slog.Info("saved persona", "path", personaPath)
+	return p, nil
+}
 
-	prompt := fmt.Sprintf(`分析以下聊天记录中"%s"的说话风格。这是%s和%s之间的微信聊天记录。
+// lowPersonaScore 人设完整度低于该值时在报告里提醒
+const lowPersonaScore = 0.5
 
-## %s的消息样本（共%d条，采样%d条）：
-%s
+// personaQuality 导入报告里的一行，如 "0.82/1.0"；完整度过低时 warning 非空
+func personaQuality(p *persona.Persona) (quality, warning string) {
+	score := p.Score()
+	quality = fmt.Sprintf("%.2f/1.0", score)
+	if score < lowPersonaScore {
+		warning = fmt.Sprintf("persona quality %s is below %.1f: many style fields are empty; check -me/-target or import more history", quality, lowPersonaScore)
+	}
+	return quality, warning
+}
 
-## 对话示例（%d段）：
-%s
+func analyzeStyle(ctx context.Context, client *genai.Client, messages []parser.ChatMessage, conversations []parser.Conversation, opts analysisOptions) (*persona.Persona, error) {
+	prompt := persona.BuildAnalysisPrompt(messages, conversations, opts.myName, opts.targetName, opts.strategy)
 
-请输出严格的 JSON 格式（不要 markdown 代码块），包含以下字段：
-{
-  "style": {
-    "typical_length": "描述消息长度特征",
-    "catchphrases": ["口头禅1", "口头禅2"],
-    "emoji_patterns": ["常用表情1", "常用表情2"],
-    "punctuation_style": "标点使用特征",
-    "response_style": "回复风格描述",
-    "humor_style": "幽默风格描述",
-    "formality": "正式程度",
-    "multi_message": true/false,
-    "negative_patterns": ["不会做的事1", "不会做的事2"],
-    "greeting_examples": ["打招呼示例"],
-    "agreement_examples": ["同意示例"],
-    "refusal_examples": ["拒绝示例"]
-  },
-  "relationship": {
-    "relationship": "关系描述",
-    "shared_topics": ["共同话题1", "共同话题2"],
-    "inside_jokes": ["内部梗/共同经历"],
-    "tone": "对话语气特征",
-    "key_facts": {"事实类别": "事实内容"}
-  }
-}`,
-		myName, myName, targetName,
-		myName, len(myMessages), len(sample),
-		strings.Join(sample, "\n"),
-		len(convSamples),
-		strings.Join(convSamples, "\n---\n"),
-	)
+	genCfg := &genai.GenerateContentConfig{
+		Temperature:     genai.Ptr(float32(0.3)),
+		MaxOutputTokens: 8192,
+		StopSequences:   opts.stopSequences,
+	}
+	if opts.thinkingBudget > 0 {
+		genCfg.ThinkingConfig = &genai.ThinkingConfig{ThinkingBudget: genai.Ptr(opts.thinkingBudget)}
+	}
 
-	resp, err := client.Models.GenerateContent(ctx, "gemini-2.5-flash",
+	resp, err := client.Models.GenerateContent(ctx, ai.AnalysisModel,
 		[]*genai.Content{genai.NewContentFromText(prompt, genai.RoleUser)},
-		&genai.GenerateContentConfig{
-			Temperature:     genai.Ptr(float32(0.3)),
-			MaxOutputTokens: 8192,
-		},
+		genCfg,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("gemini analyze: %w", err)
 	}
 
-	text := resp.Text()
-	text = strings.TrimPrefix(text, "```json")
-	text = strings.TrimPrefix(text, "```")
-	text = strings.TrimSuffix(text, "```")
-	text = strings.TrimSpace(text)
+	var usage ai.UsageStats
+	usage.Add(resp.UsageMetadata)
+	slog.Info("style analysis token usage",
+		"prompt", usage.PromptTokens,
+		"output", usage.OutputTokens,
+		"thoughts", usage.ThoughtsTokens,
+		"total", usage.TotalTokens,
+	)
 
-	var p persona.Persona
-	if err := json.Unmarshal([]byte(text), &p); err != nil {
+	p, err := persona.ParseAnalysis(resp.Text())
+	if err != nil {
 		slog.Warn("failed to parse Gemini response as JSON, saving raw", "error", err)
 		return &persona.Persona{}, nil
 	}
 
-	return &p, nil
+	return p, nil
 }
 
-func vectorize(ctx context.Context, conversations []parser.Conversation, vectorsDir string, myName, targetName string, ollamaURL string) error {
-	if err := os.MkdirAll(vectorsDir, 0755); err != nil {
-		return fmt.Errorf("create vectors dir: %w", err)
+// defaultOllamaURL -ollama-url 的默认值：环境变量 OLLAMA_URL，没有时用本机 Ollama
+func defaultOllamaURL() string {
+	if u := os.Getenv("OLLAMA_URL"); u != "" {
+		return u
 	}
+	return "http://127.0.0.1:11434/api"
+}
 
-	// 使用 Ollama 本地 embedding
-	embedFunc := chromem.NewEmbeddingFuncOllama("nomic-embed-text", ollamaURL)
-	slog.Info("using Ollama for embedding", "url", ollamaURL)
+// vectorize 向量化对话并写入向量库。整批写入失败时逐条重试，仍失败的记进 vectors/.failed_ids.jsonl；
+// 进度文件只在一批全部写入成功后前进。retryFailed 时只重新写入 .failed_ids.jsonl 里的文档。
+// sentiment 非 nil 时先给要写入的对话标注情绪（metadata["sentiment"]），返回各标签的对话数；
+// dedup 里跳过的重复对话不写入（之前写入过的删掉），保留的对话把合并的原对话数写进 metadata["count"]
+func vectorize(ctx context.Context, conversations []parser.Conversation, dedup dedupResult, vectorsDir string, myName, targetName, sourceTag string, embedFunc chromem.EmbeddingFunc, embedModel string, minDocLen, maxChunkLen, chunkOverlap int, retryFailed bool, sentiment *sentimentAnnotator) (map[string]int, error) {
+	if err := os.MkdirAll(vectorsDir, 0755); err != nil {
+		return nil, fmt.Errorf("create vectors dir: %w", err)
+	}
 
-	db, err := chromem.NewPersistentDB(vectorsDir, false)
+	store, err := rag.NewStore(vectorsDir, embedFunc, embedModel)
 	if err != nil {
-		return fmt.Errorf("create vector db: %w", err)
+		return nil, err
 	}
 
-	col, err := db.GetOrCreateCollection("conversations", nil, embedFunc)
-	if err != nil {
-		return fmt.Errorf("create collection: %w", err)
+	progressFile := filepath.Join(vectorsDir, ".progress")
+	failedFile := filepath.Join(vectorsDir, failedIDsFile)
+	if retryFailed {
+		return retryFailedDocuments(ctx, store, conversations, dedup, failedFile, progressFile, myName, targetName, sourceTag, minDocLen, maxChunkLen, chunkOverlap, sentiment)
 	}
 
 	// 断点续传：读取进度文件，跳过已完成的
-	progressFile := filepath.Join(vectorsDir, ".progress")
 	startFrom := 0
 	if data, err := os.ReadFile(progressFile); err == nil {
-		fmt.Sscanf(string(data), "%d", &startFrom)
-		slog.Info("resuming from checkpoint", "start", startFrom)
+		if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err != nil {
+			slog.Warn("unreadable progress file, starting from the beginning", "file", progressFile, "error", err)
+		} else {
+			startFrom = n
+			slog.Info("resuming from checkpoint", "start", startFrom)
+		}
+	} else if !os.IsNotExist(err) {
+		slog.Warn("read progress file failed, starting from the beginning", "file", progressFile, "error", err)
+	}
+
+	if n := removeDuplicateDocuments(ctx, store, conversations, dedup, myName, targetName, sourceTag, maxChunkLen, chunkOverlap); n > 0 {
+		slog.Info("removed documents of duplicate conversations written by an earlier run", "removed", n)
+	}
+
+	var sentiments map[int]string
+	if sentiment != nil {
+		var indices []int
+		for i := startFrom; i < len(conversations); i++ {
+			if !dedup.dropped[i] {
+				indices = append(indices, i)
+			}
+		}
+		sentiments = sentiment.annotate(ctx, conversations, indices, myName, targetName)
 	}
 
-	var docs []chromem.Document
+	var docs []rag.Document
+	failedTotal := 0
+	// 有文档失败后进度不再前进，下次续传从失败的那批开始
+	flush := func(next int) error {
+		failed := addDocuments(ctx, store, docs, minDocLen)
+		docs = docs[:0]
+		if len(failed) > 0 {
+			failedTotal += len(failed)
+			return appendFailed(failedFile, failed)
+		}
+		if failedTotal == 0 {
+			return writeProgress(progressFile, next)
+		}
+		return nil
+	}
 	for i, conv := range conversations {
 		if i < startFrom {
 			continue
 		}
-
-		text := conv.FormatAsExample(myName, targetName)
-		if len(text) < 10 {
+		if dedup.dropped[i] {
 			continue
 		}
-		if len(text) > 2000 {
-			text = text[:2000]
-		}
-
-		docs = append(docs, chromem.Document{
-			ID:      fmt.Sprintf("conv_%05d", i),
-			Content: text,
-			Metadata: map[string]string{
-				"msg_count": fmt.Sprintf("%d", len(conv.Messages)),
-			},
-		})
+		docs = append(docs, conversationDocuments(i, conv, myName, targetName, sourceTag, maxChunkLen, chunkOverlap, sentiments[i], dedup.counts[i])...)
 
 		if len(docs) >= 20 {
 			slog.Info("vectorizing", "progress", fmt.Sprintf("%d/%d", i+1, len(conversations)))
-			if err := col.AddDocuments(ctx, docs, 1); err != nil {
-				return fmt.Errorf("add documents batch at %d: %w", i, err)
+			if err := flush(i + 1); err != nil {
+				return nil, err
 			}
-			docs = docs[:0]
-			// 保存进度
-			os.WriteFile(progressFile, []byte(fmt.Sprintf("%d", i+1)), 0644)
 			time.Sleep(500 * time.Millisecond)
 		}
 	}
 
 	if len(docs) > 0 {
 		slog.Info("vectorizing final batch", "count", len(docs))
-		if err := col.AddDocuments(ctx, docs, 1); err != nil {
-			return fmt.Errorf("add final documents: %w", err)
+		if err := flush(len(conversations)); err != nil {
+			return nil, err
 		}
 	}
 
+	if failedTotal > 0 {
+		slog.Warn("some documents failed, rerun with -retry-failed", "failed", failedTotal, "file", failedFile, "total_vectors", store.Count())
+		return countSentiments(sentiments), nil
+	}
 	// 完成后删除进度文件
-	os.Remove(progressFile)
+	removeProgress(progressFile)
 
-	slog.Info("vectorization complete", "total_vectors", col.Count())
+	slog.Info("vectorization complete", "total_vectors", store.Count())
+	return countSentiments(sentiments), nil
+}
+
+// writeProgress 记录下次续传的起点：先写临时文件再重命名，中途崩溃不会留下写了一半的进度
+func writeProgress(path string, next int) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(next)), 0644); err != nil {
+		return fmt.Errorf("write progress file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename progress file: %w", err)
+	}
 	return nil
 }
+
+// removeProgress 全部写完后删除进度文件；删不掉时下次导入会从旧进度续传、跳过对话，需要手动删除
+func removeProgress(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		slog.Warn("remove progress file failed, delete it by hand before the next import", "file", path, "error", err)
+	}
+}
+
+// conversationDocuments 一段对话的向量文档：长对话切成重叠的多段，每段一个文档：conv_00001_chunk_00、conv_00001_chunk_01……（没切分的也是 _chunk_00）
+// sentiment 非空时写进 metadata["sentiment"]，对话有时间时开始、结束时间写进 metadata["start_at"]、["end_at"]，来源写进 metadata["source"]，
+// dupCount > 1 时写进 metadata["count"]
+func conversationDocuments(i int, conv parser.Conversation, myName, targetName, sourceTag string, maxChunkLen, chunkOverlap int, sentiment string, dupCount int) []rag.Document {
+	chunks := chunkConversation(conv.FormatAsExample(myName, targetName), maxChunkLen, chunkOverlap)
+	docs := make([]rag.Document, 0, len(chunks))
+	for ci, text := range chunks {
+		id := fmt.Sprintf("conv_%05d_chunk_%02d", i, ci)
+		meta := map[string]string{
+			rag.MetaMsgCount: fmt.Sprintf("%d", len(conv.Messages)),
+		}
+		if sourceTag != "" {
+			meta[rag.MetaSource] = sourceTag
+		}
+		if !conv.StartAt.IsZero() {
+			meta[rag.MetaStartAt] = conv.StartAt.Format(time.RFC3339)
+		}
+		if sentiment != "" {
+			meta[rag.MetaSentiment] = sentiment
+		}
+		if dupCount > 1 {
+			meta[metaDupCount] = strconv.Itoa(dupCount)
+		}
+		if !conv.EndAt.IsZero() {
+			meta[rag.MetaEndAt] = conv.EndAt.Format(time.RFC3339)
+		}
+		docs = append(docs, rag.Document{ID: id, Content: text, Metadata: meta})
+	}
+	return docs
+}
+
+// retryFailedDocuments 只重新写入 failedFile 里的文档，仍失败的写回 failedFile；全部成功后删除它和进度文件
+func retryFailedDocuments(ctx context.Context, store rag.VectorStore, conversations []parser.Conversation, dedup dedupResult, failedFile, progressFile, myName, targetName, sourceTag string, minDocLen, maxChunkLen, chunkOverlap int, sentiment *sentimentAnnotator) (map[string]int, error) {
+	ids, err := readFailedIDs(failedFile)
+	if err != nil {
+		return nil, err
+	}
+	// 先找出失败文档所在的对话，只给这些对话标注情绪
+	var indices []int
+	for i, conv := range conversations {
+		if dedup.dropped[i] {
+			continue
+		}
+		for _, d := range conversationDocuments(i, conv, myName, targetName, sourceTag, maxChunkLen, chunkOverlap, "", dedup.counts[i]) {
+			if ids[d.ID] {
+				indices = append(indices, i)
+				break
+			}
+		}
+	}
+	var sentiments map[int]string
+	if sentiment != nil {
+		sentiments = sentiment.annotate(ctx, conversations, indices, myName, targetName)
+	}
+	var docs []rag.Document
+	for _, i := range indices {
+		for _, d := range conversationDocuments(i, conversations[i], myName, targetName, sourceTag, maxChunkLen, chunkOverlap, sentiments[i], dedup.counts[i]) {
+			if ids[d.ID] {
+				docs = append(docs, d)
+				delete(ids, d.ID)
+			}
+		}
+	}
+	if len(ids) > 0 {
+		slog.Warn("failed documents not found in this input, dropping them", "count", len(ids))
+	}
+	slog.Info("retrying failed documents", "count", len(docs))
+
+	var failed []failedDoc
+	for _, d := range docs {
+		if err := rag.AddDocuments(ctx, store, []rag.Document{d}, minDocLen); err != nil {
+			slog.Warn("document failed", "id", d.ID, "error", err)
+			failed = append(failed, failedDoc{ID: d.ID, Error: err.Error()})
+		}
+	}
+	if err := os.Remove(failedFile); err != nil {
+		return nil, fmt.Errorf("remove failed ids file: %w", err)
+	}
+	counts := countSentiments(sentiments)
+	if len(failed) > 0 {
+		slog.Warn("some documents still failed", "failed", len(failed), "file", failedFile)
+		return counts, appendFailed(failedFile, failed)
+	}
+	removeProgress(progressFile)
+	slog.Info("all failed documents stored", "count", len(docs), "total_vectors", store.Count())
+	return counts, nil
+}
+
+// defaultSourceTag -input 的文件名或目录名（去掉扩展名）；glob 用所在目录名
+func defaultSourceTag(input string) string {
+	if strings.ContainsAny(input, "*?[") {
+		input = filepath.Dir(input)
+	}
+	base := filepath.Base(filepath.Clean(input))
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// inputFiles 展开 -input：目录取其中的非隐藏文件，含通配符时按 glob 匹配，否则就是单个文件
+func inputFiles(input string) ([]string, error) {
+	if strings.ContainsAny(input, "*?[") {
+		files, err := filepath.Glob(input)
+		if err != nil {
+			return nil, fmt.Errorf("glob %s: %w", input, err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no files match %s", input)
+		}
+		return files, nil
+	}
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, fmt.Errorf("stat input: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{input}, nil
+	}
+	entries, err := os.ReadDir(input)
+	if err != nil {
+		return nil, fmt.Errorf("read input dir: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		files = append(files, filepath.Join(input, e.Name()))
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files in %s", input)
+	}
+	return files, nil
+}
+
+// parsedFile 单个输入文件的解析结果
+type parsedFile struct {
+	format        string // 为空表示认不出格式，已跳过
+	messages      []parser.ChatMessage
+	conversations []parser.Conversation
+	bounded       bool // 格式自带对话边界（JSONL），不再按时间切分
+}
+
+// extFormats 内容认不出来时按扩展名选择内置格式
+var extFormats = map[string]string{
+	".jsonl": "jsonl",
+	".html":  "html",
+	".htm":   "html",
+	".txt":   "text",
+	".csv":   "csv",
+}
+
+// parseInput 解析一个文件：.enc 先解密；auto 时先问外部插件再试内置格式，最后按扩展名猜。
+// single 为 true（只有一个输入文件）时认不出的文件按 text 解析，否则跳过
+func parseInput(path, format, decryptKey string, builtins []parser.Plugin, single bool, myName, targetName string) (parsedFile, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	var data []byte
+	if format == "enc-jsonl" || (format == "auto" && ext == ".enc") {
+		if decryptKey == "" {
+			return parsedFile{}, fmt.Errorf("-decrypt-key required for .enc files")
+		}
+		plaintext, err := parser.DecryptFile(path, decryptKey)
+		if err != nil {
+			return parsedFile{}, fmt.Errorf("decrypt: %w", err)
+		}
+		slog.Info("decrypted successfully", "file", path, "bytes", len(plaintext))
+		data, format = plaintext, "jsonl"
+	} else {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return parsedFile{}, fmt.Errorf("read file: %w", err)
+		}
+	}
+	// 清除内存中的明文（.enc 解密后的内容）
+	defer clear(data)
+
+	var p parser.Plugin
+	if format == "auto" {
+		p = parser.Detect(data, parser.Registered()...)
+		if p == nil {
+			p = parser.Detect(data, builtins...)
+		}
+		if p == nil {
+			name, ok := extFormats[ext]
+			if !ok && !single {
+				return parsedFile{}, nil
+			}
+			if !ok {
+				name = "text"
+			}
+			p = parser.Lookup(name, builtins...)
+		}
+	} else {
+		p = parser.Lookup(format, parser.Registered()...)
+		if p == nil {
+			p = parser.Lookup(format, builtins...)
+		}
+		if p == nil {
+			return parsedFile{}, fmt.Errorf("unknown format %q", format)
+		}
+	}
+
+	pf := parsedFile{format: p.Name()}
+	var err error
+	if pf.messages, err = p.Parse(data, myName, targetName); err != nil {
+		return parsedFile{}, fmt.Errorf("parse %s: %w", p.Name(), err)
+	}
+	if cp, ok := p.(parser.ConversationParser); ok {
+		pf.bounded = true
+		if pf.conversations, err = cp.ParseConversations(data, myName, targetName); err != nil {
+			return parsedFile{}, fmt.Errorf("parse %s conversations: %w", p.Name(), err)
+		}
+	}
+	return pf, nil
+}
+
+// splitList 拆分逗号分隔的参数，去掉空项
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// countSides 统计我和对方各发了多少条
+func countSides(messages []parser.ChatMessage) (me, target int) {
+	for _, m := range messages {
+		if m.IsMe {
+			me++
+		} else {
+			target++
+		}
+	}
+	return me, target
+}
+
+// 名字传反的判断：消息够多且一方不到另一方的 1/swapRatio
+const (
+	swapMinMessages = 50
+	swapRatio       = 4
+)
+
+// nameSwapWarning 双方消息数差得离谱时返回提示（一方为 0 通常是名字没对上），否则返回空
+func nameSwapWarning(me, target int, myName, targetName string) string {
+	switch {
+	case me == 0 && target > 0:
+		return fmt.Sprintf("no messages attributed to -me %q (%d to the other side); check -me/-target (or -user-is-me, -my-staff-id)", myName, target)
+	case target == 0 && me > 0:
+		return fmt.Sprintf("all %d messages attributed to -me %q; check -me/-target (or -user-is-me, -my-staff-id)", me, myName)
+	case me+target < swapMinMessages:
+		return ""
+	case me*swapRatio < target || target*swapRatio < me:
+		return fmt.Sprintf("-me %q has %d messages but -target %q has %d; the names may be swapped, and the persona would describe the wrong person",
+			myName, me, targetName, target)
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/liao/style-bot/internal/parser"
+	"github.com/liao/style-bot/internal/rag"
+)
+
+func TestConversationDocumentIDsAlwaysHaveChunkSuffix(t *testing.T) {
+	short := parser.Conversation{Messages: []parser.ChatMessage{
+		{Sender: "小王", Content: "在吗"},
+		{Sender: "我", Content: "在", IsMe: true},
+	}}
+	docs := conversationDocuments(1, short, "我", "小王", "", 2000, 200, "", 1)
+	if len(docs) != 1 || docs[0].ID != "conv_00001_chunk_00" {
+		t.Fatalf("short conversation ids = %v, want conv_00001_chunk_00", docIDs(docs))
+	}
+
+	var long parser.Conversation
+	for range 20 {
+		long.Messages = append(long.Messages, parser.ChatMessage{Sender: "小王", Content: strings.Repeat("爬山", 10)})
+	}
+	docs = conversationDocuments(2, long, "我", "小王", "", 100, 20, "", 1)
+	if len(docs) < 2 {
+		t.Fatalf("long conversation split into %d documents", len(docs))
+	}
+	for i, d := range docs {
+		if want := fmt.Sprintf("conv_00002_chunk_%02d", i); d.ID != want {
+			t.Errorf("document %d id = %q, want %q", i, d.ID, want)
+		}
+	}
+}
+
+func docIDs(docs []rag.Document) []string {
+	ids := make([]string, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	return ids
+}
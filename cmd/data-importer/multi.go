@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/liao/style-bot/internal/parser"
+)
+
+// targetSenders -target-multiple 时要分别建人设的对象：消息数不少于 minMessages 的非我发送人，按消息数从多到少
+func targetSenders(messages []parser.ChatMessage, minMessages int) (targets []string, skipped int) {
+	counts := make(map[string]int)
+	for _, m := range messages {
+		if !m.IsMe && m.Sender != "" {
+			counts[m.Sender]++
+		}
+	}
+	for s, n := range counts {
+		if n < minMessages {
+			skipped++
+			continue
+		}
+		targets = append(targets, s)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if counts[targets[i]] != counts[targets[j]] {
+			return counts[targets[i]] > counts[targets[j]]
+		}
+		return targets[i] < targets[j]
+	})
+	return targets, skipped
+}
+
+// conversationsWith 对方说过话的对话，只保留我和对方的消息（群聊里其他人的发言去掉），过滤后不满足 min 的丢弃
+func conversationsWith(conversations []parser.Conversation, sender string, min parser.MinConversation) []parser.Conversation {
+	var out []parser.Conversation
+	for _, c := range conversations {
+		var msgs []parser.ChatMessage
+		found := false
+		for _, m := range c.Messages {
+			switch {
+			case m.IsMe:
+				msgs = append(msgs, m)
+			case m.Sender == sender:
+				msgs = append(msgs, m)
+				found = true
+			}
+		}
+		if !found {
+			continue
+		}
+		out = append(out, parser.Conversation{Messages: msgs, StartAt: msgs[0].Timestamp, EndAt: msgs[len(msgs)-1].Timestamp})
+	}
+	return parser.FilterConversations(out, min)
+}
+
+// flattenConversations 对话里的全部消息，按对话顺序
+func flattenConversations(conversations []parser.Conversation) []parser.ChatMessage {
+	var out []parser.ChatMessage
+	for _, c := range conversations {
+		out = append(out, c.Messages...)
+	}
+	return out
+}
+
+// targetDirName 发送人名字作为子目录名：去掉路径分隔符等文件名里不能用的字符
+func targetDirName(sender string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(sender))
+	if name == "" || name == "." || name == ".." {
+		return fmt.Sprintf("target_%x", sender)
+	}
+	return name
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// parseFiles 并发解析多个文件（最多 concurrency 个同时进行），结果与 files 顺序一一对应，
+// 所以合并排序时同一时间的消息总是先按文件、再按文件内的顺序排列，与哪个文件先解析完无关；
+// 有文件失败时返回排在最前的那个错误
+func parseFiles(files []string, concurrency int, parse func(path string) (parsedFile, error)) ([]parsedFile, error) {
+	results := make([]parsedFile, len(files))
+	errs := make([]error, len(files))
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, path := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = parse(path)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", files[i], err)
+		}
+	}
+	return results, nil
+}
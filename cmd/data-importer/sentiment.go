@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/genai"
+
+	"github.com/liao/style-bot/internal/ai"
+	"github.com/liao/style-bot/internal/parser"
+)
+
+// 情绪标注：每次请求标注 sentimentBatchSize 段对话，每段最多取前 sentimentMaxRunes 个字
+const (
+	sentimentBatchSize = 10
+	sentimentMaxRunes  = 1500
+)
+
+// sentimentAnnotator 用 model（-sentiment-model，即 gemini.sentiment_model）标注对话情绪
+type sentimentAnnotator struct {
+	client *genai.Client
+	model  string
+}
+
+// annotate 给 indices 里的对话标注情绪，返回对话下标 → 标签；某批请求或解析失败时这批不标注
+func (a *sentimentAnnotator) annotate(ctx context.Context, conversations []parser.Conversation, indices []int, myName, targetName string) map[int]string {
+	labels := make(map[int]string, len(indices))
+	for start := 0; start < len(indices); start += sentimentBatchSize {
+		batch := indices[start:min(start+sentimentBatchSize, len(indices))]
+		texts := make([]string, len(batch))
+		for i, ci := range batch {
+			texts[i] = parser.TruncateRunes(conversations[ci].FormatAsExample(myName, targetName), sentimentMaxRunes)
+		}
+
+		resp, err := a.client.Models.GenerateContent(ctx, a.model,
+			[]*genai.Content{genai.NewContentFromText(ai.SentimentBatchPrompt(texts), genai.RoleUser)},
+			&genai.GenerateContentConfig{Temperature: genai.Ptr(float32(0))},
+		)
+		if err != nil {
+			slog.Warn("sentiment annotation failed, batch left unlabeled", "batch_start", batch[0], "error", err)
+			continue
+		}
+		got, err := ai.ParseSentimentBatch(resp.Text(), len(batch))
+		if err != nil {
+			slog.Warn("sentiment annotation unparsable, batch left unlabeled", "batch_start", batch[0], "error", err)
+			continue
+		}
+		for i, ci := range batch {
+			if got[i] != "" {
+				labels[ci] = got[i]
+			}
+		}
+		slog.Info("annotating sentiment", "progress", fmt.Sprintf("%d/%d", start+len(batch), len(indices)))
+	}
+	return labels
+}
+
+// countSentiments 各标签的对话数；labels 为 nil（没有标注）时返回 nil
+func countSentiments(labels map[int]string) map[string]int {
+	if labels == nil {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, l := range labels {
+		counts[l]++
+	}
+	return counts
+}
+
+// formatSentimentCounts 导入报告里的一行，如 "positive 12, neutral 30, negative 3, playful 8"
+func formatSentimentCounts(counts map[string]int) string {
+	parts := make([]string, 0, len(ai.Sentiments))
+	total := 0
+	for _, s := range ai.Sentiments {
+		parts = append(parts, fmt.Sprintf("%s %d", s, counts[s]))
+		total += counts[s]
+	}
+	return fmt.Sprintf("%s (%d conversations annotated)", strings.Join(parts, ", "), total)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+
+	"github.com/liao/style-bot/internal/parser"
+	"github.com/liao/style-bot/internal/persona"
+)
+
+// analyzeWindows 把聊天记录按时间等分成 n 个窗口，并发分析（最多 concurrency 个请求同时进行），
+// 每个窗口的结果写入 persona_window_<i>.json，再按时间顺序合并：文本字段以较新的窗口为准，列表取并集
+func analyzeWindows(ctx context.Context, client *genai.Client, messages []parser.ChatMessage, conversations []parser.Conversation, n, concurrency int, outputDir string, opts analysisOptions) (*persona.Persona, error) {
+	msgWindows, convWindows := splitWindows(messages, conversations, n)
+
+	results := make([]*persona.Persona, n)
+	errs := make([]error, n)
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i := range n {
+		if !hasMine(msgWindows[i]) {
+			slog.Info("no messages of mine in window, skipping", "window", i+1)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			slog.Info("analyzing window", "window", i+1, "messages", len(msgWindows[i]), "conversations", len(convWindows[i]))
+			p, err := analyzeStyle(ctx, client, msgWindows[i], convWindows[i], opts)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			path := filepath.Join(outputDir, fmt.Sprintf("persona_window_%d.json", i+1))
+			if err := persona.SaveToFile(path, p); err != nil {
+				errs[i] = fmt.Errorf("write %s: %w", path, err)
+				return
+			}
+			results[i] = p
+		}()
+	}
+	wg.Wait()
+
+	var merged *persona.Persona
+	for i, p := range results {
+		if errs[i] != nil {
+			slog.Warn("window analysis failed, skipping", "window", i+1, "error", errs[i])
+			continue
+		}
+		if p != nil {
+			merged = persona.Merge(merged, p, persona.UnionSlices)
+		}
+	}
+	if merged == nil {
+		return nil, fmt.Errorf("all %d window analyses failed or were empty", n)
+	}
+	return merged, nil
+}
+
+// splitWindows 首尾时间之间等宽切成 n 段；没有时间的消息跟前一条，没有时间的对话按顺序均分。
+// 所有消息都没有时间时按条数均分
+func splitWindows(messages []parser.ChatMessage, conversations []parser.Conversation, n int) ([][]parser.ChatMessage, [][]parser.Conversation) {
+	var first, last time.Time
+	for _, m := range messages {
+		if m.Timestamp.IsZero() {
+			continue
+		}
+		if first.IsZero() || m.Timestamp.Before(first) {
+			first = m.Timestamp
+		}
+		if m.Timestamp.After(last) {
+			last = m.Timestamp
+		}
+	}
+	width := last.Sub(first)/time.Duration(n) + 1
+	index := func(t time.Time) int {
+		return min(int(t.Sub(first)/width), n-1)
+	}
+
+	msgWindows := make([][]parser.ChatMessage, n)
+	w := 0
+	for i, m := range messages {
+		switch {
+		case first.IsZero():
+			w = i * n / len(messages)
+		case !m.Timestamp.IsZero():
+			w = index(m.Timestamp)
+		}
+		msgWindows[w] = append(msgWindows[w], m)
+	}
+
+	convWindows := make([][]parser.Conversation, n)
+	for i, c := range conversations {
+		w := i * n / len(conversations)
+		if !first.IsZero() && !c.StartAt.IsZero() {
+			w = max(index(c.StartAt), 0)
+		}
+		convWindows[w] = append(convWindows[w], c)
+	}
+	return msgWindows, convWindows
+}
+
+// hasMine 窗口里有没有我的消息
+func hasMine(messages []parser.ChatMessage) bool {
+	for _, m := range messages {
+		if m.IsMe {
+			return true
+		}
+	}
+	return false
+}
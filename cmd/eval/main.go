@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/liao/style-bot/internal/app"
+	"github.com/liao/style-bot/internal/chat"
+	"github.com/liao/style-bot/internal/config"
+	"github.com/liao/style-bot/internal/logging"
+	"github.com/liao/style-bot/internal/parser"
+)
+
+// eval 用留出的对话（data-importer -holdout）回放对方的消息，把 bot 生成的回复和我当时真实的回复比较打分
+func main() {
+	configPath := flag.String("config", "configs/config.yaml", "config file path")
+	holdoutPath := flag.String("holdout", "data/holdout.jsonl", "held-out conversations written by data-importer -holdout")
+	format := flag.String("format", "markdown", "report format: markdown or json")
+	output := flag.String("output", "", "write the report to this file instead of stdout")
+	worst := flag.Int("worst", 10, "number of worst conversations to show in the report")
+	maxTurns := flag.Int("max-turns", 0, "stop after replaying this many turns, 0 = all")
+	logLevel := flag.String("log-level", "warn", "log level (debug, info, warn, error)")
+	flag.Parse()
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	if *format != "markdown" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: -format must be markdown or json\n")
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		slog.Error("load config failed", "error", err)
+		os.Exit(1)
+	}
+	if err := logging.Configure(slog.Default().Handler(), *logLevel, nil); err != nil {
+		slog.Error("configure logging failed", "error", err)
+		os.Exit(1)
+	}
+
+	conversations, err := readHoldout(*holdoutPath)
+	if err != nil {
+		slog.Error("read holdout failed", "error", err)
+		os.Exit(1)
+	}
+
+	// 回放时每轮都从真实的历史开始：关掉会改变后续行为的限流、升级、摘要和自动刷新，状态写到临时目录
+	stateDir, err := os.MkdirTemp("", "eval-")
+	if err != nil {
+		slog.Error("create state dir failed", "error", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(stateDir)
+	cfg.Data.SessionsDir = stateDir
+	cfg.Data.AuditDir = ""
+	cfg.Data.LiveLog = ""
+	cfg.Bot.PersonaRefreshAfterMessages = 0
+	cfg.Bot.SummaryEvery = 0
+	cfg.Bot.DriftCheckIntervalMessages = 0
+	cfg.Bot.UserRPM = 0
+	cfg.Bot.MaxRepliesPerDay = 0
+	cfg.Bot.MaxRepliesPerHourPerPeer = 0
+	cfg.Bot.Escalation.Keywords = nil
+	cfg.Bot.Escalation.ModelCheck = false
+
+	ctx := context.Background()
+	chatMgr := chat.NewMemoryManager(cfg.Bot.MaxContextTurns)
+	// 和 cmd/bot 相同的 AI 客户端、RAG、persona 和 prompt 模板；打分用同一个 embedding 函数
+	built, err := app.NewBot(ctx, cfg, chatMgr, nil, nil)
+	if err != nil {
+		slog.Error("init bot failed", "error", err)
+		os.Exit(1)
+	}
+
+	var catchphrases []string
+	if built.Persona != nil {
+		catchphrases = built.Persona.Style.Catchphrases
+	}
+	r := &replayer{bot: built.Bot, chat: chatMgr, embed: built.Embed, peer: cfg.Bot.TargetQQ, maxTurns: *maxTurns}
+	results, err := r.run(ctx, conversations)
+	if err != nil {
+		slog.Error("replay failed", "error", err)
+		os.Exit(1)
+	}
+	rep := buildReport(results, catchphrases, *worst)
+
+	var out []byte
+	if *format == "json" {
+		out, err = json.MarshalIndent(rep, "", "  ")
+		out = append(out, '\n')
+	} else {
+		out = []byte(rep.Markdown())
+	}
+	if err != nil {
+		slog.Error("render report failed", "error", err)
+		os.Exit(1)
+	}
+	if *output == "" {
+		os.Stdout.Write(out)
+		return
+	}
+	if err := os.WriteFile(*output, out, 0600); err != nil {
+		slog.Error("write report failed", "error", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "report written to %s (%d turns, mean similarity %.3f)\n", *output, rep.Turns, rep.MeanSimilarity)
+}
+
+// readHoldout 读取 data-importer 写出的留出对话，每行一个 parser.Conversation
+func readHoldout(path string) ([]parser.Conversation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open holdout: %w", err)
+	}
+	defer f.Close()
+
+	var convs []parser.Conversation
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		var c parser.Conversation
+		if err := json.Unmarshal(sc.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("parse holdout line %d: %w", len(convs)+1, err)
+		}
+		convs = append(convs, c)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read holdout: %w", err)
+	}
+	if len(convs) == 0 {
+		return nil, fmt.Errorf("no conversations in %s", path)
+	}
+	return convs, nil
+}
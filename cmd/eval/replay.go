@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+
+	"github.com/liao/style-bot/internal/ai"
+	"github.com/liao/style-bot/internal/bot"
+	"github.com/liao/style-bot/internal/chat"
+	"github.com/liao/style-bot/internal/parser"
+	"github.com/liao/style-bot/internal/rag"
+)
+
+// turn 对话里的一轮：对方连续发的几条消息和我接着发的回复
+type turn struct {
+	history  []parser.ChatMessage // 这一轮之前的全部消息
+	incoming []parser.ChatMessage
+	real     []string
+}
+
+// splitTurns 把对话切成轮次；开头我先说的和结尾对方没等到回复的消息只作为历史
+func splitTurns(c parser.Conversation) []turn {
+	var turns []turn
+	msgs := c.Messages
+	for i := 0; i < len(msgs); {
+		if msgs[i].IsMe {
+			i++
+			continue
+		}
+		start := i
+		for i < len(msgs) && !msgs[i].IsMe {
+			i++
+		}
+		end := i
+		var real []string
+		for i < len(msgs) && msgs[i].IsMe {
+			if s := strings.TrimSpace(msgs[i].Content); s != "" {
+				real = append(real, s)
+			}
+			i++
+		}
+		if len(real) > 0 {
+			turns = append(turns, turn{history: msgs[:start], incoming: msgs[start:end], real: real})
+		}
+	}
+	return turns
+}
+
+// turnResult 一轮的回放结果
+type turnResult struct {
+	Incoming      string   `json:"incoming"`
+	Real          []string `json:"real"`
+	Generated     []string `json:"generated"`
+	Similarity    float32  `json:"similarity"`
+	Scored        bool     `json:"scored"` // false：没有生成回复或 embedding 失败，不计入相似度
+	Examples      int      `json:"examples"`
+	AIPatternHits int      `json:"ai_pattern_hits"`
+	LatencyMs     int64    `json:"latency_ms"`
+}
+
+// convResult 一段对话的回放结果
+type convResult struct {
+	Index   int          `json:"index"` // 在 holdout 文件里的序号，从 0 开始
+	StartAt time.Time    `json:"start_at"`
+	Turns   []turnResult `json:"-"`
+}
+
+// replayer 逐轮回放：每轮把会话重置成真实历史，再把对方的消息交给 bot
+type replayer struct {
+	bot      *bot.Bot
+	chat     *chat.Manager
+	embed    chromem.EmbeddingFunc
+	peer     int64
+	maxTurns int
+}
+
+func (r *replayer) run(ctx context.Context, conversations []parser.Conversation) ([]convResult, error) {
+	var results []convResult
+	total := 0
+	for ci, c := range conversations {
+		cr := convResult{Index: ci, StartAt: c.StartAt}
+		for _, t := range splitTurns(c) {
+			if r.maxTurns > 0 && total >= r.maxTurns {
+				break
+			}
+			tr, err := r.replay(ctx, t)
+			if err != nil {
+				return nil, err
+			}
+			cr.Turns = append(cr.Turns, tr)
+			total++
+		}
+		if len(cr.Turns) > 0 {
+			results = append(results, cr)
+		}
+		slog.Info("conversation replayed", "conversation", ci+1, "of", len(conversations), "turns", len(cr.Turns))
+		if r.maxTurns > 0 && total >= r.maxTurns {
+			break
+		}
+	}
+	return results, nil
+}
+
+// replay 回放一轮并打分
+func (r *replayer) replay(ctx context.Context, t turn) (turnResult, error) {
+	r.chat.Reset()
+	for _, m := range t.history {
+		if m.IsMe {
+			r.chat.AddBotReply(m.Content)
+		} else {
+			r.chat.AddUserMessage(m.Content, 0)
+		}
+	}
+	last := t.incoming[len(t.incoming)-1]
+	for _, m := range t.incoming[:len(t.incoming)-1] {
+		r.chat.AddUserMessage(m.Content, 0)
+	}
+
+	start := time.Now()
+	resp, err := r.bot.RespondDetailed(ctx, r.peer, last.Content)
+	if err != nil {
+		return turnResult{}, fmt.Errorf("respond: %w", err)
+	}
+	tr := turnResult{
+		Incoming:      joinContents(t.incoming),
+		Real:          t.real,
+		Generated:     resp.Parts,
+		Examples:      resp.Examples,
+		AIPatternHits: ai.CountAIPatterns(resp.Raw),
+		LatencyMs:     time.Since(start).Milliseconds(),
+	}
+	if len(resp.Parts) == 0 {
+		return tr, nil
+	}
+
+	sim, err := r.similarity(ctx, strings.Join(resp.Parts, "\n"), strings.Join(t.real, "\n"))
+	if err != nil {
+		slog.Warn("embed replies failed, turn not scored", "error", err)
+		return tr, nil
+	}
+	tr.Similarity, tr.Scored = sim, true
+	return tr, nil
+}
+
+// similarity 两段文本 embedding 的余弦相似度
+func (r *replayer) similarity(ctx context.Context, a, b string) (float32, error) {
+	va, err := r.embed(ctx, a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := r.embed(ctx, b)
+	if err != nil {
+		return 0, err
+	}
+	return rag.CosineSimilarity(va, vb), nil
+}
+
+func joinContents(msgs []parser.ChatMessage) string {
+	parts := make([]string, len(msgs))
+	for i, m := range msgs {
+		parts[i] = m.Content
+	}
+	return strings.Join(parts, "\n")
+}
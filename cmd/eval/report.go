@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// report 评估报告
+type report struct {
+	Conversations       int     `json:"conversations"`
+	Turns               int     `json:"turns"`
+	NoReply             int     `json:"no_reply"` // bot 没有回复的轮数（敏感话题回避等也算回复）
+	MeanSimilarity      float32 `json:"mean_similarity"`
+	LengthDivergence    float64 `json:"length_divergence"` // 单条消息字数分布的 JS 散度，0 = 一致，1 = 完全不同
+	MeanLengthReal      float64 `json:"mean_length_real"`
+	MeanLengthGenerated float64 `json:"mean_length_generated"`
+	PartsPerTurnReal    float64 `json:"parts_per_turn_real"`
+	PartsPerTurnGen     float64 `json:"parts_per_turn_generated"`
+
+	Catchphrases             []string `json:"catchphrases"`
+	CatchphraseRateReal      float64  `json:"catchphrase_rate_real"` // 用到口头禅的轮数占比
+	CatchphraseRateGenerated float64  `json:"catchphrase_rate_generated"`
+
+	AIPatternHits  int `json:"ai_pattern_hits"`  // 模型原始输出里 AI 味表达的总数（发出前已过滤）
+	AIPatternTurns int `json:"ai_pattern_turns"` // 出现过 AI 味表达的轮数
+
+	Worst []worstCase `json:"worst"`
+}
+
+// worstCase 平均相似度最低的对话和其中最差的一轮
+type worstCase struct {
+	Index          int        `json:"index"`
+	StartAt        string     `json:"start_at,omitempty"`
+	Turns          int        `json:"turns"`
+	MeanSimilarity float32    `json:"mean_similarity"`
+	WorstTurn      turnResult `json:"worst_turn"`
+}
+
+// lengthBuckets 单条消息字数分布的分桶上界，最后一桶不设上限
+var lengthBuckets = []int{2, 5, 10, 20, 40}
+
+func buildReport(results []convResult, catchphrases []string, worst int) report {
+	rep := report{Conversations: len(results), Catchphrases: catchphrases}
+	var simSum float64
+	var scored int
+	realHist := make([]float64, len(lengthBuckets)+1)
+	genHist := make([]float64, len(lengthBuckets)+1)
+	var realLen, genLen, realParts, genParts int
+	var realPhrase, genPhrase, replied int
+	var cases []worstCase
+
+	for _, cr := range results {
+		wc := worstCase{Index: cr.Index, Turns: len(cr.Turns), MeanSimilarity: -1}
+		if !cr.StartAt.IsZero() {
+			wc.StartAt = cr.StartAt.Format("2006-01-02 15:04")
+		}
+		var convSum float64
+		var convScored int
+		for _, t := range cr.Turns {
+			rep.Turns++
+			rep.AIPatternHits += t.AIPatternHits
+			if t.AIPatternHits > 0 {
+				rep.AIPatternTurns++
+			}
+			for _, s := range t.Real {
+				n := utf8.RuneCountInString(s)
+				realHist[bucket(n)]++
+				realLen += n
+				realParts++
+			}
+			if len(t.Generated) == 0 {
+				rep.NoReply++
+				continue
+			}
+			replied++
+			for _, s := range t.Generated {
+				n := utf8.RuneCountInString(s)
+				genHist[bucket(n)]++
+				genLen += n
+				genParts++
+			}
+			if usesAny(t.Real, catchphrases) {
+				realPhrase++
+			}
+			if usesAny(t.Generated, catchphrases) {
+				genPhrase++
+			}
+			if !t.Scored {
+				continue
+			}
+			simSum += float64(t.Similarity)
+			scored++
+			convSum += float64(t.Similarity)
+			convScored++
+			if wc.WorstTurn.Generated == nil || t.Similarity < wc.WorstTurn.Similarity {
+				wc.WorstTurn = t
+			}
+		}
+		if convScored > 0 {
+			wc.MeanSimilarity = float32(convSum / float64(convScored))
+			cases = append(cases, wc)
+		}
+	}
+
+	if scored > 0 {
+		rep.MeanSimilarity = float32(simSum / float64(scored))
+	}
+	rep.LengthDivergence = jsDivergence(realHist, genHist)
+	if realParts > 0 {
+		rep.MeanLengthReal = float64(realLen) / float64(realParts)
+	}
+	if genParts > 0 {
+		rep.MeanLengthGenerated = float64(genLen) / float64(genParts)
+	}
+	if rep.Turns > 0 {
+		rep.PartsPerTurnReal = float64(realParts) / float64(rep.Turns)
+	}
+	if replied > 0 {
+		rep.PartsPerTurnGen = float64(genParts) / float64(replied)
+		rep.CatchphraseRateReal = float64(realPhrase) / float64(replied)
+		rep.CatchphraseRateGenerated = float64(genPhrase) / float64(replied)
+	}
+
+	sort.Slice(cases, func(i, j int) bool { return cases[i].MeanSimilarity < cases[j].MeanSimilarity })
+	if len(cases) > worst {
+		cases = cases[:worst]
+	}
+	rep.Worst = cases
+	return rep
+}
+
+// bucket 字数所在的分桶
+func bucket(n int) int {
+	for i, max := range lengthBuckets {
+		if n <= max {
+			return i
+		}
+	}
+	return len(lengthBuckets)
+}
+
+// jsDivergence 两个直方图（未归一化）的 Jensen-Shannon 散度，以 2 为底，范围 0-1；任一为空时返回 0
+func jsDivergence(p, q []float64) float64 {
+	var sp, sq float64
+	for i := range p {
+		sp += p[i]
+		sq += q[i]
+	}
+	if sp == 0 || sq == 0 {
+		return 0
+	}
+	var d float64
+	for i := range p {
+		pi, qi := p[i]/sp, q[i]/sq
+		m := (pi + qi) / 2
+		if pi > 0 {
+			d += pi * math.Log2(pi/m) / 2
+		}
+		if qi > 0 {
+			d += qi * math.Log2(qi/m) / 2
+		}
+	}
+	return d
+}
+
+// usesAny 几条消息里是否用到任意一个口头禅
+func usesAny(msgs []string, phrases []string) bool {
+	for _, m := range msgs {
+		for _, p := range phrases {
+			if p != "" && strings.Contains(m, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Markdown 渲染成 markdown
+func (r report) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# Style evaluation\n\n")
+	fmt.Fprintf(&b, "%d conversations, %d turns replayed, %d without a reply\n\n", r.Conversations, r.Turns, r.NoReply)
+	b.WriteString("| metric | real | generated |\n|---|---|---|\n")
+	fmt.Fprintf(&b, "| mean embedding similarity | | %.3f |\n", r.MeanSimilarity)
+	fmt.Fprintf(&b, "| mean message length (chars) | %.1f | %.1f |\n", r.MeanLengthReal, r.MeanLengthGenerated)
+	fmt.Fprintf(&b, "| messages per turn | %.2f | %.2f |\n", r.PartsPerTurnReal, r.PartsPerTurnGen)
+	fmt.Fprintf(&b, "| length distribution divergence (JS) | | %.3f |\n", r.LengthDivergence)
+	if len(r.Catchphrases) > 0 {
+		fmt.Fprintf(&b, "| catchphrase usage rate | %.1f%% | %.1f%% |\n", r.CatchphraseRateReal*100, r.CatchphraseRateGenerated*100)
+	} else {
+		b.WriteString("| catchphrase usage rate | n/a (persona has no catchphrases) | |\n")
+	}
+	fmt.Fprintf(&b, "| AI-pattern hits (before filtering) | | %d in %d turns |\n", r.AIPatternHits, r.AIPatternTurns)
+
+	if len(r.Worst) == 0 {
+		return b.String()
+	}
+	b.WriteString("\n## Worst conversations\n")
+	for _, w := range r.Worst {
+		fmt.Fprintf(&b, "\n### #%d", w.Index)
+		if w.StartAt != "" {
+			fmt.Fprintf(&b, " (%s)", w.StartAt)
+		}
+		fmt.Fprintf(&b, ": mean similarity %.3f over %d turns\n\n", w.MeanSimilarity, w.Turns)
+		t := w.WorstTurn
+		fmt.Fprintf(&b, "Worst turn, similarity %.3f, %d examples retrieved:\n\n", t.Similarity, t.Examples)
+		writeQuoted(&b, "them", strings.Split(t.Incoming, "\n"))
+		writeQuoted(&b, "real", t.Real)
+		writeQuoted(&b, "bot", t.Generated)
+	}
+	return b.String()
+}
+
+// writeQuoted 每条消息一行引用
+func writeQuoted(b *strings.Builder, label string, msgs []string) {
+	fmt.Fprintf(b, "**%s**\n\n", label)
+	for _, m := range msgs {
+		fmt.Fprintf(b, "> %s\n", strings.ReplaceAll(m, "\n", " "))
+	}
+	b.WriteString("\n")
+}
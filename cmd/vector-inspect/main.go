@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/philippgille/chromem-go"
+
+	"github.com/liao/style-bot/internal/app"
+	"github.com/liao/style-bot/internal/config"
+	"github.com/liao/style-bot/internal/rag"
+)
+
+// previewRunes -list 每条内容预览的长度
+const previewRunes = 60
+
+func main() {
+	configPath := flag.String("config", "configs/config.yaml", "config file path (rag.vectors_dir and embedding settings)")
+	vectorsDir := flag.String("vectors", "", "vector store directory, overrides rag.vectors_dir")
+	list := flag.Bool("list", false, "list document IDs with a content preview")
+	query := flag.String("query", "", "with -list, sort documents by similarity to this text (needs the embedding model)")
+	get := flag.String("get", "", "show one document by ID")
+	del := flag.String("delete", "", "delete one document by ID")
+	flag.Parse()
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	if !*list && *get == "" && *del == "" {
+		fmt.Fprintf(os.Stderr, "Usage: vector-inspect [-config <file>] (-list [-query <text>] | -get <id> | -delete <id>)\n")
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		slog.Error("load config failed", "error", err)
+		os.Exit(1)
+	}
+	dir := cfg.RAG.VectorsDir
+	if *vectorsDir != "" {
+		dir = *vectorsDir
+	}
+
+	ctx := context.Background()
+
+	// 只有按相似度排序时才需要 embedding，这时也校验它与库里记录的模型一致
+	var embed chromem.EmbeddingFunc
+	var model string
+	if *query != "" {
+		client, err := app.NewAIClient(ctx, cfg, nil)
+		if err != nil {
+			slog.Error("create AI client failed", "error", err)
+			os.Exit(1)
+		}
+		embed, model = app.EmbedFunc(cfg, client), client.EmbeddingModel()
+	}
+	store, err := rag.NewStore(dir, embed, model)
+	if err != nil {
+		slog.Error("open vector store failed", "error", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case *del != "":
+		err = store.Remove(ctx, *del)
+		if err == nil {
+			fmt.Printf("deleted %s (%d documents left)\n", *del, store.Count())
+		}
+	case *get != "":
+		err = printDocument(ctx, store, *get)
+	case *query != "":
+		err = listByQuery(ctx, store, *query)
+	default:
+		err = listAll(ctx, store)
+	}
+	if errors.Is(err, rag.ErrNotFound) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err != nil {
+		slog.Error("vector-inspect failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func listAll(ctx context.Context, store *rag.Store) error {
+	docs, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range docs {
+		fmt.Printf("%s\t%s\n", d.ID, preview(d.Content))
+	}
+	fmt.Fprintf(os.Stderr, "%d documents\n", len(docs))
+	return nil
+}
+
+// listByQuery 全部文档按与 text 的相似度从高到低列出
+func listByQuery(ctx context.Context, store *rag.Store, text string) error {
+	results, err := store.Query(ctx, text, store.Count(), -1, rag.QueryOptions{})
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		fmt.Printf("%.3f\t%s\t%s\n", r.Similarity, r.ID, preview(r.Content))
+	}
+	fmt.Fprintf(os.Stderr, "%d documents\n", len(results))
+	return nil
+}
+
+func printDocument(ctx context.Context, store *rag.Store, id string) error {
+	d, err := store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("id: %s\n", d.ID)
+	for _, k := range slices.Sorted(maps.Keys(d.Metadata)) {
+		fmt.Printf("%s: %s\n", k, d.Metadata[k])
+	}
+	fmt.Printf("\n%s\n", d.Content)
+	return nil
+}
+
+// preview 内容压成一行并截断
+func preview(content string) string {
+	s := strings.Join(strings.Fields(content), " ")
+	if r := []rune(s); len(r) > previewRunes {
+		return string(r[:previewRunes]) + "…"
+	}
+	return s
+}
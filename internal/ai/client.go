@@ -3,7 +3,8 @@ package ai
 import (
 	"context"
 	"fmt"
-	"log/slog"
+	"math"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -11,8 +12,13 @@ import (
 
 	chromem "github.com/philippgille/chromem-go"
 	"google.golang.org/genai"
+
+	"github.com/liao/style-bot/internal/embedtask"
+	"github.com/liao/style-bot/internal/logging"
 )
 
+var logger = logging.For("ai")
+
 type Client struct {
 	clients    []*genai.Client // 多 key 轮换
 	clientIdx  atomic.Int64
@@ -20,8 +26,17 @@ type Client struct {
 	modelIdx   atomic.Int64
 	embedModel string
 	ollamaURL  string
+	embedDim   int32 // Gemini embedding 的输出维度，0 = 模型默认
 	temp       float32
 	maxTokens  int32
+	timeout    time.Duration // 单次请求超时，0 = 不限制
+	stopSeqs   []string      // 聊天生成的停止序列
+	embedRetry RetryPolicy
+
+	sentimentModel string // ClassifySentiment 用的模型，空 = 聊天模型
+
+	usage       usageCounter
+	rateLimited atomic.Int64 // 累计 429 次数
 
 	// 限流
 	rpmLimit int
@@ -30,7 +45,32 @@ type Client struct {
 	lastTick time.Time
 }
 
-func NewClient(ctx context.Context, apiKeys []string, chatModels []string, embedModel, ollamaURL string, temp float32, maxTokens int32, rpmLimit int) (*Client, error) {
+// ClientOptions NewClient 的参数，未设置的字段为零值：不限速、不限时、模型默认的温度和长度
+type ClientOptions struct {
+	APIKeys        []string
+	APIKeysFile    string   // 追加在 APIKeys 之后的 key 文件（ReadAPIKeysFile）
+	ChatModels     []string // 按顺序轮换，429 时切到下一个；只做 embedding 时可为空
+	EmbedModel     string
+	OllamaURL      string // 非空时用 Ollama 计算 embedding
+	EmbedDim       int32  // Gemini embedding 的输出维度，0 = 模型默认
+	Temperature    float32
+	MaxTokens      int32
+	RPMLimit       int
+	RequestTimeout time.Duration // 单次请求超时，0 = 不限制
+	EmbedRetry     RetryPolicy
+	StopSequences  []string // 聊天生成的停止序列
+}
+
+func NewClient(ctx context.Context, opts ClientOptions) (*Client, error) {
+	apiKeys := opts.APIKeys
+	if opts.APIKeysFile != "" {
+		fileKeys, err := ReadAPIKeysFile(opts.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		apiKeys = append(append([]string(nil), apiKeys...), fileKeys...)
+	}
+
 	var clients []*genai.Client
 	for _, key := range apiKeys {
 		if key == "" {
@@ -41,7 +81,7 @@ func NewClient(ctx context.Context, apiKeys []string, chatModels []string, embed
 			Backend: genai.BackendGeminiAPI,
 		})
 		if err != nil {
-			slog.Warn("skip api key", "error", err)
+			logger.Warn("skip api key", "error", err)
 			continue
 		}
 		clients = append(clients, client)
@@ -52,16 +92,21 @@ func NewClient(ctx context.Context, apiKeys []string, chatModels []string, embed
 
 	c := &Client{
 		clients:    clients,
-		chatModels: chatModels,
-		embedModel: embedModel,
-		ollamaURL:  ollamaURL,
-		temp:       temp,
-		maxTokens:  maxTokens,
-		rpmLimit:   rpmLimit,
-		tokens:     rpmLimit,
+		chatModels: opts.ChatModels,
+		embedModel: opts.EmbedModel,
+		ollamaURL:  opts.OllamaURL,
+		embedDim:   opts.EmbedDim,
+		temp:       opts.Temperature,
+		maxTokens:  opts.MaxTokens,
+		timeout:    opts.RequestTimeout,
+		stopSeqs:   opts.StopSequences,
+		embedRetry: opts.EmbedRetry,
+		rpmLimit:   opts.RPMLimit,
+		tokens:     opts.RPMLimit,
 		lastTick:   time.Now(),
 	}
-	slog.Info("AI clients ready", "keys", len(clients), "models", len(chatModels))
+	rateLimitTokens.Set(int64(opts.RPMLimit))
+	logger.Info("AI clients ready", "keys", len(clients), "models", len(opts.ChatModels))
 	return c, nil
 }
 
@@ -75,84 +120,275 @@ func (c *Client) currentModel() string {
 func (c *Client) rotateModel() string {
 	newIdx := c.modelIdx.Add(1) % int64(len(c.chatModels))
 	model := c.chatModels[newIdx]
-	slog.Info("rotating to next model", "model", model)
+	logger.Info("rotating to next model", "model", model)
 	return model
 }
 
 // GenerateChat 生成对话回复，429 时自动切换模型
 func (c *Client) GenerateChat(ctx context.Context, systemPrompt string, history []*genai.Content, userMsg string) (string, error) {
-	if err := c.waitForToken(ctx); err != nil {
-		return "", err
+	reply, _, err := c.GenerateChatWithModel(ctx, systemPrompt, history, userMsg)
+	return reply, err
+}
+
+// GenerateChatWithModel 同 GenerateChat，同时返回实际生成回复的模型
+func (c *Client) GenerateChatWithModel(ctx context.Context, systemPrompt string, history []*genai.Content, userMsg string) (string, string, error) {
+	return c.generate(ctx, systemPrompt, history, []*genai.Part{genai.NewPartFromText(userMsg)})
+}
+
+// GenerateChatWithImages 生成对图片的回复，images 为图片 Part（genai.NewPartFromBytes）；同时返回实际使用的模型
+func (c *Client) GenerateChatWithImages(ctx context.Context, systemPrompt string, history []*genai.Content, userMsg string, images []*genai.Part) (string, string, error) {
+	parts := make([]*genai.Part, 0, len(images)+1)
+	parts = append(parts, images...)
+	if userMsg != "" {
+		parts = append(parts, genai.NewPartFromText(userMsg))
+	}
+	return c.generate(ctx, systemPrompt, history, parts)
+}
+
+func (c *Client) generate(ctx context.Context, systemPrompt string, history []*genai.Content, userParts []*genai.Part) (string, string, error) {
+	waitCtx, cancel := c.withTimeout(ctx)
+	err := c.waitForToken(waitCtx)
+	cancel()
+	if err != nil {
+		return "", "", err
 	}
 
 	contents := make([]*genai.Content, 0, len(history)+1)
 	contents = append(contents, history...)
-	contents = append(contents, genai.NewContentFromText(userMsg, genai.RoleUser))
+	contents = append(contents, genai.NewContentFromParts(userParts, genai.RoleUser))
+	contents = alternateTurns(contents)
 
 	cfg := &genai.GenerateContentConfig{
 		SystemInstruction: genai.NewContentFromText(systemPrompt, genai.RoleUser),
 		Temperature:       genai.Ptr(c.temp),
 		MaxOutputTokens:   c.maxTokens,
+		StopSequences:     c.stopSeqs,
 	}
 
 	// 策略：对每个模型，先试所有 key；全部 429 再降到下一个模型
 	var lastErr error
 	for mi, model := range c.chatModels {
 		for ki, client := range c.clients {
-			resp, err := client.Models.GenerateContent(ctx, model, contents, cfg)
+			reqCtx, cancel := c.withTimeout(ctx)
+			resp, err := client.Models.GenerateContent(reqCtx, model, contents, cfg)
+			cancel()
+			geminiRequests.Inc(model, strconv.Itoa(ki), responseCode(err))
 			if err != nil {
 				lastErr = err
+				if ctx.Err() != nil {
+					return "", "", fmt.Errorf("generate: %w", ctx.Err())
+				}
 				if strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "RESOURCE_EXHAUSTED") {
-					slog.Warn("quota exceeded", "key", ki, "model", model)
+					c.rateLimited.Add(1)
+					geminiRateLimited.Inc()
+					logger.Warn("quota exceeded", "key", ki, "model", model)
 					continue // 换下一个 key
 				}
 				if strings.Contains(err.Error(), "404") {
-					slog.Warn("model not found, skipping", "model", model)
+					logger.Warn("model not found, skipping", "model", model)
 					break // 换下一个模型
 				}
-				slog.Warn("generate failed", "key", ki, "model", model, "error", err)
+				logger.Warn("generate failed", "key", ki, "model", model, "error", err)
 				continue
 			}
+			c.usage.add(resp.UsageMetadata)
 			text := resp.Text()
-			slog.Info("generated reply", "key", ki, "model", model, "model_rank", mi+1)
-			return text, nil
+			logger.Info("generated reply", "key", ki, "model", model, "model_rank", mi+1)
+			return text, model, nil
 		}
 	}
-	return "", fmt.Errorf("all keys and models exhausted: %w", lastErr)
+	return "", "", fmt.Errorf("all keys and models exhausted: %w", lastErr)
 }
 
-// EmbedFunc 返回一个可用于 chromem-go 的 embedding 函数
+// Summarize 根据已有摘要和最近对话生成新的简短摘要（不超过 100 字）
+func (c *Client) Summarize(ctx context.Context, previous string, transcript []string) (string, error) {
+	var b strings.Builder
+	if previous != "" {
+		b.WriteString("之前的对话背景：\n" + previous + "\n\n")
+	}
+	b.WriteString("最近的聊天记录：\n")
+	b.WriteString(strings.Join(transcript, "\n"))
+
+	summary, err := c.GenerateChat(ctx, summarizePrompt, nil, b.String())
+	if err != nil {
+		return "", fmt.Errorf("summarize: %w", err)
+	}
+	return strings.TrimSpace(summary), nil
+}
+
+const summarizePrompt = "你是对话摘要助手。用一两句话（不超过100字）概括这段聊天当前在聊什么、" +
+	"有什么没说完的话题或约定。只输出摘要本身，不要加前缀。"
+
+// SummarizeDay 用最便宜的聊天模型（chat_models 的最后一个）列出一天聊天的主要话题，结果不超过 maxRunes 字
+func (c *Client) SummarizeDay(ctx context.Context, transcript []string, maxRunes int) (string, error) {
+	if err := c.waitForToken(ctx); err != nil {
+		return "", err
+	}
+	model := c.chatModels[len(c.chatModels)-1]
+	cfg := &genai.GenerateContentConfig{
+		SystemInstruction: genai.NewContentFromText(daySummaryPrompt, genai.RoleUser),
+		Temperature:       genai.Ptr(float32(0.3)),
+		MaxOutputTokens:   int32(maxRunes * 2), // 中文大约一个字一到两个 token
+	}
+	contents := []*genai.Content{genai.NewContentFromText(strings.Join(transcript, "\n"), genai.RoleUser)}
+
+	var lastErr error
+	for ki, client := range c.clients {
+		reqCtx, cancel := c.withTimeout(ctx)
+		resp, err := client.Models.GenerateContent(reqCtx, model, contents, cfg)
+		cancel()
+		if err != nil {
+			lastErr = err
+			logger.Warn("day summary failed", "key", ki, "model", model, "error", err)
+			continue
+		}
+		c.usage.add(resp.UsageMetadata)
+		summary := strings.TrimSpace(resp.Text())
+		if r := []rune(summary); len(r) > maxRunes {
+			summary = string(r[:maxRunes]) + "…"
+		}
+		return summary, nil
+	}
+	return "", fmt.Errorf("summarize day: %w", lastErr)
+}
+
+const daySummaryPrompt = "你是聊天记录整理助手。列出这段聊天里的主要话题，最多 3 条，每条一行、不超过 20 字，" +
+	"以 \"- \" 开头。只输出列表本身。"
+
+// AnalysisModel 风格分析使用的模型（输出较长的 JSON，不走聊天模型轮换）
+const AnalysisModel = "gemini-2.5-flash"
+
+// analysisTimeout 风格分析输出长、可能带 thinking，超时不低于这个值
+const analysisTimeout = 5 * time.Minute
+
+// AnalyzeStyle 用风格分析 prompt（persona.BuildAnalysisPrompt）生成 persona JSON，429 时换 key
+func (c *Client) AnalyzeStyle(ctx context.Context, prompt string, thinkingBudget int32, stopSequences []string) (string, error) {
+	if err := c.waitForToken(ctx); err != nil {
+		return "", err
+	}
+
+	cfg := &genai.GenerateContentConfig{
+		Temperature:     genai.Ptr(float32(0.3)),
+		MaxOutputTokens: 8192,
+		StopSequences:   stopSequences,
+	}
+	if thinkingBudget > 0 {
+		cfg.ThinkingConfig = &genai.ThinkingConfig{ThinkingBudget: genai.Ptr(thinkingBudget)}
+	}
+	contents := []*genai.Content{genai.NewContentFromText(prompt, genai.RoleUser)}
+
+	var lastErr error
+	for ki, client := range c.clients {
+		reqCtx, cancel := context.WithTimeout(ctx, max(c.timeout, analysisTimeout))
+		resp, err := client.Models.GenerateContent(reqCtx, AnalysisModel, contents, cfg)
+		cancel()
+		if err != nil {
+			lastErr = err
+			logger.Warn("style analysis failed", "key", ki, "error", err)
+			continue
+		}
+		c.usage.add(resp.UsageMetadata)
+		return resp.Text(), nil
+	}
+	return "", fmt.Errorf("gemini analyze: %w", lastErr)
+}
+
+// UsageStats 返回累计 token 用量
+func (c *Client) UsageStats() UsageStats {
+	return c.usage.snapshot()
+}
+
+// RateLimitedCount 返回累计遇到 429 的次数
+func (c *Client) RateLimitedCount() int64 {
+	return c.rateLimited.Load()
+}
+
+// EmbeddingModel EmbedFunc 实际使用的模型，如 ollama/nomic-embed-text、gemini/text-embedding-004，记录在向量库里用于校验
+func (c *Client) EmbeddingModel() string {
+	if c.ollamaURL != "" {
+		return "ollama/" + c.embedModel
+	}
+	return "gemini/" + c.embedModel
+}
+
+// EmbedFunc 返回一个可用于 chromem-go 的 embedding 函数；Gemini 按 ctx 上的 embedtask.Task 设置 TaskType
 // 优先使用 Ollama（本地，免费无限），回退到 Gemini API
 func (c *Client) EmbedFunc() chromem.EmbeddingFunc {
 	if c.ollamaURL != "" {
-		slog.Info("using Ollama for embedding", "model", c.embedModel, "url", c.ollamaURL)
-		return chromem.NewEmbeddingFuncOllama(c.embedModel, c.ollamaURL)
+		logger.Info("using Ollama for embedding", "model", c.embedModel, "url", c.ollamaURL)
+		ollama := chromem.NewEmbeddingFuncOllama(c.embedModel, c.ollamaURL)
+		return timedEmbed(RetryEmbed(func(ctx context.Context, text string) ([]float32, error) {
+			ctx, cancel := c.withTimeout(ctx)
+			defer cancel()
+			return ollama(ctx, text)
+		}, c.embedRetry))
 	}
-	slog.Info("using Gemini API for embedding", "model", c.embedModel)
-	return func(ctx context.Context, text string) ([]float32, error) {
-		var lastErr error
-		for attempt := 0; attempt < 3; attempt++ {
-			resp, err := c.clients[0].Models.EmbedContent(ctx, c.embedModel,
-				[]*genai.Content{genai.NewContentFromText(text, genai.RoleUser)}, nil)
-			if err != nil {
-				lastErr = err
-				slog.Warn("embed failed, retrying", "attempt", attempt+1, "error", err)
-				time.Sleep(time.Duration(1<<attempt) * time.Second)
-				continue
-			}
-			if len(resp.Embeddings) == 0 {
-				return nil, fmt.Errorf("empty embedding response")
-			}
-			return resp.Embeddings[0].Values, nil
+	logger.Info("using Gemini API for embedding", "model", c.embedModel, "dim", c.embedDim)
+	return timedEmbed(RetryEmbed(func(ctx context.Context, text string) ([]float32, error) {
+		// 文档 / 查询由向量库在 ctx 上标明（embedtask.With）
+		embedCfg := &genai.EmbedContentConfig{TaskType: string(embedtask.From(ctx))}
+		if c.embedDim > 0 {
+			embedCfg.OutputDimensionality = genai.Ptr(c.embedDim)
 		}
-		return nil, fmt.Errorf("embed failed after 3 attempts: %w", lastErr)
+		ctx, cancel := c.withTimeout(ctx)
+		defer cancel()
+		resp, err := c.clients[0].Models.EmbedContent(ctx, c.embedModel,
+			[]*genai.Content{genai.NewContentFromText(text, genai.RoleUser)}, embedCfg)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Embeddings) == 0 {
+			return nil, fmt.Errorf("empty embedding response")
+		}
+		// 截短维度（embedding_dim）后的向量不再是单位长度，chromem 按点积算相似度，要先归一化
+		return unitVector(resp.Embeddings[0].Values), nil
+	}, c.embedRetry))
+}
+
+// unitVector 把向量缩放到单位长度，零向量原样返回
+func unitVector(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return v
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range v {
+		v[i] *= scale
+	}
+	return v
+}
+
+// timedEmbed 记录每次 embedding（含重试）的耗时
+func timedEmbed(embed chromem.EmbeddingFunc) chromem.EmbeddingFunc {
+	return func(ctx context.Context, text string) ([]float32, error) {
+		defer embeddingLatency.ObserveSince(time.Now())
+		return embed(ctx, text)
 	}
 }
 
-// waitForToken 简单令牌桶限流
+// withTimeout 给单次请求加上 request_timeout
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// WaitForToken 占用一次 rpm_limit 配额，供不经过 Generate 的调用方（如启动时的 RAG 预热）限流
+func (c *Client) WaitForToken(ctx context.Context) error {
+	return c.waitForToken(ctx)
+}
+
+// waitForToken 简单令牌桶限流；需要等待的时间超过 ctx 的截止时间时直接失败
 func (c *Client) waitForToken(ctx context.Context) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer func() {
+		rateLimitTokens.Set(int64(c.tokens))
+		c.mu.Unlock()
+	}()
 
 	now := time.Now()
 	elapsed := now.Sub(c.lastTick)
@@ -167,8 +403,11 @@ func (c *Client) waitForToken(ctx context.Context) error {
 	}
 
 	wait := time.Minute - elapsed
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		return fmt.Errorf("rate limit wait %s exceeds request deadline", wait.Round(time.Second))
+	}
 	c.mu.Unlock()
-	slog.Info("rate limit reached, waiting", "duration", wait)
+	logger.Info("rate limit reached, waiting", "duration", wait)
 	select {
 	case <-ctx.Done():
 		c.mu.Lock()
@@ -0,0 +1,59 @@
+package ai
+
+import (
+	"math/rand/v2"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// EmojiInjector 按人设的表情习惯，偶尔给回复补一个表情（模型常常忘记用）
+type EmojiInjector struct {
+	patterns    []string
+	probability float32
+}
+
+func NewEmojiInjector(patterns []string, probability float32) *EmojiInjector {
+	return &EmojiInjector{patterns: patterns, probability: probability}
+}
+
+// Inject 以 probability 的概率，在随机一条分段的开头或结尾加一个表情；已经以表情结尾的分段不加
+func (e *EmojiInjector) Inject(reply string) string {
+	if e == nil || len(e.patterns) == 0 || rand.Float32() >= e.probability {
+		return reply
+	}
+
+	parts := SplitMultiMessage(reply)
+	var candidates []int
+	for i, p := range parts {
+		if !e.endsWithEmoji(p) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return reply
+	}
+
+	i := candidates[rand.IntN(len(candidates))]
+	emoji := e.patterns[rand.IntN(len(e.patterns))]
+	if rand.IntN(2) == 0 {
+		parts[i] = parts[i] + emoji
+	} else {
+		parts[i] = emoji + parts[i]
+	}
+	return strings.Join(parts, "|||")
+}
+
+// endsWithEmoji 结尾是人设表情、[表情名] 标记或 Unicode 表情符号
+func (e *EmojiInjector) endsWithEmoji(s string) bool {
+	for _, p := range e.patterns {
+		if p != "" && strings.HasSuffix(s, p) {
+			return true
+		}
+	}
+	if strings.HasSuffix(s, "]") && strings.LastIndex(s, "[") >= 0 {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r >= 0x1F000 || unicode.Is(unicode.So, r) || r == 0xFE0F
+}
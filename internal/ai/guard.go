@@ -0,0 +1,113 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 疑问标记：出现任一即视为提问
+var questionMarkers = []string{
+	"?", "？", "吗", "么", "呢", "是不是", "有没有", "能不能", "要不要",
+}
+
+// 事实/计划类关键词：问的是具体时间、地点、安排、数字等
+var factKeywords = []string{
+	"几点", "几号", "哪天", "哪里", "哪儿", "在哪", "什么时候", "啥时候", "多久",
+	"多少", "几个", "谁", "什么地方", "计划", "安排", "打算", "约", "定了",
+	"明天", "后天", "周末", "下周", "上次", "那天", "记得", "地址", "电话",
+}
+
+// DeflectRule 检索不到相关记忆时追加到 system prompt 的强约束
+const DeflectRule = "\n## 重要\n" +
+	"对方在问一件具体的事实或安排，但你的聊天记录里没有相关信息。\n" +
+	"绝对不要编造时间、地点、人名、数字或计划。\n" +
+	"用你的风格含糊带过，比如说不记得了、回头再说、等下确认一下。\n"
+
+// IsFactQuestion 粗略判断消息是否在询问具体的事实或计划
+func IsFactQuestion(msg string) bool {
+	hasMarker := false
+	for _, m := range questionMarkers {
+		if strings.Contains(msg, m) {
+			hasMarker = true
+			break
+		}
+	}
+	if !hasMarker {
+		return false
+	}
+	for _, k := range factKeywords {
+		if strings.Contains(msg, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// TopicGuard 敏感话题拦截：关键词或正则命中即视为不能让模型即兴发挥的话题
+type TopicGuard struct {
+	keywords []string
+	patterns []*regexp.Regexp
+}
+
+// NewTopicGuard 编译正则，任一写错返回错误
+func NewTopicGuard(keywords, patterns []string) (*TopicGuard, error) {
+	g := &TopicGuard{}
+	for _, k := range keywords {
+		if k = strings.TrimSpace(k); k != "" {
+			g.keywords = append(g.keywords, k)
+		}
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("compile blocked topic pattern %q: %w", p, err)
+		}
+		g.patterns = append(g.patterns, re)
+	}
+	return g, nil
+}
+
+// Match 返回命中的关键词或正则，未命中返回空字符串。多条回复（||| 分隔）连起来检查（关键词被拆到两条里也算），
+// 正则还逐条检查，^ 和 $ 对每一条都生效
+func (g *TopicGuard) Match(text string) string {
+	if g == nil {
+		return ""
+	}
+	parts := strings.Split(text, "|||")
+	joined := strings.Join(parts, "")
+	for _, k := range g.keywords {
+		if strings.Contains(joined, k) {
+			return k
+		}
+	}
+	for _, re := range g.patterns {
+		if re.MatchString(joined) {
+			return re.String()
+		}
+		for _, part := range parts {
+			if re.MatchString(part) {
+				return re.String()
+			}
+		}
+	}
+	return ""
+}
+
+const stakesPrompt = "你是聊天消息分类器。判断这条私聊消息是否属于高风险/情绪激烈的场景，" +
+	"例如提分手、吵架、紧急情况、受伤生病、求助、重大决定。只输出 0 到 1 之间的一个数字，不要其他内容。"
+
+// ClassifyStakes 用模型给消息的严重程度打分（0-1）
+func (c *Client) ClassifyStakes(ctx context.Context, msg string) (float32, error) {
+	text, err := c.GenerateChat(ctx, stakesPrompt, nil, msg)
+	if err != nil {
+		return 0, fmt.Errorf("classify stakes: %w", err)
+	}
+	score, err := strconv.ParseFloat(strings.TrimSpace(text), 32)
+	if err != nil {
+		return 0, fmt.Errorf("parse stakes score %q: %w", text, err)
+	}
+	return float32(score), nil
+}
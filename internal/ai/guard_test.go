@@ -0,0 +1,29 @@
+package ai
+
+import "testing"
+
+func TestTopicGuardMatchesMultiPartReplies(t *testing.T) {
+	g, err := NewTopicGuard([]string{"借钱"}, []string{`^转账`, `密码$`})
+	if err != nil {
+		t.Fatalf("new guard: %v", err)
+	}
+	for _, tc := range []struct{ text, want string }{
+		{"好啊|||借钱给你", "借钱"},
+		{"可以借|||钱的事晚点说", "借钱"},
+		{"好|||转账给你", "^转账"},
+		{"你的密码|||是多少", "密码$"},
+		{"好啊|||几点", ""},
+		{"别转账", ""},
+	} {
+		if got := g.Match(tc.text); got != tc.want {
+			t.Errorf("Match(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestTopicGuardNilMatchesNothing(t *testing.T) {
+	var g *TopicGuard
+	if got := g.Match("借钱"); got != "" {
+		t.Errorf("nil guard matched %q", got)
+	}
+}
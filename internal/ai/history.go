@@ -0,0 +1,24 @@
+package ai
+
+import "google.golang.org/genai"
+
+// alternateTurns 整理发给模型的 contents：去掉空的、开头的 model turn，相邻同角色的合并成一轮（Parts 依次拼接），
+// 保证以 user 开头、user / model 交替，否则 API 可能返回 400（如上次回复失败后再次进入，末尾就有两个 user turn）
+func alternateTurns(contents []*genai.Content) []*genai.Content {
+	out := make([]*genai.Content, 0, len(contents))
+	for _, c := range contents {
+		if c == nil || len(c.Parts) == 0 {
+			continue
+		}
+		if len(out) == 0 && c.Role != genai.RoleUser {
+			continue
+		}
+		if n := len(out); n > 0 && out[n-1].Role == c.Role {
+			parts := append(append([]*genai.Part(nil), out[n-1].Parts...), c.Parts...)
+			out[n-1] = genai.NewContentFromParts(parts, genai.Role(c.Role))
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
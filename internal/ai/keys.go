@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadAPIKeysFile 从 CSV 文件读取 API key，每行一个（取第一列），# 开头为注释；
+// 文件内容以 [ 开头时按 JSON 字符串数组解析。读取后清零文件内容在内存中的副本
+func ReadAPIKeysFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read api keys file: %w", err)
+	}
+	defer func() {
+		for i := range data {
+			data[i] = 0
+		}
+	}()
+
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("[")) {
+		var keys []string
+		if err := json.Unmarshal(trimmed, &keys); err != nil {
+			return nil, fmt.Errorf("parse api keys file: %w", err)
+		}
+		return keys, nil
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	var keys []string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse api keys file: %w", err)
+		}
+		if len(record) == 0 {
+			continue
+		}
+		if key := strings.TrimSpace(record[0]); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/liao/style-bot/internal/rag"
+)
+
+// Language 消息的主要语言
+type Language string
+
+const (
+	LangUnknown Language = ""      // 没有文字（纯表情、数字等）
+	LangChinese Language = "zh"    // 中文
+	LangEnglish Language = "en"    // 英文
+	LangMixed   Language = "mixed" // 中英混杂
+)
+
+// mixedShare 少数一方占比不低于这个值时算中英混杂
+const mixedShare = 0.25
+
+// DetectLanguage 按字符粗略判断语言：一个汉字和一个英文单词各算一个词
+func DetectLanguage(text string) Language {
+	han, words := 0, 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+			inWord = false
+		case r < unicode.MaxASCII && unicode.IsLetter(r):
+			if !inWord {
+				words++
+			}
+			inWord = true
+		default:
+			inWord = false
+		}
+	}
+	total := han + words
+	switch {
+	case total == 0:
+		return LangUnknown
+	case float64(min(han, words)) >= mixedShare*float64(total):
+		return LangMixed
+	case han > words:
+		return LangChinese
+	}
+	return LangEnglish
+}
+
+// ParseLanguage 解析 reply_language 配置：空、auto 或不认识的值返回 LangUnknown（按消息检测）
+func ParseLanguage(s string) Language {
+	switch Language(s) {
+	case LangChinese, LangEnglish, LangMixed:
+		return Language(s)
+	}
+	return LangUnknown
+}
+
+// LanguageRule 追加到 system prompt 的语言提示，内置 prompt 本来就是中文，中文不用额外提示
+func LanguageRule(lang Language, forced bool) string {
+	switch lang {
+	case LangEnglish:
+		return "\n## 语言\n用英文回复，保持你平时的语气和习惯（简短、口语化，不要像翻译）。\n"
+	case LangMixed:
+		return "\n## 语言\n对方中英文混着说，你也可以自然地中英夹杂，参考示例里你平时中英混用的习惯。\n"
+	case LangChinese:
+		if forced {
+			return "\n## 语言\n不管对方用什么语言，都用中文回复。\n"
+		}
+	}
+	return ""
+}
+
+// SelectExamples 对方说英文或中英混杂时，优先用同样带英文的聊天示例；没有这样的示例时原样返回
+func SelectExamples(results []rag.Result, lang Language) []rag.Result {
+	if lang != LangEnglish && lang != LangMixed {
+		return results
+	}
+	var kept []rag.Result
+	for _, r := range results {
+		if l := DetectLanguage(stripSpeakers(r.Content)); l == LangEnglish || l == LangMixed {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == 0 {
+		return results
+	}
+	return kept
+}
+
+// stripSpeakers 去掉示例每行的 "名字：" 前缀，名字（如中文对话里的英文昵称）不算进语言判断
+func stripSpeakers(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if _, text, ok := strings.Cut(line, "："); ok {
+			lines[i] = text
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,39 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/liao/style-bot/internal/rag"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Language
+	}{
+		{"are you free this weekend", LangEnglish},
+		{"周末有空吗", LangChinese},
+		{"周末 go hiking 吗", LangMixed},
+		{"哈哈哈哈 ok", LangChinese},
+		{"😂 123", LangUnknown},
+	} {
+		if got := DetectLanguage(tc.in); got != tc.want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestSelectExamplesIgnoresSpeakerNames(t *testing.T) {
+	results := []rag.Result{
+		{ID: "zh", Content: "Bob Smith：今天吃什么\nAlice：火锅"},
+		{ID: "en", Content: "小王：are you free tonight\n我：sure"},
+		{ID: "mixed", Content: "小王：周末 go hiking 吗\n我：好"},
+	}
+	got := SelectExamples(results, LangEnglish)
+	if len(got) != 2 || got[0].ID != "en" || got[1].ID != "mixed" {
+		t.Errorf("selected %+v, want en and mixed", got)
+	}
+	if got := SelectExamples(results, LangChinese); len(got) != 3 {
+		t.Errorf("Chinese message filtered the examples: %+v", got)
+	}
+}
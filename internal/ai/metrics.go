@@ -0,0 +1,39 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"google.golang.org/genai"
+
+	"github.com/liao/style-bot/internal/metrics"
+)
+
+var (
+	geminiRequests = metrics.NewCounterVec("stylebot_gemini_requests_total",
+		"Gemini generation requests by model, key index and response code.", "model", "key", "code")
+	embeddingLatency = metrics.NewHistogram("stylebot_embedding_latency_seconds",
+		"Embedding latency, including retries.", metrics.LatencyBuckets)
+	rateLimitTokens = metrics.NewGauge("stylebot_rate_limit_tokens_remaining",
+		"Requests left in the current rate limit window.")
+	geminiTokens = metrics.NewCounterVec("stylebot_gemini_tokens_total",
+		"Gemini token usage by kind.", "kind")
+	geminiRateLimited = metrics.NewCounter("stylebot_gemini_rate_limited_total",
+		"Gemini 429 responses.")
+)
+
+// responseCode gemini_requests_total 的 code 标签：HTTP 状态码，超时为 timeout，其他错误为 error
+func responseCode(err error) string {
+	if err == nil {
+		return "200"
+	}
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) && apiErr.Code != 0 {
+		return strconv.Itoa(apiErr.Code)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return "error"
+}
@@ -3,48 +3,108 @@ package ai
 import (
 	"fmt"
 	"strings"
-)
+	"time"
 
-// BuildSystemPrompt 组装完整的 System Prompt
-func BuildSystemPrompt(myName, targetName string, styleProfile string, relationship string, ragExamples []string) string {
-	var b strings.Builder
+	"github.com/liao/style-bot/internal/rag"
+)
 
-	// 身份定义
-	fmt.Fprintf(&b, "你是%s本人，正在通过 QQ 和%s聊天。\n", myName, targetName)
-	b.WriteString("你必须完全模仿" + myName + "的说话风格。不要暴露你是 AI。\n")
-	b.WriteString("如果被问到是不是机器人，用" + myName + "的风格否认。\n\n")
+// RolePlayContext 组装 System Prompt 需要的信息
+type RolePlayContext struct {
+	MyName              string
+	TargetName          string
+	StyleProfile        string
+	RelationshipProfile string
+	Summary             string // 当前会话的滚动摘要，可为空
+	RAGExamples         []rag.Result
+	CurrentDateTime     time.Time // 非零时在开头加一行 "# Current time: Monday 15:30"
+	DebugMode           bool      // 在开头加 RAG 检索信息，模板 WithDebug 时总是加
+}
 
-	// 风格档案
-	if styleProfile != "" {
-		b.WriteString("## 你的说话风格\n")
-		b.WriteString(styleProfile)
-		b.WriteString("\n\n")
+// BuildSystemPrompt 用内置模板组装完整的 System Prompt
+func BuildSystemPrompt(ctx RolePlayContext) string {
+	prompt, err := DefaultPromptTemplate().Build(ctx)
+	if err != nil {
+		logger.Error("render builtin prompt template failed", "error", err)
 	}
+	return prompt
+}
 
-	// 关系记忆
-	if relationship != "" {
-		fmt.Fprintf(&b, "## 你和%s的关系\n", targetName)
-		b.WriteString(relationship)
-		b.WriteString("\n\n")
+// Build 组装完整的 System Prompt
+func (t *PromptTemplate) Build(rc RolePlayContext) (string, error) {
+	prompt, err := t.execute(rc.RAGExamples, rc.DebugMode, PromptData{
+		MyName:       rc.MyName,
+		TargetName:   rc.TargetName,
+		Identity:     identityText(t.disclosure, rc.MyName, rc.TargetName),
+		Style:        rc.StyleProfile,
+		Relationship: rc.RelationshipProfile,
+		Summary:      rc.Summary,
+		Examples:     promptExamples(rc.RAGExamples),
+		Rules:        t.rules(),
+	})
+	if err != nil || rc.CurrentDateTime.IsZero() {
+		return prompt, err
 	}
+	return TimeHeader(rc.CurrentDateTime) + "\n" + prompt, nil
+}
 
-	// RAG 示例
-	if len(ragExamples) > 0 {
-		b.WriteString("## 你在类似场景下的真实回复示例\n")
-		for i, ex := range ragExamples {
-			fmt.Fprintf(&b, "示例%d：\n%s\n\n", i+1, ex)
-		}
+// TimeHeader 让回复知道现在是星期几、几点：# Current time: Monday 15:30
+func TimeHeader(t time.Time) string {
+	return "# Current time: " + t.Format("Monday 15:04")
+}
+
+// BuildGroup 组装群聊用的 System Prompt：senderName 是叫你的人，recent 为最近的群消息
+func (t *PromptTemplate) BuildGroup(myName, senderName string, styleProfile string, relationship string, recent []string, ragExamples []rag.Result) (string, error) {
+	return t.execute(ragExamples, false, PromptData{
+		MyName:       myName,
+		TargetName:   senderName,
+		Identity:     identityText(t.disclosure, myName, senderName),
+		Style:        styleProfile,
+		Relationship: relationship,
+		Group:        recent,
+		Examples:     promptExamples(ragExamples),
+		Rules:        t.rules(),
+	})
+}
+
+// execute 渲染模板，调试模式（debug 或 WithDebug）下在开头加 RAG 检索信息
+func (t *PromptTemplate) execute(ragExamples []rag.Result, debug bool, data PromptData) (string, error) {
+	prompt, err := t.Execute(data)
+	if err != nil || !(debug || t.debug) {
+		return prompt, err
 	}
+	return RAGHeader(ragExamples) + "\n" + prompt, nil
+}
 
-	// 规则
-	b.WriteString("## 回复规则\n")
-	b.WriteString("1. 严格模仿上面的风格示例来回复\n")
-	b.WriteString("2. 保持消息简短\n")
-	b.WriteString("3. 最多发2-3条短消息，用 ||| 分隔，不要超过3条\n")
-	b.WriteString("4. 不知道的事情就含糊带过，不要编造具体细节\n")
-	b.WriteString("5. 绝不使用：敬语、长段落、列表格式、\"我理解你的感受\" 等 AI 味表达\n")
+// RAGHeader 调试用的 RAG 检索摘要：# RAG: retrieved N examples (min_sim=X, max_sim=Y)
+func RAGHeader(ragExamples []rag.Result) string {
+	if len(ragExamples) == 0 {
+		return "# RAG: retrieved 0 examples"
+	}
+	minSim, maxSim := ragExamples[0].Similarity, ragExamples[0].Similarity
+	for _, r := range ragExamples[1:] {
+		minSim = min(minSim, r.Similarity)
+		maxSim = max(maxSim, r.Similarity)
+	}
+	return fmt.Sprintf("# RAG: retrieved %d examples (min_sim=%.2f, max_sim=%.2f)", len(ragExamples), minSim, maxSim)
+}
 
-	return b.String()
+// promptExamples 把 RAG 结果转换为模板示例
+func promptExamples(ragExamples []rag.Result) []PromptExample {
+	// RAG 示例保持检索管线给出的顺序（时间衰减、情绪加权、MMR、重排后的 Score），第一条标注最相似
+	examples := make([]PromptExample, 0, len(ragExamples))
+	for i, ex := range ragExamples {
+		label := fmt.Sprintf("相似度%.2f", ex.Similarity)
+		if i == 0 {
+			label = "最相似，" + label
+		}
+		examples = append(examples, PromptExample{
+			Index:      i + 1,
+			Label:      label,
+			Content:    ex.Content,
+			Similarity: ex.Similarity,
+		})
+	}
+	return examples
 }
 
 // SplitMultiMessage 按 ||| 分割多条消息
@@ -67,21 +127,32 @@ func SplitMultiMessage(reply string) []string {
 	return result
 }
 
+// aiPatterns 明显的 AI 味表达
+var aiPatterns = []string{
+	"作为一个AI",
+	"作为AI",
+	"我理解你的感受",
+	"我很高兴",
+	"我很抱歉",
+	"如果你有任何",
+	"请随时",
+	"希望这对你有帮助",
+	"有什么我可以帮助",
+}
+
 // FilterAIPatterns 过滤明显的 AI 味表达
 func FilterAIPatterns(reply string) string {
-	aiPatterns := []string{
-		"作为一个AI",
-		"作为AI",
-		"我理解你的感受",
-		"我很高兴",
-		"我很抱歉",
-		"如果你有任何",
-		"请随时",
-		"希望这对你有帮助",
-		"有什么我可以帮助",
-	}
 	for _, p := range aiPatterns {
 		reply = strings.ReplaceAll(reply, p, "")
 	}
 	return strings.TrimSpace(reply)
 }
+
+// CountAIPatterns 统计文本里 AI 味表达出现的次数（评估用，FilterAIPatterns 之前的文本）
+func CountAIPatterns(text string) int {
+	n := 0
+	for _, p := range aiPatterns {
+		n += strings.Count(text, p)
+	}
+	return n
+}
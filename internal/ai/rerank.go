@@ -0,0 +1,58 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+const rerankPrompt = "你是聊天记录检索的相关性评分器。给出对方刚发的一条消息和若干段历史对话，" +
+	"判断每段对话作为回复这条消息的参考有多合适：话题、语气和情境都要对得上（对方在开玩笑时，吵架的对话不合适）。" +
+	"按顺序给每段打 0-10 分，输出与对话数量相同的 JSON 数字数组。"
+
+// rerankSchema 结构化输出：与候选一一对应的分数数组
+var rerankSchema = &genai.Schema{
+	Type:  genai.TypeArray,
+	Items: &genai.Schema{Type: genai.TypeNumber},
+}
+
+// ScoreRelevance 用最便宜的聊天模型（chat_models 的最后一个）给每段候选对话打 0-10 的相关分，结果与 snippets 一一对应；
+// 供 rag.Pipeline 重排检索结果，签名与 rag.RerankFunc 一致
+func (c *Client) ScoreRelevance(ctx context.Context, query string, snippets []string) ([]float32, error) {
+	if err := c.waitForToken(ctx); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "对方的消息：%s\n", query)
+	for i, s := range snippets {
+		fmt.Fprintf(&b, "\n=== 对话 %d ===\n%s\n", i+1, s)
+	}
+
+	model := c.chatModels[len(c.chatModels)-1]
+	cfg := &genai.GenerateContentConfig{
+		SystemInstruction: genai.NewContentFromText(rerankPrompt, genai.RoleUser),
+		Temperature:       genai.Ptr(float32(0)),
+		ResponseMIMEType:  "application/json",
+		ResponseSchema:    rerankSchema,
+	}
+	reqCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	resp, err := c.clients[0].Models.GenerateContent(reqCtx, model,
+		[]*genai.Content{genai.NewContentFromText(b.String(), genai.RoleUser)}, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("score relevance: %w", err)
+	}
+	c.usage.add(resp.UsageMetadata)
+
+	var scores []float32
+	if err := json.Unmarshal([]byte(strings.TrimSpace(resp.Text())), &scores); err != nil {
+		return nil, fmt.Errorf("parse relevance scores: %w", err)
+	}
+	if len(scores) != len(snippets) {
+		return nil, fmt.Errorf("got %d relevance scores for %d snippets", len(scores), len(snippets))
+	}
+	return scores, nil
+}
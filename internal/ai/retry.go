@@ -0,0 +1,84 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	chromem "github.com/philippgille/chromem-go"
+)
+
+// RetryPolicy 指数退避重试策略
+type RetryPolicy struct {
+	MaxAttempts int           // 总尝试次数，含第一次
+	BaseDelay   time.Duration // 第一次重试前的等待，之后每次翻倍
+	MaxDelay    time.Duration // 等待上限，0 = 不限制
+	Jitter      float64       // 随机抖动比例，0.2 表示 ±20%
+}
+
+// DefaultRetryPolicy 默认：3 次，1s 起翻倍，最多 30s，±20% 抖动
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second, Jitter: 0.2}
+}
+
+// withDefaults 未配置的字段用默认值
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	d := DefaultRetryPolicy()
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = d.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = d.BaseDelay
+	}
+	return p
+}
+
+// delay 第 attempt 次失败后（从 0 开始）的等待时间
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay << attempt
+	if p.MaxDelay > 0 && (d > p.MaxDelay || d <= 0) {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return d
+}
+
+// Do 执行 fn，失败时按策略退避重试；等待期间 ctx 取消立即返回
+func (p RetryPolicy) Do(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	p = p.withDefaults()
+	var lastErr error
+	for attempt := 0; attempt < p.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			wait := p.delay(attempt - 1)
+			logger.Warn(name+" failed, retrying", "attempt", attempt, "wait", wait, "error", lastErr)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		if lastErr = fn(ctx); lastErr == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("%s failed after %d attempts: %w", name, p.MaxAttempts, lastErr)
+}
+
+// RetryEmbed 给 embedding 函数加上重试
+func RetryEmbed(embed chromem.EmbeddingFunc, p RetryPolicy) chromem.EmbeddingFunc {
+	return func(ctx context.Context, text string) ([]float32, error) {
+		var vec []float32
+		err := p.Do(ctx, "embed", func(ctx context.Context) error {
+			var err error
+			vec, err = embed(ctx, text)
+			return err
+		})
+		return vec, err
+	}
+}
@@ -0,0 +1,22 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const rewriteQueryPrompt = "你是检索助手。根据下面的聊天记录，把最后一条消息改写成一句能独立理解的检索语句，补全省略的话题和指代（如\"好啊\"→\"周末一起去爬山好啊\"）。只输出改写后的句子，不要其他内容。"
+
+// RewriteQuery 用模型把最近几轮对话（从旧到新）改写成检索语句，供 rag.query_rewrite 使用
+func (c *Client) RewriteQuery(ctx context.Context, turns []string) (string, error) {
+	text, err := c.GenerateChat(ctx, rewriteQueryPrompt, nil, strings.Join(turns, "\n"))
+	if err != nil {
+		return "", fmt.Errorf("rewrite query: %w", err)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("rewrite query: empty output")
+	}
+	return text, nil
+}
@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// 对话情绪标签：导入时标注在向量文档的 metadata["sentiment"]，检索时优先同样情绪的示例
+const (
+	SentimentPositive = "positive"
+	SentimentNeutral  = "neutral"
+	SentimentNegative = "negative"
+	SentimentPlayful  = "playful"
+)
+
+// Sentiments 全部情绪标签
+var Sentiments = []string{SentimentPositive, SentimentNeutral, SentimentNegative, SentimentPlayful}
+
+// ParseSentiment 规范化模型输出的标签，认不出时返回空
+func ParseSentiment(s string) string {
+	s = strings.ToLower(strings.Trim(strings.TrimSpace(s), `"'.。`))
+	if slices.Contains(Sentiments, s) {
+		return s
+	}
+	return ""
+}
+
+const sentimentPrompt = "你是聊天情绪分类器。判断这条私聊消息的情绪，只输出 positive、neutral、negative、playful 之一，不要其他内容。"
+
+// SetSentimentModel ClassifySentiment 用的模型（gemini.sentiment_model），为空时用聊天模型
+func (c *Client) SetSentimentModel(model string) {
+	c.sentimentModel = model
+}
+
+// ClassifySentiment 用模型判断一条消息的情绪，返回 Sentiments 之一
+func (c *Client) ClassifySentiment(ctx context.Context, msg string) (string, error) {
+	text, err := c.classify(ctx, msg)
+	if err != nil {
+		return "", fmt.Errorf("classify sentiment: %w", err)
+	}
+	s := ParseSentiment(text)
+	if s == "" {
+		return "", fmt.Errorf("unknown sentiment %q", text)
+	}
+	return s, nil
+}
+
+// classify 用情绪模型回答 sentimentPrompt；没设情绪模型时走聊天模型
+func (c *Client) classify(ctx context.Context, msg string) (string, error) {
+	if c.sentimentModel == "" {
+		return c.GenerateChat(ctx, sentimentPrompt, nil, msg)
+	}
+	if err := c.waitForToken(ctx); err != nil {
+		return "", err
+	}
+	reqCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	resp, err := c.clients[0].Models.GenerateContent(reqCtx, c.sentimentModel,
+		[]*genai.Content{genai.NewContentFromText(msg, genai.RoleUser)},
+		&genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText(sentimentPrompt, genai.RoleUser),
+			Temperature:       genai.Ptr(float32(0)),
+		})
+	if err != nil {
+		return "", err
+	}
+	c.usage.add(resp.UsageMetadata)
+	return resp.Text(), nil
+}
+
+// SentimentBatchPrompt 一次标注多段对话的 prompt，模型输出与对话顺序一致的 JSON 字符串数组
+func SentimentBatchPrompt(conversations []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "下面是 %d 段聊天记录。判断每段对话整体的情绪，从 positive、neutral、negative、playful 中选一个。\n"+
+		"只输出一个 JSON 字符串数组，按顺序每段一个标签，例如 [\"neutral\",\"playful\"]，不要其他内容。\n", len(conversations))
+	for i, c := range conversations {
+		fmt.Fprintf(&b, "\n=== 对话 %d ===\n%s\n", i+1, c)
+	}
+	return b.String()
+}
+
+// ParseSentimentBatch 解析 SentimentBatchPrompt 的输出；数量不对时返回错误，认不出的标签为空
+func ParseSentimentBatch(text string, n int) ([]string, error) {
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.Trim(strings.TrimSpace(text), "`")
+	var labels []string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &labels); err != nil {
+		return nil, fmt.Errorf("parse sentiment labels: %w", err)
+	}
+	if len(labels) != n {
+		return nil, fmt.Errorf("got %d sentiment labels for %d conversations", len(labels), n)
+	}
+	for i, l := range labels {
+		labels[i] = ParseSentiment(l)
+	}
+	return labels, nil
+}
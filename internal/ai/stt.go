@@ -0,0 +1,67 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+const transcribePrompt = "你是语音转写助手。把这段语音逐字转写成中文文本，保留口语和语气词。只输出转写内容，听不清就输出空。"
+
+var sttHTTPClient = &http.Client{Timeout: 60 * time.Second}
+
+// Transcribe 用 Gemini 的音频理解把语音转成文字
+func (c *Client) Transcribe(ctx context.Context, audio []byte, mimeType string) (string, error) {
+	text, _, err := c.generate(ctx, transcribePrompt, nil, []*genai.Part{genai.NewPartFromBytes(audio, mimeType)})
+	if err != nil {
+		return "", fmt.Errorf("transcribe: %w", err)
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// TranscribeWhisper 调本地 whisper 服务（OpenAI 兼容的 /v1/audio/transcriptions 接口）
+func TranscribeWhisper(ctx context.Context, url string, audio []byte, filename string) (string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fw, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return "", fmt.Errorf("create form file: %w", err)
+	}
+	if _, err := fw.Write(audio); err != nil {
+		return "", fmt.Errorf("write form file: %w", err)
+	}
+	_ = w.WriteField("language", "zh")
+	_ = w.WriteField("response_format", "json")
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("close form: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return "", fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	resp, err := sttHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("whisper request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("whisper request: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode whisper response: %w", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
@@ -0,0 +1,200 @@
+package ai
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// defaultRules 内置回复规则，自定义模板可通过 {{.Rules}} 引用
+const defaultRules = `1. 严格模仿上面的风格示例来回复
+2. 保持消息简短
+3. 最多发2-3条短消息，用 ||| 分隔，不要超过3条
+4. 不知道的事情就含糊带过，不要编造具体细节
+5. 绝不使用：敬语、长段落、列表格式、"我理解你的感受" 等 AI 味表达
+`
+
+// DisclosureMode 被问到是不是 AI 时的应对方式
+type DisclosureMode string
+
+const (
+	DisclosureDeny    DisclosureMode = "deny"    // 否认（默认）
+	DisclosureDeflect DisclosureMode = "deflect" // 岔开话题，不正面撒谎
+	DisclosureHonest  DisclosureMode = "honest"  // 如实承认是 AI
+)
+
+// ParseDisclosureMode 解析配置值，空字符串视为 deny
+func ParseDisclosureMode(s string) (DisclosureMode, error) {
+	switch m := DisclosureMode(s); m {
+	case "":
+		return DisclosureDeny, nil
+	case DisclosureDeny, DisclosureDeflect, DisclosureHonest:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown disclosure mode %q (want deny, deflect or honest)", s)
+	}
+}
+
+// identityText 按披露模式生成身份定义段落
+func identityText(mode DisclosureMode, myName, targetName string) string {
+	switch mode {
+	case DisclosureDeflect:
+		return fmt.Sprintf("你正在用%s的身份通过 QQ 和%s聊天。\n"+
+			"你必须完全模仿%s的说话风格。\n"+
+			"如果被问到是不是机器人，不要正面回答，用%s的风格开个玩笑或岔开话题，但不要斩钉截铁地说自己是真人。",
+			myName, targetName, myName, myName)
+	case DisclosureHonest:
+		return fmt.Sprintf("你是%s设置的 AI 聊天助手，正在通过 QQ 和%s聊天。\n"+
+			"你用%s的说话风格回复。\n"+
+			"如果被问到是不是机器人，如实承认你是 AI，语气保持%s的风格。",
+			myName, targetName, myName, myName)
+	default:
+		return fmt.Sprintf("你是%s本人，正在通过 QQ 和%s聊天。\n"+
+			"你必须完全模仿%s的说话风格。不要暴露你是 AI。\n"+
+			"如果被问到是不是机器人，用%s的风格否认。",
+			myName, targetName, myName, myName)
+	}
+}
+
+// defaultTemplate 内置 system prompt 模板
+const defaultTemplate = `{{.Identity}}
+
+{{if .Style}}## 你的说话风格
+{{.Style}}
+
+{{end}}{{if .Relationship}}## 你和{{.TargetName}}的关系
+{{.Relationship}}
+
+{{end}}{{if .Summary}}## 当前对话背景
+{{.Summary}}
+
+{{end}}{{if .Group}}## 群聊
+你现在在 QQ 群里，{{.TargetName}} @ 了你或叫了你的名字。群里说话更随意、更短，只回应叫你的这条，不要去接别人之间的话，也不要 @ 任何人。
+最近的群消息：
+{{range .Group}}{{.}}
+{{end}}
+{{end}}{{if .Examples}}## 你在类似场景下的真实回复示例（按相关度排序，越靠前越要参考）
+{{range .Examples}}示例{{.Index}}（{{.Label}}）：
+{{.Content}}
+
+{{end}}{{end}}## 回复规则
+{{.Rules}}`
+
+// PromptData 模板可用的字段
+type PromptData struct {
+	MyName       string
+	TargetName   string
+	Identity     string // 身份定义，随 disclosure_mode 变化
+	Style        string
+	Relationship string
+	Summary      string   // 当前会话的滚动摘要，可为空
+	Group        []string // 群聊时最近的群消息（"名字：内容"），私聊为空
+	Examples     []PromptExample
+	Rules        string
+}
+
+// PromptExample 一条 RAG 示例，按检索管线的得分排序
+type PromptExample struct {
+	Index      int // 从 1 开始
+	Label      string
+	Content    string
+	Similarity float32
+}
+
+// PromptTemplate system prompt 模板
+type PromptTemplate struct {
+	tmpl       *template.Template
+	disclosure DisclosureMode
+	extraRules []string // 追加在内置规则后的规则
+	debug      bool     // 在 prompt 开头加 RAG 检索信息，便于排查
+}
+
+var builtinTemplate = template.Must(template.New("system").Parse(defaultTemplate))
+
+// DefaultPromptTemplate 返回内置模板
+func DefaultPromptTemplate() *PromptTemplate {
+	return &PromptTemplate{tmpl: builtinTemplate, disclosure: DisclosureDeny}
+}
+
+// LoadPromptTemplate 从文件加载模板；path 为空时使用内置模板
+// 加载后用示例数据试渲染一次，字段写错会在启动时报错
+func LoadPromptTemplate(path string, mode DisclosureMode) (*PromptTemplate, error) {
+	if path == "" {
+		return &PromptTemplate{tmpl: builtinTemplate, disclosure: mode}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read prompt template: %w", err)
+	}
+	tmpl, err := template.New("system").Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse prompt template: %w", err)
+	}
+	t := &PromptTemplate{tmpl: tmpl, disclosure: mode}
+
+	sample := PromptData{
+		MyName:       "我",
+		TargetName:   "对方",
+		Identity:     identityText(mode, "我", "对方"),
+		Style:        "- 消息长度：短",
+		Relationship: "- 关系：朋友",
+		Summary:      "在聊周末去哪玩",
+		Group:        []string{"小王：周末去哪", "对方：爬山吧"},
+		Examples:     []PromptExample{{Index: 1, Label: "最相似", Content: "对方：在吗\n我：在", Similarity: 1}},
+		Rules:        defaultRules,
+	}
+	if _, err := t.Execute(sample); err != nil {
+		return nil, fmt.Errorf("validate prompt template: %w", err)
+	}
+	return t, nil
+}
+
+// WithRules 返回追加了额外回复规则的模板副本
+func (t *PromptTemplate) WithRules(rules ...string) *PromptTemplate {
+	c := *t
+	c.extraRules = append(append([]string(nil), t.extraRules...), rules...)
+	return &c
+}
+
+// WithDebug 返回开启调试头的模板副本：prompt 开头附加 "# RAG: ..." 检索信息
+func (t *PromptTemplate) WithDebug() *PromptTemplate {
+	c := *t
+	c.debug = true
+	return &c
+}
+
+// Builtin 返回换成内置模板的副本，披露模式、追加规则和调试头不变；自定义模板渲染失败时用它兜底
+func (t *PromptTemplate) Builtin() *PromptTemplate {
+	c := *t
+	c.tmpl = builtinTemplate
+	return &c
+}
+
+// rules 内置规则 + 追加规则，按序编号
+func (t *PromptTemplate) rules() string {
+	if len(t.extraRules) == 0 {
+		return defaultRules
+	}
+	var b strings.Builder
+	b.WriteString(defaultRules)
+	n := strings.Count(defaultRules, "\n")
+	for i, r := range t.extraRules {
+		fmt.Fprintf(&b, "%d. %s\n", n+i+1, r)
+	}
+	return b.String()
+}
+
+// Disclosure 返回模板使用的披露模式
+func (t *PromptTemplate) Disclosure() DisclosureMode {
+	return t.disclosure
+}
+
+// Execute 渲染模板
+func (t *PromptTemplate) Execute(data PromptData) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
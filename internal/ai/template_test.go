@@ -0,0 +1,83 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/liao/style-bot/internal/rag"
+)
+
+func TestDisclosureModeIdentity(t *testing.T) {
+	for _, tc := range []struct {
+		mode      string
+		want      string
+		forbidden string
+	}{
+		{"", "你是阿亮本人", "AI 聊天助手"},
+		{"deny", "用阿亮的风格否认", "如实承认"},
+		{"deflect", "不要正面回答", "不要暴露你是 AI"},
+		{"honest", "如实承认你是 AI", "不要暴露你是 AI"},
+	} {
+		mode, err := ParseDisclosureMode(tc.mode)
+		if err != nil {
+			t.Fatalf("ParseDisclosureMode(%q): %v", tc.mode, err)
+		}
+		tmpl, err := LoadPromptTemplate("", mode)
+		if err != nil {
+			t.Fatalf("load template for %q: %v", tc.mode, err)
+		}
+		prompt, err := tmpl.Build(RolePlayContext{MyName: "阿亮", TargetName: "小王"})
+		if err != nil {
+			t.Fatalf("build prompt for %q: %v", tc.mode, err)
+		}
+		if !strings.HasPrefix(prompt, identityText(mode, "阿亮", "小王")) {
+			t.Errorf("mode %q: prompt does not start with its identity text:\n%s", tc.mode, prompt)
+		}
+		if !strings.Contains(prompt, tc.want) {
+			t.Errorf("mode %q: prompt missing %q:\n%s", tc.mode, tc.want, prompt)
+		}
+		if strings.Contains(prompt, tc.forbidden) {
+			t.Errorf("mode %q: prompt contains %q from another mode:\n%s", tc.mode, tc.forbidden, prompt)
+		}
+	}
+}
+
+func TestParseDisclosureModeRejectsUnknown(t *testing.T) {
+	if _, err := ParseDisclosureMode("lie"); err == nil {
+		t.Error("ParseDisclosureMode(\"lie\") returned no error")
+	}
+}
+
+func TestBuildKeepsPipelineExampleOrder(t *testing.T) {
+	// 重排后得分高的排在前面，即使原始相似度更低
+	prompt, err := DefaultPromptTemplate().Build(RolePlayContext{MyName: "我", TargetName: "小王", RAGExamples: []rag.Result{
+		{Content: "小王: 周末爬山\n我: 走起", Similarity: 0.6, Score: 0.9},
+		{Content: "小王: 早安\n我: 早", Similarity: 0.8, Score: 0.5},
+	}})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	hike, morning := strings.Index(prompt, "周末爬山"), strings.Index(prompt, "早安")
+	if hike < 0 || morning < 0 || hike > morning {
+		t.Errorf("examples reordered by similarity:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "示例1（最相似，相似度0.60）") {
+		t.Errorf("first example not labelled most similar:\n%s", prompt)
+	}
+}
+
+func TestBuiltinKeepsRulesAndDebug(t *testing.T) {
+	tmpl, err := LoadPromptTemplate("", DisclosureHonest)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	prompt, err := tmpl.WithRules("不要发语音").WithDebug().Builtin().Build(RolePlayContext{MyName: "阿亮", TargetName: "小王"})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	for _, want := range []string{"# RAG:", "6. 不要发语音", "如实承认你是 AI"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("builtin fallback missing %q:\n%s", want, prompt)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package ai
+
+import (
+	"sync"
+
+	"google.golang.org/genai"
+)
+
+// UsageStats 累计 token 用量，思考 token 单独统计
+type UsageStats struct {
+	Requests       int64
+	PromptTokens   int64
+	OutputTokens   int64
+	ThoughtsTokens int64 // thinking 模式消耗的 token
+	TotalTokens    int64
+}
+
+// Add 累加一次响应的用量
+func (u *UsageStats) Add(md *genai.GenerateContentResponseUsageMetadata) {
+	u.Requests++
+	if md == nil {
+		return
+	}
+	u.PromptTokens += int64(md.PromptTokenCount)
+	u.OutputTokens += int64(md.CandidatesTokenCount)
+	u.ThoughtsTokens += int64(md.ThoughtsTokenCount)
+	u.TotalTokens += int64(md.TotalTokenCount)
+}
+
+// usageCounter 并发安全的 UsageStats
+type usageCounter struct {
+	mu    sync.Mutex
+	stats UsageStats
+}
+
+func (c *usageCounter) add(md *genai.GenerateContentResponseUsageMetadata) {
+	c.mu.Lock()
+	c.stats.Add(md)
+	c.mu.Unlock()
+	if md != nil {
+		geminiTokens.Add(int64(md.PromptTokenCount), "prompt")
+		geminiTokens.Add(int64(md.CandidatesTokenCount), "output")
+		geminiTokens.Add(int64(md.ThoughtsTokenCount), "thoughts")
+	}
+}
+
+func (c *usageCounter) snapshot() UsageStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
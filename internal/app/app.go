@@ -0,0 +1,155 @@
+// Package app 按配置组装 AI 客户端、RAG、persona 和 bot，cmd/bot、cmd/eval、cmd/chat-cli、cmd/vector-inspect 共用，
+// 保证各命令和线上 bot 的检索、生成方式一致
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/philippgille/chromem-go"
+
+	"github.com/liao/style-bot/internal/ai"
+	"github.com/liao/style-bot/internal/bot"
+	"github.com/liao/style-bot/internal/chat"
+	"github.com/liao/style-bot/internal/config"
+	"github.com/liao/style-bot/internal/coord"
+	"github.com/liao/style-bot/internal/logging"
+	"github.com/liao/style-bot/internal/persona"
+	"github.com/liao/style-bot/internal/rag"
+)
+
+var logger = logging.For("app")
+
+// NewAIClient 按 gemini 配置创建客户端；extraKeys（如 -api-keys-json）和环境变量 GEMINI_API_KEY2 追加在 gemini.api_keys 之后
+func NewAIClient(ctx context.Context, cfg *config.Config, extraKeys []string) (*ai.Client, error) {
+	chatModels := cfg.Gemini.ChatModels
+	if len(chatModels) == 0 && cfg.Gemini.ChatModel != "" {
+		chatModels = []string{cfg.Gemini.ChatModel}
+	}
+	apiKeys := config.MergeAPIKeys(cfg.Gemini.APIKeys, extraKeys)
+	if key2 := os.Getenv("GEMINI_API_KEY2"); key2 != "" {
+		apiKeys = append(apiKeys, key2)
+	}
+	client, err := ai.NewClient(ctx, ai.ClientOptions{
+		APIKeys:        apiKeys,
+		APIKeysFile:    cfg.Gemini.APIKeysFile,
+		ChatModels:     chatModels,
+		EmbedModel:     cfg.Gemini.EmbeddingModel,
+		OllamaURL:      cfg.Gemini.OllamaURL,
+		EmbedDim:       cfg.Gemini.EmbeddingDim,
+		Temperature:    cfg.Gemini.Temperature,
+		MaxTokens:      cfg.Gemini.MaxOutputTokens,
+		RPMLimit:       cfg.Gemini.RPMLimit,
+		RequestTimeout: cfg.Gemini.RequestTimeout,
+		EmbedRetry: ai.RetryPolicy{
+			MaxAttempts: cfg.Gemini.EmbedRetry.MaxAttempts,
+			BaseDelay:   cfg.Gemini.EmbedRetry.BaseDelay,
+			MaxDelay:    cfg.Gemini.EmbedRetry.MaxDelay,
+			Jitter:      cfg.Gemini.EmbedRetry.Jitter,
+		},
+		StopSequences: cfg.Gemini.StopSequences,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create AI client: %w", err)
+	}
+	client.SetSentimentModel(cfg.Gemini.SentimentModel)
+	return client, nil
+}
+
+// EmbedFunc 与向量库一致的 embedding 函数（按 rag.strip_emoji 清理文本）
+func EmbedFunc(cfg *config.Config, client *ai.Client) chromem.EmbeddingFunc {
+	return rag.NormalizedEmbedding(client.EmbedFunc(), cfg.RAG.StripEmoji)
+}
+
+// NewPipeline 按 rag 配置在 store 上建检索流程（rerank、过滤条件）；store 为 nil 时检索关闭
+func NewPipeline(cfg *config.Config, client *ai.Client, store rag.VectorStore) *rag.Pipeline {
+	rc := cfg.RAG
+	p := rag.NewPipeline(store, rc.TopK, rc.MinSimilarity, rc.StrongSimilarity, rc.StripEmoji, rc.RecencyHalfLifeDays, rc.MMRLambda)
+	if rc.Rerank {
+		p.SetReranker(client.ScoreRelevance, rc.RerankMinScore, rc.RerankBudget)
+	}
+	minDate, maxDate := rc.Filter.DateRange()
+	p.SetFilter(rag.QueryOptions{MinDate: minDate, MaxDate: maxDate, MinMsgCount: rc.Filter.MinMsgCount, SourceTag: rc.Filter.Source})
+	return p
+}
+
+// OpenPipeline 打开 vectorsDir 的向量库并建检索流程。向量库与 embedding 模型不一致时返回 rag.ErrEmbeddingMismatch，
+// 其他打开失败只记日志，返回关闭检索的流程
+func OpenPipeline(cfg *config.Config, client *ai.Client, vectorsDir string) (*rag.Pipeline, error) {
+	store, err := rag.OpenStore(cfg.RAG.Backend, vectorsDir, EmbedFunc(cfg, client), client.EmbeddingModel())
+	if errors.Is(err, rag.ErrEmbeddingMismatch) {
+		return nil, err
+	}
+	if err != nil {
+		logger.Warn("load vector store failed, RAG disabled", "dir", vectorsDir, "error", err)
+		store = nil
+	}
+	return NewPipeline(cfg, client, store), nil
+}
+
+// LoadPersona 读取 data.persona_file，没配置或读取失败时为 nil（用默认人设）
+func LoadPersona(cfg *config.Config) *persona.Persona {
+	if cfg.Data.PersonaFile == "" {
+		return nil
+	}
+	p, err := persona.LoadFromFile(cfg.Data.PersonaFile)
+	if err != nil {
+		logger.Warn("load persona failed, using default", "error", err)
+		return nil
+	}
+	return p
+}
+
+// PromptTemplate 按 bot.prompt_template 和 bot.disclosure_mode 加载 system prompt 模板
+func PromptTemplate(cfg *config.Config) (*ai.PromptTemplate, error) {
+	disclosure, err := ai.ParseDisclosureMode(cfg.Bot.DisclosureMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bot.disclosure_mode: %w", err)
+	}
+	tmpl, err := ai.LoadPromptTemplate(cfg.Bot.PromptTemplate, disclosure)
+	if err != nil {
+		return nil, fmt.Errorf("load prompt template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Bot 组装好的 bot 和它的依赖，命令按需取用
+type Bot struct {
+	*bot.Bot
+	AI      *ai.Client
+	RAG     *rag.Pipeline
+	Embed   chromem.EmbeddingFunc
+	Persona *persona.Persona
+}
+
+// NewBot 按配置组装 bot：AI 客户端、RAG（含 <QQ号>/vectors 单独的向量库）、persona 和 prompt 模板；c 为 nil 时单实例
+func NewBot(ctx context.Context, cfg *config.Config, chatMgr *chat.Manager, c coord.Coordinator, extraKeys []string) (*Bot, error) {
+	client, err := NewAIClient(ctx, cfg, extraKeys)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := OpenPipeline(cfg, client, cfg.RAG.VectorsDir)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := PromptTemplate(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := LoadPersona(cfg)
+
+	b, err := bot.New(cfg, client, chatMgr, pipeline, p, tmpl, c)
+	if err != nil {
+		return nil, fmt.Errorf("create bot: %w", err)
+	}
+	b.LoadPeerPipelines(func(vectorsDir string) (*rag.Pipeline, error) {
+		store, err := rag.OpenStore(cfg.RAG.Backend, vectorsDir, EmbedFunc(cfg, client), client.EmbeddingModel())
+		if err != nil {
+			return nil, err
+		}
+		return NewPipeline(cfg, client, store), nil
+	})
+	return &Bot{Bot: b, AI: client, RAG: pipeline, Embed: EmbedFunc(cfg, client), Persona: p}, nil
+}
@@ -0,0 +1,125 @@
+package bot
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liao/style-bot/internal/chat"
+)
+
+// peerAccess 私聊对象的处理方式
+type peerAccess int
+
+const (
+	peerDenied   peerAccess = iota // 不回复
+	peerTarget                     // 用人设回复
+	peerStranger                   // 陌生人：按 others_mode 回复
+)
+
+// others_mode：陌生人怎么回复
+const (
+	othersNeutral = "neutral" // 中性人设：不带关系描述和聊天记录示例（默认）
+	othersCanned  = "canned"  // 固定回复 others_reply
+	othersPersona = "persona" // 和 target 一样用完整人设
+)
+
+// accessFor 判断私聊对象：block_qq 永不回复；target_qq 和 allow_qq 用人设回复；
+// 设了 target_qq 时其他人不回复，否则其他人是陌生人，default_deny 时不回复
+func (b *Bot) accessFor(qq int64) peerAccess {
+	cfg := &b.cfg.Bot
+	switch {
+	case slices.Contains(cfg.BlockQQ, qq):
+		return peerDenied
+	case qq == cfg.TargetQQ || slices.Contains(cfg.AllowQQ, qq):
+		return peerTarget
+	case cfg.TargetQQ != 0 || cfg.DefaultDeny:
+		return peerDenied
+	}
+	return peerStranger
+}
+
+// othersMode 配置的 others_mode，空为 neutral
+func (b *Bot) othersMode() string {
+	if b.cfg.Bot.OthersMode == "" {
+		return othersNeutral
+	}
+	return b.cfg.Bot.OthersMode
+}
+
+// sessionFor 私聊对象的会话：主会话只属于 target_qq，allow_qq 和陌生人各自一个单独的会话，
+// 不读 target 的聊天记录和摘要，也不把自己的消息混进去
+func (b *Bot) sessionFor(peerID int64) *chat.Manager {
+	if peerID != b.cfg.Bot.TargetQQ {
+		return b.chat.Peer(peerID)
+	}
+	return b.chat
+}
+
+// strangerName 中性人设里对陌生人的称呼
+const strangerName = "对方"
+
+// strangerInfo 一个陌生发送者的统计
+type strangerInfo struct {
+	count  int
+	last   time.Time
+	denied bool
+}
+
+// strangers 记录 target 之外的私聊发送者，/status 里展示
+type strangers struct {
+	mu   sync.Mutex
+	seen map[int64]*strangerInfo
+}
+
+// maxStrangers 最多记录多少个陌生 QQ，超过后不再记新的
+const maxStrangers = 1000
+
+// Record 记录一次消息，返回是否第一次见到这个 QQ
+func (s *strangers) Record(qq int64, denied bool, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen == nil {
+		s.seen = make(map[int64]*strangerInfo)
+	}
+	info, ok := s.seen[qq]
+	if !ok {
+		if len(s.seen) >= maxStrangers {
+			return false
+		}
+		info = &strangerInfo{}
+		s.seen[qq] = info
+	}
+	info.count++
+	info.last = now
+	info.denied = denied
+	return !ok
+}
+
+// Summary /status 用：数量和最近的几个
+func (s *strangers) Summary(limit int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.seen) == 0 {
+		return "unknown senders: none"
+	}
+	qqs := make([]int64, 0, len(s.seen))
+	for qq := range s.seen {
+		qqs = append(qqs, qq)
+	}
+	sort.Slice(qqs, func(i, j int) bool { return s.seen[qqs[i]].last.After(s.seen[qqs[j]].last) })
+
+	var lines []string
+	for _, qq := range qqs[:min(limit, len(qqs))] {
+		info := s.seen[qq]
+		state := "replied"
+		if info.denied {
+			state = "ignored"
+		}
+		lines = append(lines, fmt.Sprintf("  %d: %d msgs, %s, last %s", qq, info.count, state, formatTime(info.last)))
+	}
+	return fmt.Sprintf("unknown senders: %d\n%s", len(s.seen), strings.Join(lines, "\n"))
+}
@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	registry "github.com/liao/style-bot/internal/metrics"
+)
+
+// adminShutdownTimeout ctx 取消后等待进行中的管理请求完成的时间
+const adminShutdownTimeout = 5 * time.Second
+
+// ServeAdmin 在 admin.listen 上启动管理 HTTP 服务（健康检查、Prometheus 指标、暂停/恢复），
+// 未配置时直接返回；ctx 取消时关闭
+func (b *Bot) ServeAdmin(ctx context.Context) error {
+	addr := b.cfg.Admin.Listen
+	if addr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", b.handleHealthz)
+	mux.HandleFunc("GET /metrics", b.handleMetrics)
+	mux.HandleFunc("POST /pause", b.handlePause)
+	mux.HandleFunc("POST /resume", b.handleResume)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           b.adminAuth(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	logger.Info("admin server listening", "addr", addr)
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("admin server: %w", err)
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown admin server: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("admin server: %w", err)
+	}
+	return nil
+}
+
+// adminAuth 校验 Authorization: Bearer <admin.token>
+func (b *Bot) adminAuth(next http.Handler) http.Handler {
+	want := []byte(b.cfg.Admin.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// healthStatus /healthz 的响应
+type healthStatus struct {
+	WebSocket string `json:"websocket"` // connected / disconnected / disabled
+	AI        string `json:"ai"`        // ok / failing
+	Store     string `json:"store"`     // loaded / empty
+}
+
+// handleHealthz WebSocket 和 AI 都正常时 200，否则 503；没有向量库只是不检索示例，只报告状态不算不健康
+func (b *Bot) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	st := healthStatus{WebSocket: "disabled", AI: "ok", Store: "loaded"}
+	healthy := true
+	if b.cfg.NapCat.WSURL != "" {
+		st.WebSocket = "connected"
+		if ws := b.ws.Load(); ws == nil || !ws.Alive() {
+			st.WebSocket = "disconnected"
+			healthy = false
+		}
+	}
+	if b.health.failing.Load() {
+		st.AI = "failing"
+		healthy = false
+	}
+	if !b.rag.Enabled() {
+		st.Store = "empty"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(st)
+}
+
+// handleMetrics Prometheus 文本格式：registry.Default 里 ai、rag、chat 和 bot 注册的全部指标
+func (b *Bot) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	b.updateGauges(time.Now())
+	registry.Default.Write(w)
+}
+
+// handlePause POST /pause?peer=QQ&minutes=N，与 /pause 命令相同：不带 peer 暂停所有人，不带 minutes 直到恢复
+func (b *Bot) handlePause(w http.ResponseWriter, r *http.Request) {
+	peer, minutes, err := pauseArgs(r.URL.Query().Get("peer"), r.URL.Query().Get("minutes"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b.paused.Pause(peer, time.Duration(minutes)*time.Minute)
+	logger.Info("auto reply paused via admin", "peer", peer, "minutes", minutes)
+	fmt.Fprintln(w, "auto reply paused")
+}
+
+// handleResume POST /resume?peer=QQ，与 /resume 命令相同：不带 peer 恢复全部
+func (b *Bot) handleResume(w http.ResponseWriter, r *http.Request) {
+	peer, _, err := pauseArgs(r.URL.Query().Get("peer"), "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b.paused.Resume(peer)
+	logger.Info("auto reply resumed via admin", "peer", peer)
+	fmt.Fprintln(w, "auto reply resumed")
+}
+
+// pauseArgs 解析 QQ 号和分钟数，空字符串为 0
+func pauseArgs(peerArg, minutesArg string) (peer int64, minutes int, err error) {
+	if peerArg != "" {
+		if peer, err = strconv.ParseInt(peerArg, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid peer %q", peerArg)
+		}
+	}
+	if minutesArg != "" {
+		if minutes, err = strconv.Atoi(minutesArg); err != nil || minutes < 0 {
+			return 0, 0, fmt.Errorf("invalid minutes %q", minutesArg)
+		}
+	}
+	return peer, minutes, nil
+}
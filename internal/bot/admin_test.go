@@ -0,0 +1,49 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthzWithoutVectorStoreIsHealthy(t *testing.T) {
+	b := newTestBot(t, &fakeAI{}, nil, nil)
+	rec := httptest.NewRecorder()
+	b.handleHealthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"store":"empty"`) {
+		t.Errorf("body = %s, want store reported empty", rec.Body)
+	}
+}
+
+func TestHealthzFailingAIIsUnhealthy(t *testing.T) {
+	b := newTestBot(t, &fakeAI{}, nil, nil)
+	b.health.failing.Store(true)
+	rec := httptest.NewRecorder()
+	b.handleHealthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+}
+
+func TestPauseAllCoversEveryPeer(t *testing.T) {
+	var p pausedPeers
+	now := time.Now()
+	p.Pause(0, 0)
+	for _, peer := range []int64{testTarget, 20002} {
+		if !p.Paused(peer, now) {
+			t.Errorf("peer %d not paused by pause-all", peer)
+		}
+	}
+	if n := p.Count(now); n != 1 {
+		t.Errorf("count = %d, want 1", n)
+	}
+	p.Resume(0)
+	if p.Paused(testTarget, now) {
+		t.Error("still paused after resume")
+	}
+}
@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultAlertAfterAttempts 连续重连失败多少次后推送告警
+const defaultAlertAfterAttempts = 5
+
+var alertHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// sendAlert 向带外告警地址 POST JSON：title + text（Telegram 用 text）+ desp（Server酱用 desp）
+func sendAlert(ctx context.Context, url, title, text string) error {
+	body, err := json.Marshal(map[string]string{"title": title, "text": title + "\n" + text, "desp": text})
+	if err != nil {
+		return fmt.Errorf("marshal alert: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("new alert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := alertHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("post alert: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("post alert: status %s", resp.Status)
+	}
+	return nil
+}
+
+// alertOwner 推送带外告警，未配置地址时跳过
+func (b *Bot) alertOwner(ctx context.Context, title, text string) {
+	url := b.cfg.NapCat.AlertWebhook
+	if url == "" {
+		return
+	}
+	if err := sendAlert(ctx, url, title, text); err != nil {
+		logger.Error("send alert failed", "error", err)
+		return
+	}
+	logger.Info("alert sent", "title", title)
+}
+
+// connStatus /status 里的 NapCat 连接状态
+func (b *Bot) connStatus() string {
+	ws := b.ws.Load()
+	if ws == nil {
+		return "napcat: not started"
+	}
+	state := "connected"
+	if !ws.Alive() {
+		state = fmt.Sprintf("reconnecting (%d failed)", b.wsFailures.Load())
+	}
+	last := "never"
+	if t := ws.LastEvent(); !t.IsZero() {
+		last = time.Since(t).Truncate(time.Second).String() + " ago"
+	}
+	return fmt.Sprintf("napcat: %s, disconnects %d, last event %s", state, napcatDisconnects.Value(), last)
+}
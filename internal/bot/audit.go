@@ -0,0 +1,332 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/liao/style-bot/internal/config"
+)
+
+// 审计记录方向
+const (
+	auditIn  = "in"
+	auditOut = "out"
+)
+
+// auditEntry 审计日志的一行，收到和发出的每条消息各一行
+type auditEntry struct {
+	TS              time.Time `json:"ts"`
+	Direction       string    `json:"direction"` // in / out
+	Peer            int64     `json:"peer"`
+	GroupID         int64     `json:"group_id,omitempty"`
+	MessageID       int64     `json:"message_id"`
+	Text            string    `json:"text"`
+	Model           string    `json:"model,omitempty"`
+	LatencyMs       int64     `json:"latency_ms,omitempty"`
+	RAGExampleCount int       `json:"rag_example_count"`
+	FallbackUsed    bool      `json:"fallback_used"`
+}
+
+// auditQueueSize 写入队列长度，满了就丢弃并告警，不阻塞消息处理
+const auditQueueSize = 1024
+
+// auditLog 只追加的审计日志，按天写到 dir/audit-YYYY-MM-DD.jsonl；dir 为空时不记录
+// 设置了 password 时每行单独加密（与 data-importer 的 .enc 同一套 AES-256-GCM 参数），base64 后写入 .jsonl.enc
+type auditLog struct {
+	dir      string
+	password string
+	key      []byte // 本进程的加密 key，nil = 明文
+	salt     []byte
+
+	entries chan auditEntry
+	done    chan struct{}
+	once    sync.Once
+
+	// 只在写入 goroutine 里访问
+	day string
+	f   *os.File
+	w   *bufio.Writer
+}
+
+func newAuditLog(dir, password string) (*auditLog, error) {
+	l := &auditLog{dir: dir, password: password}
+	if dir == "" {
+		return l, nil
+	}
+	if password != "" {
+		l.salt = make([]byte, 16)
+		if _, err := rand.Read(l.salt); err != nil {
+			return nil, fmt.Errorf("generate audit salt: %w", err)
+		}
+		l.key = auditKey(password, l.salt)
+	}
+	l.entries = make(chan auditEntry, auditQueueSize)
+	l.done = make(chan struct{})
+	go l.run()
+	return l, nil
+}
+
+// auditKey 与 parser.DecryptFile 相同的 PBKDF2 参数
+func auditKey(password string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(password), salt, 100000, 32, sha256.New)
+}
+
+// Record 异步写入一条审计记录；队列满时丢弃
+func (l *auditLog) Record(e auditEntry) {
+	if l.entries == nil {
+		return
+	}
+	if e.TS.IsZero() {
+		e.TS = time.Now()
+	}
+	select {
+	case l.entries <- e:
+	default:
+		logger.Warn("audit queue full, dropping entry", "direction", e.Direction, "peer", e.Peer)
+	}
+}
+
+// Close 写完队列里剩下的记录并关闭文件
+func (l *auditLog) Close() {
+	if l.entries == nil {
+		return
+	}
+	l.once.Do(func() { close(l.entries) })
+	<-l.done
+}
+
+func (l *auditLog) run() {
+	defer close(l.done)
+	for e := range l.entries {
+		if err := l.write(e); err != nil {
+			logger.Error("write audit log failed", "error", err)
+		}
+		// 队列空了再刷盘，突发时合并写入
+		if len(l.entries) == 0 && l.w != nil {
+			if err := l.w.Flush(); err != nil {
+				logger.Error("flush audit log failed", "error", err)
+			}
+		}
+	}
+	l.closeFile()
+}
+
+func (l *auditLog) write(e auditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal audit entry: %w", err)
+	}
+	if l.key != nil {
+		if line, err = l.seal(line); err != nil {
+			return err
+		}
+	}
+
+	day := e.TS.Format(time.DateOnly)
+	if day != l.day || l.w == nil {
+		l.closeFile()
+		if err := os.MkdirAll(l.dir, 0700); err != nil {
+			return fmt.Errorf("create audit dir: %w", err)
+		}
+		f, err := os.OpenFile(l.path(day), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("open audit log: %w", err)
+		}
+		l.day, l.f, l.w = day, f, bufio.NewWriter(f)
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	return nil
+}
+
+func (l *auditLog) closeFile() {
+	if l.w == nil {
+		return
+	}
+	if err := l.w.Flush(); err != nil {
+		logger.Error("flush audit log failed", "error", err)
+	}
+	l.f.Close()
+	l.f, l.w = nil, nil
+}
+
+// path 某一天的审计文件
+func (l *auditLog) path(day string) string {
+	name := "audit-" + day + ".jsonl"
+	if l.key != nil {
+		name += ".enc"
+	}
+	return filepath.Join(l.dir, name)
+}
+
+// seal 加密一行：base64(salt(16) + nonce(16) + tag(16) + ciphertext)
+func (l *auditLog) seal(plain []byte) ([]byte, error) {
+	gcm, err := newAuditGCM(l.key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nil, nonce, plain, nil)
+	ct, tag := sealed[:len(plain)], sealed[len(plain):]
+
+	raw := make([]byte, 0, 48+len(ct))
+	raw = append(raw, l.salt...)
+	raw = append(raw, nonce...)
+	raw = append(raw, tag...)
+	raw = append(raw, ct...)
+	return []byte(base64.StdEncoding.EncodeToString(raw)), nil
+}
+
+func newAuditGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("new cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, 16)
+	if err != nil {
+		return nil, fmt.Errorf("new gcm: %w", err)
+	}
+	return gcm, nil
+}
+
+// auditSummary 某一天的审计统计
+type auditSummary struct {
+	In, Out       int
+	Peers         int
+	Fallbacks     int
+	AvgLatencyMs  float64
+	Undecryptable int
+}
+
+// Summarize 统计某一天的审计记录；之前进程写的加密行用各自的 salt 重新派生 key
+func (l *auditLog) Summarize(day time.Time) (auditSummary, error) {
+	var s auditSummary
+	if l.dir == "" {
+		return s, fmt.Errorf("audit log disabled")
+	}
+	data, err := os.ReadFile(l.path(day.Format(time.DateOnly)))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("read audit log: %w", err)
+	}
+
+	keys := map[string][]byte{} // salt -> key，同一进程写的行共用一个 salt
+	peers := map[int64]bool{}
+	var latencySum int64
+	var latencyN int
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if l.key != nil {
+			if line, err = openAuditLine(line, l.password, keys); err != nil {
+				s.Undecryptable++
+				continue
+			}
+		}
+		var e auditEntry
+		if json.Unmarshal(line, &e) != nil {
+			continue
+		}
+		peers[e.Peer] = true
+		switch e.Direction {
+		case auditIn:
+			s.In++
+		case auditOut:
+			s.Out++
+			if e.FallbackUsed {
+				s.Fallbacks++
+			}
+			if e.LatencyMs > 0 {
+				latencySum += e.LatencyMs
+				latencyN++
+			}
+		}
+	}
+	s.Peers = len(peers)
+	if latencyN > 0 {
+		s.AvgLatencyMs = float64(latencySum) / float64(latencyN)
+	}
+	return s, nil
+}
+
+// openAuditLine 解密 seal 写入的一行
+func openAuditLine(line []byte, password string, keys map[string][]byte) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(line)))
+	if err != nil {
+		return nil, fmt.Errorf("decode audit line: %w", err)
+	}
+	if len(raw) < 48 {
+		return nil, fmt.Errorf("audit line too short")
+	}
+	salt, nonce, tag, ct := raw[:16], raw[16:32], raw[32:48], raw[48:]
+	key, ok := keys[string(salt)]
+	if !ok {
+		key = auditKey(password, salt)
+		keys[string(salt)] = key
+	}
+	gcm, err := newAuditGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, nonce, append(append([]byte(nil), ct...), tag...), nil)
+}
+
+// auditPassword 开启 audit_encrypt 时用 decrypt_key 加密
+func auditPassword(cfg config.DataConfig) string {
+	if !cfg.AuditEncrypt {
+		return ""
+	}
+	return cfg.DecryptKey
+}
+
+// record 计入收发指标并写审计日志
+func (b *Bot) record(e auditEntry) {
+	switch e.Direction {
+	case auditIn:
+		messagesHandled.Inc()
+	case auditOut:
+		repliesSent.Inc()
+	}
+	b.audit.Record(e)
+}
+
+// auditReply 记录一条发出的回复，latency 从收到消息算起
+func (b *Bot) auditReply(peer, groupID, msgID int64, text string, received time.Time, gen generation, ragCount int) {
+	b.record(auditEntry{
+		Direction:       auditOut,
+		Peer:            peer,
+		GroupID:         groupID,
+		MessageID:       msgID,
+		Text:            text,
+		Model:           gen.Model,
+		LatencyMs:       time.Since(received).Milliseconds(),
+		RAGExampleCount: ragCount,
+		FallbackUsed:    gen.Fallback,
+	})
+}
+
+// sendCanned 发送预设话术（配额提醒、敏感话题回避等），同样记入审计日志
+func (b *Bot) sendCanned(sink replySink, peerID int64, text string) {
+	id, _ := sink.send(text, 0)
+	b.record(auditEntry{Direction: auditOut, Peer: peerID, MessageID: id, Text: text})
+}
@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liao/style-bot/internal/config"
+)
+
+// humanSink 模拟打字的发送端，记录发出的每条消息
+type humanSink struct {
+	sent []string
+}
+
+func (s *humanSink) send(part string, _ int64) (int64, bool) {
+	s.sent = append(s.sent, part)
+	return int64(len(s.sent)), true
+}
+
+func (s *humanSink) humanize() bool { return true }
+
+func readAudit(t *testing.T, dir string) []auditEntry {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "audit-"+time.Now().Format(time.DateOnly)+".jsonl"))
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	var entries []auditEntry
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var e auditEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatalf("parse audit line %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestAuditRecordsTypoAndCorrectionAsSent(t *testing.T) {
+	dir := t.TempDir()
+	fake := &fakeAI{reply: "我知道了啊"}
+	b := newTestBot(t, fake, nil, func(cfg *config.Config) {
+		cfg.Data.AuditDir = dir
+		cfg.Bot.TypoProbability = 1
+	})
+	sink := &humanSink{}
+	if _, err := b.respond(context.Background(), inbound{peerID: testTarget, text: "明天见", received: time.Now()}, sink); err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	b.audit.Close()
+
+	if len(sink.sent) != 2 || sink.sent[0] == "我知道了啊" || !strings.HasPrefix(sink.sent[1], "*") {
+		t.Fatalf("sent %q, want a typo and its correction", sink.sent)
+	}
+	var out []string
+	for _, e := range readAudit(t, dir) {
+		if e.Direction == auditOut {
+			out = append(out, e.Text)
+		}
+	}
+	if strings.Join(out, "/") != strings.Join(sink.sent, "/") {
+		t.Errorf("audited %q, want what was sent %q", out, sink.sent)
+	}
+	if transcript := b.chat.Transcript(); !strings.Contains(transcript[len(transcript)-1], "我知道了啊") {
+		t.Errorf("session should keep the corrected text, got %q", transcript)
+	}
+}
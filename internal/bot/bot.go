@@ -2,69 +2,386 @@ package bot
 
 import (
 	"context"
-	"log/slog"
+	"fmt"
 	"math/rand/v2"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	zero "github.com/wdvxdr1123/ZeroBot"
-	"github.com/wdvxdr1123/ZeroBot/driver"
 	"github.com/wdvxdr1123/ZeroBot/message"
+	"google.golang.org/genai"
 
 	"github.com/liao/style-bot/internal/ai"
 	"github.com/liao/style-bot/internal/chat"
 	"github.com/liao/style-bot/internal/config"
+	"github.com/liao/style-bot/internal/coord"
+	"github.com/liao/style-bot/internal/logging"
 	"github.com/liao/style-bot/internal/persona"
 	"github.com/liao/style-bot/internal/rag"
 )
 
+var logger = logging.For("bot")
+
 type Bot struct {
-	cfg      *config.Config
-	ai       *ai.Client
-	chat     *chat.Manager
-	rag      *rag.Pipeline
-	persona  *persona.Persona
-	cancel   context.CancelFunc
+	cfg     *config.Config
+	ai      AI
+	chat    *chat.Manager
+	rag     *rag.Pipeline
+	persona atomic.Pointer[persona.Persona] // /retrain 后原子替换
+	prompt  *ai.PromptTemplate
+	coord   coord.Coordinator
+	quota   *quota
+	limiter *genLimiter
+	inbound *userLimiter // 按用户的入站限流
+	topics  *ai.TopicGuard
+	paused  pausedPeers                      // 升级给 owner 后暂停回复的对象
+	emoji   atomic.Pointer[ai.EmojiInjector] // 人设没有表情习惯时为 nil
+	liveLog *liveLog
+	audit   *auditLog
+	health  aiHealth
+	ws      atomic.Pointer[wsDriver] // 当前的 NapCat 连接，/healthz 用
+	outbox  *outbox                  // 发送失败的回复，连上后补发
+	drift   driftTracker
+	loc     *time.Location // bot.timezone，prompt 里的当前时间用
+
+	strangers strangers       // target 之外的私聊发送者
+	requests  pendingRequests // 等 owner 决定的好友申请和群邀请
+	followups followups       // 回复后待发的追加消息
+	peerLocks peerLocks       // 同一私聊对象的会话写入和发送串行进行
+
+	peerPersonas map[int64]*persona.Persona // 按 QQ 号单独的人设（<QQ号>/persona.json），启动时加载，/retrain 不更新
+	peerRAG      map[int64]*rag.Pipeline    // 按 QQ 号单独的向量库（<QQ号>/vectors），LoadPeerPipelines 加载
+
+	silent atomic.Bool // 静默模式：照常生成但不发送，/silent-toggle 切换
+
+	wsFailures atomic.Int64 // 当前连续重连失败次数，连上后归零
+
+	cancel context.CancelFunc
+
+	branchMu sync.Mutex
+	branch   *branchTest // 进行中的 A/B prompt 测试
+
+	registerOnce sync.Once
+	handled      *recentIDs // 最近处理过的 message_id，防止重复回复
+	poke         pokeCooldown
+
+	summarizing   atomic.Bool
+	retraining    atomic.Bool            // /retrain 和自动刷新共用，同一时间只跑一个
+	sinceAnalysis atomic.Int64           // 上次风格分析后新增的消息数
+	lastPrompt    atomic.Pointer[string] // debug_prompt 开启时记录最近一次的 system prompt
+	topK          atomic.Int64           // SetTopK 设置的检索条数，0 = 按配置
+	retrainedAt   time.Time              // 上次 /retrain 处理到的 live log 时间，只在 retraining 期间读写
 }
 
-func New(cfg *config.Config, aiClient *ai.Client, chatMgr *chat.Manager, ragPipeline *rag.Pipeline, p *persona.Persona) *Bot {
-	return &Bot{
+func New(cfg *config.Config, aiClient AI, chatMgr *chat.Manager, ragPipeline *rag.Pipeline, p *persona.Persona, tmpl *ai.PromptTemplate, c coord.Coordinator) (*Bot, error) {
+	if tmpl == nil {
+		tmpl = ai.DefaultPromptTemplate()
+	}
+	if !cfg.Bot.DisableFaces {
+		var patterns []string
+		if p != nil {
+			patterns = p.Style.EmojiPatterns
+		}
+		tmpl = tmpl.WithRules(faceRule(patterns))
+	}
+	if cfg.Bot.DebugPrompt {
+		tmpl = tmpl.WithDebug()
+	}
+	if c == nil {
+		c = coord.Noop{}
+	}
+	// 正则已在 config.Load 校验过
+	topics, _ := ai.NewTopicGuard(cfg.Bot.BlockedTopics.Keywords, cfg.Bot.BlockedTopics.Patterns)
+	audit, err := newAuditLog(cfg.Data.AuditDir, auditPassword(cfg.Data))
+	if err != nil {
+		return nil, err
+	}
+	loc, err := cfg.Bot.Location()
+	if err != nil {
+		return nil, err
+	}
+	b := &Bot{
 		cfg:     cfg,
 		ai:      aiClient,
 		chat:    chatMgr,
 		rag:     ragPipeline,
-		persona: p,
+		prompt:  tmpl,
+		coord:   c,
+		liveLog: newLiveLog(cfg.Data.LiveLog),
+		audit:   audit,
+		loc:     loc,
+		quota: newQuota(filepath.Join(cfg.Data.SessionsDir, "state.json"), loc,
+			cfg.Bot.MaxRepliesPerDay, cfg.Bot.MaxRepliesPerHourPerPeer),
+		outbox:  newOutbox(filepath.Join(cfg.Data.SessionsDir, "outbox.json")),
+		handled: newRecentIDs(handledIDWindow),
+		inbound: newUserLimiter(cfg.Bot.UserRPM),
+		topics:  topics,
+		limiter: newGenLimiter(cfg.Bot.MaxConcurrentGenerations, cfg.Bot.MaxQueuedGenerations,
+			time.Duration(cfg.Bot.QueueStaleSec)*time.Second),
 	}
+	b.setPersona(p)
+	b.peerPersonas = loadPeerPersonas(cfg)
+	b.silent.Store(cfg.Bot.SilentMode)
+	if cfg.Bot.DryRun {
+		logger.Warn("dry run: replies are forwarded to the owner, nothing is sent to the target", "owner", cfg.Bot.OwnerQQ)
+	}
+	return b, nil
+}
+
+// now bot.timezone 时区的当前时间
+func (b *Bot) now() time.Time {
+	return time.Now().In(b.loc)
 }
 
+// handledIDWindow 去重时记住的最近 message_id 数量
+const handledIDWindow = 256
+
+// 重连退避
+const (
+	reconnectBaseDelay = time.Second
+	reconnectMaxDelay  = 60 * time.Second
+)
+
+// defaultHeartbeatTimeout 没收到任何事件多久后断开重连（NapCat 默认 30 秒一次心跳）
+const defaultHeartbeatTimeout = 90 * time.Second
+
 func (b *Bot) Run(ctx context.Context) {
 	ctx, b.cancel = context.WithCancel(ctx)
 
-	ws := driver.NewWebSocketClient(
-		b.cfg.NapCat.WSURL,
-		b.cfg.NapCat.AccessToken,
+	logger.Info("bot starting",
+		"target_qq", b.cfg.Bot.TargetQQ,
+		"ws_url", b.cfg.NapCat.WSURL,
 	)
 
+	// 处理器只注册一次，重连只换 driver：ZeroBot 的 matcher 是全局的，
+	// 每次重连都注册会累积订阅，同一条消息被回复多次
+	b.registerOnce.Do(func() { b.registerHandlers(ctx) })
+	go b.watchOutbox(ctx)
+	go b.watchDigest(ctx)
+	go b.initDrift(ctx)
+	go b.warmUp(ctx)
+
+	idleTimeout := b.cfg.NapCat.HeartbeatTimeout
+	if idleTimeout == 0 {
+		idleTimeout = defaultHeartbeatTimeout
+	}
+	alertAfter := b.cfg.NapCat.AlertAfterAttempts
+	if alertAfter <= 0 {
+		alertAfter = defaultAlertAfterAttempts
+	}
+
+	// 断线后指数退避重连；会话、persona 都在 Bot 上，重连不丢状态
+	delay := reconnectBaseDelay
+	attempts := 0
+	alerted := false
+	for {
+		ws := newWSDriver(b.cfg.NapCat.WSURL, b.cfg.NapCat.AccessToken, max(idleTimeout, 0))
+		b.ws.Store(ws)
+
+		zero.RunAndBlock(&zero.Config{
+			NickName:      []string{"style-bot"},
+			CommandPrefix: "/",
+			SuperUsers:    []int64{b.cfg.Bot.OwnerQQ},
+			Driver:        []zero.Driver{ws},
+		}, nil)
+
+		if ctx.Err() != nil {
+			return
+		}
+		if ws.Connected() {
+			// 连上过说明服务端正常，重新计数
+			delay = reconnectBaseDelay
+			attempts = 0
+			if alerted {
+				alerted = false
+				go b.alertOwner(ctx, "style-bot reconnected", "NapCat connection recovered")
+			}
+		}
+		attempts++
+		napcatDisconnects.Inc()
+		b.wsFailures.Store(int64(attempts))
+		if attempts == alertAfter && !alerted {
+			alerted = true
+			go b.alertOwner(ctx, "style-bot disconnected",
+				fmt.Sprintf("NapCat reconnect failed %d times in a row: %v", attempts, ws.Err()))
+		}
+		if max := b.cfg.NapCat.MaxReconnectAttempts; max > 0 && attempts > max {
+			logger.Error("napcat reconnect attempts exhausted", "attempts", max, "error", ws.Err())
+			return
+		}
+
+		logger.Warn("napcat disconnected, reconnecting", "attempt", attempts, "delay", delay, "error", ws.Err())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+}
+
+// registerHandlers 在新的 Engine 上注册所有处理器，整个进程只调用一次
+func (b *Bot) registerHandlers(ctx context.Context) *zero.Engine {
+	engine := zero.New()
+
 	// 注册私聊消息处理
-	zero.OnMessage(zero.OnlyPrivate, b.targetFilter()).Handle(func(zctx *zero.Ctx) {
+	engine.OnMessage(zero.OnlyPrivate, b.targetFilter()).Handle(func(zctx *zero.Ctx) {
 		b.handleMessage(ctx, zctx)
 	})
 
+	// 群聊：白名单里的群，被 @ 或叫名字时回复
+	if len(b.cfg.Bot.Groups) > 0 {
+		engine.OnMessage(zero.OnlyGroup, b.groupFilter()).Handle(func(zctx *zero.Ctx) {
+			b.handleGroupMessage(ctx, zctx)
+		})
+	}
+
+	// 对方拍了拍 bot
+	engine.OnNotice(zero.Type("notice/notify/poke"), zero.OnlyToMe, b.targetFilter()).Handle(func(zctx *zero.Ctx) {
+		b.handlePoke(ctx, zctx)
+	})
+
+	// 对方撤回消息
+	engine.OnNotice(zero.Type("notice/friend_recall"), b.targetFilter()).Handle(func(zctx *zero.Ctx) {
+		b.handleRecall(zctx)
+	})
+
 	// 管理命令：owner 发 /status 查看状态
-	zero.OnCommand("status", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
-		zctx.Send(message.Text("style-bot running"))
+	engine.OnCommand("status", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
+		st := b.chat.Stats()
+		mode := "style-bot running"
+		if b.cfg.Bot.DryRun {
+			mode = "style-bot running (DRY RUN: replies go to owner only)"
+		}
+		zctx.Send(message.Text(fmt.Sprintf("%s\n"+
+			"session: %d messages (me %d, them %d)\n"+
+			"started: %s\nlast active: %s\navg reply latency: %.1fs\n%s\noutbox: %d pending\npersona quality: %.2f/1.0\n%s",
+			mode, st.TotalMessages, st.MyMessages, st.UserMessages,
+			formatTime(st.SessionStart), formatTime(st.LastActive), st.AverageReplyLatencyMs/1000,
+			b.connStatus(), b.outbox.Len(), b.persona.Load().Score(), b.strangers.Summary(5))))
 	})
 
-	slog.Info("bot starting",
-		"target_qq", b.cfg.Bot.TargetQQ,
-		"ws_url", b.cfg.NapCat.WSURL,
-	)
+	// 管理命令：/silent-toggle 切换静默模式（照常生成但不发送，回复写进 sessions_dir/silent_log.jsonl）
+	engine.OnCommand("silent-toggle", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
+		on := !b.silent.Load()
+		b.silent.Store(on)
+		logger.Info("silent mode toggled", "on", on)
+		if on {
+			zctx.Send(message.Text("silent mode on: replies are generated but not sent"))
+			return
+		}
+		zctx.Send(message.Text("silent mode off"))
+	})
+
+	// 管理命令：/prompt 查看最近一次的 system prompt（需开启 debug_prompt）
+	if b.cfg.Bot.DebugPrompt {
+		engine.OnCommand("prompt", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
+			last := b.lastPrompt.Load()
+			if last == nil {
+				zctx.Send(message.Text("no prompt yet"))
+				return
+			}
+			zctx.Send(message.Text(*last))
+		})
+	}
+
+	// 管理命令：/clear-session 清空私聊会话（含磁盘上的会话文件），bot 陷入奇怪的对话循环时用
+	engine.OnCommand("clear-session", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
+		b.chat.Clear()
+		logger.Info("session cleared by owner")
+		zctx.Send(message.Text("session cleared"))
+	})
+
+	// 管理命令：/test-reply <消息> 假装对方发了这条消息，生成回复只发给 owner，不记入会话
+	engine.OnCommand("test-reply", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
+		b.testReply(ctx, zctx, commandArgs(zctx.State))
+	})
+
+	// 管理命令：/pause [QQ号] [分钟] 暂停自动回复，不带 QQ 号暂停所有人，不带分钟数直到 /resume
+	engine.OnCommand("pause", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
+		args := strings.Fields(commandArgs(zctx.State))
+		args = append(args, "", "")
+		peer, minutes, err := pauseArgs(args[0], args[1])
+		if err != nil {
+			zctx.Send(message.Text("usage: /pause [QQ] [minutes]"))
+			return
+		}
+		b.paused.Pause(peer, time.Duration(minutes)*time.Minute)
+		zctx.Send(message.Text("auto reply paused"))
+	})
+
+	// 管理命令：/resume [QQ号] 恢复被升级暂停的自动回复，不带参数恢复全部
+	engine.OnCommand("resume", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
+		peer, _ := strconv.ParseInt(commandArgs(zctx.State), 10, 64)
+		b.paused.Resume(peer)
+		zctx.Send(message.Text("auto reply resumed"))
+	})
+
+	// 好友申请和群邀请
+	engine.OnRequest().Handle(func(zctx *zero.Ctx) {
+		b.handleRequest(zctx)
+	})
 
-	zero.RunAndBlock(&zero.Config{
-		NickName:   []string{"style-bot"},
-		SuperUsers: []int64{b.cfg.Bot.OwnerQQ},
-		Driver:     []zero.Driver{ws},
-	}, nil)
+	// 管理命令：/approve <flag> 同意、/reject <flag> 拒绝转过来的申请，不带参数列出待处理的
+	engine.OnCommand("approve", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
+		b.onRequestDecision(zctx, true)
+	})
+	engine.OnCommand("reject", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
+		b.onRequestDecision(zctx, false)
+	})
+
+	// 管理命令：/audit today 查看当天审计日志的收发统计
+	engine.OnCommand("audit", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
+		if arg := commandArgs(zctx.State); arg != "" && arg != "today" {
+			zctx.Send(message.Text("usage: /audit today"))
+			return
+		}
+		st, err := b.audit.Summarize(time.Now())
+		if err != nil {
+			zctx.Send(message.Text("audit failed: " + err.Error()))
+			return
+		}
+		text := fmt.Sprintf("audit %s\nin: %d, out: %d, peers: %d\nfallbacks: %d, avg latency: %.1fs",
+			time.Now().Format(time.DateOnly), st.In, st.Out, st.Peers, st.Fallbacks, st.AvgLatencyMs/1000)
+		if st.Undecryptable > 0 {
+			text += fmt.Sprintf("\nundecryptable lines: %d", st.Undecryptable)
+		}
+		zctx.Send(message.Text(text))
+	})
+
+	// 管理命令：/retrain 用 live log 里的新对话增量更新 persona
+	engine.OnCommand("retrain", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
+		if !b.retraining.CompareAndSwap(false, true) {
+			zctx.Send(message.Text("retrain already running"))
+			return
+		}
+		zctx.Send(message.Text("retrain started"))
+		go func() {
+			defer b.retraining.Store(false)
+			n, err := b.retrain(ctx)
+			if err != nil {
+				zctx.Send(message.Text("retrain failed: " + err.Error()))
+				return
+			}
+			zctx.Send(message.Text(fmt.Sprintf("retrain done: %d new exchanges merged into persona", n)))
+		}()
+	})
+
+	// 管理命令：/branch-test <变体名> 用另一个 prompt 模板对比后续几轮回复
+	engine.OnCommand("branch-test", zero.OnlyPrivate, b.ownerFilter()).Handle(func(zctx *zero.Ctx) {
+		variant := commandArgs(zctx.State)
+		if err := b.startBranchTest(variant); err != nil {
+			zctx.Send(message.Text("branch test failed: " + err.Error()))
+			return
+		}
+		zctx.Send(message.Text("branch test started: " + variant))
+	})
+
+	return engine
 }
 
 func (b *Bot) Stop() {
@@ -72,94 +389,376 @@ func (b *Bot) Stop() {
 		b.cancel()
 	}
 	if err := b.chat.Save(); err != nil {
-		slog.Error("save session failed", "error", err)
+		logger.Error("save session failed", "error", err)
+	}
+	if err := b.quota.Save(); err != nil {
+		logger.Error("save quota state failed", "error", err)
+	}
+	if err := b.liveLog.Close(); err != nil {
+		logger.Error("close live log failed", "error", err)
+	}
+	b.audit.Close()
+	if err := b.coord.Close(); err != nil {
+		logger.Error("close coordinator failed", "error", err)
 	}
 }
 
 func (b *Bot) handleMessage(ctx context.Context, zctx *zero.Ctx) {
-	userMsg := strings.TrimSpace(zctx.ExtractPlainText())
-	if userMsg == "" {
-		return // 跳过纯表情/图片等非文本消息
+	received := time.Now()
+	messagesReceived.Inc()
+	if b.handled.Seen(eventMessageID(zctx)) {
+		logger.Warn("duplicate message event, skipping", "message_id", eventMessageID(zctx))
+		return
+	}
+	// 对方发来任何消息（包括纯表情）都取消待发的追加消息
+	if b.followups.Cancel(zctx.Event.UserID) {
+		logger.Debug("pending follow-up canceled", "peer", zctx.Event.UserID)
+	}
+	userMsg := b.messageText(zctx.Event.Message, zctx.Event.SelfID)
+	var images []message.Segment
+	if b.cfg.Bot.VisionEnabled {
+		images = imageSegments(zctx)
+	}
+	// 语音：转写成文字后按普通消息处理
+	if b.cfg.Bot.VoiceEnabled && userMsg == "" && len(images) == 0 {
+		if seg, ok := recordSegment(zctx); ok {
+			transcript, err := b.transcribeVoice(ctx, zctx, seg)
+			if err != nil {
+				logger.Warn("voice transcription failed", "from", zctx.Event.UserID, "error", err)
+				b.onVoiceFailed(zctx)
+				return
+			}
+			userMsg = voicePrefix + transcript
+		}
+	}
+	if userMsg == "" && len(images) == 0 {
+		return // 跳过纯表情等非文本消息
 	}
 
-	slog.Info("received message", "from", zctx.Event.UserID, "text", userMsg)
+	logger.Info("received message", "from", zctx.Event.UserID, logging.Content("text", userMsg), "images", len(images))
 
-	// 添加到会话上下文
-	b.chat.AddUserMessage(userMsg)
+	r, _ := b.respond(ctx, inbound{
+		peerID:   zctx.Event.UserID,
+		msgID:    eventMessageID(zctx),
+		text:     userMsg,
+		images:   images,
+		zctx:     zctx,
+		received: received,
+	}, qqSink{b: b, zctx: zctx})
+	if len(r.Parts) > 0 {
+		b.maybeFollowup(ctx, zctx, zctx.Event.UserID)
+	}
+}
 
-	// RAG 检索相关示例
-	examples, err := b.rag.Retrieve(ctx, userMsg)
-	if err != nil {
-		slog.Error("RAG retrieve failed", "error", err)
+// finishReply 回复发出后的收尾：记入会话和 live log、分支测试、persona 刷新、摘要、配额和保存；
+// 陌生人的单独会话只记入会话和配额，不参与 persona 刷新、漂移检查和摘要
+func (b *Bot) finishReply(ctx context.Context, peerID, msgID int64, userMsg, sessionText string, sent []string, received time.Time, d replyDraft) {
+	replyLatency.ObserveSince(received)
+	// 记录 bot 实际发出的回复到上下文
+	sess := b.sessionFor(peerID)
+	sess.AddBotReply(strings.Join(sent, "|||"))
+	b.quota.Record(peerID, time.Now())
+	if sess != b.chat {
+		go b.saveSession()
+		return
+	}
+	if err := b.liveLog.Append(peerID, sessionText, sent, received); err != nil {
+		logger.Warn("append live log failed", "error", err)
+	}
+
+	// A/B 测试分支：同样的输入用变体 prompt 生成，只记录不发送
+	go b.runBranch(ctx, userMsg, msgID, d.Style, d.Relation, d.Results, d.Reply)
+
+	// 消息够多后自动刷新 persona
+	b.countForRefresh(ctx, 2)
+	b.trackDrift(ctx, sent)
+
+	// 定期更新对话摘要
+	if every := b.cfg.Bot.SummaryEvery; every > 0 && b.chat.MessagesSinceSummary() >= every {
+		go b.refreshSummary(ctx)
+	}
+
+	// 异步保存会话
+	go b.saveSession()
+}
+
+// saveSession 保存会话（含子会话）、配额和 live log
+func (b *Bot) saveSession() {
+	if err := b.chat.Save(); err != nil {
+		logger.Error("save session failed", "error", err)
+	}
+	if err := b.quota.Save(); err != nil {
+		logger.Error("save quota state failed", "error", err)
+	}
+	if err := b.liveLog.Flush(); err != nil {
+		logger.Error("flush live log failed", "error", err)
+	}
+}
+
+// replyDraft 生成好、还没发送的私聊回复
+type replyDraft struct {
+	Reply    string
+	Gen      generation
+	Results  []rag.Result
+	Style    string // 生成时用的风格描述，分支测试复用
+	Relation string
+	Prompt   string // 组装好的 system prompt
+	Raw      string // 后处理之前的模型输出
+}
+
+// replyLanguage 回复用的语言：配置了 reply_language 时固定（forced 为 true），否则按消息检测
+func (b *Bot) replyLanguage(userMsg string) (lang ai.Language, forced bool) {
+	if fixed := ai.ParseLanguage(b.cfg.Bot.ReplyLanguage); fixed != ai.LangUnknown {
+		return fixed, true
+	}
+	return ai.DetectLanguage(userMsg), false
+}
+
+// draftReply 检索示例、组装 prompt 并生成回复（已过滤 AI 味、补表情）；QQ 私聊和 webhook 共用。
+// 前文取自对方的会话（sessionFor），最后一条会话消息必须是刚收到的 userMsg；images 非空时 zctx 用于下载图片
+func (b *Bot) draftReply(ctx context.Context, zctx *zero.Ctx, peerID int64, userMsg string, images []message.Segment) replyDraft {
+	d := b.draftReplyIn(ctx, zctx, b.sessionFor(peerID), peerID, userMsg, images)
+	if b.cfg.Bot.DebugPrompt {
+		b.lastPrompt.Store(&d.Prompt)
+	}
+	return d
+}
+
+// draftReplyIn 同 draftReply，但前文和摘要取自 sess（/test-reply 用会话的内存副本，不影响真实会话），也不记入 /prompt
+func (b *Bot) draftReplyIn(ctx context.Context, zctx *zero.Ctx, sess *chat.Manager, peerID int64, userMsg string, images []message.Segment) replyDraft {
+	// 陌生人用中性人设：只保留说话风格，不带关系描述和聊天记录示例
+	neutral := b.accessFor(peerID) == peerStranger && b.othersMode() == othersNeutral
+
+	// RAG 检索相关示例（纯图片消息没有可检索的文本）；对方有单独的向量库时用它
+	pipeline := b.ragFor(peerID)
+	var results []rag.Result
+	var err error
+	if userMsg != "" && !neutral {
+		topK, minSim := b.retrievalParams(userMsg)
+		results, err = pipeline.RetrieveWith(ctx, b.retrievalQuery(ctx, pipeline, sess, userMsg), topK, minSim, b.messageSentiment(ctx, pipeline, userMsg))
+		if err != nil {
+			logger.Error("RAG retrieve failed", "error", err)
+		}
+	}
+
+	// 问具体事实/计划但检索不到相关记忆：防止模型编造
+	unknownFact := err == nil && !neutral && pipeline.Enabled() && len(results) == 0 && ai.IsFactQuestion(userMsg)
+	if unknownFact {
+		logger.Info("no relevant memory for fact question, deflecting", logging.Content("text", userMsg))
 	}
 
+	// 按对方这条消息的语言回复，示例优先挑同样语言的
+	lang, forcedLang := b.replyLanguage(userMsg)
+	results = ai.SelectExamples(results, lang)
+
 	// 组装 system prompt
 	styleText := ""
 	relationText := ""
-	if b.persona != nil {
-		styleText = b.persona.FormatStyleForPrompt()
-		relationText = b.persona.FormatRelationshipForPrompt(b.cfg.Bot.TargetName)
+	targetName := b.cfg.Bot.TargetName
+	if p := b.personaFor(peerID); p != nil {
+		if p.TargetName != "" {
+			targetName = p.TargetName
+		}
+		styleText = p.FormatStyleForPrompt()
+		if !neutral {
+			relationText = p.FormatRelationshipForPrompt(targetName)
+		}
+	}
+	if neutral {
+		targetName = strangerName
 	}
 
-	systemPrompt := ai.BuildSystemPrompt(
-		b.cfg.Bot.MyName,
-		b.cfg.Bot.TargetName,
-		styleText,
-		relationText,
-		examples,
-	)
+	summary := sess.Summary()
+	rc := ai.RolePlayContext{
+		MyName:              b.cfg.Bot.MyName,
+		TargetName:          targetName,
+		StyleProfile:        styleText,
+		RelationshipProfile: relationText,
+		Summary:             summary,
+		RAGExamples:         results,
+		CurrentDateTime:     b.now(),
+	}
+	systemPrompt, err := b.prompt.Build(rc)
+	if err != nil {
+		logger.Error("render prompt template failed, using builtin", "error", err)
+		systemPrompt, _ = b.prompt.Builtin().Build(rc)
+	}
+	if unknownFact {
+		systemPrompt += ai.DeflectRule
+	}
+	systemPrompt += ai.LanguageRule(lang, forcedLang)
 
 	// 获取对话历史
-	history := b.chat.GetHistory()
 	// 最后一条是刚添加的 user message，从历史中排除（会作为 userMsg 传入）
-	if len(history) > 0 {
-		history = history[:len(history)-1]
-	}
+	history := sess.PriorHistory()
 
-	// 调 Gemini 生成回复，失败时兜底
-	reply, err := b.ai.GenerateChat(ctx, systemPrompt, history, userMsg)
-	if err != nil {
-		slog.Error("generate reply failed, using fallback", "error", err)
-		// 兜底：清掉历史重试一次（可能是历史数据有问题）
-		reply, err = b.ai.GenerateChat(ctx, systemPrompt, nil, userMsg)
-		if err != nil {
-			slog.Error("fallback also failed, sending simple reply", "error", err)
-			// 最终兜底：从风格档案里随机挑一个回复
-			reply = b.fallbackReply()
-		}
+	var reply string
+	var gen generation
+	switch {
+	case unknownFact && b.cfg.Bot.DeflectUnknown:
+		reply, gen = b.deflectReply(), fallbackGen("")
+	case len(images) > 0:
+		reply, gen = b.generateWithImages(ctx, zctx, systemPrompt, history, userMsg, images)
+	default:
+		reply, gen = b.generate(ctx, systemPrompt, history, userMsg)
 	}
 
 	// 后处理
+	raw := reply
 	reply = ai.FilterAIPatterns(reply)
+	reply = b.emoji.Load().Inject(reply)
+	return replyDraft{Reply: reply, Gen: gen, Results: results, Style: styleText, Relation: relationText, Prompt: systemPrompt, Raw: raw}
+}
+
+// onQuotaExceeded 超限时给对方一条"等下再聊"并通知管理员，每轮超限只发一次
+func (b *Bot) onQuotaExceeded(sink replySink, peerID int64, reason string) {
+	if !b.cfg.Bot.QuotaNotice || b.quota.MarkNotified(peerID) {
+		return
+	}
+	notice := "等下再聊"
+	if p := b.persona.Load(); p != nil && len(p.Style.RefusalExamples) > 0 {
+		notice = p.Style.RefusalExamples[rand.IntN(len(p.Style.RefusalExamples))]
+	}
+	b.sendCanned(sink, peerID, notice)
+	b.sessionFor(peerID).AddBotReply(notice)
+
+	if b.cfg.Bot.OwnerQQ != peerID {
+		b.notifyOwnerQQ(fmt.Sprintf("[style-bot] %d: %s", peerID, reason))
+	}
+	if err := b.quota.Save(); err != nil {
+		logger.Error("save quota state failed", "error", err)
+	}
+}
+
+// onBlockedTopic 命中敏感话题：发一句含糊的回复代替模型回复，并把触发的消息转给 owner
+func (b *Bot) onBlockedTopic(sink replySink, peerID int64, trigger, topic string) {
+	logger.Warn("message hit blocked topic, deflecting", "peer", peerID, "topic", topic)
+	reply := b.topicDeflection()
+	b.typingDelay(sink)
+	b.sendCanned(sink, peerID, reply)
+	b.sessionFor(peerID).AddBotReply(reply)
 
-	// 分割多条消息并发送
-	parts := ai.SplitMultiMessage(reply)
-	for i, part := range parts {
-		if i > 0 {
-			delay := b.randomDelay()
-			time.Sleep(delay)
+	if b.cfg.Bot.OwnerQQ != peerID {
+		b.notifyOwnerQQ(fmt.Sprintf("[style-bot] %d 触发敏感话题 %q：%s", peerID, topic, trigger))
+	}
+	go func() {
+		if err := b.chat.Save(); err != nil {
+			logger.Error("save session failed", "error", err)
+		}
+	}()
+}
+
+// topicDeflection 命中敏感话题时的回复：优先用配置的话术，其次人设的拒绝示例
+func (b *Bot) topicDeflection() string {
+	deflections := b.cfg.Bot.BlockedTopics.Deflections
+	if len(deflections) == 0 {
+		if p := b.persona.Load(); p != nil && len(p.Style.RefusalExamples) > 0 {
+			deflections = p.Style.RefusalExamples
+		} else {
+			deflections = []string{"这个等我晚点语音跟你说"}
 		}
-		part = ConvertWxEmoji(part)
-		zctx.Send(message.Text(part))
 	}
+	return deflections[rand.IntN(len(deflections))]
+}
 
-	// 记录 bot 回复到上下文
-	b.chat.AddBotReply(reply)
+// refreshSummary 用最近的对话更新滚动摘要，同一时间只跑一个
+func (b *Bot) refreshSummary(ctx context.Context) {
+	if !b.summarizing.CompareAndSwap(false, true) {
+		return
+	}
+	defer b.summarizing.Store(false)
+
+	summary, err := b.ai.Summarize(ctx, b.chat.Summary(), b.chat.Transcript())
+	if err != nil {
+		logger.Warn("refresh session summary failed", "error", err)
+		return
+	}
+	b.chat.SetSummary(summary)
+	logger.Debug("session summary updated", logging.Content("summary", summary))
+}
+
+// handleRecall 对方撤回消息：在会话中标记，prompt 里替换成占位文本
+func (b *Bot) handleRecall(zctx *zero.Ctx) {
+	msgID := eventMessageID(zctx)
+	sess := b.sessionFor(zctx.Event.UserID)
+	if !sess.MarkRecalled(msgID) {
+		logger.Debug("recalled message not in session", "message_id", msgID)
+		return
+	}
+	logger.Info("message recalled", "from", zctx.Event.UserID, "message_id", msgID)
+
+	if b.cfg.Bot.RecallReaction {
+		reactions := []string{"撤回啥了哈哈", "我看到了哦", "撤回了什么", "？？撤回干嘛"}
+		reaction := reactions[rand.IntN(len(reactions))]
+		time.Sleep(b.randomDelay())
+		b.sendCanned(qqSink{b: b, zctx: zctx}, zctx.Event.UserID, reaction)
+		sess.AddBotReply(reaction)
+	}
 
-	// 异步保存会话
 	go func() {
 		if err := b.chat.Save(); err != nil {
-			slog.Error("save session failed", "error", err)
+			logger.Error("save session failed", "error", err)
 		}
 	}()
 }
 
+// formatTime 状态输出用的时间格式，零值显示为 -
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// eventMessageID 取事件的 OneBot message_id，取不到返回 0
+func eventMessageID(zctx *zero.Ctx) int64 {
+	id, _ := zctx.Event.MessageID.(int64)
+	return id
+}
+
+// renderPart 把一条回复转换为要发送的消息：表情标记转 QQ 表情，或退化为 Unicode emoji
+func (b *Bot) renderPart(part string) message.Message {
+	if b.cfg.Bot.DisableFaces {
+		return message.Message{message.Text(ConvertWxEmoji(part))}
+	}
+	return buildFaceMessage(part)
+}
+
+// generation 一次回复生成的来源，记入审计日志
+type generation struct {
+	Model    string // 实际生成回复的模型，兜底话术为空
+	Fallback bool   // 走了兜底（去掉历史重试、预设话术等）
+}
+
+// generate 调 Gemini 生成回复，失败时兜底
+func (b *Bot) generate(ctx context.Context, systemPrompt string, history []*genai.Content, userMsg string) (string, generation) {
+	start := time.Now()
+	reply, model, err := b.ai.GenerateChatWithModel(ctx, systemPrompt, history, userMsg)
+	b.health.observeGeneration(time.Since(start), err)
+	if err == nil {
+		return reply, generation{Model: model}
+	}
+	logger.Error("generate reply failed, using fallback", "error", err)
+	// 兜底：清掉历史重试一次（可能是历史数据有问题）
+	reply, model, err = b.ai.GenerateChatWithModel(ctx, systemPrompt, nil, userMsg)
+	if err == nil {
+		return reply, fallbackGen(model)
+	}
+	logger.Error("fallback also failed, sending simple reply", "error", err)
+	// 最终兜底：从风格档案里随机挑一个回复
+	return b.fallbackReply(), fallbackGen("")
+}
+
 func (b *Bot) targetFilter() zero.Rule {
 	return func(ctx *zero.Ctx) bool {
-		if b.cfg.Bot.TargetQQ == 0 {
-			return true // 不限制，回复所有人
+		uid := ctx.Event.UserID
+		if b.accessFor(uid) != peerDenied {
+			return true
+		}
+		if uid != b.cfg.Bot.OwnerQQ && b.strangers.Record(uid, true, time.Now()) {
+			logger.Info("ignoring unknown sender", "from", uid)
 		}
-		return ctx.Event.UserID == b.cfg.Bot.TargetQQ
+		return false
 	}
 }
 
@@ -171,12 +770,21 @@ func (b *Bot) ownerFilter() zero.Rule {
 
 func (b *Bot) fallbackReply() string {
 	fallbacks := []string{"嗯嗯", "好呢", "哈哈", "嘻嘻", "在呢", "怎么啦", "好好好"}
-	if b.persona != nil && len(b.persona.Style.AgreementExamples) > 0 {
-		fallbacks = b.persona.Style.AgreementExamples
+	if p := b.persona.Load(); p != nil && len(p.Style.AgreementExamples) > 0 {
+		fallbacks = p.Style.AgreementExamples
 	}
 	return fallbacks[rand.IntN(len(fallbacks))]
 }
 
+// deflectReply 对答不上的事实问题给出含糊回复
+func (b *Bot) deflectReply() string {
+	deflects := []string{"不记得了", "回头说", "我想想哈", "等下跟你说", "忘了诶"}
+	if p := b.persona.Load(); p != nil && len(p.Style.RefusalExamples) > 0 {
+		deflects = p.Style.RefusalExamples
+	}
+	return deflects[rand.IntN(len(deflects))]
+}
+
 func (b *Bot) randomDelay() time.Duration {
 	minMs := b.cfg.Bot.ReplyDelayMinMs
 	maxMs := b.cfg.Bot.ReplyDelayMaxMs
@@ -0,0 +1,151 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/liao/style-bot/internal/ai"
+	"github.com/liao/style-bot/internal/chat"
+	"github.com/liao/style-bot/internal/rag"
+)
+
+// branchTest 一次 A/B prompt 测试：分支会话用另一个 prompt 模板生成回复，只记录不发送
+type branchTest struct {
+	variant  string
+	prompt   *ai.PromptTemplate
+	chat     *chat.Manager
+	turns    int
+	maxTurns int
+}
+
+// branchRecord branch_comparison.jsonl 中的一行
+type branchRecord struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Variant     string    `json:"variant"`
+	Turn        int       `json:"turn"`
+	UserMsg     string    `json:"user_msg"`
+	MainReply   string    `json:"main_reply"`
+	BranchReply string    `json:"branch_reply"`
+}
+
+// startBranchTest 从当前会话分出一个分支，后续 N 轮同时用变体 prompt 生成
+func (b *Bot) startBranchTest(variant string) error {
+	path, ok := b.cfg.Bot.PromptVariants[variant]
+	if !ok {
+		return fmt.Errorf("unknown prompt variant %q", variant)
+	}
+	disclosure, err := ai.ParseDisclosureMode(b.cfg.Bot.DisclosureMode)
+	if err != nil {
+		return err
+	}
+	tmpl, err := ai.LoadPromptTemplate(path, disclosure)
+	if err != nil {
+		return err
+	}
+	turns := b.cfg.Bot.BranchTestTurns
+	if turns <= 0 {
+		turns = 10
+	}
+
+	b.branchMu.Lock()
+	defer b.branchMu.Unlock()
+	if b.branch != nil {
+		b.discardBranchLocked()
+	}
+	b.branch = &branchTest{
+		variant:  variant,
+		prompt:   tmpl,
+		chat:     b.chat.Branch(),
+		maxTurns: turns,
+	}
+	logger.Info("branch test started", "variant", variant, "turns", turns)
+	return nil
+}
+
+// runBranch 用分支会话和变体 prompt 生成一条回复并与主回复一起记录
+func (b *Bot) runBranch(ctx context.Context, userMsg string, msgID int64, styleText, relationText string, results []rag.Result, mainReply string) {
+	b.branchMu.Lock()
+	defer b.branchMu.Unlock()
+	br := b.branch
+	if br == nil {
+		return
+	}
+
+	br.chat.AddUserMessage(userMsg, msgID)
+	history := br.chat.PriorHistory()
+
+	prompt, err := br.prompt.Build(ai.RolePlayContext{
+		MyName:              b.cfg.Bot.MyName,
+		TargetName:          b.cfg.Bot.TargetName,
+		StyleProfile:        styleText,
+		RelationshipProfile: relationText,
+		Summary:             br.chat.Summary(),
+		RAGExamples:         results,
+		CurrentDateTime:     b.now(),
+	})
+	if err != nil {
+		logger.Error("render branch prompt failed", "variant", br.variant, "error", err)
+		return
+	}
+	branchReply, err := b.ai.GenerateChat(ctx, prompt, history, userMsg)
+	if err != nil {
+		logger.Error("branch generate failed", "variant", br.variant, "error", err)
+		branchReply = ""
+	}
+	branchReply = ai.FilterAIPatterns(branchReply)
+	br.chat.AddBotReply(branchReply)
+	br.turns++
+
+	rec := branchRecord{
+		Timestamp:   time.Now(),
+		Variant:     br.variant,
+		Turn:        br.turns,
+		UserMsg:     userMsg,
+		MainReply:   mainReply,
+		BranchReply: branchReply,
+	}
+	if err := appendJSONL(filepath.Join(b.cfg.Data.SessionsDir, "branch_comparison.jsonl"), rec); err != nil {
+		logger.Error("write branch comparison failed", "error", err)
+	}
+	if err := br.chat.Save(); err != nil {
+		logger.Error("save branch session failed", "error", err)
+	}
+
+	if br.turns >= br.maxTurns {
+		logger.Info("branch test finished", "variant", br.variant, "turns", br.turns)
+		b.discardBranchLocked()
+	}
+}
+
+func (b *Bot) discardBranchLocked() {
+	if err := b.branch.chat.Discard(); err != nil {
+		logger.Warn("discard branch session failed", "error", err)
+	}
+	b.branch = nil
+}
+
+// appendJSONL 追加一行 JSON 到文件
+func appendJSONL(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal record: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// commandArgs 取命令参数
+func commandArgs(state map[string]any) string {
+	args, _ := state["args"].(string)
+	return strings.TrimSpace(args)
+}
@@ -0,0 +1,35 @@
+package bot
+
+import "sync"
+
+// recentIDs 记住最近处理过的 message_id，同一条消息（如重连后 NapCat 重推）只回复一次
+type recentIDs struct {
+	mu   sync.Mutex
+	seen map[int64]bool
+	ring []int64
+	next int
+}
+
+func newRecentIDs(size int) *recentIDs {
+	return &recentIDs{seen: make(map[int64]bool, size), ring: make([]int64, size)}
+}
+
+// Seen 记录 id，之前已记录过返回 true；id 为 0（未知）时总是返回 false
+func (r *recentIDs) Seen(id int64) bool {
+	if id == 0 {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.seen[id] {
+		return true
+	}
+	if old := r.ring[r.next]; old != 0 {
+		delete(r.seen, old)
+	}
+	r.ring[r.next] = id
+	r.next = (r.next + 1) % len(r.ring)
+	r.seen[id] = true
+	return false
+}
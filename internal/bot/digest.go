@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/liao/style-bot/internal/ai"
+)
+
+// digestTopicRunes 摘要里"主要话题"部分的最大字数
+const digestTopicRunes = 150
+
+// digestCounts 摘要用到的计数，取两次快照的差得到当天的量（进程重启后从 0 开始）
+type digestCounts struct {
+	handled, replies                    int64
+	genErrors, sendFailures             int64
+	blocked, escalations, quotaExceeded int64
+	usage                               ai.UsageStats
+}
+
+func (b *Bot) digestSnapshot() digestCounts {
+	return digestCounts{
+		handled:       messagesHandled.Value(),
+		replies:       repliesSent.Value(),
+		genErrors:     generationErrors.Value(),
+		sendFailures:  sendFailures.Value(),
+		blocked:       blockedTopics.Value(),
+		escalations:   escalations.Value(),
+		quotaExceeded: quotaExceeded.Value(),
+		usage:         b.ai.UsageStats(),
+	}
+}
+
+// sub 当前快照减去上次的
+func (c digestCounts) sub(prev digestCounts) digestCounts {
+	return digestCounts{
+		handled:       c.handled - prev.handled,
+		replies:       c.replies - prev.replies,
+		genErrors:     c.genErrors - prev.genErrors,
+		sendFailures:  c.sendFailures - prev.sendFailures,
+		blocked:       c.blocked - prev.blocked,
+		escalations:   c.escalations - prev.escalations,
+		quotaExceeded: c.quotaExceeded - prev.quotaExceeded,
+		usage: ai.UsageStats{
+			Requests:     c.usage.Requests - prev.usage.Requests,
+			PromptTokens: c.usage.PromptTokens - prev.usage.PromptTokens,
+			OutputTokens: c.usage.OutputTokens - prev.usage.OutputTokens,
+			TotalTokens:  c.usage.TotalTokens - prev.usage.TotalTokens,
+		},
+	}
+}
+
+// nextDigestAt now 之后下一个 HH:MM（本地时间）
+func nextDigestAt(now time.Time, clock string) time.Time {
+	t, _ := time.Parse("15:04", clock) // 已在 config.Load 校验
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// watchDigest 每天 bot.digest.time 给 owner 发当天的摘要
+func (b *Bot) watchDigest(ctx context.Context) {
+	if !b.cfg.Bot.Digest.Enabled || b.cfg.Bot.OwnerQQ == 0 {
+		return
+	}
+	prev := b.digestSnapshot()
+	for {
+		next := nextDigestAt(time.Now(), b.cfg.Bot.Digest.Time)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		cur := b.digestSnapshot()
+		day := cur.sub(prev)
+		prev = cur
+		if day.handled == 0 && day.replies == 0 {
+			logger.Debug("no activity today, skipping digest")
+			continue
+		}
+		b.notifyOwnerQQ(b.buildDigest(ctx, next, day))
+		logger.Info("daily digest sent", "messages", day.handled, "replies", day.replies)
+	}
+}
+
+// buildDigest 组装摘要文本；话题由模型根据当天的会话概括，失败时省略
+func (b *Bot) buildDigest(ctx context.Context, at time.Time, day digestCounts) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[style-bot] %s 每日摘要\n", at.Format(time.DateOnly))
+	fmt.Fprintf(&sb, "收到 %d 条消息，发出 %d 条回复\n", day.handled, day.replies)
+
+	dayStart := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+	var transcript []string
+	for _, m := range b.chat.MessagesSince(dayStart) {
+		if m.Recalled || strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		speaker := "对方"
+		if m.Role == "model" {
+			speaker = "我"
+		}
+		transcript = append(transcript, speaker+"："+m.Content)
+	}
+	if len(transcript) > 0 {
+		topics, err := b.ai.SummarizeDay(ctx, transcript, digestTopicRunes)
+		if err != nil {
+			logger.Warn("summarize day for digest failed", "error", err)
+		} else if topics != "" {
+			sb.WriteString("主要话题：\n" + topics + "\n")
+		}
+	}
+
+	if day.blocked+day.escalations+day.quotaExceeded > 0 {
+		fmt.Fprintf(&sb, "敏感话题 %d 次，升级给你 %d 次，超配额 %d 次\n", day.blocked, day.escalations, day.quotaExceeded)
+	}
+	if day.genErrors+day.sendFailures > 0 {
+		fmt.Fprintf(&sb, "生成失败 %d 次，发送失败 %d 条\n", day.genErrors, day.sendFailures)
+	}
+	fmt.Fprintf(&sb, "Gemini 请求 %d 次，token：输入 %d / 输出 %d / 合计 %d",
+		day.usage.Requests, day.usage.PromptTokens, day.usage.OutputTokens, day.usage.TotalTokens)
+	return sb.String()
+}
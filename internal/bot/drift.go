@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/liao/style-bot/internal/rag"
+)
+
+// driftSampleSize 风格漂移检查取最近多少条回复
+const driftSampleSize = 10
+
+// driftTracker 记录最近的回复，每隔 drift_check_interval_messages 条消息和向量库的风格中心比一次
+type driftTracker struct {
+	mu       sync.Mutex
+	centroid []float32 // 启动时由向量库示例算出，nil = 还没算好或不可用
+	recent   []string  // 最近的回复，最多 driftSampleSize 条
+	since    int       // 上次检查后新增的消息数
+	alerted  bool      // 已提醒过，恢复到阈值以上后重置
+}
+
+// Add 记录一轮回复（n 条消息），到检查间隔时返回采样的回复
+func (d *driftTracker) Add(replies []string, n, interval int) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.recent = append(d.recent, replies...)
+	if len(d.recent) > driftSampleSize {
+		d.recent = d.recent[len(d.recent)-driftSampleSize:]
+	}
+	d.since += n
+	if d.centroid == nil || d.since < interval {
+		return nil
+	}
+	d.since = 0
+	return append([]string(nil), d.recent...)
+}
+
+// initDrift 启动时计算风格中心，向量库为空时不做漂移检查
+func (b *Bot) initDrift(ctx context.Context) {
+	if b.cfg.Bot.DriftCheckIntervalMessages <= 0 || !b.rag.Enabled() {
+		return
+	}
+	centroid, err := b.rag.ComputeCentroid(ctx)
+	if err != nil {
+		logger.Warn("compute style centroid failed, drift check disabled", "error", err)
+		return
+	}
+	b.drift.mu.Lock()
+	b.drift.centroid = centroid
+	b.drift.mu.Unlock()
+	logger.Info("style centroid ready", "dims", len(centroid))
+}
+
+// trackDrift 在回复发出后调用，到间隔时在后台检查风格漂移
+func (b *Bot) trackDrift(ctx context.Context, sent []string) {
+	interval := b.cfg.Bot.DriftCheckIntervalMessages
+	if interval <= 0 {
+		return
+	}
+	if sample := b.drift.Add(sent, 2, interval); sample != nil {
+		go b.checkDrift(ctx, sample)
+	}
+}
+
+// checkDrift 最近回复的平均向量与风格中心的相似度低于阈值时提醒 owner
+func (b *Bot) checkDrift(ctx context.Context, sample []string) {
+	vecs := make([][]float32, 0, len(sample))
+	for _, reply := range sample {
+		vec, err := b.rag.Embed(ctx, reply)
+		if err != nil {
+			logger.Warn("embed reply for drift check failed", "error", err)
+			return
+		}
+		vecs = append(vecs, vec)
+	}
+
+	b.drift.mu.Lock()
+	defer b.drift.mu.Unlock()
+	sim := rag.CosineSimilarity(rag.Centroid(vecs), b.drift.centroid)
+	logger.Info("style drift check", "similarity", sim, "threshold", b.cfg.Bot.DriftAlertThreshold, "replies", len(sample))
+	if sim >= b.cfg.Bot.DriftAlertThreshold {
+		b.drift.alerted = false
+		return
+	}
+	if b.drift.alerted {
+		return
+	}
+	b.drift.alerted = true
+	logger.Warn("style drift detected", "similarity", sim)
+	b.notifyOwnerQQ(fmt.Sprintf("[style-bot] style drift detected (similarity %.2f < %.2f), consider re-running data-importer",
+		sim, b.cfg.Bot.DriftAlertThreshold))
+}
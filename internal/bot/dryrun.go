@@ -0,0 +1,32 @@
+package bot
+
+import (
+	"fmt"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/liao/style-bot/internal/logging"
+)
+
+// dryRunSentID 演练模式下没有 owner 可转发时代替消息 ID，让流程当作已发出继续走
+const dryRunSentID = -1
+
+// dryRunSend 演练模式：要发给 peer（groupID 非 0 时为群）的一条回复只写日志并转发给 owner，返回转发消息的 ID；
+// zctx 为 nil（没有 QQ 连接）时只写日志
+func (b *Bot) dryRunSend(zctx *zero.Ctx, peer, groupID int64, part string) int64 {
+	target := fmt.Sprintf("%d", peer)
+	if groupID != 0 {
+		target = fmt.Sprintf("group %d", groupID)
+	}
+	logger.Info("dry run reply", "target", target, logging.Content("text", part))
+	if b.cfg.Bot.OwnerQQ == 0 || zctx == nil {
+		return dryRunSentID
+	}
+	id := zctx.SendPrivateMessage(b.cfg.Bot.OwnerQQ, message.Text(fmt.Sprintf("[dry run → %s] %s", target, part)))
+	if id == 0 {
+		logger.Warn("forward dry run reply to owner failed", "target", target)
+		return dryRunSentID
+	}
+	return id
+}
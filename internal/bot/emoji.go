@@ -5,29 +5,27 @@ import (
 	"strings"
 )
 
-// 微信表情名 → QQ face ID 映射
+// 微信表情名 → QQ face ID 映射；QQ 没有的（奸笑、机智、裂开等微信新表情）不在表里，由 ConvertWxEmoji 转成 emoji
 var wxToQQFace = map[string]int{
-	"微笑": 14, "撇嘴": 1, "色": 110, "发呆": 3, "得意": 4,
+	"惊讶": 0, "撇嘴": 1, "色": 2, "发呆": 3, "得意": 4,
 	"流泪": 5, "害羞": 6, "闭嘴": 7, "睡": 8, "大哭": 9,
-	"尴尬": 10, "发怒": 11, "调皮": 12, "呲牙": 13, "惊讶": 0,
+	"尴尬": 10, "发怒": 11, "调皮": 12, "呲牙": 13, "微笑": 14,
 	"难过": 15, "酷": 16, "抓狂": 18, "吐": 19, "偷笑": 20,
 	"可爱": 21, "白眼": 22, "傲慢": 23, "饥饿": 24, "困": 25,
 	"惊恐": 26, "流汗": 27, "憨笑": 28, "悠闲": 29, "奋斗": 30,
 	"咒骂": 31, "疑问": 32, "嘘": 33, "晕": 34, "折磨": 35,
-	"衰": 36, "骷髅": 37, "敲打": 38, "再见": 39, "擦汗": 97,
+	"衰": 36, "骷髅": 37, "敲打": 38, "再见": 39, "发抖": 41,
+	"爱情": 42, "跳跳": 43, "猪头": 46, "拥抱": 49, "蛋糕": 53,
+	"闪电": 54, "炸弹": 55, "刀": 56, "足球": 57, "便便": 59,
+	"咖啡": 60, "饭": 61, "玫瑰": 63, "凋谢": 64, "爱心": 66,
+	"心碎": 67, "太阳": 74, "月亮": 75, "强": 76, "弱": 77,
+	"握手": 78, "胜利": 79, "飞吻": 85, "怄火": 86, "擦汗": 97,
 	"抠鼻": 98, "鼓掌": 99, "糗大了": 100, "坏笑": 101, "左哼哼": 102,
 	"右哼哼": 103, "哈欠": 104, "鄙视": 105, "委屈": 106, "快哭了": 107,
-	"阴险": 108, "亲亲": 109, "吓": 111, "可怜": 112,
-	"菜刀": 112, "啤酒": 113, "篮球": 114, "乒乓": 115, "咖啡": 60,
-	"饭": 61, "猪头": 62, "玫瑰": 63, "凋谢": 64, "示爱": 65,
-	"爱心": 66, "心碎": 67, "蛋糕": 68, "闪电": 69, "炸弹": 70,
-	"刀": 71, "足球": 72, "瓢虫": 73, "便便": 74, "月亮": 75,
-	"太阳": 76, "彩虹": 77, "拥抱": 78, "强": 79, "弱": 80,
-	"握手": 81, "胜利": 82, "抱拳": 83, "勾引": 84, "拳头": 85,
-	"差劲": 86, "爱你": 87, "NO": 88, "OK": 89, "爱情": 90,
-	"飞吻": 91, "跳跳": 92, "发抖": 93, "怄火": 94, "转圈": 95,
-	"磕头": 96, "捂脸": 264, "奸笑": 265, "机智": 277, "皱眉": 278,
-	"耶": 279, "裂开": 342, "苦涩": 343, "叹气": 344, "让我看看": 345,
+	"阴险": 108, "亲亲": 109, "吓": 110, "可怜": 111, "菜刀": 112,
+	"啤酒": 113, "篮球": 114, "乒乓": 115, "示爱": 116, "瓢虫": 117,
+	"抱拳": 118, "勾引": 119, "拳头": 120, "差劲": 121, "爱你": 122,
+	"NO": 123, "OK": 124, "转圈": 125, "磕头": 126, "捂脸": 264,
 }
 
 var wxEmojiRegex = regexp.MustCompile(`\[([^\[\]]+)\]`)
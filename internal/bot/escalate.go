@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// escalationContextLines 转给 owner 时附带的最近对话条数
+const escalationContextLines = 6
+
+// pausedPeers 升级给 owner 后暂停自动回复的对象，零值时间表示直到 /resume；peer 为 0 表示暂停所有人
+type pausedPeers struct {
+	mu    sync.Mutex
+	until map[int64]time.Time
+}
+
+// Pause 暂停 peer（0 = 所有人），d 为 0 时直到手动恢复
+func (p *pausedPeers) Pause(peer int64, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.until == nil {
+		p.until = make(map[int64]time.Time)
+	}
+	var until time.Time
+	if d > 0 {
+		until = time.Now().Add(d)
+	}
+	p.until[peer] = until
+}
+
+// Resume 恢复 peer，peer 为 0 时全部恢复
+func (p *pausedPeers) Resume(peer int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if peer == 0 {
+		clear(p.until)
+		return
+	}
+	delete(p.until, peer)
+}
+
+// Paused peer 是否处于暂停中（单独暂停或全部暂停），到期的自动恢复
+func (p *pausedPeers) Paused(peer int64, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active(peer, now) || p.active(0, now)
+}
+
+// Count 暂停中的条目数（全部暂停算一条）
+func (p *pausedPeers) Count(now time.Time) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for peer := range p.until {
+		if p.active(peer, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// active 调用方持有锁
+func (p *pausedPeers) active(peer int64, now time.Time) bool {
+	until, ok := p.until[peer]
+	if !ok {
+		return false
+	}
+	if !until.IsZero() && now.After(until) {
+		delete(p.until, peer)
+		return false
+	}
+	return true
+}
+
+// isHighStakes 关键词命中，或开启模型判断且打分超过阈值
+func (b *Bot) isHighStakes(ctx context.Context, msg string) (bool, string) {
+	esc := b.cfg.Bot.Escalation
+	for _, k := range esc.Keywords {
+		if k != "" && strings.Contains(msg, k) {
+			return true, "keyword " + strconv.Quote(k)
+		}
+	}
+	if !esc.ModelCheck {
+		return false, ""
+	}
+	score, err := b.ai.ClassifyStakes(ctx, msg)
+	if err != nil {
+		logger.Warn("stakes classification failed", "error", err)
+		return false, ""
+	}
+	threshold := esc.ModelThreshold
+	if threshold <= 0 {
+		threshold = 0.7
+	}
+	if score >= threshold {
+		return true, fmt.Sprintf("model score %.2f", score)
+	}
+	return false, ""
+}
+
+// escalate 自动回复已暂停（decide），把消息和最近对话转给 owner，可选回一句中性的缓冲回复
+func (b *Bot) escalate(sink replySink, peerID int64, reason string) {
+	esc := b.cfg.Bot.Escalation
+
+	if b.cfg.Bot.OwnerQQ != 0 {
+		transcript := b.sessionFor(peerID).Transcript()
+		if len(transcript) > escalationContextLines {
+			transcript = transcript[len(transcript)-escalationContextLines:]
+		}
+		b.notifyOwnerQQ(fmt.Sprintf(
+			"[style-bot] %d 的消息需要你亲自回复（%s），已暂停自动回复，/resume %d 恢复\n%s",
+			peerID, reason, peerID, strings.Join(transcript, "\n")))
+	}
+
+	if !esc.HoldingReply {
+		return
+	}
+	reply := b.holdingReply()
+	b.typingDelay(sink)
+	b.sendCanned(sink, peerID, reply)
+	b.sessionFor(peerID).AddBotReply(reply)
+}
+
+// holdingReply 升级后先回的一句中性缓冲话
+func (b *Bot) holdingReply() string {
+	replies := b.cfg.Bot.Escalation.HoldingReplies
+	if len(replies) == 0 {
+		replies = []string{"等下哈", "我等下跟你说", "稍等我一下"}
+	}
+	return replies[rand.IntN(len(replies))]
+}
@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// faceTokenRegex 匹配 [face:182] 或 [表情名]
+var faceTokenRegex = regexp.MustCompile(`\[(?:face:(\d+)|([^\[\]]+))\]`)
+
+// faceRule 允许模型输出 QQ 表情的 prompt 规则
+func faceRule(emojiPatterns []string) string {
+	rule := "可以用 [face:表情ID] 或 [表情名] 发 QQ 表情，比如 [捂脸]、[呲牙]，不要滥用"
+	if len(emojiPatterns) > 0 {
+		rule += "；优先用你常用的：" + strings.Join(emojiPatterns, "、")
+	}
+	return rule
+}
+
+// lookupFace 表情名 → QQ face ID
+func lookupFace(name string) (int, bool) {
+	id, ok := wxToQQFace[strings.TrimSpace(name)]
+	return id, ok
+}
+
+// buildFaceMessage 把文本中的表情标记转换为 Face 段，其余部分为 Text 段
+// 不认识的表情名交给 ConvertWxEmoji，转不了就保留原括号文本
+func buildFaceMessage(text string) message.Message {
+	var msg message.Message
+	appendText := func(s string) {
+		s = ConvertWxEmoji(s)
+		if s == "" {
+			return
+		}
+		// 合并相邻文本段
+		if n := len(msg); n > 0 && msg[n-1].Type == "text" {
+			msg[n-1] = message.Text(msg[n-1].Data["text"] + s)
+			return
+		}
+		msg = append(msg, message.Text(s))
+	}
+
+	last := 0
+	for _, loc := range faceTokenRegex.FindAllStringSubmatchIndex(text, -1) {
+		appendText(text[last:loc[0]])
+		last = loc[1]
+
+		if loc[2] >= 0 {
+			if id, err := strconv.Atoi(text[loc[2]:loc[3]]); err == nil {
+				msg = append(msg, message.Face(id))
+				continue
+			}
+		} else if id, ok := lookupFace(text[loc[4]:loc[5]]); ok {
+			msg = append(msg, message.Face(id))
+			continue
+		}
+		appendText(text[loc[0]:loc[1]])
+	}
+	appendText(text[last:])
+	return msg
+}
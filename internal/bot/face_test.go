@@ -0,0 +1,46 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+func TestLookupFace(t *testing.T) {
+	for name, want := range map[string]int{"惊讶": 0, "色": 2, "微笑": 14, "强": 76, "可怜": 111, "菜刀": 112, "捂脸": 264, " 呲牙 ": 13} {
+		if id, ok := lookupFace(name); !ok || id != want {
+			t.Errorf("lookupFace(%q) = %d, %v; want %d", name, id, ok, want)
+		}
+	}
+	if _, ok := lookupFace("裂开"); ok {
+		t.Error("WeChat-only face mapped to a QQ face")
+	}
+}
+
+func TestFaceTableIDsAreUnique(t *testing.T) {
+	names := make(map[int]string)
+	for name, id := range wxToQQFace {
+		if other, ok := names[id]; ok {
+			t.Errorf("%s and %s both map to face %d", name, other, id)
+		}
+		names[id] = name
+	}
+}
+
+func TestBuildFaceMessage(t *testing.T) {
+	msg := buildFaceMessage("好的[face:182][捂脸]行[裂开][不认识]")
+	want := message.Message{
+		message.Text("好的"),
+		message.Face(182),
+		message.Face(264),
+		message.Text("行💔[不认识]"),
+	}
+	if len(msg) != len(want) {
+		t.Fatalf("got %d segments %+v, want %+v", len(msg), msg, want)
+	}
+	for i := range want {
+		if msg[i].Type != want[i].Type || msg[i].Data["text"] != want[i].Data["text"] || msg[i].Data["id"] != want[i].Data["id"] {
+			t.Errorf("segment %d = %+v, want %+v", i, msg[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+
+	"github.com/liao/style-bot/internal/ai"
+)
+
+// 追加消息：回复发出后过一会儿对方还没回，再补一句
+const (
+	followupMinDelay = 30 * time.Second
+	followupMaxDelay = 120 * time.Second
+	followupPrompt   = "(对方还没回。你刚想起还有话说：接着刚才的话补一句，或者问个相关的问题。像平时那样随口说，别重复刚才说过的)"
+)
+
+// followups 每个私聊对象最多一个待发的追加消息，对方发来新消息时取消
+type followups struct {
+	mu      sync.Mutex
+	pending map[int64]*followup
+}
+
+type followup struct {
+	timer *time.Timer
+}
+
+// Schedule 在 delay 后调用 fire，替换该对象之前待发的追加消息
+func (f *followups) Schedule(peerID int64, delay time.Duration, fire func(*followup)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pending == nil {
+		f.pending = make(map[int64]*followup)
+	}
+	if old := f.pending[peerID]; old != nil {
+		old.timer.Stop()
+	}
+	fu := &followup{}
+	fu.timer = time.AfterFunc(delay, func() { fire(fu) })
+	f.pending[peerID] = fu
+}
+
+// Cancel 取消待发的追加消息；已经在生成的会在发送前发现被取消
+func (f *followups) Cancel(peerID int64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fu := f.pending[peerID]
+	if fu == nil {
+		return false
+	}
+	fu.timer.Stop()
+	delete(f.pending, peerID)
+	return true
+}
+
+// Take 发送前调用：fu 仍是该对象待发的追加消息时移除并返回 true，已被取消或替换时返回 false
+func (f *followups) Take(peerID int64, fu *followup) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pending[peerID] != fu {
+		return false
+	}
+	delete(f.pending, peerID)
+	return true
+}
+
+// maybeFollowup 回复发出后按 followup_probability 安排一条追加消息
+func (b *Bot) maybeFollowup(ctx context.Context, zctx *zero.Ctx, peerID int64) {
+	if b.accessFor(peerID) != peerTarget || rand.Float32() >= b.cfg.Bot.FollowupProbability {
+		return
+	}
+	delay := followupMinDelay + rand.N(followupMaxDelay-followupMinDelay)
+	logger.Debug("follow-up scheduled", "peer", peerID, "delay", delay.Truncate(time.Second))
+	b.followups.Schedule(peerID, delay, func(fu *followup) {
+		b.sendFollowup(ctx, zctx, peerID, fu)
+	})
+}
+
+// sendFollowup 生成并发送追加消息，和普通回复一样受暂停、静默、敏感话题和配额限制；
+// 对方在此期间发了消息（或会话最后一条不是 bot 的回复）时放弃。检查、发送和记入会话在对方的锁里进行
+func (b *Bot) sendFollowup(ctx context.Context, zctx *zero.Ctx, peerID int64, fu *followup) {
+	if ctx.Err() != nil || !b.awaitingReply() || b.silent.Load() {
+		b.followups.Take(peerID, fu)
+		return
+	}
+	if b.paused.Paused(peerID, time.Now()) {
+		logger.Debug("follow-up skipped, peer paused", "peer", peerID)
+		b.followups.Take(peerID, fu)
+		return
+	}
+	if reason := b.quota.Allow(peerID, time.Now()); reason != "" {
+		logger.Debug("follow-up skipped, reply quota exceeded", "peer", peerID, "reason", reason)
+		b.followups.Take(peerID, fu)
+		return
+	}
+	release, ok := b.limiter.Acquire(ctx, time.Now())
+	if !ok {
+		b.followups.Take(peerID, fu)
+		return
+	}
+	defer release()
+
+	reply, gen := b.followupReply(ctx)
+	parts := ai.SplitMultiMessage(reply)
+	if reply == "" || len(parts) == 0 {
+		b.followups.Take(peerID, fu)
+		return
+	}
+	if hit := b.topics.Match(reply); hit != "" {
+		logger.Warn("follow-up hit blocked topic, not sending", "peer", peerID, "topic", hit)
+		blockedTopics.Inc()
+		b.followups.Take(peerID, fu)
+		return
+	}
+
+	unlock := b.peerLocks.Lock(peerID)
+	defer unlock()
+	// 生成期间对方发了新消息、被暂停或切到静默：追加消息作废
+	if !b.followups.Take(peerID, fu) || !b.awaitingReply() || b.coord.OtherReplied(peerID) ||
+		b.paused.Paused(peerID, time.Now()) || b.silent.Load() {
+		logger.Info("follow-up canceled by new activity", "peer", peerID)
+		return
+	}
+
+	received := time.Now()
+	var sent []string
+	for i, part := range parts {
+		if i > 0 {
+			time.Sleep(b.randomDelay())
+		}
+		sentID := b.sendPart(zctx, part, 0)
+		if sentID == 0 {
+			b.queueUnsent(peerID, 0, parts[i:])
+			break
+		}
+		b.auditReply(peerID, 0, sentID, part, received, gen, 0)
+		sent = append(sent, part)
+	}
+	if len(sent) == 0 {
+		return
+	}
+	logger.Info("follow-up sent", "peer", peerID, "parts", len(sent))
+
+	// 追加消息作为 bot 的又一轮回复记入会话
+	b.chat.AddBotReply(strings.Join(sent, "|||"))
+	b.quota.Record(peerID, time.Now())
+	go func() {
+		if err := b.chat.Save(); err != nil {
+			logger.Error("save session failed", "error", err)
+		}
+	}()
+}
+
+// awaitingReply 会话最后一条是 bot 的回复，即对方还没回
+func (b *Bot) awaitingReply() bool {
+	msgs := b.chat.Messages()
+	return len(msgs) > 0 && msgs[len(msgs)-1].Role == "model"
+}
+
+// followupReply 用人设接着会话生成追加消息，失败时返回空字符串（不发）
+func (b *Bot) followupReply(ctx context.Context) (string, generation) {
+	var styleText, relationText string
+	if p := b.persona.Load(); p != nil {
+		styleText = p.FormatStyleForPrompt()
+		relationText = p.FormatRelationshipForPrompt(b.cfg.Bot.TargetName)
+	}
+	systemPrompt, err := b.prompt.Build(ai.RolePlayContext{
+		MyName:              b.cfg.Bot.MyName,
+		TargetName:          b.cfg.Bot.TargetName,
+		StyleProfile:        styleText,
+		RelationshipProfile: relationText,
+		Summary:             b.chat.Summary(),
+		CurrentDateTime:     b.now(),
+	})
+	if err != nil {
+		logger.Warn("render prompt for follow-up failed", "error", err)
+		return "", generation{}
+	}
+	reply, model, err := b.ai.GenerateChatWithModel(ctx, systemPrompt, b.chat.GetHistory(), followupPrompt)
+	if err != nil {
+		logger.Warn("generate follow-up failed", "error", err)
+		return "", generation{}
+	}
+	reply = ai.FilterAIPatterns(reply)
+	return b.emoji.Load().Inject(reply), generation{Model: model}
+}
@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+
+	"github.com/liao/style-bot/internal/ai"
+	"github.com/liao/style-bot/internal/chat"
+	"github.com/liao/style-bot/internal/logging"
+)
+
+// groupContextLines 群聊 prompt 里列出的最近群消息条数
+const groupContextLines = 15
+
+var leadingAtRegex = regexp.MustCompile(`^(@\S+\s*)+`)
+
+// groupFilter 只处理 bot.groups 白名单里的群
+func (b *Bot) groupFilter() zero.Rule {
+	return func(ctx *zero.Ctx) bool {
+		return slices.Contains(b.cfg.Bot.Groups, ctx.Event.GroupID)
+	}
+}
+
+// groupNicknames 群里叫 bot 的名字，未配置时用 my_name
+func (b *Bot) groupNicknames() []string {
+	if len(b.cfg.Bot.GroupNicknames) > 0 {
+		return b.cfg.Bot.GroupNicknames
+	}
+	return []string{b.cfg.Bot.MyName}
+}
+
+// calledInGroup 被 @ 或消息里出现了 bot 的名字
+func (b *Bot) calledInGroup(zctx *zero.Ctx, text string) bool {
+	if zctx.Event.IsToMe {
+		return true
+	}
+	for _, name := range b.groupNicknames() {
+		if name != "" && strings.Contains(text, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleGroupMessage 群消息都记进该群的会话作为上下文，只在被 @ 或叫名字时回复
+func (b *Bot) handleGroupMessage(ctx context.Context, zctx *zero.Ctx) {
+	received := time.Now()
+	messagesReceived.Inc()
+	text := strings.TrimSpace(leadingAtRegex.ReplaceAllString(b.messageText(zctx.Event.Message, zctx.Event.SelfID), ""))
+	if text == "" {
+		return
+	}
+	if b.handled.Seen(eventMessageID(zctx)) {
+		return
+	}
+	groupID := zctx.Event.GroupID
+	sender := zctx.Event.Sender.Name()
+	session := b.chat.Group(groupID)
+	session.AddGroupMessage(sender, text, eventMessageID(zctx))
+	b.record(auditEntry{TS: received, Direction: auditIn, Peer: zctx.Event.UserID, GroupID: groupID, MessageID: eventMessageID(zctx), Text: text})
+
+	if !b.calledInGroup(zctx, text) || b.silent.Load() {
+		return
+	}
+	// 全部暂停（/pause 0）或暂停了发言人时群里也不接
+	if b.paused.Paused(zctx.Event.UserID, received) {
+		logger.Info("reply paused, skipping group reply", "group", groupID, "from", zctx.Event.UserID)
+		return
+	}
+	logger.Info("called in group", "group", groupID, "from", zctx.Event.UserID, logging.Content("text", text))
+
+	// 敏感话题在群里直接不接
+	if hit := b.topics.Match(text); hit != "" {
+		logger.Warn("group message hit blocked topic, staying silent", "group", groupID, "topic", hit)
+		blockedTopics.Inc()
+		return
+	}
+
+	// 群和 QQ 号不在同一个号段空间，用负数区分配额
+	quotaKey := -groupID
+	if reason := b.quota.Allow(quotaKey, received); reason != "" {
+		logger.Warn("reply quota exceeded, skipping group reply", "group", groupID, "reason", reason)
+		quotaExceeded.Inc()
+		return
+	}
+	release, ok := b.limiter.Acquire(ctx, received)
+	if !ok {
+		return
+	}
+	defer release()
+
+	results, err := b.rag.Retrieve(ctx, text, "")
+	if err != nil {
+		logger.Warn("RAG retrieve failed", "error", err)
+	}
+
+	var styleText, relationText string
+	if p := b.persona.Load(); p != nil {
+		styleText = p.FormatStyleForPrompt()
+		if zctx.Event.UserID == b.cfg.Bot.TargetQQ {
+			relationText = p.FormatRelationshipForPrompt(b.cfg.Bot.TargetName)
+		}
+	}
+
+	recent := session.Transcript()
+	if len(recent) > groupContextLines {
+		recent = recent[len(recent)-groupContextLines:]
+	}
+	systemPrompt, err := b.prompt.BuildGroup(b.cfg.Bot.MyName, sender, styleText, relationText, recent, results)
+	if err != nil {
+		logger.Error("render prompt template failed, using builtin", "error", err)
+		systemPrompt, _ = b.prompt.Builtin().BuildGroup(b.cfg.Bot.MyName, sender, styleText, relationText, recent, results)
+	}
+
+	// 群聊上下文已经在 prompt 里，不再传历史
+	reply, gen := b.generate(ctx, systemPrompt, nil, sender+"："+text)
+	reply = ai.FilterAIPatterns(reply)
+	if hit := b.topics.Match(reply); hit != "" {
+		logger.Warn("group reply hit blocked topic, not sending", "group", groupID, "topic", hit)
+		return
+	}
+	reply = b.emoji.Load().Inject(reply)
+
+	var parts []string
+	for _, part := range ai.SplitMultiMessage(reply) {
+		if part = strings.TrimSpace(leadingAtRegex.ReplaceAllString(part, "")); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	quoteID := b.quoteTarget(session, eventMessageID(zctx))
+	var sent []string
+	for i, part := range parts {
+		if i > 0 {
+			time.Sleep(b.randomDelay())
+		}
+		sentID := b.sendPart(zctx, part, quoteID)
+		if sentID == 0 {
+			// 重试后仍失败：这条和剩下的都进待发箱，保持顺序
+			b.queueUnsent(zctx.Event.UserID, groupID, parts[i:])
+			break
+		}
+		quoteID = 0
+		b.auditReply(zctx.Event.UserID, groupID, sentID, part, received, gen, len(results))
+		sent = append(sent, part)
+	}
+	if len(sent) == 0 {
+		return
+	}
+	replyLatency.ObserveSince(received)
+	session.AddBotReply(strings.Join(sent, "|||"))
+	b.quota.Record(quotaKey, time.Now())
+
+	go b.saveGroup(session)
+}
+
+func (b *Bot) saveGroup(session *chat.Manager) {
+	if err := session.Save(); err != nil {
+		logger.Error("save group session failed", "error", err)
+	}
+	if err := b.quota.Save(); err != nil {
+		logger.Error("save quota state failed", "error", err)
+	}
+}
@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// genLimiter 限制同时进行的生成数量，排队有上限，排太久的消息直接丢弃
+type genLimiter struct {
+	sem      chan struct{} // nil = 不限制
+	maxQueue int
+	stale    time.Duration
+
+	mu      sync.Mutex
+	waiting int
+}
+
+func newGenLimiter(maxConcurrent, maxQueue int, stale time.Duration) *genLimiter {
+	l := &genLimiter{maxQueue: maxQueue, stale: stale}
+	if maxConcurrent > 0 {
+		l.sem = make(chan struct{}, maxConcurrent)
+	}
+	return l
+}
+
+// Acquire 获取一个生成名额；队列已满、等待超时或消息已过期时返回 false
+func (l *genLimiter) Acquire(ctx context.Context, received time.Time) (release func(), ok bool) {
+	if l.sem == nil {
+		return func() {}, true
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		return l.release, true
+	default:
+	}
+
+	l.mu.Lock()
+	if l.maxQueue > 0 && l.waiting >= l.maxQueue {
+		l.mu.Unlock()
+		logger.Warn("generation queue full, dropping message", "queued", l.maxQueue)
+		return nil, false
+	}
+	l.waiting++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+
+	select {
+	case l.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, false
+	}
+	if l.stale > 0 && time.Since(received) > l.stale {
+		l.release()
+		logger.Warn("message waited too long in queue, discarding", "waited", time.Since(received).Round(time.Second))
+		return nil, false
+	}
+	return l.release, true
+}
+
+// Queued 当前排队中的消息数
+func (l *genLimiter) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.waiting
+}
+
+func (l *genLimiter) release() {
+	<-l.sem
+}
@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// liveEntry 与 parser.ParseJSONLToConversations 读取的格式一致；
+// 按导入器默认的 -user-is-me=true，"user" 是我（bot 的回复），"assistant" 是对方
+type liveEntry struct {
+	Messages  []liveMessage `json:"messages"`
+	UserID    int64         `json:"user_id"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+type liveMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// liveLog 把每轮对话追加写入 JSONL，供之后重新跑导入器；path 为空时不记录
+type liveLog struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	w    *bufio.Writer
+}
+
+func newLiveLog(path string) *liveLog {
+	return &liveLog{path: path}
+}
+
+// Append 记录一轮对话：对方的消息和 bot 实际发出的回复（多条用换行分隔）
+func (l *liveLog) Append(userID int64, incoming string, replies []string, at time.Time) error {
+	if l.path == "" {
+		return nil
+	}
+	line, err := json.Marshal(liveEntry{
+		Messages: []liveMessage{
+			{Role: "assistant", Content: incoming},
+			{Role: "user", Content: strings.Join(replies, "\n")},
+		},
+		UserID:    userID,
+		Timestamp: at,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal live entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.w == nil {
+		if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+			return fmt.Errorf("create live log dir: %w", err)
+		}
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("open live log: %w", err)
+		}
+		l.f = f
+		l.w = bufio.NewWriter(f)
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write live log: %w", err)
+	}
+	return nil
+}
+
+// Flush 把缓冲写入文件
+func (l *liveLog) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.w == nil {
+		return nil
+	}
+	return l.w.Flush()
+}
+
+// Close 刷新并关闭文件
+func (l *liveLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.w == nil {
+		return nil
+	}
+	if err := l.w.Flush(); err != nil {
+		l.f.Close()
+		return fmt.Errorf("flush live log: %w", err)
+	}
+	l.w = nil
+	return l.f.Close()
+}
+
+// readLiveSince 读取 live log 中 since 之后的记录，返回这些行（仍是导入器格式）、条数和最新时间
+func readLiveSince(path string, since time.Time) ([]byte, int, time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, since, fmt.Errorf("read live log: %w", err)
+	}
+
+	var out bytes.Buffer
+	n, latest := 0, since
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var e liveEntry
+		if len(bytes.TrimSpace(line)) == 0 || json.Unmarshal(line, &e) != nil {
+			continue
+		}
+		if !e.Timestamp.After(since) {
+			continue
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+		n++
+		if e.Timestamp.After(latest) {
+			latest = e.Timestamp
+		}
+	}
+	return out.Bytes(), n, latest, nil
+}
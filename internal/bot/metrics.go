@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"sync/atomic"
+	"time"
+
+	registry "github.com/liao/style-bot/internal/metrics"
+)
+
+// bot 的指标，注册在 registry.Default，/metrics 统一输出
+var (
+	messagesReceived = registry.NewCounter("stylebot_messages_received_total", "Inbound messages received, before access and duplicate checks.")
+	messagesHandled  = registry.NewCounter("stylebot_messages_handled_total", "Inbound messages handled.")
+	repliesSent      = registry.NewCounter("stylebot_replies_sent_total", "Reply messages sent, including canned replies.")
+	fallbackReplies  = registry.NewCounter("stylebot_fallback_replies_total", "Replies that fell back to a retry without history or a canned line.")
+	replyLatency     = registry.NewHistogram("stylebot_reply_latency_seconds", "End-to-end latency from receiving a message to the last reply part sent.", registry.LatencyBuckets)
+
+	generationLatency = registry.NewHistogram("stylebot_generation_latency_seconds", "Reply generation latency.", latencyBuckets)
+	generationErrors  = registry.NewCounter("stylebot_generation_errors_total", "Failed reply generations.")
+	blockedTopics     = registry.NewCounter("stylebot_blocked_topics_total", "Messages that hit a blocked topic.")
+	escalations       = registry.NewCounter("stylebot_escalations_total", "High-stakes messages escalated to the owner.")
+	quotaExceeded     = registry.NewCounter("stylebot_quota_exceeded_total", "Messages not answered because of the reply quota.")
+	sendFailures      = registry.NewCounter("stylebot_send_failures_total", "Reply parts queued in the outbox after failed sends.")
+
+	// 下面几个是 Bot 的当前状态，每次 /metrics 前由 updateGauges 设置
+	generationQueueDepth    = registry.NewGauge("stylebot_generation_queue_depth", "Messages waiting for a generation slot.")
+	pausedPeersGauge        = registry.NewGauge("stylebot_paused_peers", "Active reply pauses; a pause of everyone (/pause 0) counts as one.")
+	outboxPending           = registry.NewGauge("stylebot_outbox_pending", "Replies waiting for redelivery after failed sends.")
+	napcatConnected         = registry.NewGauge("stylebot_napcat_connected", "Whether the NapCat WebSocket is connected.")
+	napcatDisconnects       = registry.NewCounter("stylebot_napcat_disconnects_total", "NapCat disconnects and failed reconnect attempts.")
+	napcatReconnectFailures = registry.NewGauge("stylebot_napcat_reconnect_failures", "Consecutive failed NapCat reconnect attempts.")
+)
+
+// fallbackGen 走了兜底的 generation，计入 fallback_replies
+func fallbackGen(model string) generation {
+	fallbackReplies.Inc()
+	return generation{Model: model, Fallback: true}
+}
+
+// latencyBuckets 生成耗时直方图的桶上界（秒）
+var latencyBuckets = []float64{0.5, 1, 2, 5, 10, 20, 30, 60}
+
+// aiHealth 最近一次生成是否失败，/healthz 用
+type aiHealth struct {
+	failing atomic.Bool
+}
+
+// observeGeneration 记录一次生成的耗时和结果
+func (h *aiHealth) observeGeneration(d time.Duration, err error) {
+	h.failing.Store(err != nil)
+	if err != nil {
+		generationErrors.Inc()
+	}
+	generationLatency.Observe(d.Seconds())
+}
+
+// updateGauges 把 Bot 的当前状态写进对应的 gauge
+func (b *Bot) updateGauges(now time.Time) {
+	generationQueueDepth.Set(int64(b.limiter.Queued()))
+	pausedPeersGauge.Set(int64(b.paused.Count(now)))
+	outboxPending.Set(int64(b.outbox.Len()))
+	connected, failures := int64(0), b.wsFailures.Load()
+	if ws := b.ws.Load(); ws != nil && ws.Alive() {
+		connected, failures = 1, 0
+	}
+	napcatConnected.Set(connected)
+	napcatReconnectFailures.Set(failures)
+}
@@ -0,0 +1,27 @@
+package bot
+
+import (
+	"context"
+
+	"google.golang.org/genai"
+
+	"github.com/liao/style-bot/internal/ai"
+)
+
+// AI bot 用到的模型调用，*ai.Client 实现；测试里换成假的
+type AI interface {
+	GenerateChat(ctx context.Context, systemPrompt string, history []*genai.Content, userMsg string) (string, error)
+	GenerateChatWithModel(ctx context.Context, systemPrompt string, history []*genai.Content, userMsg string) (string, string, error)
+	GenerateChatWithImages(ctx context.Context, systemPrompt string, history []*genai.Content, userMsg string, images []*genai.Part) (string, string, error)
+	RewriteQuery(ctx context.Context, turns []string) (string, error)
+	ClassifySentiment(ctx context.Context, msg string) (string, error)
+	ClassifyStakes(ctx context.Context, msg string) (float32, error)
+	Summarize(ctx context.Context, previous string, transcript []string) (string, error)
+	SummarizeDay(ctx context.Context, transcript []string, maxRunes int) (string, error)
+	AnalyzeStyle(ctx context.Context, prompt string, thinkingBudget int32, stopSequences []string) (string, error)
+	Transcribe(ctx context.Context, audio []byte, mimeType string) (string, error)
+	WaitForToken(ctx context.Context) error
+	UsageStats() ai.UsageStats
+}
+
+var _ AI = (*ai.Client)(nil)
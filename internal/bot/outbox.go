@@ -0,0 +1,214 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// outboxItem 重试后仍没发出去的一条回复
+type outboxItem struct {
+	Peer     int64     `json:"peer"`
+	GroupID  int64     `json:"group_id,omitempty"`
+	Text     string    `json:"text"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// outbox 待发箱，持久化到 outbox.json，连接恢复后补发
+type outbox struct {
+	mu       sync.Mutex
+	path     string
+	items    []outboxItem
+	notified bool // 本轮积压是否已通知过 owner，清空后重置
+}
+
+func newOutbox(path string) *outbox {
+	o := &outbox{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("read outbox failed", "file", path, "error", err)
+		}
+		return o
+	}
+	if err := json.Unmarshal(data, &o.items); err != nil {
+		// 留着损坏的文件供排查，下次保存不会覆盖它
+		corrupt := path + ".corrupt"
+		logger.Error("outbox corrupt, queued replies lost", "file", path, "moved_to", corrupt, "error", err)
+		if err := os.Rename(path, corrupt); err != nil {
+			logger.Warn("move corrupt outbox aside failed", "error", err)
+		}
+		o.items = nil
+	}
+	return o
+}
+
+// Push 追加并立即保存
+func (o *outbox) Push(items ...outboxItem) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.items = append(o.items, items...)
+	if err := o.save(); err != nil {
+		logger.Error("save outbox failed", "error", err)
+	}
+}
+
+// Head 返回最早的待发消息，待发箱为空时 ok 为 false；发出去或丢弃后再 Pop，补发期间新 Push 的排在它后面
+func (o *outbox) Head() (it outboxItem, ok bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.items) == 0 {
+		return outboxItem{}, false
+	}
+	return o.items[0], true
+}
+
+// Pop 移除最早的待发消息并保存
+func (o *outbox) Pop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.items) == 0 {
+		return
+	}
+	o.items = o.items[1:]
+	if err := o.save(); err != nil {
+		logger.Error("save outbox failed", "error", err)
+	}
+}
+
+// Len 待发消息数
+func (o *outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.items)
+}
+
+// ShouldNotify 最早的待发消息已积压超过 after 且本轮还没通知过时返回 true；待发箱为空时重置
+func (o *outbox) ShouldNotify(now time.Time, after time.Duration) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.items) == 0 {
+		o.notified = false
+		return false
+	}
+	if o.notified || after <= 0 || now.Sub(o.items[0].QueuedAt) < after {
+		return false
+	}
+	o.notified = true
+	return true
+}
+
+// save 先写临时文件再重命名，崩溃时不会留下写了一半的 outbox.json
+func (o *outbox) save() error {
+	data, err := json.MarshalIndent(o.items, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal outbox: %w", err)
+	}
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write outbox: %w", err)
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename outbox: %w", err)
+	}
+	return nil
+}
+
+// outboxInterval 检查待发箱的间隔
+const outboxInterval = 15 * time.Second
+
+// sendRetryBaseDelay 发送失败重试的初始退避，每次翻倍
+const sendRetryBaseDelay = time.Second
+
+// queueUnsent 把没发出去的回复放进待发箱
+func (b *Bot) queueUnsent(peer, groupID int64, parts []string) {
+	now := time.Now()
+	items := make([]outboxItem, len(parts))
+	for i, part := range parts {
+		items[i] = outboxItem{Peer: peer, GroupID: groupID, Text: part, QueuedAt: now}
+	}
+	b.outbox.Push(items...)
+	sendFailures.Add(int64(len(parts)))
+	logger.Warn("reply not delivered, queued in outbox", "peer", peer, "group", groupID, "parts", len(parts))
+}
+
+// watchOutbox 连接正常时补发待发箱，积压太久时通知 owner
+func (b *Bot) watchOutbox(ctx context.Context) {
+	ticker := time.NewTicker(outboxInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// 静默模式下不补发，留在待发箱里等关闭后再发
+		if ws := b.ws.Load(); ws != nil && ws.Alive() && b.outbox.Len() > 0 && !b.silent.Load() {
+			b.redeliver()
+		}
+		after := time.Duration(b.cfg.Bot.OutboxNotifyAfterSec) * time.Second
+		if b.outbox.ShouldNotify(time.Now(), after) {
+			text := fmt.Sprintf("%d replies not delivered for over %s", b.outbox.Len(), after)
+			b.notifyOwnerQQ("[style-bot] " + text)
+			b.alertOwner(ctx, "style-bot outbox", text)
+		}
+	}
+}
+
+// redeliver 从最早的开始依次补发，过期的丢弃；发出去才移出待发箱，遇到失败停下，顺序不变
+func (b *Bot) redeliver() {
+	zctx := anyBot()
+	if zctx == nil {
+		return
+	}
+	maxAge := time.Duration(b.cfg.Bot.OutboxMaxAgeSec) * time.Second
+	for {
+		it, ok := b.outbox.Head()
+		if !ok {
+			return
+		}
+		if maxAge > 0 && time.Since(it.QueuedAt) > maxAge {
+			logger.Info("dropping stale outbox message", "peer", it.Peer, "group", it.GroupID, "age", time.Since(it.QueuedAt).Truncate(time.Second))
+			b.outbox.Pop()
+			continue
+		}
+		id := b.sendPartTo(zctx, it.Peer, it.GroupID, it.Text, 0)
+		if id == 0 {
+			return
+		}
+		b.outbox.Pop()
+		logger.Info("outbox message delivered", "peer", it.Peer, "group", it.GroupID)
+		b.record(auditEntry{Direction: auditOut, Peer: it.Peer, GroupID: it.GroupID, MessageID: id, Text: it.Text})
+		if it.GroupID == 0 {
+			b.sessionFor(it.Peer).AddBotReply(it.Text)
+		}
+	}
+}
+
+// notifyOwnerQQ 不依赖事件上下文给 owner 发私聊，没有连接时忽略
+func (b *Bot) notifyOwnerQQ(text string) {
+	if b.cfg.Bot.OwnerQQ == 0 {
+		return
+	}
+	if zctx := anyBot(); zctx != nil {
+		zctx.SendPrivateMessage(b.cfg.Bot.OwnerQQ, message.Text(text))
+	}
+}
+
+// anyBot 返回任意一个已连接的 bot 实例（只连一个 NapCat），没有时返回 nil
+func anyBot() *zero.Ctx {
+	var zctx *zero.Ctx
+	zero.RangeBot(func(_ int64, c *zero.Ctx) bool {
+		zctx = c
+		return false
+	})
+	return zctx
+}
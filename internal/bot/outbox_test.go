@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOutboxKeepsOrderUntilPopped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	o := newOutbox(path)
+	now := time.Now()
+	o.Push(outboxItem{Peer: 1, Text: "a", QueuedAt: now}, outboxItem{Peer: 1, Text: "b", QueuedAt: now})
+
+	// 补发 a 失败期间又排进来一条，a、b 仍在它前面
+	if it, ok := o.Head(); !ok || it.Text != "a" {
+		t.Fatalf("head = %q, %v, want a", it.Text, ok)
+	}
+	o.Push(outboxItem{Peer: 1, Text: "c", QueuedAt: now})
+	o.Pop()
+
+	o = newOutbox(path)
+	var got []string
+	for {
+		it, ok := o.Head()
+		if !ok {
+			break
+		}
+		got = append(got, it.Text)
+		o.Pop()
+	}
+	if len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Errorf("reloaded outbox = %q, want [b c]", got)
+	}
+}
+
+func TestOutboxMovesCorruptFileAside(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	if err := os.WriteFile(path, []byte(`[{"peer":1,"te`), 0644); err != nil {
+		t.Fatalf("write outbox: %v", err)
+	}
+	o := newOutbox(path)
+	if o.Len() != 0 {
+		t.Errorf("loaded %d items from a corrupt outbox", o.Len())
+	}
+	if _, err := os.Stat(path + ".corrupt"); err != nil {
+		t.Errorf("corrupt outbox not kept: %v", err)
+	}
+}
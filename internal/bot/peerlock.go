@@ -0,0 +1,26 @@
+package bot
+
+import "sync"
+
+// peerLocks 按私聊对象串行执行：收到的消息记入会话、回复的发送和记录、追加消息都在对象的锁里进行，
+// 所以追加消息不会插在对方的新消息和 bot 的回复之间
+type peerLocks struct {
+	mu    sync.Mutex
+	locks map[int64]*sync.Mutex
+}
+
+// Lock 占住 peer，返回解锁函数
+func (p *peerLocks) Lock(peer int64) func() {
+	p.mu.Lock()
+	if p.locks == nil {
+		p.locks = make(map[int64]*sync.Mutex)
+	}
+	l := p.locks[peer]
+	if l == nil {
+		l = &sync.Mutex{}
+		p.locks[peer] = l
+	}
+	p.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/liao/style-bot/internal/config"
+	"github.com/liao/style-bot/internal/persona"
+	"github.com/liao/style-bot/internal/rag"
+)
+
+// peerDirs target_qq 和 allow_qq 各自的数据目录：persona_file 同目录下的 <QQ号>/（data-importer -target-multiple 生成后按 QQ 号改名）
+func peerDirs(cfg *config.Config) map[int64]string {
+	if cfg.Data.PersonaFile == "" {
+		return nil
+	}
+	dir := filepath.Dir(cfg.Data.PersonaFile)
+	dirs := make(map[int64]string)
+	for _, qq := range append([]int64{cfg.Bot.TargetQQ}, cfg.Bot.AllowQQ...) {
+		if qq != 0 {
+			dirs[qq] = filepath.Join(dir, strconv.FormatInt(qq, 10))
+		}
+	}
+	return dirs
+}
+
+// loadPeerPersonas 读取各对象数据目录下的 persona.json；没有单独人设的对象用全局 persona
+func loadPeerPersonas(cfg *config.Config) map[int64]*persona.Persona {
+	peers := make(map[int64]*persona.Persona)
+	for qq, dir := range peerDirs(cfg) {
+		path := filepath.Join(dir, "persona.json")
+		p, err := persona.LoadFromFile(path)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				logger.Warn("load peer persona failed, using default", "peer", qq, "path", path, "error", err)
+			}
+			continue
+		}
+		peers[qq] = p
+		logger.Info("peer persona loaded", "peer", qq, "path", path)
+	}
+	return peers
+}
+
+// LoadPeerPipelines 读取各对象数据目录下的 vectors/，open 按目录打开向量库并建好检索流程；
+// 没有单独向量库的对象用全局的。在 Run 之前调用
+func (b *Bot) LoadPeerPipelines(open func(vectorsDir string) (*rag.Pipeline, error)) {
+	b.peerRAG = make(map[int64]*rag.Pipeline)
+	for qq, dir := range peerDirs(b.cfg) {
+		path := filepath.Join(dir, "vectors")
+		if _, err := os.Stat(path); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				logger.Warn("stat peer vectors failed, using default", "peer", qq, "path", path, "error", err)
+			}
+			continue
+		}
+		pipeline, err := open(path)
+		if err != nil {
+			logger.Warn("load peer vectors failed, using default", "peer", qq, "path", path, "error", err)
+			continue
+		}
+		b.peerRAG[qq] = pipeline
+		logger.Info("peer vectors loaded", "peer", qq, "path", path)
+	}
+}
+
+// ragFor 对方有单独的向量库时用它，否则用全局的
+func (b *Bot) ragFor(peerID int64) *rag.Pipeline {
+	if p, ok := b.peerRAG[peerID]; ok {
+		return p
+	}
+	return b.rag
+}
+
+// personaFor 对方有单独的人设时用它，否则用全局 persona
+func (b *Bot) personaFor(peerID int64) *persona.Persona {
+	if p, ok := b.peerPersonas[peerID]; ok {
+		return p
+	}
+	return b.persona.Load()
+}
@@ -0,0 +1,55 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/liao/style-bot/internal/logging"
+	"github.com/liao/style-bot/internal/platform"
+)
+
+// HandlePlatformMessage 处理 QQ 之外的平台（如 webhook）收到的私聊消息，回复同步返回而不是主动发送，多条回复用换行拼接
+func (b *Bot) HandlePlatformMessage(ctx context.Context, msg platform.Message) (string, error) {
+	parts, err := b.Respond(ctx, msg.From, msg.Text)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// Respond 走一遍私聊回复流程（respond）并返回要发的各条回复（不需要回复时为空）：
+// 不模拟打字延迟、引用和错字；升级和敏感话题只在连着 QQ 时通知 owner。
+// 演练模式下回复只写日志并转发给 owner（连着 QQ 时），不返回。只有 ctx 被取消时返回错误
+func (b *Bot) Respond(ctx context.Context, userID int64, text string) ([]string, error) {
+	sink := &platformSink{b: b, peer: userID, dryRun: b.cfg.Bot.DryRun}
+	_, err := b.respondPlatform(ctx, userID, text, sink)
+	return sink.parts, err
+}
+
+// Response 一次回复的结果和生成细节，本地调试（cmd/chat-cli）和评估（cmd/eval）用
+type Response struct {
+	Parts    []string
+	Examples int    // RAG 检索到的示例数
+	Prompt   string // 组装好的 system prompt，没走到生成（预设话术等）时为空
+	Model    string // 生成用的模型，没走到生成时为空
+	Raw      string // 后处理（过滤 AI 味、补表情）之前的模型输出
+}
+
+// RespondDetailed 同 Respond，另外返回检索和 prompt 等细节；不管演练模式，总是返回要发的回复（本地调试不会发出去）
+func (b *Bot) RespondDetailed(ctx context.Context, userID int64, text string) (Response, error) {
+	sink := &platformSink{b: b, peer: userID}
+	r, err := b.respondPlatform(ctx, userID, text, sink)
+	r.Parts = sink.parts
+	return r, err
+}
+
+func (b *Bot) respondPlatform(ctx context.Context, userID int64, text string, sink *platformSink) (Response, error) {
+	messagesReceived.Inc()
+	userMsg := strings.TrimSpace(text)
+	if userMsg == "" {
+		return Response{}, nil
+	}
+	logger.Info("received platform message", "from", userID, logging.Content("text", userMsg))
+	return b.respond(ctx, inbound{peerID: userID, text: userMsg, received: time.Now()}, sink)
+}
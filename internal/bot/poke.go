@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+
+	"github.com/liao/style-bot/internal/ai"
+	"github.com/liao/style-bot/internal/chat"
+)
+
+// 拍一拍
+const (
+	pokeEventText          = "(对方拍了拍你)"
+	pokeBackText           = "(你拍了拍对方)"
+	defaultPokeCooldownSec = 60
+)
+
+// pokeCooldown 拍一拍冷却，防止互拍死循环
+type pokeCooldown struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// Allow 距上次响应超过 cooldown 时返回 true 并记录本次
+func (c *pokeCooldown) Allow(now time.Time, cooldown time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.last.IsZero() && now.Sub(c.last) < cooldown {
+		return false
+	}
+	c.last = now
+	return true
+}
+
+// handlePoke 对方私聊拍了拍 bot：记入会话，按概率拍回去，否则生成一句短回复
+func (b *Bot) handlePoke(ctx context.Context, zctx *zero.Ctx) {
+	if zctx.Event.GroupID != 0 {
+		return // 只处理私聊里的拍一拍
+	}
+	received := time.Now()
+	sess := b.sessionFor(zctx.Event.UserID)
+	sess.AddUserMessage(pokeEventText, 0)
+	b.record(auditEntry{TS: received, Direction: auditIn, Peer: zctx.Event.UserID, Text: pokeEventText})
+
+	if b.silent.Load() || b.cfg.Bot.DryRun || b.paused.Paused(zctx.Event.UserID, received) {
+		return
+	}
+	cooldown := time.Duration(b.cfg.Bot.PokeCooldownSec) * time.Second
+	if cooldown <= 0 {
+		cooldown = defaultPokeCooldownSec * time.Second
+	}
+	if !b.poke.Allow(received, cooldown) {
+		logger.Debug("poke ignored during cooldown", "from", zctx.Event.UserID)
+		return
+	}
+	logger.Info("poked", "from", zctx.Event.UserID)
+	time.Sleep(b.randomDelay())
+
+	if rand.Float32() < b.cfg.Bot.PokeBackProbability {
+		zctx.FriendPoke(zctx.Event.UserID)
+		b.record(auditEntry{Direction: auditOut, Peer: zctx.Event.UserID, Text: pokeBackText, LatencyMs: time.Since(received).Milliseconds()})
+		sess.AddBotReply(pokeBackText)
+	} else {
+		reply, gen := b.pokeReply(ctx, sess)
+		b.auditReply(zctx.Event.UserID, 0, zctx.Send(b.renderPart(reply)).ID(), reply, received, gen, 0)
+		sess.AddBotReply(reply)
+	}
+
+	go func() {
+		if err := b.chat.Save(); err != nil {
+			logger.Error("save session failed", "error", err)
+		}
+	}()
+}
+
+// pokeReply 用人设生成一句对拍一拍的短回复，只取第一条；陌生人的单独会话不带关系描述
+func (b *Bot) pokeReply(ctx context.Context, sess *chat.Manager) (string, generation) {
+	var styleText, relationText string
+	targetName := b.cfg.Bot.TargetName
+	if p := b.persona.Load(); p != nil {
+		styleText = p.FormatStyleForPrompt()
+		if sess == b.chat {
+			relationText = p.FormatRelationshipForPrompt(b.cfg.Bot.TargetName)
+		}
+	}
+	if sess != b.chat {
+		targetName = strangerName
+	}
+	systemPrompt, err := b.prompt.Build(ai.RolePlayContext{
+		MyName:              b.cfg.Bot.MyName,
+		TargetName:          targetName,
+		StyleProfile:        styleText,
+		RelationshipProfile: relationText,
+		Summary:             sess.Summary(),
+		CurrentDateTime:     b.now(),
+	})
+	if err != nil {
+		return "拍我干嘛", fallbackGen("")
+	}
+	history := sess.PriorHistory()
+	reply, model, err := b.ai.GenerateChatWithModel(ctx, systemPrompt, history, pokeEventText+"，像平时那样随口回一句")
+	if err != nil {
+		logger.Warn("generate poke reply failed", "error", err)
+		return "拍我干嘛", fallbackGen("")
+	}
+	if parts := ai.SplitMultiMessage(ai.FilterAIPatterns(reply)); len(parts) > 0 && parts[0] != "" {
+		return parts[0], generation{Model: model}
+	}
+	return "拍我干嘛", fallbackGen("")
+}
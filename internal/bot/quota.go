@@ -0,0 +1,125 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// quotaState 回复配额计数，持久化到 state.json，跨重启保留
+type quotaState struct {
+	Day        string                `json:"day"` // bot.timezone 下的日期 2006-01-02，变化即午夜重置
+	DailyCount int                   `json:"daily_count"`
+	PeerSends  map[int64][]time.Time `json:"peer_sends"` // 每个对象最近一小时内的回复时间
+	Notified   map[int64]bool        `json:"notified"`   // 本轮超限是否已发过"等下再聊"
+}
+
+// quota 每日总回复上限 + 单个对象每小时回复上限
+type quota struct {
+	mu         sync.Mutex
+	path       string
+	loc        *time.Location // 按这个时区判断跨天（bot.timezone）
+	maxPerDay  int            // 0 = 不限制
+	maxPerHour int            // 0 = 不限制
+	state      quotaState
+}
+
+func newQuota(path string, loc *time.Location, maxPerDay, maxPerHour int) *quota {
+	q := &quota{path: path, loc: loc, maxPerDay: maxPerDay, maxPerHour: maxPerHour}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &q.state)
+	}
+	if q.state.PeerSends == nil {
+		q.state.PeerSends = make(map[int64][]time.Time)
+	}
+	if q.state.Notified == nil {
+		q.state.Notified = make(map[int64]bool)
+	}
+	return q
+}
+
+// Allow 检查是否还能给 peer 回复；返回拒绝原因（空表示允许）
+func (q *quota) Allow(peer int64, now time.Time) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.resetIfNewDay(now)
+	if q.maxPerDay > 0 && q.state.DailyCount >= q.maxPerDay {
+		return fmt.Sprintf("daily reply cap %d reached", q.maxPerDay)
+	}
+	if q.maxPerHour > 0 && len(q.recent(peer, now)) >= q.maxPerHour {
+		return fmt.Sprintf("hourly reply cap %d reached for peer", q.maxPerHour)
+	}
+	delete(q.state.Notified, peer)
+	return ""
+}
+
+// Record 记录一次回复
+func (q *quota) Record(peer int64, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.resetIfNewDay(now)
+	q.state.DailyCount++
+	q.state.PeerSends[peer] = append(q.recent(peer, now), now)
+}
+
+// MarkNotified 标记已经给 peer 发过超限提示，返回之前是否已发过
+func (q *quota) MarkNotified(peer int64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.state.Notified[peer] {
+		return true
+	}
+	q.state.Notified[peer] = true
+	return false
+}
+
+// Save 持久化计数：先写临时文件再重命名，崩溃时不会留下写了一半的 state.json
+func (q *quota) Save() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	data, err := json.MarshalIndent(q.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal quota state: %w", err)
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write quota state: %w", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename quota state: %w", err)
+	}
+	return nil
+}
+
+func (q *quota) resetIfNewDay(now time.Time) {
+	day := now.In(q.loc).Format("2006-01-02")
+	if q.state.Day != day {
+		q.state.Day = day
+		q.state.DailyCount = 0
+		q.state.Notified = make(map[int64]bool)
+	}
+}
+
+// recent 返回 peer 最近一小时内的回复时间，顺便清理过期记录
+func (q *quota) recent(peer int64, now time.Time) []time.Time {
+	sends := q.state.PeerSends[peer]
+	cutoff := now.Add(-time.Hour)
+	i := 0
+	for i < len(sends) && !sends[i].After(cutoff) {
+		i++
+	}
+	sends = sends[i:]
+	if len(sends) == 0 {
+		delete(q.state.PeerSends, peer)
+	} else {
+		q.state.PeerSends[peer] = sends
+	}
+	return sends
+}
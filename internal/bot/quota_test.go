@@ -0,0 +1,37 @@
+package bot
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQuotaResetsAtMidnightInBotTimezone(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	q := newQuota(filepath.Join(t.TempDir(), "state.json"), shanghai, 1, 0)
+
+	// 北京时间 23:30，UTC 还是同一天 15:30
+	q.Record(1, time.Date(2024, 5, 1, 15, 30, 0, 0, time.UTC))
+	if reason := q.Allow(1, time.Date(2024, 5, 1, 15, 45, 0, 0, time.UTC)); reason == "" {
+		t.Fatal("second reply on the same day was allowed")
+	}
+	// 北京时间已过午夜，UTC 仍是 5 月 1 日
+	if reason := q.Allow(1, time.Date(2024, 5, 1, 16, 30, 0, 0, time.UTC)); reason != "" {
+		t.Errorf("reply after midnight in bot timezone refused: %s", reason)
+	}
+}
+
+func TestQuotaSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	q := newQuota(path, time.UTC, 1, 0)
+	q.Record(1, now)
+	if err := q.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	q = newQuota(path, time.UTC, 1, 0)
+	if reason := q.Allow(2, now.Add(time.Minute)); reason == "" {
+		t.Error("daily cap forgotten after restart")
+	}
+}
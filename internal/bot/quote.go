@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"math/rand/v2"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/liao/style-bot/internal/chat"
+)
+
+// quoteTarget 决定第一条回复是否引用对方的消息，返回要引用的 message_id（0 = 不引用）
+// 开启 quote_reply 时总是引用；生成期间对方又发了新消息时也总是引用，避免回复对不上；
+// 否则按 quote_reply_probability 随机引用。拿不到 message_id 时不引用
+func (b *Bot) quoteTarget(session *chat.Manager, msgID int64) int64 {
+	if msgID == 0 {
+		return 0
+	}
+	if b.cfg.Bot.QuoteReply || session.LastUserMessageID() != msgID {
+		return msgID
+	}
+	if rand.Float32() < b.cfg.Bot.QuoteReplyProbability {
+		return msgID
+	}
+	return 0
+}
+
+// sendPart 发送一条回复给事件的来源（私聊对象或群），失败时按 send_retries 退避重试，返回消息 ID（0 = 最终失败）；
+// quoteID 非 0 时带引用。演练模式下只转发给 owner
+func (b *Bot) sendPart(zctx *zero.Ctx, part string, quoteID int64) int64 {
+	return b.sendPartTo(zctx, zctx.Event.UserID, zctx.Event.GroupID, part, quoteID)
+}
+
+// sendPartTo 同 sendPart，但发给指定的私聊对象或群（groupID 非 0），补发待发箱时 zctx 没有事件
+func (b *Bot) sendPartTo(zctx *zero.Ctx, peer, groupID int64, part string, quoteID int64) int64 {
+	if b.cfg.Bot.DryRun {
+		return b.dryRunSend(zctx, peer, groupID, part)
+	}
+	delay := sendRetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		if id := b.sendOnce(zctx, peer, groupID, part, quoteID); id != 0 {
+			return id
+		}
+		if attempt >= b.cfg.Bot.SendRetries {
+			return 0
+		}
+		logger.Warn("send failed, retrying", "attempt", attempt+1, "delay", delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// sendOnce 发送一次；quoteID 非 0 时带引用，引用失效（如消息已撤回）发送失败则去掉引用重发
+func (b *Bot) sendOnce(zctx *zero.Ctx, peer, groupID int64, part string, quoteID int64) int64 {
+	send := func(msg message.Message) int64 {
+		if groupID != 0 {
+			return zctx.SendGroupMessage(groupID, msg)
+		}
+		return zctx.SendPrivateMessage(peer, msg)
+	}
+	msg := b.renderPart(part)
+	if quoteID != 0 {
+		quoted := append(message.Message{message.Reply(quoteID)}, msg...)
+		if id := send(quoted); id != 0 {
+			return id
+		}
+		logger.Warn("quoted reply failed, sending without quote", "quote_id", quoteID)
+	}
+	return send(msg)
+}
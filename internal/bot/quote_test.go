@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/tidwall/gjson"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// fakeCaller 记录 API 调用的 OneBot 端；rejectQuotes 时带引用的消息发送失败（如被引用的消息已撤回）
+type fakeCaller struct {
+	mu           sync.Mutex
+	sent         []message.Message
+	rejectQuotes bool
+}
+
+func (c *fakeCaller) CallAPI(_ context.Context, req zero.APIRequest) (zero.APIResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	msg, _ := req.Params["message"].(message.Message)
+	c.sent = append(c.sent, msg)
+	if c.rejectQuotes && len(msg) > 0 && msg[0].Type == "reply" {
+		return zero.APIResponse{Status: "failed", RetCode: 1200, Message: "message not found"}, nil
+	}
+	return zero.APIResponse{Status: "ok", Data: gjson.Parse(`{"message_id": 7}`)}, nil
+}
+
+// newFakeCtx 用 caller 发消息的 zero.Ctx，selfID 在测试之间不要重复
+func newFakeCtx(t *testing.T, selfID int64, caller zero.APICaller) *zero.Ctx {
+	t.Helper()
+	zero.APICallers.Store(selfID, caller)
+	t.Cleanup(func() { zero.APICallers.Delete(selfID) })
+	return zero.GetBot(selfID)
+}
+
+func TestSendOnceFallsBackWhenQuoteIsInvalid(t *testing.T) {
+	b := newTestBot(t, &fakeAI{}, nil, nil)
+	caller := &fakeCaller{rejectQuotes: true}
+	zctx := newFakeCtx(t, 4201, caller)
+
+	if id := b.sendOnce(zctx, testTarget, 0, "好啊", 42); id != 7 {
+		t.Fatalf("message id = %d, want 7", id)
+	}
+	if len(caller.sent) != 2 {
+		t.Fatalf("sent %d messages, want the quoted attempt and the fallback", len(caller.sent))
+	}
+	if first := caller.sent[0]; len(first) != 2 || first[0].Type != "reply" || first[0].Data["id"] != "42" {
+		t.Errorf("first attempt = %+v, want a reply to 42", first)
+	}
+	if second := caller.sent[1]; len(second) != 1 || second[0].Type != "text" || second[0].Data["text"] != "好啊" {
+		t.Errorf("fallback = %+v, want the plain text", second)
+	}
+}
+
+func TestSendOnceKeepsValidQuote(t *testing.T) {
+	b := newTestBot(t, &fakeAI{}, nil, nil)
+	caller := &fakeCaller{}
+	zctx := newFakeCtx(t, 4202, caller)
+
+	if id := b.sendOnce(zctx, testTarget, 0, "好啊", 42); id != 7 {
+		t.Fatalf("message id = %d, want 7", id)
+	}
+	if len(caller.sent) != 1 || caller.sent[0][0].Type != "reply" {
+		t.Errorf("sent %+v, want one quoted message", caller.sent)
+	}
+}
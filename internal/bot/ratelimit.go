@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"sync"
+	"time"
+)
+
+// 入站限流
+const (
+	maxTrackedUsers = 1024             // 最多跟踪的用户数，超出时清理空闲的
+	userIdleEvict   = 10 * time.Minute // 空闲多久的用户可以被清理
+)
+
+// userBucket 单个用户的令牌桶
+type userBucket struct {
+	tokens   float64
+	last     time.Time
+	notified bool // 本轮超限已提醒过
+}
+
+// userLimiter 按 UserID 的令牌桶，容量和每分钟补充量都是 rpm
+type userLimiter struct {
+	mu      sync.Mutex
+	rpm     int // 0 = 不限制
+	buckets map[int64]*userBucket
+}
+
+func newUserLimiter(rpm int) *userLimiter {
+	return &userLimiter{rpm: rpm, buckets: make(map[int64]*userBucket)}
+}
+
+// Allow 消耗一个令牌；超限时返回 false，notify 表示这是本轮第一次超限（该发一次提醒）
+func (l *userLimiter) Allow(user int64, now time.Time) (ok, notify bool) {
+	if l.rpm <= 0 {
+		return true, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, exists := l.buckets[user]
+	if !exists {
+		if len(l.buckets) >= maxTrackedUsers {
+			l.evictIdle(now)
+		}
+		b = &userBucket{tokens: float64(l.rpm), last: now}
+		l.buckets[user] = b
+	}
+
+	b.tokens = min(float64(l.rpm), b.tokens+now.Sub(b.last).Minutes()*float64(l.rpm))
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		b.notified = false
+		return true, false
+	}
+	notify = !b.notified
+	b.notified = true
+	return false, notify
+}
+
+// evictIdle 清理长时间没发消息的用户；仍然太多时全部清空
+func (l *userLimiter) evictIdle(now time.Time) {
+	for id, b := range l.buckets {
+		if now.Sub(b.last) > userIdleEvict {
+			delete(l.buckets, id)
+		}
+	}
+	if len(l.buckets) >= maxTrackedUsers {
+		clear(l.buckets)
+	}
+}
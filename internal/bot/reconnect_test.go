@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/liao/style-bot/internal/config"
+)
+
+// fakeNapCat 假的 NapCat 正向 WebSocket：第 i 次连接推送 conns[i] 里的事件，应答所有 API 调用并记录发出的私聊消息，
+// 收到回复后断开让 bot 重连；预设的连接用完后保持连接直到 quit 关闭
+type fakeNapCat struct {
+	t     *testing.T
+	conns [][]string
+	sent  chan struct{}
+	quit  chan struct{}
+
+	mu    sync.Mutex
+	conn  int
+	sends []int // 每条私聊回复是第几次连接上发的
+}
+
+func privateMessageEvent(id int64, text string) string {
+	return fmt.Sprintf(`{"post_type":"message","message_type":"private","sub_type":"friend","time":%d,"self_id":999,`+
+		`"message_id":%d,"user_id":%d,"message":[{"type":"text","data":{"text":%q}}],"raw_message":%q,"sender":{"user_id":%d,"nickname":"小王"}}`,
+		time.Now().Unix(), id, testTarget, text, text, testTarget)
+}
+
+func (f *fakeNapCat) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		f.t.Errorf("upgrade: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	f.mu.Lock()
+	n := f.conn
+	f.conn++
+	f.mu.Unlock()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"post_type":"meta_event","meta_event_type":"lifecycle","self_id":999}`))
+	if n < len(f.conns) {
+		for _, evt := range f.conns[n] {
+			conn.WriteMessage(websocket.TextMessage, []byte(evt))
+		}
+	}
+	// 应答 API 调用；推送过事件的连接在回复发出、再安静一会儿后断开
+	for {
+		select {
+		case <-f.quit:
+			return
+		default:
+		}
+		conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		_, data, err := conn.ReadMessage()
+		if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+			if n < len(f.conns) && f.sendsOn(n) > 0 {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			return
+		}
+		var req struct {
+			Action string          `json:"action"`
+			Echo   json.RawMessage `json:"echo"`
+		}
+		if err := json.Unmarshal(data, &req); err != nil {
+			continue
+		}
+		if req.Action == "send_private_msg" || req.Action == "send_msg" {
+			f.mu.Lock()
+			f.sends = append(f.sends, n)
+			f.mu.Unlock()
+			f.sent <- struct{}{}
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"status":"ok","retcode":0,"data":{"message_id":%d},"echo":%s}`, time.Now().UnixNano(), req.Echo)))
+	}
+}
+
+func (f *fakeNapCat) sendsOn(conn int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.sends {
+		if c == conn {
+			n++
+		}
+	}
+	return n
+}
+
+func TestReconnectRepliesOncePerMessage(t *testing.T) {
+	napcat := &fakeNapCat{
+		t: t,
+		conns: [][]string{
+			{privateMessageEvent(1, "在吗")},
+			// 重连后 NapCat 重推了上一条，又来了一条新的
+			{privateMessageEvent(1, "在吗"), privateMessageEvent(2, "周末去爬山吗")},
+		},
+		sent: make(chan struct{}, 16),
+		quit: make(chan struct{}),
+	}
+	srv := httptest.NewServer(napcat)
+	defer srv.Close()
+
+	fake := &fakeAI{reply: "在呢"}
+	b := newTestBot(t, fake, nil, func(cfg *config.Config) {
+		cfg.NapCat.WSURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+		cfg.Bot.MaxRepliesPerDay = 0
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		close(napcat.quit)
+		<-done
+	}()
+
+	for range 2 {
+		select {
+		case <-napcat.sent:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for replies, got %d generations", fake.calls())
+		}
+	}
+	// 等一会儿，重复的事件或重复注册的处理器会带来多余的回复
+	time.Sleep(500 * time.Millisecond)
+
+	if got := fake.calls(); got != 2 {
+		t.Errorf("generated %d replies, want 2", got)
+	}
+	if first, second := napcat.sendsOn(0), napcat.sendsOn(1); first != 1 || second != 1 {
+		t.Errorf("sent %d replies on the first connection and %d after reconnecting, want 1 and 1", first, second)
+	}
+}
@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/liao/style-bot/internal/logging"
+)
+
+// 好友申请 / 群邀请的处理策略（requests.allow_qq 里的人总是自动同意）
+const (
+	requestIgnore = "ignore" // 不处理（默认）
+	requestReject = "reject" // 自动拒绝
+	requestOwner  = "owner"  // 转给 owner，/approve <flag> 或 /reject <flag> 决定
+)
+
+// pendingRequest 等 owner 决定的申请
+type pendingRequest struct {
+	kind    string // friend / group
+	subType string // 群请求的 add / invite
+	userID  int64
+	groupID int64
+	comment string
+	at      time.Time
+}
+
+func (r pendingRequest) String() string {
+	if r.kind == "friend" {
+		return fmt.Sprintf("friend request from %d: %q", r.userID, r.comment)
+	}
+	return fmt.Sprintf("group %s %d from %d: %q", r.subType, r.groupID, r.userID, r.comment)
+}
+
+// LogValue 日志里的申请，附言按 logging.redact_content 脱敏
+func (r pendingRequest) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.String("kind", r.kind), slog.Int64("from", r.userID)}
+	if r.kind != "friend" {
+		attrs = append(attrs, slog.String("sub_type", r.subType), slog.Int64("group", r.groupID))
+	}
+	return slog.GroupValue(append(attrs, logging.Content("comment", r.comment))...)
+}
+
+// pendingRequests 按 flag 保存的待决定申请，只在内存里，重启后丢失（NapCat 那边仍会保留）
+type pendingRequests struct {
+	mu    sync.Mutex
+	items map[string]pendingRequest
+}
+
+func (p *pendingRequests) Add(flag string, r pendingRequest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.items == nil {
+		p.items = make(map[string]pendingRequest)
+	}
+	p.items[flag] = r
+}
+
+// Take 取出并删除
+func (p *pendingRequests) Take(flag string) (pendingRequest, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r, ok := p.items[flag]
+	delete(p.items, flag)
+	return r, ok
+}
+
+// List 按时间列出，/approve 不带参数时显示
+func (p *pendingRequests) List() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.items) == 0 {
+		return "no pending requests"
+	}
+	flags := make([]string, 0, len(p.items))
+	for flag := range p.items {
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return p.items[flags[i]].at.Before(p.items[flags[j]].at) })
+	lines := make([]string, len(flags))
+	for i, flag := range flags {
+		lines[i] = flag + "  " + p.items[flag].String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handleRequest 处理好友申请和加群请求/邀请
+func (b *Bot) handleRequest(zctx *zero.Ctx) {
+	ev := zctx.Event
+	r := pendingRequest{kind: ev.RequestType, subType: ev.SubType, userID: ev.UserID, groupID: ev.GroupID, comment: ev.Comment, at: time.Now()}
+	policy := b.cfg.Bot.Requests.FriendPolicy
+	if r.kind == "group" {
+		policy = b.cfg.Bot.Requests.GroupPolicy
+	}
+	if slices.Contains(b.cfg.Bot.Requests.AllowQQ, r.userID) {
+		b.decideRequest(zctx, ev.Flag, r, true, "allowlisted")
+		return
+	}
+	switch policy {
+	case requestReject:
+		b.decideRequest(zctx, ev.Flag, r, false, "policy")
+	case requestOwner:
+		if b.cfg.Bot.OwnerQQ == 0 {
+			logger.Warn("request policy is owner but owner_qq is not set, ignoring", "request", r)
+			return
+		}
+		b.requests.Add(ev.Flag, r)
+		logger.Info("request forwarded to owner", "flag", ev.Flag, "request", r)
+		zctx.SendPrivateMessage(b.cfg.Bot.OwnerQQ, message.Text(fmt.Sprintf(
+			"[style-bot] %s\n/approve %s 同意，/reject %s 拒绝", r, ev.Flag, ev.Flag)))
+	default:
+		logger.Info("request ignored", "request", r)
+	}
+}
+
+// decideRequest 同意或拒绝申请并记录结果；同意好友不会让对方成为回复对象，除非在 allow_qq 里
+func (b *Bot) decideRequest(zctx *zero.Ctx, flag string, r pendingRequest, approve bool, reason string) error {
+	var rsp zero.APIResponse
+	if r.kind == "friend" {
+		rsp = zctx.CallAction("set_friend_add_request", zero.Params{"flag": flag, "approve": approve})
+	} else {
+		rsp = zctx.CallAction("set_group_add_request", zero.Params{"flag": flag, "sub_type": r.subType, "approve": approve})
+	}
+	if rsp.Status != "ok" {
+		err := fmt.Errorf("%s (retcode %d)", rsp.Message, rsp.RetCode)
+		logger.Error("handle request failed", "request", r, "approve", approve, "error", err)
+		return err
+	}
+	logger.Info("request handled", "request", r, "approve", approve, "reason", reason)
+	return nil
+}
+
+// onRequestDecision /approve 和 /reject 命令
+func (b *Bot) onRequestDecision(zctx *zero.Ctx, approve bool) {
+	flag := commandArgs(zctx.State)
+	if flag == "" {
+		zctx.Send(message.Text(b.requests.List()))
+		return
+	}
+	r, ok := b.requests.Take(flag)
+	if !ok {
+		zctx.Send(message.Text("no pending request with flag " + flag))
+		return
+	}
+	if err := b.decideRequest(zctx, flag, r, approve, "owner"); err != nil {
+		b.requests.Add(flag, r)
+		zctx.Send(message.Text("failed: " + err.Error()))
+		return
+	}
+	zctx.Send(message.Text("done: " + r.String()))
+}
@@ -0,0 +1,267 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/liao/style-bot/internal/ai"
+)
+
+// outcomeKind 私聊消息的处理结论
+type outcomeKind int
+
+const (
+	outcomeNone     outcomeKind = iota // 不回复（暂停中、排队过久等）
+	outcomeFlood                       // 发太快，text 非空时发一次提醒
+	outcomeBlocked                     // 消息或生成的回复命中敏感话题
+	outcomeEscalate                    // 高风险消息，已暂停自动回复
+	outcomeQuota                       // 超出回复配额
+	outcomeReply                       // 正常回复，draft 为生成结果
+)
+
+// outcome decide 的结果，respond 按它发送
+type outcome struct {
+	kind    outcomeKind
+	text    string     // outcomeFlood：提醒话术
+	reason  string     // outcomeBlocked：命中的话题；outcomeEscalate、outcomeQuota：原因
+	trigger string     // outcomeBlocked：命中的文本
+	draft   replyDraft // outcomeReply
+	release func()     // outcomeReply：占用的生成名额，发完后调用
+}
+
+// decide 私聊消息记入会话之后的公共流程：刷屏、暂停、敏感话题、升级和配额检查，通过后检索并生成回复。
+// images 非空时 zctx 用于下载图片，其余情况 zctx 可以为 nil
+func (b *Bot) decide(ctx context.Context, zctx *zero.Ctx, peerID int64, userMsg string, images []message.Segment, received time.Time) outcome {
+	// 刷屏保护：单个用户发太快时只记录不生成，owner 不受限
+	if peerID != b.cfg.Bot.OwnerQQ {
+		if ok, notify := b.inbound.Allow(peerID, received); !ok {
+			logger.Warn("user sending too fast, skipping generation", "peer", peerID)
+			o := outcome{kind: outcomeFlood}
+			if notify {
+				o.text = b.cfg.Bot.FloodNotice
+			}
+			return o
+		}
+	}
+
+	// 已升级给 owner 的对象不再自动回复
+	if b.paused.Paused(peerID, received) {
+		logger.Info("peer paused after escalation, skipping", "peer", peerID)
+		return outcome{kind: outcomeNone}
+	}
+
+	// 敏感话题：不让模型即兴回答
+	if hit := b.topics.Match(userMsg); hit != "" {
+		blockedTopics.Inc()
+		return outcome{kind: outcomeBlocked, reason: hit, trigger: userMsg}
+	}
+
+	// 高风险消息：暂停自动回复，交给 owner 亲自处理
+	if high, reason := b.isHighStakes(ctx, userMsg); high {
+		b.paused.Pause(peerID, time.Duration(b.cfg.Bot.Escalation.PauseMinutes)*time.Minute)
+		logger.Warn("high-stakes message, escalating to owner", "peer", peerID, "reason", reason)
+		escalations.Inc()
+		return outcome{kind: outcomeEscalate, reason: reason}
+	}
+
+	// 回复配额：超限后只记录不生成
+	if reason := b.quota.Allow(peerID, received); reason != "" {
+		logger.Warn("reply quota exceeded, skipping generation", "peer", peerID, "reason", reason)
+		quotaExceeded.Inc()
+		return outcome{kind: outcomeQuota, reason: reason}
+	}
+
+	// 背压：限制并发生成，排队过久的消息不再回复（仍保留在会话里）
+	release, ok := b.limiter.Acquire(ctx, received)
+	if !ok {
+		return outcome{kind: outcomeNone}
+	}
+
+	d := b.draftReply(ctx, zctx, peerID, userMsg, images)
+	if hit := b.topics.Match(d.Reply); hit != "" {
+		release()
+		logger.Warn("generated reply hit blocked topic, not sending", "topic", hit)
+		blockedTopics.Inc()
+		return outcome{kind: outcomeBlocked, reason: hit, trigger: userMsg}
+	}
+	return outcome{kind: outcomeReply, draft: d, release: release}
+}
+
+// replySink 私聊回复的发送端：QQ 私聊主动发送，其他平台收集起来同步返回
+type replySink interface {
+	// send 发出一条回复，quoteID 非 0 时带引用；ok 为 false 表示重试后仍失败，id 为消息 ID（没有时为 0）
+	send(part string, quoteID int64) (id int64, ok bool)
+	// humanize 是否模拟打字间隔、错字和引用
+	humanize() bool
+}
+
+// qqSink 发给 QQ 事件的来源
+type qqSink struct {
+	b    *Bot
+	zctx *zero.Ctx
+}
+
+func (s qqSink) send(part string, quoteID int64) (int64, bool) {
+	id := s.b.sendPart(s.zctx, part, quoteID)
+	return id, id != 0
+}
+
+func (s qqSink) humanize() bool { return true }
+
+// platformSink 其他平台：回复收集起来由调用方同步返回；dryRun 时不收集，只写日志并转发给 owner（连着 QQ 时）
+type platformSink struct {
+	b      *Bot
+	peer   int64
+	dryRun bool
+	parts  []string
+}
+
+func (s *platformSink) send(part string, _ int64) (int64, bool) {
+	if s.dryRun {
+		return s.b.dryRunSend(anyBot(), s.peer, 0, part), true
+	}
+	s.parts = append(s.parts, part)
+	return 0, true
+}
+
+func (s *platformSink) humanize() bool { return false }
+
+// inbound 一条要回复的私聊消息
+type inbound struct {
+	peerID   int64
+	msgID    int64  // 0 = 没有（其他平台）
+	text     string // 用于检索和生成的文本
+	images   []message.Segment
+	zctx     *zero.Ctx // 只在 images 非空时用于下载图片
+	received time.Time
+}
+
+// respond 私聊回复的完整流程，QQ 私聊（handleMessage）和其他平台（RespondDetailed）共用：
+// 陌生人处理、记入会话和审计、静默模式、decide、各种预设话术、分条发送和收尾。
+// 返回的 Parts 是实际发出的模型回复（不含预设话术）；只有 ctx 被取消时返回错误
+func (b *Bot) respond(ctx context.Context, in inbound, sink replySink) (Response, error) {
+	peerID := in.peerID
+	switch b.accessFor(peerID) {
+	case peerDenied:
+		if peerID != b.cfg.Bot.OwnerQQ && b.strangers.Record(peerID, true, in.received) {
+			logger.Info("ignoring unknown sender", "from", peerID)
+		}
+		return Response{}, nil
+	case peerStranger:
+		// 陌生人：不用针对 target 的人设，固定回复模式下直接回一句
+		if b.strangers.Record(peerID, false, in.received) {
+			logger.Info("message from unknown sender", "from", peerID, "mode", b.othersMode())
+		}
+		if b.othersMode() == othersCanned {
+			if b.cfg.Bot.OthersReply != "" && !b.silent.Load() {
+				b.sendCanned(sink, peerID, b.cfg.Bot.OthersReply)
+			}
+			return Response{}, nil
+		}
+	}
+
+	// 添加到会话上下文
+	sess := b.sessionFor(peerID)
+	sessionText := in.text
+	if len(in.images) > 0 {
+		sessionText = strings.TrimSpace("[图片] " + in.text)
+	}
+	unlock := b.peerLocks.Lock(peerID)
+	sess.AddUserMessage(sessionText, in.msgID)
+	unlock()
+	b.record(auditEntry{TS: in.received, Direction: auditIn, Peer: peerID, MessageID: in.msgID, Text: sessionText})
+
+	// 静默模式：照常生成并写 silent_log，但不发送
+	if b.silent.Load() {
+		b.silentReply(ctx, in.zctx, peerID, in.text, in.images, in.received)
+		return Response{}, nil
+	}
+
+	o := b.decide(ctx, in.zctx, peerID, in.text, in.images, in.received)
+	switch o.kind {
+	case outcomeNone:
+		return Response{}, ctx.Err()
+	case outcomeFlood:
+		if o.text != "" {
+			b.sendCanned(sink, peerID, o.text)
+			sess.AddBotReply(o.text)
+		}
+		return Response{}, nil
+	case outcomeBlocked:
+		b.onBlockedTopic(sink, peerID, o.trigger, o.reason)
+		return Response{}, nil
+	case outcomeEscalate:
+		b.escalate(sink, peerID, o.reason)
+		return Response{}, nil
+	case outcomeQuota:
+		b.onQuotaExceeded(sink, peerID, o.reason)
+		return Response{}, nil
+	}
+	defer o.release()
+	d := o.draft
+
+	// 发送和记入会话期间不让追加消息插进来
+	unlock = b.peerLocks.Lock(peerID)
+	defer unlock()
+
+	// 分割多条消息并发送
+	parts := ai.SplitMultiMessage(d.Reply)
+	quoteID := b.quoteTarget(sess, in.msgID)
+	var sent []string
+	for i, part := range parts {
+		if i > 0 {
+			b.typingDelay(sink)
+		}
+		// 其他实例刚回复过，放弃本实例剩余的回复
+		if b.coord.OtherReplied(peerID) {
+			logger.Info("another instance replied, dropping pending reply", "peer", peerID, "remaining", len(parts)-i)
+			break
+		}
+		// 偶尔打个错字再补一句更正；会话里记录的是正确的文本，审计日志记录实际发出的错字和更正
+		text, correction := part, ""
+		if typo, corr, hit := injectTypo(part, b.cfg.Bot.TypoProbability); hit && sink.humanize() && !b.cfg.Bot.DryRun {
+			text, correction = typo, corr
+		}
+		sentID, ok := sink.send(text, quoteID)
+		if !ok {
+			// 重试后仍失败：这条和剩下的都进待发箱，会话里只记已发出的部分
+			b.queueUnsent(peerID, 0, parts[i:])
+			break
+		}
+		quoteID = 0 // 只有第一条带引用
+		b.auditReply(peerID, 0, sentID, text, in.received, d.Gen, len(d.Results))
+		if correction != "" {
+			time.Sleep(typoCorrectionWait)
+			if corrID, ok := sink.send(correction, 0); ok {
+				b.auditReply(peerID, 0, corrID, correction, in.received, d.Gen, len(d.Results))
+			}
+		}
+		sent = append(sent, part)
+		if err := b.coord.Announce(ctx, peerID); err != nil {
+			logger.Warn("announce reply failed", "error", err)
+		}
+	}
+	r := Response{Parts: sent, Examples: len(d.Results), Prompt: d.Prompt, Model: d.Gen.Model, Raw: d.Raw}
+	if len(sent) == 0 {
+		return r, nil
+	}
+	b.finishReply(ctx, peerID, in.msgID, in.text, sessionText, sent, in.received, d)
+	return r, nil
+}
+
+// typingDelay 模拟两条消息之间的打字间隔；不模拟的发送端不等，演练模式只记日志
+func (b *Bot) typingDelay(sink replySink) {
+	if !sink.humanize() {
+		return
+	}
+	delay := b.randomDelay()
+	if b.cfg.Bot.DryRun {
+		logger.Info("dry run, delay not slept", "delay", delay)
+		return
+	}
+	time.Sleep(delay)
+}
@@ -0,0 +1,293 @@
+package bot
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+
+	"github.com/liao/style-bot/internal/ai"
+	"github.com/liao/style-bot/internal/chat"
+	"github.com/liao/style-bot/internal/config"
+	"github.com/liao/style-bot/internal/rag"
+)
+
+// fakeAI 固定回复的模型，记录收到的生成请求
+type fakeAI struct {
+	mu       sync.Mutex
+	reply    string
+	prompts  []string
+	msgs     []string
+	history  [][]*genai.Content
+	rewrites [][]string
+}
+
+func (f *fakeAI) GenerateChat(ctx context.Context, systemPrompt string, history []*genai.Content, userMsg string) (string, error) {
+	reply, _, err := f.GenerateChatWithModel(ctx, systemPrompt, history, userMsg)
+	return reply, err
+}
+
+func (f *fakeAI) GenerateChatWithModel(_ context.Context, systemPrompt string, history []*genai.Content, userMsg string) (string, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prompts = append(f.prompts, systemPrompt)
+	f.msgs = append(f.msgs, userMsg)
+	f.history = append(f.history, history)
+	return f.reply, "fake-model", nil
+}
+
+func (f *fakeAI) GenerateChatWithImages(ctx context.Context, systemPrompt string, history []*genai.Content, userMsg string, _ []*genai.Part) (string, string, error) {
+	return f.GenerateChatWithModel(ctx, systemPrompt, history, userMsg)
+}
+
+func (f *fakeAI) RewriteQuery(_ context.Context, turns []string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rewrites = append(f.rewrites, turns)
+	return strings.Join(turns, "\n"), nil
+}
+
+func (f *fakeAI) ClassifySentiment(context.Context, string) (string, error) { return "", nil }
+
+func (f *fakeAI) ClassifyStakes(context.Context, string) (float32, error) { return 0, nil }
+
+func (f *fakeAI) Summarize(context.Context, string, []string) (string, error) { return "", nil }
+
+func (f *fakeAI) SummarizeDay(context.Context, []string, int) (string, error) { return "", nil }
+
+func (f *fakeAI) AnalyzeStyle(context.Context, string, int32, []string) (string, error) {
+	return "", nil
+}
+
+func (f *fakeAI) Transcribe(context.Context, []byte, string) (string, error) { return "", nil }
+
+func (f *fakeAI) WaitForToken(context.Context) error { return nil }
+
+func (f *fakeAI) UsageStats() ai.UsageStats { return ai.UsageStats{} }
+
+func (f *fakeAI) calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.msgs)
+}
+
+// runeEmbed 按字计数的假 embedding：字重合越多越相似
+func runeEmbed(_ context.Context, text string) ([]float32, error) {
+	vec := make([]float32, 64)
+	for _, r := range text {
+		h := fnv.New32a()
+		h.Write([]byte(string(r)))
+		vec[h.Sum32()%uint32(len(vec))]++
+	}
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v * v)
+	}
+	if norm > 0 {
+		for i := range vec {
+			vec[i] /= float32(math.Sqrt(norm))
+		}
+	}
+	return vec, nil
+}
+
+const testTarget = 10001
+
+// newTestBot 内存会话 + 内存向量库 + 假模型的 bot，不连 QQ
+func newTestBot(t *testing.T, fake *fakeAI, docs []rag.Document, configure func(*config.Config)) *Bot {
+	t.Helper()
+	cfg := config.Defaults()
+	cfg.Bot.TargetQQ = testTarget
+	cfg.Bot.TargetName = "小王"
+	cfg.Bot.MyName = "我"
+	cfg.Bot.ReplyDelayMinMs = 0
+	cfg.Bot.ReplyDelayMaxMs = 0
+	cfg.Bot.DisableFaces = true
+	cfg.Data.SessionsDir = t.TempDir()
+	cfg.RAG.MinSimilarity = 0.3
+	cfg.RAG.Short = config.QueryTuning{}
+	cfg.RAG.Long = config.QueryTuning{}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	store := rag.NewMemoryStore(runeEmbed)
+	if err := store.Add(context.Background(), docs); err != nil {
+		t.Fatalf("add documents: %v", err)
+	}
+	pipeline := rag.NewPipeline(store, cfg.RAG.TopK, cfg.RAG.MinSimilarity, 0, false, 0, 0)
+	b, err := New(cfg, fake, chat.NewMemoryManager(cfg.Bot.MaxContextTurns), pipeline, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("new bot: %v", err)
+	}
+	return b
+}
+
+func TestRespondUsesRetrievedExamples(t *testing.T) {
+	fake := &fakeAI{reply: "好啊|||几点"}
+	b := newTestBot(t, fake, []rag.Document{
+		{ID: "hike", Content: "小王: 周末去爬山吧\n我: 好啊"},
+		{ID: "food", Content: "小王: 晚饭吃什么\n我: 火锅"},
+	}, nil)
+
+	r, err := b.RespondDetailed(context.Background(), testTarget, "周末去爬山吗")
+	if err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	if got := strings.Join(r.Parts, "/"); got != "好啊/几点" {
+		t.Errorf("parts = %q, want 好啊/几点", got)
+	}
+	if r.Examples == 0 || !strings.Contains(r.Prompt, "周末去爬山吧") {
+		t.Errorf("retrieved example missing from prompt (examples=%d)", r.Examples)
+	}
+	if r.Model != "fake-model" {
+		t.Errorf("model = %q", r.Model)
+	}
+	if fake.msgs[0] != "周末去爬山吗" {
+		t.Errorf("generated for %q", fake.msgs[0])
+	}
+	transcript := b.chat.Transcript()
+	if len(transcript) != 2 || !strings.Contains(transcript[1], "好啊") {
+		t.Errorf("session transcript = %q", transcript)
+	}
+}
+
+func TestRespondKeepsHistoryAcrossTurns(t *testing.T) {
+	fake := &fakeAI{reply: "在呢"}
+	b := newTestBot(t, fake, nil, nil)
+	ctx := context.Background()
+
+	for _, msg := range []string{"在吗", "明天有空吗"} {
+		if _, err := b.Respond(ctx, testTarget, msg); err != nil {
+			t.Fatalf("respond %q: %v", msg, err)
+		}
+	}
+	if fake.calls() != 2 {
+		t.Fatalf("generated %d times, want 2", fake.calls())
+	}
+	// 第二次生成带上第一轮的问答，不含刚收到的消息
+	if n := len(fake.history[1]); n != 2 {
+		t.Errorf("second turn history has %d entries, want 2", n)
+	}
+}
+
+func TestRespondSilentModeDoesNotReply(t *testing.T) {
+	fake := &fakeAI{reply: "好啊"}
+	b := newTestBot(t, fake, nil, func(cfg *config.Config) { cfg.Bot.SilentMode = true })
+
+	parts, err := b.Respond(context.Background(), testTarget, "周末去爬山吗")
+	if err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	if len(parts) != 0 {
+		t.Errorf("silent mode returned %q", parts)
+	}
+	if fake.calls() != 1 {
+		t.Errorf("silent mode generated %d times, want 1", fake.calls())
+	}
+	if n := len(b.chat.Transcript()); n != 1 {
+		t.Errorf("session has %d messages, want only the user's", n)
+	}
+}
+
+func TestRespondBlockedTopicDeflects(t *testing.T) {
+	fake := &fakeAI{reply: "好啊"}
+	b := newTestBot(t, fake, nil, func(cfg *config.Config) {
+		cfg.Bot.BlockedTopics.Keywords = []string{"借钱"}
+		cfg.Bot.BlockedTopics.Deflections = []string{"晚点说"}
+	})
+
+	parts, err := b.Respond(context.Background(), testTarget, "能借钱给我吗")
+	if err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	if len(parts) != 1 || parts[0] != "晚点说" {
+		t.Errorf("parts = %q, want the deflection", parts)
+	}
+	if fake.calls() != 0 {
+		t.Errorf("blocked message reached the model")
+	}
+}
+
+func TestRespondStrangerCannedReply(t *testing.T) {
+	fake := &fakeAI{reply: "好啊"}
+	b := newTestBot(t, fake, nil, func(cfg *config.Config) {
+		cfg.Bot.TargetQQ = 0
+		cfg.Bot.OthersMode = othersCanned
+		cfg.Bot.OthersReply = "你是？"
+	})
+
+	parts, err := b.Respond(context.Background(), 20002, "你好")
+	if err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	if len(parts) != 1 || parts[0] != "你是？" {
+		t.Errorf("parts = %q, want the canned reply", parts)
+	}
+	if fake.calls() != 0 {
+		t.Errorf("canned stranger reply reached the model")
+	}
+}
+
+func TestRespondDryRunReturnsNothing(t *testing.T) {
+	fake := &fakeAI{reply: "好啊"}
+	b := newTestBot(t, fake, nil, func(cfg *config.Config) { cfg.Bot.DryRun = true })
+
+	parts, err := b.Respond(context.Background(), testTarget, "在吗")
+	if err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	if len(parts) != 0 {
+		t.Errorf("dry run returned %q", parts)
+	}
+	r, err := b.RespondDetailed(context.Background(), testTarget, "在吗")
+	if err != nil {
+		t.Fatalf("respond detailed: %v", err)
+	}
+	if len(r.Parts) != 1 {
+		t.Errorf("RespondDetailed in dry run returned %q, want the reply", r.Parts)
+	}
+}
+
+func TestRespondPromptUsesConfiguredTimezone(t *testing.T) {
+	fake := &fakeAI{reply: "在呢"}
+	b := newTestBot(t, fake, nil, func(cfg *config.Config) { cfg.Bot.Timezone = "Pacific/Kiritimati" })
+	loc, err := time.LoadLocation("Pacific/Kiritimati")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+
+	before := ai.TimeHeader(time.Now().In(loc))
+	r, err := b.RespondDetailed(context.Background(), testTarget, "现在几点")
+	if err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	after := ai.TimeHeader(time.Now().In(loc))
+	if !strings.HasPrefix(r.Prompt, before) && !strings.HasPrefix(r.Prompt, after) {
+		t.Errorf("prompt starts with %q, want %q", strings.SplitN(r.Prompt, "\n", 2)[0], after)
+	}
+}
+
+func TestRespondBlocksTopicInLaterReplyPart(t *testing.T) {
+	fake := &fakeAI{reply: "好啊|||借|||钱的事再说"}
+	b := newTestBot(t, fake, nil, func(cfg *config.Config) {
+		cfg.Bot.BlockedTopics.Keywords = []string{"借钱"}
+		cfg.Bot.BlockedTopics.Deflections = []string{"晚点说"}
+	})
+
+	parts, err := b.Respond(context.Background(), testTarget, "周末有空吗")
+	if err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	if len(parts) != 1 || parts[0] != "晚点说" {
+		t.Errorf("parts = %q, want the deflection", parts)
+	}
+	if fake.calls() != 1 {
+		t.Errorf("generated %d times, want 1", fake.calls())
+	}
+}
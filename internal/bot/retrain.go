@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/liao/style-bot/internal/ai"
+	"github.com/liao/style-bot/internal/parser"
+	"github.com/liao/style-bot/internal/persona"
+)
+
+// setPersona 原子替换 persona，并按新的表情习惯重建表情注入器
+func (b *Bot) setPersona(p *persona.Persona) {
+	b.persona.Store(p)
+	var emoji *ai.EmojiInjector
+	if p != nil && len(p.Style.EmojiPatterns) > 0 && b.cfg.Bot.EmojiInjectionProbability > 0 {
+		emoji = ai.NewEmojiInjector(p.Style.EmojiPatterns, b.cfg.Bot.EmojiInjectionProbability)
+	}
+	b.emoji.Store(emoji)
+}
+
+// retrain 对上次之后新增的 live log 做风格分析，合并进当前 persona 并写回 persona 文件；不动向量库
+// 调用方保证同一时间只有一个 retrain
+func (b *Bot) retrain(ctx context.Context) (int, error) {
+	path := b.cfg.Data.LiveLog
+	if path == "" {
+		return 0, fmt.Errorf("data.live_log is not configured")
+	}
+	if err := b.liveLog.Flush(); err != nil {
+		return 0, fmt.Errorf("flush live log: %w", err)
+	}
+
+	data, n, latest, err := readLiveSince(path, b.retrainedAt)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("no new exchanges in live log")
+	}
+
+	// live log 里 "user" 是我（bot 的回复），与导入器默认的 -user-is-me=true 一致
+	myName, targetName := b.cfg.Bot.MyName, b.cfg.Bot.TargetName
+	conversations, err := parser.ParseJSONLToConversations(data, myName, targetName, true, parser.DefaultMinConversation)
+	if err != nil {
+		return 0, fmt.Errorf("parse live log: %w", err)
+	}
+	messages, err := parser.ParseJSONLBytes(data, myName, targetName, true)
+	if err != nil {
+		return 0, fmt.Errorf("parse live log: %w", err)
+	}
+
+	if _, err := b.analyzePersona(ctx, messages, conversations); err != nil {
+		return 0, err
+	}
+	b.retrainedAt = latest
+	logger.Info("persona retrained from live log", "exchanges", n)
+	return n, nil
+}
+
+// analyzePersona 对给定对话做风格分析，合并进当前 persona 后原子替换，配置了 persona 文件时写回
+func (b *Bot) analyzePersona(ctx context.Context, messages []parser.ChatMessage, conversations []parser.Conversation) (*persona.Persona, error) {
+	prompt := persona.BuildAnalysisPrompt(messages, conversations, b.cfg.Bot.MyName, b.cfg.Bot.TargetName, persona.SampleByIndex)
+	text, err := b.ai.AnalyzeStyle(ctx, prompt, b.cfg.Gemini.AnalysisThinkingBudget, b.cfg.Gemini.AnalysisStopSequences)
+	if err != nil {
+		return nil, err
+	}
+	fresh, err := persona.ParseAnalysis(text)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := persona.Merge(b.persona.Load(), fresh, persona.UnionSlices)
+	b.setPersona(merged)
+	if path := b.cfg.Data.PersonaFile; path != "" {
+		if err := persona.SaveToFile(path, merged); err != nil {
+			logger.Error("save persona failed", "error", err)
+		}
+	}
+	return merged, nil
+}
+
+// countForRefresh 累计新消息数，超过 persona_refresh_after_messages 时在后台用最近会话重新分析风格
+func (b *Bot) countForRefresh(ctx context.Context, n int) {
+	threshold := b.cfg.Bot.PersonaRefreshAfterMessages
+	if threshold <= 0 || b.sinceAnalysis.Add(int64(n)) < int64(threshold) {
+		return
+	}
+	if !b.retraining.CompareAndSwap(false, true) {
+		return
+	}
+	b.sinceAnalysis.Store(0)
+	go func() {
+		defer b.retraining.Store(false)
+		if err := b.refreshPersona(ctx); err != nil {
+			logger.Warn("persona refresh failed", "error", err)
+		}
+	}()
+}
+
+// refreshPersona 只用当前会话里的消息做一次轻量风格分析并合并
+func (b *Bot) refreshPersona(ctx context.Context) error {
+	myName, targetName := b.cfg.Bot.MyName, b.cfg.Bot.TargetName
+	var conv parser.Conversation
+	for _, m := range b.chat.Messages() {
+		if m.Recalled || strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		msg := parser.ChatMessage{Timestamp: m.Timestamp, Sender: targetName, Content: m.Content}
+		if m.Role == "model" {
+			msg.Sender, msg.IsMe = myName, true
+			// 多条回复在会话里用 ||| 连接
+			msg.Content = strings.ReplaceAll(m.Content, "|||", "\n")
+		}
+		conv.Messages = append(conv.Messages, msg)
+	}
+	if len(conv.Messages) < 2 {
+		return fmt.Errorf("not enough session messages")
+	}
+	conv.StartAt, conv.EndAt = conv.Messages[0].Timestamp, conv.Messages[len(conv.Messages)-1].Timestamp
+
+	if _, err := b.analyzePersona(ctx, conv.Messages, []parser.Conversation{conv}); err != nil {
+		return err
+	}
+	logger.Info("persona refreshed from recent session", "messages", len(conv.Messages))
+	return nil
+}
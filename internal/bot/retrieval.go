@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/liao/style-bot/internal/ai"
+	"github.com/liao/style-bot/internal/chat"
+	"github.com/liao/style-bot/internal/config"
+	"github.com/liao/style-bot/internal/logging"
+	"github.com/liao/style-bot/internal/rag"
+)
+
+// SetTopK 覆盖检索条数（本地调试用），n <= 0 时恢复按配置选
+func (b *Bot) SetTopK(n int) {
+	b.topK.Store(int64(max(n, 0)))
+}
+
+// retrievalParams 按消息长度和类型选检索参数：寒暄少而严，长消息和提问多而宽，其余用 rag 默认值；SetTopK 设置过时用设置的条数
+func (b *Bot) retrievalParams(userMsg string) (topK int, minSim float32) {
+	topK, minSim = b.tunedParams(userMsg)
+	if n := b.topK.Load(); n > 0 {
+		topK = int(n)
+	}
+	return topK, minSim
+}
+
+// tunedParams 按配置为这条消息选检索参数；短消息先判断，"在吗？"这类带问号的寒暄也按短消息检索
+func (b *Bot) tunedParams(userMsg string) (int, float32) {
+	rc := b.cfg.RAG
+	n := utf8.RuneCountInString(strings.TrimSpace(userMsg))
+	switch {
+	case rc.Short.Runes > 0 && n <= rc.Short.Runes:
+		return tuned(rc, rc.Short)
+	case rc.Long.Runes > 0 && (n >= rc.Long.Runes || strings.ContainsAny(userMsg, "?？") || ai.IsFactQuestion(userMsg)):
+		return tuned(rc, rc.Long)
+	}
+	return rc.TopK, rc.MinSimilarity
+}
+
+// tuned 覆盖值为 0 的字段回退到默认值
+func tuned(rc config.RAGConfig, t config.QueryTuning) (int, float32) {
+	topK, minSim := rc.TopK, rc.MinSimilarity
+	if t.TopK > 0 {
+		topK = t.TopK
+	}
+	if t.MinSimilarity > 0 {
+		minSim = t.MinSimilarity
+	}
+	return topK, minSim
+}
+
+// retrievalQuery 检索文本：对方会话 sess 里最近 rag.query_turns 条消息（最后一条是刚收到的 userMsg），
+// 开启 query_rewrite 时让模型改写；会话里没有前文或检索关闭时就是 userMsg（不花改写的请求额度）
+func (b *Bot) retrievalQuery(ctx context.Context, pipeline *rag.Pipeline, sess *chat.Manager, userMsg string) string {
+	n := b.cfg.RAG.QueryTurns
+	if n <= 1 || !pipeline.Enabled() {
+		return userMsg
+	}
+	msgs := sess.Messages()
+	if len(msgs) > 0 {
+		msgs = msgs[:len(msgs)-1] // 刚添加的这条，用 userMsg 代替
+	}
+	var turns []string
+	for i := len(msgs) - 1; i >= 0 && len(turns) < n-1; i-- {
+		// 分条发送的回复存成 a|||b，检索时换成换行
+		if m := msgs[i]; !m.Recalled && strings.TrimSpace(m.Content) != "" {
+			turns = append(turns, strings.ReplaceAll(m.Content, "|||", "\n"))
+		}
+	}
+	if len(turns) == 0 {
+		return userMsg
+	}
+	slices.Reverse(turns)
+	turns = append(turns, userMsg)
+
+	if b.cfg.RAG.QueryRewrite {
+		q, err := b.ai.RewriteQuery(ctx, turns)
+		if err == nil {
+			logger.Debug("RAG query rewritten", logging.Content("query", q))
+			return q
+		}
+		logger.Warn("rewrite RAG query failed, using recent turns", "error", err)
+	}
+	return rag.ContextQuery(turns)
+}
+
+// messageSentiment 开启 rag.sentiment_boost 时用模型判断这条消息的情绪，检索时优先同样情绪的示例；失败或关闭时为空
+func (b *Bot) messageSentiment(ctx context.Context, pipeline *rag.Pipeline, userMsg string) string {
+	if !b.cfg.RAG.SentimentBoost || !pipeline.Enabled() {
+		return ""
+	}
+	s, err := b.ai.ClassifySentiment(ctx, userMsg)
+	if err != nil {
+		logger.Debug("classify sentiment failed", "error", err)
+		return ""
+	}
+	return s
+}
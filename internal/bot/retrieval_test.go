@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/liao/style-bot/internal/config"
+	"github.com/liao/style-bot/internal/rag"
+)
+
+var topicDocs = []rag.Document{
+	{ID: "hike", Content: "小王: 周末去爬山吧\n我: 好啊 几点出发"},
+	{ID: "food", Content: "小王: 晚饭吃什么\n我: 火锅"},
+}
+
+func TestRetrievalFollowsTopicAcrossTurns(t *testing.T) {
+	for _, tc := range []struct {
+		turns   int
+		wantHit bool
+	}{
+		{turns: 1, wantHit: false},
+		{turns: 3, wantHit: true},
+	} {
+		fake := &fakeAI{reply: "好啊|||几点"}
+		b := newTestBot(t, fake, topicDocs, func(cfg *config.Config) {
+			cfg.RAG.QueryTurns = tc.turns
+			cfg.RAG.MinSimilarity = 0.5
+		})
+		ctx := context.Background()
+		if _, err := b.Respond(ctx, testTarget, "周末去爬山吗"); err != nil {
+			t.Fatalf("respond: %v", err)
+		}
+		// "那明天呢" 本身检索不到爬山，带上前文才能接住话题
+		r, err := b.RespondDetailed(ctx, testTarget, "那明天呢")
+		if err != nil {
+			t.Fatalf("respond: %v", err)
+		}
+		if hit := strings.Contains(r.Prompt, "周末去爬山吧"); hit != tc.wantHit {
+			t.Errorf("query_turns=%d: hike example in prompt = %v, want %v", tc.turns, hit, tc.wantHit)
+		}
+		if strings.Contains(r.Prompt, "火锅") {
+			t.Errorf("query_turns=%d: unrelated example retrieved", tc.turns)
+		}
+	}
+}
+
+func TestRetrievalQueryCleansSeparatorsAndSkipsOtherPeers(t *testing.T) {
+	fake := &fakeAI{reply: "好啊|||几点"}
+	b := newTestBot(t, fake, topicDocs, func(cfg *config.Config) {
+		cfg.Bot.AllowQQ = []int64{20002}
+		cfg.RAG.QueryRewrite = true
+	})
+	ctx := context.Background()
+	if _, err := b.Respond(ctx, testTarget, "周末去爬山吗"); err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	if _, err := b.Respond(ctx, 20002, "晚饭吃什么"); err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	if _, err := b.Respond(ctx, testTarget, "那明天呢"); err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+
+	last := fake.rewrites[len(fake.rewrites)-1]
+	want := []string{"周末去爬山吗", "好啊\n几点", "那明天呢"}
+	if strings.Join(last, "/") != strings.Join(want, "/") {
+		t.Errorf("rewrite turns = %q, want %q", last, want)
+	}
+}
+
+func TestRetrievalQueryNoRewriteWithoutRAG(t *testing.T) {
+	fake := &fakeAI{reply: "好啊"}
+	b := newTestBot(t, fake, nil, func(cfg *config.Config) { cfg.RAG.QueryRewrite = true })
+	ctx := context.Background()
+	for _, msg := range []string{"周末去爬山吗", "那明天呢"} {
+		if _, err := b.Respond(ctx, testTarget, msg); err != nil {
+			t.Fatalf("respond %q: %v", msg, err)
+		}
+	}
+	if len(fake.rewrites) != 0 {
+		t.Errorf("rewrote %d queries with RAG disabled", len(fake.rewrites))
+	}
+}
+
+func TestRetrievalParamsByMessage(t *testing.T) {
+	b := newTestBot(t, &fakeAI{reply: "好啊"}, nil, func(cfg *config.Config) {
+		cfg.RAG.TopK, cfg.RAG.MinSimilarity = 5, 0.3
+		cfg.RAG.Short = config.QueryTuning{Runes: 4, TopK: 2, MinSimilarity: 0.45}
+		cfg.RAG.Long = config.QueryTuning{Runes: 30, TopK: 8, MinSimilarity: 0.25}
+	})
+	for _, tc := range []struct {
+		msg    string
+		topK   int
+		minSim float32
+	}{
+		{"在吗", 2, 0.45},
+		{"在吗？", 2, 0.45},
+		{"早?", 2, 0.45},
+		{"今天上班好累啊", 5, 0.3},
+		{"你明天几点下班？", 8, 0.25},
+		{strings.Repeat("好", 30), 8, 0.25},
+	} {
+		if topK, minSim := b.retrievalParams(tc.msg); topK != tc.topK || minSim != tc.minSim {
+			t.Errorf("retrievalParams(%q) = %d, %.2f, want %d, %.2f", tc.msg, topK, minSim, tc.topK, tc.minSim)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// messageText 把消息段转成规范化文本，会话记录和 prompt 共用：
+// 文字原样保留，@ 转成 "@我"/"@昵称"，链接、转发、卡片等转成 "[链接] 标题: 描述" 这样的简短描述。
+// 图片和语音由 vision / voice 单独处理，表情和回复引用跳过（纯表情消息仍视为空消息）
+func (b *Bot) messageText(segs message.Message, selfID int64) string {
+	var sb strings.Builder
+	for _, seg := range segs {
+		var s string
+		switch seg.Type {
+		case "text":
+			t := seg.Data["text"]
+			if strings.HasSuffix(sb.String(), " ") {
+				t = strings.TrimLeft(t, " ")
+			}
+			sb.WriteString(t)
+			continue
+		case "at":
+			s = b.atText(seg, selfID)
+		case "share":
+			s = cardText("[链接]", seg.Data["title"], seg.Data["content"])
+		case "json":
+			s = jsonCardText(seg.Data["data"])
+		case "xml":
+			s = "[卡片]"
+		case "forward", "node":
+			s = "[转发的聊天记录]"
+		case "music":
+			s = "[音乐]"
+		case "location":
+			s = cardText("[位置]", seg.Data["title"], seg.Data["content"])
+		case "contact":
+			s = "[名片]"
+		case "file":
+			s = cardText("[文件]", seg.Data["name"], "")
+		case "video":
+			s = "[视频]"
+		default:
+			continue
+		}
+		// 描述前后用空格和正文隔开
+		if sb.Len() > 0 && !strings.HasSuffix(sb.String(), " ") {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(s)
+		sb.WriteByte(' ')
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// atText @ 段：@ 自己为 "@我"，@ target 用 target_name，其余优先用段里带的昵称
+func (b *Bot) atText(seg message.Segment, selfID int64) string {
+	qq := seg.Data["qq"]
+	if qq == "all" {
+		return "@全体成员"
+	}
+	id, _ := strconv.ParseInt(qq, 10, 64)
+	switch {
+	case id != 0 && id == selfID:
+		return "@我"
+	case id != 0 && id == b.cfg.Bot.TargetQQ && b.cfg.Bot.TargetName != "":
+		return "@" + b.cfg.Bot.TargetName
+	case seg.Data["name"] != "":
+		return "@" + strings.TrimPrefix(seg.Data["name"], "@")
+	}
+	return "@某人"
+}
+
+// cardText "[标签] 标题: 描述"，描述为空或与标题相同时省略
+func cardText(label, title, desc string) string {
+	title, desc = strings.TrimSpace(title), strings.TrimSpace(desc)
+	switch {
+	case title == "":
+		return label
+	case desc == "" || desc == title:
+		return label + " " + title
+	}
+	return label + " " + title + ": " + desc
+}
+
+// jsonCard QQ 的 JSON 卡片消息（音乐、小程序、链接分享、合并转发）
+type jsonCard struct {
+	App    string                     `json:"app"`
+	Prompt string                     `json:"prompt"`
+	Meta   map[string]json.RawMessage `json:"meta"`
+}
+
+type jsonCardMeta struct {
+	Title string `json:"title"`
+	Desc  string `json:"desc"`
+}
+
+// jsonCardLabels meta 里的 key → 标签
+var jsonCardLabels = []struct{ key, label string }{
+	{"music", "[音乐]"},
+	{"detail_1", "[小程序]"},
+	{"news", "[链接]"},
+}
+
+// jsonCardText 提取卡片的标题和描述，解析不了时退回卡片自带的 prompt（如 "[QQ小程序]哔哩哔哩"）
+func jsonCardText(data string) string {
+	var card jsonCard
+	if err := json.Unmarshal([]byte(data), &card); err != nil {
+		return "[卡片]"
+	}
+	if card.App == "com.tencent.multimsg" {
+		return "[转发的聊天记录]"
+	}
+	for _, l := range jsonCardLabels {
+		raw, ok := card.Meta[l.key]
+		if !ok {
+			continue
+		}
+		var m jsonCardMeta
+		if json.Unmarshal(raw, &m) == nil && m.Title != "" {
+			return cardText(l.label, m.Title, m.Desc)
+		}
+	}
+	if p := strings.TrimSpace(card.Prompt); p != "" {
+		return p
+	}
+	return "[卡片]"
+}
@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// TestMessageTextFromNapCatEvents testdata/napcat 下是 NapCat 推送的原始事件（message_format=array）
+func TestMessageTextFromNapCatEvents(t *testing.T) {
+	b := newTestBot(t, &fakeAI{}, nil, nil)
+	for _, tc := range []struct{ fixture, want string }{
+		{"group_at_me.json", "@我 周末去爬山吗"},
+		{"group_at_other.json", "@老李 你也来 @全体成员"},
+		{"private_share.json", "看这个 [链接] 香山红叶攻略: 十月底最佳观赏期"},
+		{"private_music_card.json", "[音乐] 好久不见: 陈奕迅"},
+		{"private_miniapp_card.json", "[小程序] 哔哩哔哩: 周末爬山vlog"},
+		{"private_forward.json", "[转发的聊天记录]"},
+		{"private_multimsg_card.json", "[转发的聊天记录]"},
+		{"private_reply_face.json", "好的"},
+		{"private_face_only.json", ""},
+		{"private_file.json", "[文件] 路线.pdf"},
+	} {
+		t.Run(tc.fixture, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "napcat", tc.fixture))
+			if err != nil {
+				t.Fatalf("read fixture: %v", err)
+			}
+			var e zero.Event
+			if err := json.Unmarshal(data, &e); err != nil {
+				t.Fatalf("parse event: %v", err)
+			}
+			if got := b.messageText(message.ParseMessage(e.NativeMessage), e.SelfID); got != tc.want {
+				t.Errorf("messageText = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMessageTextAtTarget(t *testing.T) {
+	b := newTestBot(t, &fakeAI{}, nil, nil)
+	segs := message.Message{message.At(testTarget), message.Text("在吗")}
+	if got := b.messageText(segs, 999); got != "@小王 在吗" {
+		t.Errorf("messageText = %q", got)
+	}
+}
+
+func TestJSONCardTextFallsBackToPrompt(t *testing.T) {
+	for _, tc := range []struct{ data, want string }{
+		{`{"app":"com.tencent.structmsg","meta":{"news":{"title":"","desc":""}},"prompt":"[分享]天气预报"}`, "[分享]天气预报"},
+		{`{"app":"com.tencent.structmsg","meta":{}}`, "[卡片]"},
+		{`not json`, "[卡片]"},
+	} {
+		if got := jsonCardText(tc.data); got != tc.want {
+			t.Errorf("jsonCardText(%s) = %q, want %q", tc.data, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package bot
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// silentLogFile 静默模式下生成但没发出的回复，写在 sessions_dir 下
+const silentLogFile = "silent_log.jsonl"
+
+// silentEntry silent_log.jsonl 的一行
+type silentEntry struct {
+	Timestamp      time.Time `json:"timestamp"`
+	UserMsg        string    `json:"user_msg"`
+	GeneratedReply string    `json:"generated_reply"`
+	LatencyMs      int64     `json:"latency_ms"`
+}
+
+// silentReply 静默模式：照常生成回复（计入延迟指标）但不发送，只写进 silent_log.jsonl；
+// 会话里只有对方的消息，没发出的回复不记入。zctx 只在 images 非空时使用，其他平台传 nil
+func (b *Bot) silentReply(ctx context.Context, zctx *zero.Ctx, peerID int64, userMsg string, images []message.Segment, received time.Time) {
+	release, ok := b.limiter.Acquire(ctx, received)
+	if !ok {
+		return
+	}
+	defer release()
+
+	d := b.draftReply(ctx, zctx, peerID, userMsg, images)
+	latency := time.Since(received)
+	logger.Info("silent mode, reply not sent", "peer", peerID, "latency", latency.Truncate(time.Millisecond))
+	path := filepath.Join(b.cfg.Data.SessionsDir, silentLogFile)
+	if err := appendJSONL(path, silentEntry{Timestamp: received, UserMsg: userMsg, GeneratedReply: d.Reply, LatencyMs: latency.Milliseconds()}); err != nil {
+		logger.Warn("write silent log failed", "error", err)
+	}
+	go func() {
+		if err := b.chat.Save(); err != nil {
+			logger.Error("save session failed", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,35 @@
+package bot
+
+import (
+	"context"
+	"strings"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/liao/style-bot/internal/logging"
+)
+
+// testReplyLabel /test-reply 回复的前缀，和真实回复区分开
+const testReplyLabel = "[TEST] generated reply:"
+
+// testReply 用当前 persona 和 RAG 生成对 userMsg 的回复，就像 target 发来的一样；
+// 在会话副本上生成，回复只发给 owner，不记入会话、不发给对方。完整的 system prompt 写进日志（受 logging.redact_content 控制）
+func (b *Bot) testReply(ctx context.Context, zctx *zero.Ctx, userMsg string) {
+	userMsg = strings.TrimSpace(userMsg)
+	if userMsg == "" {
+		zctx.Send(message.Text("usage: /test-reply <message>"))
+		return
+	}
+	zctx.Send(message.Text(b.testReplyText(ctx, userMsg)))
+}
+
+// testReplyText 在会话的内存副本上生成回复，返回发给 owner 的文本
+func (b *Bot) testReplyText(ctx context.Context, userMsg string) string {
+	sess := b.chat.Copy()
+	sess.AddUserMessage(userMsg, 0)
+	d := b.draftReplyIn(ctx, nil, sess, b.cfg.Bot.TargetQQ, userMsg, nil)
+	logger.Info("test reply generated", "model", d.Gen.Model, "fallback", d.Gen.Fallback, "examples", len(d.Results),
+		logging.Content("text", userMsg), logging.Content("prompt", d.Prompt), logging.Content("reply", d.Reply))
+	return testReplyLabel + "\n" + strings.ReplaceAll(d.Reply, "|||", "\n")
+}
@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/liao/style-bot/internal/chat"
+	"github.com/liao/style-bot/internal/config"
+)
+
+func TestTestReplyLeavesSessionAndPromptAlone(t *testing.T) {
+	fake := &fakeAI{reply: "好啊|||几点"}
+	b := newTestBot(t, fake, nil, func(cfg *config.Config) { cfg.Bot.DebugPrompt = true })
+	sessions, err := chat.NewManager(b.cfg.Bot.MaxContextTurns, b.cfg.Data.SessionsDir)
+	if err != nil {
+		t.Fatalf("new session manager: %v", err)
+	}
+	b.chat = sessions
+	ctx := context.Background()
+	if _, err := b.Respond(ctx, testTarget, "在吗"); err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	real := b.lastPrompt.Load()
+	if real == nil {
+		t.Fatal("reply did not record the prompt")
+	}
+
+	if got := b.testReplyText(ctx, "周末去爬山吗"); got != testReplyLabel+"\n好啊\n几点" {
+		t.Errorf("test reply = %q", got)
+	}
+	if n := len(b.chat.Transcript()); n != 2 {
+		t.Errorf("session has %d messages after /test-reply, want 2", n)
+	}
+	if b.lastPrompt.Load() != real {
+		t.Error("/test-reply replaced the prompt shown by /prompt")
+	}
+	if err := b.chat.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	entries, err := os.ReadDir(b.cfg.Data.SessionsDir)
+	if err != nil {
+		t.Fatalf("read sessions dir: %v", err)
+	}
+	for _, e := range entries {
+		if e.Name() != "session.log" && e.Name() != "session.json" {
+			t.Errorf("unexpected session file %s", e.Name())
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// 打错字
+const (
+	typoMinRunes       = 4 // 短于这个长度的消息不打错字
+	typoCorrectionWait = time.Second
+)
+
+// homophones 常见的同音/近音错字，key 是正确的字
+var homophones = map[rune][]rune{
+	'的': {'得', '地'},
+	'得': {'的'},
+	'在': {'再'},
+	'再': {'在'},
+	'做': {'作'},
+	'那': {'哪'},
+	'哪': {'那'},
+	'吗': {'嘛'},
+	'嘛': {'吗'},
+	'已': {'以'},
+	'以': {'已'},
+	'像': {'象'},
+	'带': {'戴'},
+	'他': {'她'},
+	'她': {'他'},
+	'是': {'事'},
+	'知': {'之'},
+	'道': {'到'},
+	'到': {'道'},
+	'就': {'久'},
+	'还': {'换'},
+	'没': {'每'},
+	'会': {'回'},
+	'回': {'会'},
+	'想': {'相'},
+	'见': {'件'},
+	'觉': {'绝'},
+	'候': {'后'},
+	'几': {'机'},
+	'样': {'羊'},
+}
+
+// injectTypo 以 probability 的概率把一个字换成同音错字，返回错字版本和更正消息（"*对的字"）
+// 没有打错字时 ok 为 false
+func injectTypo(part string, probability float32) (typo, correction string, ok bool) {
+	runes := []rune(part)
+	if len(runes) < typoMinRunes || rand.Float32() >= probability {
+		return "", "", false
+	}
+	var candidates []int
+	for i, r := range runes {
+		if _, has := homophones[r]; has {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", "", false
+	}
+
+	i := candidates[rand.IntN(len(candidates))]
+	right := runes[i]
+	wrongs := homophones[right]
+	runes[i] = wrongs[rand.IntN(len(wrongs))]
+	return string(runes), "*" + string(right), true
+}
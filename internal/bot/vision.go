@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+	"google.golang.org/genai"
+)
+
+// 图片默认限制
+const (
+	defaultVisionMaxImages = 3
+	defaultVisionMaxBytes  = 5 << 20
+	imageInstruction       = "（对方发了图片，像你平时那样自然地回应一下）"
+)
+
+var imageHTTPClient = &http.Client{Timeout: 20 * time.Second}
+
+// imageSegments 取出消息里的图片段
+func imageSegments(zctx *zero.Ctx) []message.Segment {
+	var images []message.Segment
+	for _, seg := range zctx.Event.Message {
+		if seg.Type == "image" {
+			images = append(images, seg)
+		}
+	}
+	return images
+}
+
+// generateWithImages 下载图片并调用多模态生成，失败时回一句风格化的附和
+func (b *Bot) generateWithImages(ctx context.Context, zctx *zero.Ctx, systemPrompt string, history []*genai.Content, userMsg string, images []message.Segment) (string, generation) {
+	parts := b.fetchImages(ctx, zctx, images)
+	if len(parts) == 0 {
+		logger.Warn("no image could be downloaded, using acknowledgement")
+		return b.imageAck(), fallbackGen("")
+	}
+
+	text := imageInstruction
+	if userMsg != "" {
+		text = userMsg + "\n" + imageInstruction
+	}
+	start := time.Now()
+	reply, model, err := b.ai.GenerateChatWithImages(ctx, systemPrompt, history, text, parts)
+	b.health.observeGeneration(time.Since(start), err)
+	if err != nil {
+		logger.Error("vision generate failed, using acknowledgement", "error", err)
+		return b.imageAck(), fallbackGen("")
+	}
+	return reply, generation{Model: model}
+}
+
+// fetchImages 通过 NapCat 拿到图片地址并下载，超出数量/大小限制的跳过
+func (b *Bot) fetchImages(ctx context.Context, zctx *zero.Ctx, images []message.Segment) []*genai.Part {
+	maxImages := b.cfg.Bot.VisionMaxImages
+	if maxImages <= 0 {
+		maxImages = defaultVisionMaxImages
+	}
+	maxBytes := b.cfg.Bot.VisionMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultVisionMaxBytes
+	}
+
+	var parts []*genai.Part
+	for _, seg := range images {
+		if len(parts) >= maxImages {
+			break
+		}
+		url := seg.Data["url"]
+		if url == "" && seg.Data["file"] != "" {
+			url = zctx.GetImage(seg.Data["file"]).Get("url").String()
+		}
+		if url == "" {
+			logger.Warn("image segment has no url", "file", seg.Data["file"])
+			continue
+		}
+		data, mime, err := downloadImage(ctx, url, maxBytes)
+		if err != nil {
+			logger.Warn("download image failed", "error", err)
+			continue
+		}
+		parts = append(parts, genai.NewPartFromBytes(data, mime))
+	}
+	return parts
+}
+
+func downloadImage(ctx context.Context, url string, maxBytes int) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("new request: %w", err)
+	}
+	resp, err := imageHTTPClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("get image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("get image: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("read image: %w", err)
+	}
+	if len(data) > maxBytes {
+		return nil, "", fmt.Errorf("image larger than %d bytes", maxBytes)
+	}
+	return data, http.DetectContentType(data), nil
+}
+
+// imageAck 看不了图时的附和回复
+func (b *Bot) imageAck() string {
+	acks := []string{"哈哈哈", "好看", "可以可以", "？", "hhh"}
+	if p := b.persona.Load(); p != nil && len(p.Style.AgreementExamples) > 0 {
+		acks = p.Style.AgreementExamples
+	}
+	return acks[rand.IntN(len(acks))]
+}
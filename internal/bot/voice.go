@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/liao/style-bot/internal/ai"
+)
+
+// 语音默认限制
+const (
+	defaultVoiceMaxSeconds = 60
+	voiceMaxBytes          = 10 << 20
+	voicePrefix            = "(语音) "
+)
+
+var errVoiceTooLong = errors.New("voice clip too long")
+
+// recordSegment 取出消息里的第一段语音
+func recordSegment(zctx *zero.Ctx) (message.Segment, bool) {
+	for _, seg := range zctx.Event.Message {
+		if seg.Type == "record" {
+			return seg, true
+		}
+	}
+	return message.Segment{}, false
+}
+
+// transcribeVoice 通过 NapCat get_record 拿到 wav，超长的不转写；配置了 stt_url 时走本地 whisper
+func (b *Bot) transcribeVoice(ctx context.Context, zctx *zero.Ctx, seg message.Segment) (string, error) {
+	data, err := fetchRecord(ctx, zctx, seg)
+	if err != nil {
+		return "", err
+	}
+
+	maxSeconds := b.cfg.Bot.VoiceMaxSeconds
+	if maxSeconds <= 0 {
+		maxSeconds = defaultVoiceMaxSeconds
+	}
+	if d, ok := wavDuration(data); ok && d > time.Duration(maxSeconds)*time.Second {
+		return "", fmt.Errorf("%w: %s", errVoiceTooLong, d.Round(time.Second))
+	}
+
+	var text string
+	if b.cfg.Gemini.STTURL != "" {
+		text, err = ai.TranscribeWhisper(ctx, b.cfg.Gemini.STTURL, data, "voice.wav")
+	} else {
+		text, err = b.ai.Transcribe(ctx, data, "audio/wav")
+	}
+	if err != nil {
+		return "", err
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("empty transcript")
+	}
+	return text, nil
+}
+
+// fetchRecord 调 get_record 转成 wav，依次尝试 base64、url、本地路径
+func fetchRecord(ctx context.Context, zctx *zero.Ctx, seg message.Segment) ([]byte, error) {
+	file := seg.Data["file"]
+	if file == "" {
+		return nil, fmt.Errorf("record segment has no file")
+	}
+	rsp := zctx.CallActionWithContext(ctx, "get_record", zero.Params{"file": file, "out_format": "wav"})
+	if rsp.Status != "ok" {
+		return nil, fmt.Errorf("get_record: retcode %d %s", rsp.RetCode, rsp.Message)
+	}
+
+	if b64 := rsp.Data.Get("base64").String(); b64 != "" {
+		data, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, fmt.Errorf("decode record: %w", err)
+		}
+		return data, nil
+	}
+	if url := rsp.Data.Get("url").String(); strings.HasPrefix(url, "http") {
+		return downloadRecord(ctx, url)
+	}
+	path := rsp.Data.Get("file").String()
+	if path == "" {
+		return nil, fmt.Errorf("get_record returned no file")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open record: %w", err)
+	}
+	defer f.Close()
+	return readLimited(f, voiceMaxBytes)
+}
+
+func downloadRecord(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	resp, err := imageHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get record: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get record: status %d", resp.StatusCode)
+	}
+	return readLimited(resp.Body, voiceMaxBytes)
+}
+
+func readLimited(r io.Reader, maxBytes int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(maxBytes)+1))
+	if err != nil {
+		return nil, fmt.Errorf("read record: %w", err)
+	}
+	if len(data) > maxBytes {
+		return nil, fmt.Errorf("record larger than %d bytes", maxBytes)
+	}
+	return data, nil
+}
+
+// wavDuration 按 wav 头里的 byte rate 估算时长
+func wavDuration(data []byte) (time.Duration, bool) {
+	if len(data) < 44 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0, false
+	}
+	byteRate := binary.LittleEndian.Uint32(data[28:32])
+	if byteRate == 0 {
+		return 0, false
+	}
+	return time.Duration(len(data)-44) * time.Second / time.Duration(byteRate), true
+}
+
+// onVoiceFailed 语音转写失败或过长，记下语音并回一句"不方便听"
+func (b *Bot) onVoiceFailed(zctx *zero.Ctx) {
+	sess := b.sessionFor(zctx.Event.UserID)
+	sess.AddUserMessage(strings.TrimSpace(voicePrefix), eventMessageID(zctx))
+	b.record(auditEntry{Direction: auditIn, Peer: zctx.Event.UserID, MessageID: eventMessageID(zctx), Text: strings.TrimSpace(voicePrefix)})
+	reply := b.voiceFailReply()
+	time.Sleep(b.randomDelay())
+	b.sendCanned(qqSink{b: b, zctx: zctx}, zctx.Event.UserID, reply)
+	sess.AddBotReply(reply)
+
+	go func() {
+		if err := b.chat.Save(); err != nil {
+			logger.Error("save session failed", "error", err)
+		}
+	}()
+}
+
+// voiceFailReply 听不了语音时的回复
+func (b *Bot) voiceFailReply() string {
+	replies := b.cfg.Bot.VoiceFailReplies
+	if len(replies) == 0 {
+		replies = []string{"我现在不方便听语音", "听不了语音，打字吧", "在外面，不方便听"}
+	}
+	return replies[rand.IntN(len(replies))]
+}
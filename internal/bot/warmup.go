@@ -0,0 +1,31 @@
+package bot
+
+import (
+	"context"
+	"time"
+)
+
+// warmUpTimeout 启动预热的总时长上限，超时不影响 bot 正常收消息
+const warmUpTimeout = 30 * time.Second
+
+// warmUp 用 warmup_messages 预热 RAG；每条先占一次 rpm_limit 配额，配额等不到就只预热已拿到配额的部分
+func (b *Bot) warmUp(ctx context.Context) {
+	queries := b.cfg.Bot.WarmupMessages
+	if len(queries) == 0 || !b.rag.Enabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, warmUpTimeout)
+	defer cancel()
+
+	allowed := 0
+	for range queries {
+		if err := b.ai.WaitForToken(ctx); err != nil {
+			logger.Warn("RAG warm-up limited by rate limit", "queries", allowed, "skipped", len(queries)-allowed, "error", err)
+			break
+		}
+		allowed++
+	}
+	if err := b.rag.WarmUp(ctx, queries[:allowed]); err != nil {
+		logger.Warn("RAG warm-up failed", "error", err)
+	}
+}
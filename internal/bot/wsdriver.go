@@ -0,0 +1,200 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tidwall/gjson"
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+// wsDriver 正向 WebSocket 驱动，断线后 Listen 直接返回，由 Run 的重连循环负责重建
+// （ZeroBot 自带的 WSClient 会在内部无限重连，没法控制退避和次数）
+type wsDriver struct {
+	url         string
+	accessToken string
+	idleTimeout time.Duration // 超过这么久没有任何事件（含心跳）视为断线，0 = 不检查
+
+	conn    *websocket.Conn
+	connErr error
+	selfID  int64
+	alive   atomic.Bool  // 连接中（Listen 返回后为 false）
+	stale   atomic.Bool  // 被心跳看门狗断开
+	lastEvt atomic.Int64 // 最近一次收到事件的时间（UnixNano）
+
+	writeMu sync.Mutex
+	seq     atomic.Uint64
+	pending sync.Map // echo → chan zero.APIResponse
+}
+
+func newWSDriver(url, accessToken string, idleTimeout time.Duration) *wsDriver {
+	return &wsDriver{url: url, accessToken: accessToken, idleTimeout: idleTimeout}
+}
+
+// Connect 尝试连接一次，失败时记录错误，Listen 会立即返回
+func (d *wsDriver) Connect() {
+	header := http.Header{"X-Client-Role": []string{"Universal"}}
+	if d.accessToken != "" {
+		header.Set("Authorization", "Bearer "+d.accessToken)
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial(d.url, header)
+	if err != nil {
+		d.connErr = fmt.Errorf("dial %s: %w", d.url, err)
+		return
+	}
+	resp.Body.Close()
+
+	// NapCat 连接后先推送一条带 self_id 的 lifecycle 事件
+	var hello struct {
+		SelfID int64 `json:"self_id"`
+	}
+	if err := conn.ReadJSON(&hello); err != nil {
+		conn.Close()
+		d.connErr = fmt.Errorf("handshake: %w", err)
+		return
+	}
+	d.conn = conn
+	d.selfID = hello.SelfID
+	d.alive.Store(true)
+	d.lastEvt.Store(time.Now().UnixNano())
+	zero.APICallers.Store(d.selfID, d)
+	logger.Info("napcat connected", "url", d.url, "self_id", d.selfID)
+}
+
+// Connected 是否连接成功过
+func (d *wsDriver) Connected() bool {
+	return d.conn != nil
+}
+
+// Alive 当前是否连接中
+func (d *wsDriver) Alive() bool {
+	return d.alive.Load()
+}
+
+// LastEvent 最近一次收到事件（含心跳）的时间，没连上过为零值
+func (d *wsDriver) LastEvent() time.Time {
+	if n := d.lastEvt.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// watchdog 定期检查事件时间，超过 idleTimeout 没有任何事件（NapCat 卡死但 TCP 没断）时关闭连接，
+// 让 Listen 返回、进入重连
+func (d *wsDriver) watchdog(done <-chan struct{}) {
+	ticker := time.NewTicker(max(d.idleTimeout/3, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if idle := time.Since(d.LastEvent()); idle > d.idleTimeout {
+			logger.Warn("no events from napcat, closing connection", "idle", idle.Round(time.Second))
+			d.stale.Store(true)
+			d.conn.Close()
+			return
+		}
+	}
+}
+
+// Err 连接或读取失败的原因
+func (d *wsDriver) Err() error {
+	return d.connErr
+}
+
+// Listen 读取事件直到连接断开
+func (d *wsDriver) Listen(handler func([]byte, zero.APICaller)) {
+	if d.conn == nil {
+		return
+	}
+	if d.idleTimeout > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go d.watchdog(done)
+	}
+	defer func() {
+		d.alive.Store(false)
+		zero.APICallers.Delete(d.selfID)
+		d.conn.Close()
+		// 唤醒所有等待中的 API 调用
+		d.pending.Range(func(key, value any) bool {
+			d.pending.Delete(key)
+			close(value.(chan zero.APIResponse))
+			return true
+		})
+	}()
+
+	for {
+		typ, payload, err := d.conn.ReadMessage()
+		if err != nil {
+			if d.stale.Load() {
+				err = fmt.Errorf("no events for over %s", d.idleTimeout)
+			}
+			d.connErr = fmt.Errorf("read: %w", err)
+			return
+		}
+		d.lastEvt.Store(time.Now().UnixNano())
+		if typ != websocket.TextMessage {
+			continue
+		}
+		rsp := gjson.ParseBytes(payload)
+		if echo := rsp.Get("echo"); echo.Exists() {
+			if ch, ok := d.pending.LoadAndDelete(echo.Uint()); ok {
+				msg := rsp.Get("message").Str
+				if msg == "" {
+					msg = rsp.Get("msg").Str
+				}
+				ch.(chan zero.APIResponse) <- zero.APIResponse{
+					Status:  rsp.Get("status").String(),
+					Data:    rsp.Get("data"),
+					Message: msg,
+					Wording: rsp.Get("wording").Str,
+					RetCode: rsp.Get("retcode").Int(),
+					Echo:    echo.Uint(),
+				}
+			}
+			continue
+		}
+		if rsp.Get("meta_event_type").Str == "heartbeat" {
+			continue
+		}
+		handler(payload, d)
+	}
+}
+
+// CallAPI 发送 API 请求并等待响应
+func (d *wsDriver) CallAPI(ctx context.Context, req zero.APIRequest) (zero.APIResponse, error) {
+	if d.conn == nil {
+		return zero.APIResponse{}, io.ErrClosedPipe
+	}
+	ch := make(chan zero.APIResponse, 1)
+	req.Echo = d.seq.Add(1)
+	d.pending.Store(req.Echo, ch)
+
+	d.writeMu.Lock()
+	err := d.conn.WriteJSON(&req)
+	d.writeMu.Unlock()
+	if err != nil {
+		d.pending.Delete(req.Echo)
+		return zero.APIResponse{}, fmt.Errorf("write api request: %w", err)
+	}
+
+	select {
+	case rsp, ok := <-ch:
+		if !ok {
+			return zero.APIResponse{}, io.ErrClosedPipe
+		}
+		return rsp, nil
+	case <-ctx.Done():
+		d.pending.Delete(req.Echo)
+		return zero.APIResponse{}, ctx.Err()
+	}
+}
@@ -1,6 +1,8 @@
 package chat
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -10,25 +12,50 @@ import (
 	"time"
 
 	"google.golang.org/genai"
+
+	"github.com/liao/style-bot/internal/logging"
+	"github.com/liao/style-bot/internal/metrics"
 )
 
+var logger = logging.For("chat")
+
+var sessionLength = metrics.NewGauge("stylebot_session_length", "Messages kept in the private chat session.")
+
+// RecalledPlaceholder 被撤回的消息在 prompt 中的替代文本
+const RecalledPlaceholder = "（对方撤回了一条消息）"
+
 type Message struct {
-	Role      string    `json:"role"`    // "user" / "model"
+	Role      string    `json:"role"` // "user" / "model"
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
+	MessageID int64     `json:"message_id,omitempty"` // OneBot message_id，用于撤回定位
+	Recalled  bool      `json:"recalled,omitempty"`
+	Sender    string    `json:"sender,omitempty"` // 群聊中发言人的群名片/昵称
 }
 
 type Session struct {
 	Messages   []Message `json:"messages"`
 	LastActive time.Time `json:"last_active"`
+	Summary    string    `json:"summary,omitempty"` // 滚动摘要，历史被裁剪后仍能保持话题
 }
 
 type Manager struct {
 	mu          sync.Mutex
 	session     *Session
+	sinceSum    int // 上次摘要后新增的消息数
 	maxTurns    int
 	sessionDir  string
 	sessionFile string
+
+	// 增量保存：Save 只把新消息追加到 WAL（session.log），攒够 maxTurns 条或有修改（撤回、摘要）时重写快照
+	walFile  string
+	unsaved  []Message // 还没写进 WAL 的消息
+	walLines int       // WAL 里已有的消息数
+	dirty    bool      // 有 WAL 表达不了的修改，下次 Save 写完整快照
+
+	groups map[string]*Manager // 群聊和单独私聊对象的会话，按文件名（group_<群号>、peer_<QQ号>）区分
+
+	private bool // 私聊主会话，长度记入 session_length（群聊、分支不记）
 }
 
 func NewManager(maxTurns int, sessionDir string) (*Manager, error) {
@@ -40,38 +67,296 @@ func NewManager(maxTurns int, sessionDir string) (*Manager, error) {
 		maxTurns:    maxTurns,
 		sessionDir:  sessionDir,
 		sessionFile: filepath.Join(sessionDir, "session.json"),
+		groups:      make(map[string]*Manager),
+		private:     true,
 	}
+	m.load()
+	m.observeLength()
+	return m, nil
+}
+
+// NewMemoryManager 只在内存里的会话，Save 不写文件（本地调试用）
+func NewMemoryManager(maxTurns int) *Manager {
+	m := &Manager{
+		session:  &Session{LastActive: time.Now()},
+		maxTurns: maxTurns,
+		groups:   make(map[string]*Manager),
+		private:  true,
+	}
+	m.observeLength()
+	return m
+}
+
+// Reset 清空会话消息和摘要
+func (m *Manager) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.session = &Session{LastActive: time.Now()}
+	m.sinceSum = 0
+	m.unsaved = nil
+	m.dirty = true
+	m.observeLength()
+}
+
+// Clear 清空会话并删除磁盘上的会话文件和 WAL；之后没有新消息时 Save 什么也不写（bot 陷入奇怪的循环时用）
+func (m *Manager) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.session = &Session{LastActive: time.Now()}
+	m.sinceSum = 0
+	m.unsaved, m.dirty, m.walLines = nil, false, 0
+	m.observeLength()
+	if m.sessionFile == "" {
+		return
+	}
+	for _, path := range []string{m.sessionFile, m.walFile} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Warn("remove session file failed", "file", path, "error", err)
+		}
+	}
+}
 
-	// 尝试从文件恢复
+// load 从快照恢复，再重放 WAL 里快照之后的消息；WAL 损坏时只用快照
+func (m *Manager) load() {
+	m.walFile = walPath(m.sessionFile)
 	if data, err := os.ReadFile(m.sessionFile); err == nil {
 		var s Session
-		if json.Unmarshal(data, &s) == nil {
+		if err := json.Unmarshal(data, &s); err != nil {
+			logger.Warn("session snapshot corrupt, starting from WAL only", "file", m.sessionFile, "error", err)
+		} else {
 			m.session = &s
 		}
+	} else if !os.IsNotExist(err) {
+		logger.Warn("read session snapshot failed", "file", m.sessionFile, "error", err)
 	}
 	if m.session == nil {
 		m.session = &Session{LastActive: time.Now()}
 	}
-	return m, nil
+
+	msgs, torn, err := readWAL(m.walFile)
+	if err != nil {
+		logger.Warn("session WAL corrupt, falling back to snapshot", "file", m.walFile, "error", err)
+		m.dirty = true // 下次保存写快照并清空 WAL
+		return
+	}
+	if torn {
+		// 不再往写了一半的行后面追加，下次保存写快照并清空 WAL
+		m.dirty = true
+	}
+	// 写完快照、还没清空 WAL 时崩溃的话，WAL 里的消息快照里已经有了
+	var last time.Time
+	if n := len(m.session.Messages); n > 0 {
+		last = m.session.Messages[n-1].Timestamp
+	}
+	for _, msg := range msgs {
+		if !msg.Timestamp.After(last) {
+			continue
+		}
+		m.session.Messages = append(m.session.Messages, msg)
+		if msg.Role == "user" {
+			m.session.LastActive = msg.Timestamp
+		}
+		m.trim()
+	}
+	m.walLines = len(msgs)
+}
+
+// walPath session.json → session.log，group_<群号>.json → group_<群号>.log
+func walPath(sessionFile string) string {
+	return strings.TrimSuffix(sessionFile, filepath.Ext(sessionFile)) + ".log"
+}
+
+// readWAL 读取 WAL，每行一条 JSON 编码的 Message；文件不存在时返回空。
+// 最后一行没有换行（追加时崩溃）时 torn 为 true，解析不了就丢掉这一行，前面的照常恢复
+func readWAL(path string) (msgs []Message, torn bool, err error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read session WAL: %w", err)
+	}
+	torn = len(data) > 0 && data[len(data)-1] != '\n'
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			if torn && i == len(lines)-1 {
+				logger.Warn("dropped torn last line of session WAL", "file", path, "line", i+1)
+				break
+			}
+			return nil, false, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, torn, nil
 }
 
-// AddUserMessage 添加对方发来的消息
-func (m *Manager) AddUserMessage(content string) {
+// Group 返回某个群的会话（group_<群号>.json），首次访问时从文件恢复
+func (m *Manager) Group(groupID int64) *Manager {
+	return m.sub(fmt.Sprintf("group_%d", groupID))
+}
+
+// Peer 返回某个私聊对象单独的会话（peer_<QQ号>.json），与主会话互不影响，首次访问时从文件恢复
+func (m *Manager) Peer(peerID int64) *Manager {
+	return m.sub(fmt.Sprintf("peer_%d", peerID))
+}
+
+// sub 按名字取子会话，随主会话一起保存
+func (m *Manager) sub(name string) *Manager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if g, ok := m.groups[name]; ok {
+		return g
+	}
+	if m.groups == nil {
+		m.groups = make(map[string]*Manager)
+	}
+	if m.sessionFile == "" {
+		g := &Manager{session: &Session{LastActive: time.Now()}, maxTurns: m.maxTurns}
+		m.groups[name] = g
+		return g
+	}
+	g := &Manager{
+		maxTurns:    m.maxTurns,
+		sessionDir:  m.sessionDir,
+		sessionFile: filepath.Join(m.sessionDir, name+".json"),
+	}
+	g.load()
+	m.groups[name] = g
+	return g
+}
+
+// Branch 复制当前会话到一个新的 Manager，用于 A/B 测试 prompt
+// 分支有独立的会话文件 branch_<id>.json，互不影响
+func (m *Manager) Branch() *Manager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.copySession()
+	if m.sessionFile == "" {
+		return &Manager{session: session, maxTurns: m.maxTurns}
+	}
+	sessionFile := filepath.Join(m.sessionDir, "branch_"+randomID()+".json")
+	return &Manager{
+		session:     session,
+		maxTurns:    m.maxTurns,
+		sessionDir:  m.sessionDir,
+		sessionFile: sessionFile,
+		walFile:     walPath(sessionFile),
+		dirty:       true,
+	}
+}
+
+// Copy 复制当前会话到一个只在内存里的 Manager，Save 不写文件（试生成回复用，用完即弃）
+func (m *Manager) Copy() *Manager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return &Manager{session: m.copySession(), maxTurns: m.maxTurns}
+}
+
+// copySession 复制会话的消息和摘要，调用方持有 m.mu
+func (m *Manager) copySession() *Session {
+	msgs := make([]Message, len(m.session.Messages))
+	copy(msgs, m.session.Messages)
+	return &Session{Messages: msgs, LastActive: m.session.LastActive, Summary: m.session.Summary}
+}
+
+// Discard 删除会话文件（用于丢弃分支）
+func (m *Manager) Discard() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessionFile == "" {
+		return nil
+	}
+	if err := os.Remove(m.sessionFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove session file: %w", err)
+	}
+	if err := os.Remove(m.walFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove session WAL: %w", err)
+	}
+	return nil
+}
+
+// AddUserMessage 添加对方发来的消息，messageID 为 0 表示未知
+func (m *Manager) AddUserMessage(content string, messageID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+	m.add(Message{
+		Role:      "user",
+		Content:   content,
+		Timestamp: time.Now(),
+		MessageID: messageID,
+	})
+	m.session.LastActive = time.Now()
+	m.sinceSum++
+	m.trim()
+}
+
+// AddGroupMessage 添加群聊里别人的发言，sender 为群名片/昵称
+func (m *Manager) AddGroupMessage(sender, content string, messageID int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if strings.TrimSpace(content) == "" {
 		return
 	}
-	m.session.Messages = append(m.session.Messages, Message{
+	m.add(Message{
 		Role:      "user",
 		Content:   content,
 		Timestamp: time.Now(),
+		MessageID: messageID,
+		Sender:    sender,
 	})
 	m.session.LastActive = time.Now()
+	m.sinceSum++
 	m.trim()
 }
 
+// LastUserMessageID 最近一条对方消息的 message_id，没有时返回 0
+func (m *Manager) LastUserMessageID() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.session.Messages) - 1; i >= 0; i-- {
+		if m.session.Messages[i].Role == "user" {
+			return m.session.Messages[i].MessageID
+		}
+	}
+	return 0
+}
+
+// MarkRecalled 把指定 message_id 的对方消息标记为已撤回，找到返回 true
+func (m *Manager) MarkRecalled(messageID int64) bool {
+	if messageID == 0 {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.session.Messages) - 1; i >= 0; i-- {
+		msg := &m.session.Messages[i]
+		if msg.Role == "user" && msg.MessageID == messageID {
+			msg.Recalled = true
+			m.dirty = true
+			return true
+		}
+	}
+	return false
+}
+
 // AddBotReply 添加 bot 的回复
 func (m *Manager) AddBotReply(content string) {
 	if strings.TrimSpace(content) == "" {
@@ -80,21 +365,44 @@ func (m *Manager) AddBotReply(content string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.session.Messages = append(m.session.Messages, Message{
+	m.add(Message{
 		Role:      "model",
 		Content:   content,
 		Timestamp: time.Now(),
 	})
+	m.sinceSum++
 	m.trim()
 }
 
-// GetHistory 获取对话历史，转换为 genai.Content 格式
+// GetHistory 获取对话历史，转换为 genai.Content 格式；同一方连续的几条（对方连发）合并成一轮，用换行连接，保证 user / model 交替
 func (m *Manager) GetHistory() []*genai.Content {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return buildHistory(m.session.Messages)
+}
+
+// PriorHistory 同 GetHistory，但不含最后一条消息（刚添加、会作为本轮输入单独传入的那条）
+func (m *Manager) PriorHistory() []*genai.Content {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msgs := m.session.Messages
+	if len(msgs) > 0 {
+		msgs = msgs[:len(msgs)-1]
+	}
+	return buildHistory(msgs)
+}
 
-	contents := make([]*genai.Content, 0, len(m.session.Messages))
-	for _, msg := range m.session.Messages {
+func buildHistory(messages []Message) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(messages))
+	var lines []string
+	var last genai.Role
+	flush := func() {
+		if len(lines) > 0 {
+			contents = append(contents, genai.NewContentFromText(strings.Join(lines, "\n"), last))
+			lines = lines[:0]
+		}
+	}
+	for _, msg := range messages {
 		if strings.TrimSpace(msg.Content) == "" {
 			continue // 跳过空消息，避免 API 400 错误
 		}
@@ -102,21 +410,242 @@ func (m *Manager) GetHistory() []*genai.Content {
 		if msg.Role == "model" {
 			role = genai.RoleModel
 		}
-		contents = append(contents, genai.NewContentFromText(msg.Content, role))
+		text := msg.Content
+		if msg.Recalled {
+			text = RecalledPlaceholder
+		}
+		if role != last {
+			flush()
+			last = role
+		}
+		lines = append(lines, text)
 	}
+	flush()
 	return contents
 }
 
-// Save 持久化到文件
+// Summary 返回当前对话的滚动摘要
+func (m *Manager) Summary() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.session.Summary
+}
+
+// SetSummary 更新滚动摘要并重置计数
+func (m *Manager) SetSummary(summary string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.session.Summary = summary
+	m.sinceSum = 0
+	m.dirty = true
+}
+
+// MessagesSinceSummary 上次摘要后新增的消息数
+func (m *Manager) MessagesSinceSummary() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sinceSum
+}
+
+// Messages 返回当前会话消息的副本
+func (m *Manager) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msgs := make([]Message, len(m.session.Messages))
+	copy(msgs, m.session.Messages)
+	return msgs
+}
+
+// MessagesSince 返回 t 之后的消息（副本）
+func (m *Manager) MessagesSince(t time.Time) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var msgs []Message
+	for _, msg := range m.session.Messages {
+		if msg.Timestamp.After(t) {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// SessionStats 会话统计
+type SessionStats struct {
+	TotalMessages         int
+	MyMessages            int // bot 发出的
+	UserMessages          int // 对方发来的
+	SessionStart          time.Time
+	LastActive            time.Time
+	AverageReplyLatencyMs float64 // 对方消息到 bot 下一条回复的平均间隔
+}
+
+// Stats 统计当前会话（裁剪后保留的部分）
+func (m *Manager) Stats() SessionStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := SessionStats{
+		TotalMessages: len(m.session.Messages),
+		LastActive:    m.session.LastActive,
+	}
+	if len(m.session.Messages) > 0 {
+		st.SessionStart = m.session.Messages[0].Timestamp
+	}
+
+	var pending time.Time // 尚未被回复的第一条对方消息
+	var total time.Duration
+	var replies int
+	for _, msg := range m.session.Messages {
+		if msg.Role == "model" {
+			st.MyMessages++
+			if !pending.IsZero() {
+				total += msg.Timestamp.Sub(pending)
+				replies++
+				pending = time.Time{}
+			}
+			continue
+		}
+		st.UserMessages++
+		if pending.IsZero() {
+			pending = msg.Timestamp
+		}
+	}
+	if replies > 0 {
+		st.AverageReplyLatencyMs = float64(total.Milliseconds()) / float64(replies)
+	}
+	return st
+}
+
+// Transcript 返回最近的对话文本，每行 "对方：xx" / "我：xx"，群聊中用发言人的名字代替"对方"
+func (m *Manager) Transcript() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lines := make([]string, 0, len(m.session.Messages))
+	for _, msg := range m.session.Messages {
+		if strings.TrimSpace(msg.Content) == "" || msg.Recalled {
+			continue
+		}
+		speaker := "对方"
+		if msg.Sender != "" {
+			speaker = msg.Sender
+		}
+		if msg.Role == "model" {
+			speaker = "我"
+		}
+		lines = append(lines, speaker+"："+msg.Content)
+	}
+	return lines
+}
+
+// Save 持久化到文件，群聊和单独私聊对象的会话一并保存；内存会话不写文件
 func (m *Manager) Save() error {
+	groups, err := m.save()
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if err := g.Save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save 把新消息追加到 WAL（必要时改为重写快照），返回需要一并保存的子会话
+func (m *Manager) save() ([]*Manager, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.sessionFile == "" {
+		m.unsaved, m.dirty = nil, false
+	} else if m.dirty || m.walLines+len(m.unsaved) >= m.maxTurns {
+		if err := m.compact(); err != nil {
+			return nil, err
+		}
+	} else if err := m.appendWAL(); err != nil {
+		return nil, err
+	}
+	groups := make([]*Manager, 0, len(m.groups))
+	for _, g := range m.groups {
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// add 追加一条消息，下次 Save 时写进 WAL
+func (m *Manager) add(msg Message) {
+	m.session.Messages = append(m.session.Messages, msg)
+	m.unsaved = append(m.unsaved, msg)
+}
+
+// appendWAL 把还没保存的消息追加到 WAL
+func (m *Manager) appendWAL() error {
+	if len(m.unsaved) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, msg := range m.unsaved {
+		line, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("marshal message: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	f, err := os.OpenFile(m.walFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open session WAL: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(buf); err != nil {
+		return fmt.Errorf("append session WAL: %w", err)
+	}
+	m.walLines += len(m.unsaved)
+	m.unsaved = nil
+	return nil
+}
+
+// compact 重写完整快照并清空 WAL
+func (m *Manager) compact() error {
 	data, err := json.MarshalIndent(m.session, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal session: %w", err)
 	}
-	return os.WriteFile(m.sessionFile, data, 0644)
+	if err := writeFileSync(m.sessionFile, data); err != nil {
+		return err
+	}
+	// 快照落盘后才清空 WAL，中途崩溃时旧快照 + WAL 仍然完整
+	if err := os.Remove(m.walFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("truncate session WAL: %w", err)
+	}
+	m.walLines, m.unsaved, m.dirty = 0, nil, false
+	return nil
+}
+
+// writeFileSync 先写 path.tmp 并 fsync，再重命名覆盖 path，崩溃时不会留下写了一半的快照
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("write session snapshot: %w", err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write session snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename session snapshot: %w", err)
+	}
+	return nil
 }
 
 func (m *Manager) trim() {
@@ -125,4 +654,18 @@ func (m *Manager) trim() {
 	if len(m.session.Messages) > max {
 		m.session.Messages = m.session.Messages[len(m.session.Messages)-max:]
 	}
+	m.observeLength()
+}
+
+// observeLength 私聊主会话更新 session_length
+func (m *Manager) observeLength() {
+	if m.private {
+		sessionLength.Set(int64(len(m.session.Messages)))
+	}
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
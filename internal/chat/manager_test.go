@@ -0,0 +1,133 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestLoadDropsTornLastWALLine(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(10, dir)
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	m.AddUserMessage("在吗", 0)
+	m.AddBotReply("在")
+	if err := m.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// 追加时崩溃：最后一行只写了一半
+	wal := filepath.Join(dir, "session.log")
+	f, err := os.OpenFile(wal, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("open WAL: %v", err)
+	}
+	f.WriteString(`{"role":"user","content":"明天`)
+	f.Close()
+
+	m, err = NewManager(10, dir)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := strings.Join(m.Transcript(), "/"); got != "对方：在吗/我：在" {
+		t.Fatalf("transcript after torn WAL = %q", got)
+	}
+
+	// 之后的消息不接在半行后面，再次加载时都在
+	m.AddUserMessage("明天有空吗", 0)
+	if err := m.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	m, err = NewManager(10, dir)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := strings.Join(m.Transcript(), "/"); got != "对方：在吗/我：在/对方：明天有空吗" {
+		t.Errorf("transcript after next save = %q", got)
+	}
+}
+
+func TestLoadFallsBackToSnapshotOnCorruptWALLine(t *testing.T) {
+	dir := t.TempDir()
+	wal := filepath.Join(dir, "session.log")
+	data := `{"role":"user","content":"在吗","timestamp":"2024-05-01T20:00:00Z"}` + "\n" + "garbage\n" + `{"role":"model","content":"在","timestamp":"2024-05-01T20:01:00Z"}` + "\n"
+	if err := os.WriteFile(wal, []byte(data), 0644); err != nil {
+		t.Fatalf("write WAL: %v", err)
+	}
+	m, err := NewManager(10, dir)
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	if got := m.Transcript(); len(got) != 0 {
+		t.Errorf("transcript = %q, want the (empty) snapshot", got)
+	}
+}
+
+func TestLoadReplaysWALOverTruncatedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "session.json"), []byte(`{"messages":[{"role":"us`), 0644); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	data := `{"role":"user","content":"在吗","timestamp":"2024-05-01T20:00:00Z"}` + "\n" + `{"role":"model","content":"在","timestamp":"2024-05-01T20:01:00Z"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "session.log"), []byte(data), 0644); err != nil {
+		t.Fatalf("write WAL: %v", err)
+	}
+	m, err := NewManager(10, dir)
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	if got := strings.Join(m.Transcript(), "/"); got != "对方：在吗/我：在" {
+		t.Fatalf("transcript = %q, want the WAL messages", got)
+	}
+
+	m.Clear()
+	m.AddUserMessage("明天有空吗", 0)
+	m.dirty = true // 强制写快照
+	if err := m.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "session.json.tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary snapshot left behind: %v", err)
+	}
+	m, err = NewManager(10, dir)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := strings.Join(m.Transcript(), "/"); got != "对方：明天有空吗" {
+		t.Errorf("transcript after compaction = %q", got)
+	}
+}
+
+func TestBuildHistoryMergesConsecutiveMessages(t *testing.T) {
+	history := buildHistory([]Message{
+		{Role: "user", Content: "在吗"},
+		{Role: "user", Content: "  "},
+		{Role: "user", Content: "明天有空吗"},
+		{Role: "model", Content: "有"},
+		{Role: "model", Content: "怎么了"},
+		{Role: "user", Content: "打错了", Recalled: true},
+		{Role: "user", Content: "去爬山"},
+	})
+	want := []struct {
+		role genai.Role
+		text string
+	}{
+		{genai.RoleUser, "在吗\n明天有空吗"},
+		{genai.RoleModel, "有\n怎么了"},
+		{genai.RoleUser, RecalledPlaceholder + "\n去爬山"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("got %d contents, want %d", len(history), len(want))
+	}
+	for i, w := range want {
+		c := history[i]
+		if genai.Role(c.Role) != w.role || len(c.Parts) != 1 || c.Parts[0].Text != w.text {
+			t.Errorf("content %d = %s %q, want %s %q", i, c.Role, c.Parts[0].Text, w.role, w.text)
+		}
+	}
+}
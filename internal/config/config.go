@@ -1,9 +1,12 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -14,6 +17,11 @@ type Config struct {
 	Gemini GeminiConfig `mapstructure:"gemini"`
 	RAG    RAGConfig    `mapstructure:"rag"`
 	Data   DataConfig   `mapstructure:"data"`
+	NATS   NATSConfig   `mapstructure:"nats"`
+
+	Webhook WebhookConfig `mapstructure:"webhook"`
+	Admin   AdminConfig   `mapstructure:"admin"`
+	Logging LoggingConfig `mapstructure:"logging"`
 }
 
 type BotConfig struct {
@@ -25,33 +33,288 @@ type BotConfig struct {
 	ReplyDelayMaxMs int    `mapstructure:"reply_delay_max_ms"`
 	MaxContextTurns int    `mapstructure:"max_context_turns"`
 	SessionTimeoutM int    `mapstructure:"session_timeout_min"`
+	PromptTemplate  string `mapstructure:"prompt_template"` // system prompt 模板文件（text/template），空 = 内置
+	DisclosureMode  string `mapstructure:"disclosure_mode"` // 被问是不是 AI：deny | deflect | honest
+	SummaryEvery    int    `mapstructure:"summary_every"`   // 每新增多少条消息更新一次对话摘要，0 = 关闭
+	DeflectUnknown  bool   `mapstructure:"deflect_unknown"` // 问到记录里没有的事实时直接用兜底话术回复
+
+	MaxRepliesPerDay         int  `mapstructure:"max_replies_per_day"`           // 0 = 不限制
+	MaxRepliesPerHourPerPeer int  `mapstructure:"max_replies_per_hour_per_peer"` // 0 = 不限制
+	QuotaNotice              bool `mapstructure:"quota_notice"`                  // 超限时发一条"等下再聊"
+
+	RecallReaction bool `mapstructure:"recall_reaction"` // 对方撤回消息时偶尔调侃一句
+
+	UserRPM     int    `mapstructure:"user_rpm"`     // 单个用户每分钟最多触发几次生成，超出只记录不回复，0 = 不限制
+	FloodNotice string `mapstructure:"flood_notice"` // 超出 user_rpm 时发一次的提醒，为空不发
+
+	MaxConcurrentGenerations int `mapstructure:"max_concurrent_generations"` // 同时生成的回复数上限，0 = 不限制
+	MaxQueuedGenerations     int `mapstructure:"max_queued_generations"`     // 排队上限，超出直接丢弃，0 = 不限制
+	QueueStaleSec            int `mapstructure:"queue_stale_sec"`            // 排队超过该秒数的消息不再回复，0 = 不限制
+
+	// EmojiInjectionProbability 回复里没有表情时补一个人设表情的概率，0 = 关闭
+	EmojiInjectionProbability float32 `mapstructure:"emoji_injection_probability"`
+
+	// PersonaRefreshAfterMessages 累计多少条新消息后用最近会话自动重新分析风格，0 = 关闭
+	PersonaRefreshAfterMessages int `mapstructure:"persona_refresh_after_messages"`
+
+	// TypoProbability 每条回复打一个同音错字并随后发 "*正确的字" 更正的概率，0 = 关闭
+	TypoProbability float32 `mapstructure:"typo_probability"`
+
+	DebugPrompt  bool `mapstructure:"debug_prompt"`  // system prompt 开头加 RAG 检索信息，owner 可用 /prompt 查看
+	DisableFaces bool `mapstructure:"disable_faces"` // 不发送 QQ 表情，表情标记只转成 Unicode emoji
+
+	// SilentMode 静默模式：照常记录会话、生成回复但不发送，回复写进 sessions_dir/silent_log.jsonl；owner 可用 /silent-toggle 切换
+	SilentMode bool `mapstructure:"silent_mode"`
+	// DryRun 演练模式：照常检索、生成、后处理并更新会话，延迟只计算不等待，回复转发给 owner 而不发给对方
+	DryRun bool `mapstructure:"dry_run"`
+
+	VisionEnabled   bool `mapstructure:"vision_enabled"`    // 对方发图片时用 Gemini 看图回复
+	VisionMaxImages int  `mapstructure:"vision_max_images"` // 单条消息最多处理几张图
+	VisionMaxBytes  int  `mapstructure:"vision_max_bytes"`  // 单张图片大小上限
+
+	Groups         []int64  `mapstructure:"groups"`          // 群聊白名单，被 @ 或叫名字时回复
+	GroupNicknames []string `mapstructure:"group_nicknames"` // 群里叫 bot 的名字，为空时用 my_name
+
+	QuoteReply bool `mapstructure:"quote_reply"` // 第一条回复总是引用对方的消息
+	// QuoteReplyProbability 第一条回复引用对方消息的概率；回复时对方已发了新消息则总是引用
+	QuoteReplyProbability float32 `mapstructure:"quote_reply_probability"`
+
+	PokeBackProbability float32 `mapstructure:"poke_back_probability"` // 被拍一拍时拍回去的概率，否则回一句话
+	PokeCooldownSec     int     `mapstructure:"poke_cooldown_sec"`     // 拍一拍响应冷却，防止互拍死循环
+
+	// FollowupProbability 回复后对方 30-120 秒没回时再补一句（接着说或问个相关问题）的概率，0 = 关闭
+	FollowupProbability float32 `mapstructure:"followup_probability"`
+
+	BlockedTopics BlockedTopicsConfig `mapstructure:"blocked_topics"`
+	Escalation    EscalationConfig    `mapstructure:"escalation"`
+
+	VoiceEnabled     bool     `mapstructure:"voice_enabled"`      // 对方发语音时转写后回复
+	VoiceMaxSeconds  int      `mapstructure:"voice_max_seconds"`  // 超过该时长的语音不转写
+	VoiceFailReplies []string `mapstructure:"voice_fail_replies"` // 听不了语音时的回复，随机挑一条
+
+	PromptVariants  map[string]string `mapstructure:"prompt_variants"`   // /branch-test 可用的变体：名字 → 模板文件
+	BranchTestTurns int               `mapstructure:"branch_test_turns"` // 分支测试持续轮数
+
+	SendRetries          int `mapstructure:"send_retries"`            // 发送失败后重试次数（退避 1s 起翻倍），仍失败的进待发箱
+	OutboxMaxAgeSec      int `mapstructure:"outbox_max_age_sec"`      // 补发时超过该秒数的消息直接丢弃，0 = 不过期
+	OutboxNotifyAfterSec int `mapstructure:"outbox_notify_after_sec"` // 待发箱非空超过该秒数时通知 owner，0 = 不通知
+
+	AllowQQ     []int64 `mapstructure:"allow_qq"`     // 同样用人设回复的 QQ（target_qq 之外）
+	BlockQQ     []int64 `mapstructure:"block_qq"`     // 永不回复
+	DefaultDeny bool    `mapstructure:"default_deny"` // target_qq 为 0 时也不回复 allow_qq 之外的人
+	OthersMode  string  `mapstructure:"others_mode"`  // target_qq 为 0 时陌生人的回复方式：neutral | canned | persona
+	OthersReply string  `mapstructure:"others_reply"` // others_mode 为 canned 时的固定回复，为空不回
+
+	Requests RequestsConfig `mapstructure:"requests"`
+	Digest   DigestConfig   `mapstructure:"digest"`
+
+	ReplyLanguage string `mapstructure:"reply_language"` // auto 按对方消息的语言回复 | zh | en | mixed 固定
+	Timezone      string `mapstructure:"timezone"`       // prompt 里"当前时间"的时区，如 Asia/Shanghai；空 = 服务器本地时区
+
+	DriftCheckIntervalMessages int     `mapstructure:"drift_check_interval_messages"` // 每多少条消息检查一次风格漂移，0 = 关闭
+	DriftAlertThreshold        float32 `mapstructure:"drift_alert_threshold"`         // 最近回复与向量库风格中心的相似度低于该值时提醒 owner
+
+	WarmupMessages []string `mapstructure:"warmup_messages"` // 启动时先检索一遍这些消息预热向量库，为空不预热
+}
+
+// RequestsConfig 好友申请和群邀请的处理：ignore 不处理 | reject 自动拒绝 | owner 转给 owner 用 /approve、/reject 决定；
+// AllowQQ 里的人总是自动同意（同意好友不等于会回复对方，回复对象仍由 target_qq / allow_qq 决定）
+type RequestsConfig struct {
+	FriendPolicy string  `mapstructure:"friend_policy"`
+	GroupPolicy  string  `mapstructure:"group_policy"`
+	AllowQQ      []int64 `mapstructure:"allow_qq"`
+}
+
+// DigestConfig 每天定时私聊 owner 一份当天的摘要：消息数、主要话题、拦截和错误、token 用量
+type DigestConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Time    string `mapstructure:"time"` // 发送时间 HH:MM，默认 23:30
+}
+
+// BlockedTopicsConfig 不允许 bot 代为回答的话题（转账、约见面、密码验证码等）
+type BlockedTopicsConfig struct {
+	Keywords    []string `mapstructure:"keywords"`
+	Patterns    []string `mapstructure:"patterns"`    // 正则
+	Deflections []string `mapstructure:"deflections"` // 命中时的回复，为空用人设的拒绝示例
+}
+
+// EscalationConfig 高风险/情绪激烈的消息交给 owner 亲自处理
+type EscalationConfig struct {
+	Keywords       []string `mapstructure:"keywords"`
+	ModelCheck     bool     `mapstructure:"model_check"`     // 关键词没命中时再用模型打分
+	ModelThreshold float32  `mapstructure:"model_threshold"` // 模型打分阈值（0-1），默认 0.7
+	PauseMinutes   int      `mapstructure:"pause_minutes"`   // 暂停自动回复的时长，0 = 直到 /resume
+	HoldingReply   bool     `mapstructure:"holding_reply"`   // 是否先回一句中性的缓冲话
+	HoldingReplies []string `mapstructure:"holding_replies"`
 }
 
 type NapCatConfig struct {
 	WSURL       string `mapstructure:"ws_url"`
 	AccessToken string `mapstructure:"access_token"`
+	// MaxReconnectAttempts 断线后最多连续重连次数，0 = 无限
+	MaxReconnectAttempts int `mapstructure:"max_reconnect_attempts"`
+	// HeartbeatTimeout 超过这么久没收到任何事件（含心跳）就断开重连，如 90s，0 = 默认 90s，负数 = 不检查
+	HeartbeatTimeout time.Duration `mapstructure:"heartbeat_timeout"`
+	// AlertWebhook 连续重连失败时推送告警的地址（QQ 断了没法通知 owner），为空不推送
+	AlertWebhook string `mapstructure:"alert_webhook"`
+	// AlertAfterAttempts 连续失败多少次后推送告警，0 = 默认 5
+	AlertAfterAttempts int `mapstructure:"alert_after_attempts"`
 }
 
 type GeminiConfig struct {
-	APIKey          string  `mapstructure:"api_key"`
+	APIKey          string   `mapstructure:"api_key"`
+	APIKeysFile     string   `mapstructure:"api_keys_file"`
+	APIKeys         []string `mapstructure:"api_keys"` // Load 后包含 api_key（可以是 JSON 数组）展开的全部 key
 	ChatModel       string   `mapstructure:"chat_model"`
 	ChatModels      []string `mapstructure:"chat_models"`
 	EmbeddingModel  string   `mapstructure:"embedding_model"`
 	OllamaURL       string   `mapstructure:"ollama_url"`
-	Temperature     float32 `mapstructure:"temperature"`
-	MaxOutputTokens int32   `mapstructure:"max_output_tokens"`
-	RPMLimit        int     `mapstructure:"rpm_limit"`
+	Temperature     float32  `mapstructure:"temperature"`
+	MaxOutputTokens int32    `mapstructure:"max_output_tokens"`
+	RPMLimit        int      `mapstructure:"rpm_limit"`
+	STTURL          string   `mapstructure:"stt_url"` // 本地 whisper 转写地址，为空时用 Gemini 听语音
+	// AnalysisThinkingBudget 风格分析时的 thinking token 预算，0 = 关闭；聊天回复不使用 thinking
+	AnalysisThinkingBudget int32 `mapstructure:"analysis_thinking_budget"`
+	// RequestTimeout 单次生成/embedding 请求超时，如 30s，0 = 不限制
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+	EmbedRetry     RetryConfig   `mapstructure:"embed_retry"`
+	// StopSequences 聊天生成的停止序列，如 ["|||"] 只保留第一条消息
+	StopSequences []string `mapstructure:"stop_sequences"`
+	// AnalysisStopSequences 风格分析的停止序列，如 ["```"] 防止 JSON 被包进代码块后继续输出
+	AnalysisStopSequences []string `mapstructure:"analysis_stop_sequences"`
+	// SentimentModel 判断消息情绪（rag.sentiment_boost）和导入时标注对话情绪用的轻量模型
+	SentimentModel string `mapstructure:"sentiment_model"`
+	// EmbeddingDim Gemini embedding 的输出维度（如 gemini-embedding-001 的 768），0 = 模型默认；用 Ollama 时无效
+	EmbeddingDim int32 `mapstructure:"embedding_dim"`
+}
+
+// Location bot.timezone 对应的时区，空时为服务器本地时区
+func (c BotConfig) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("bot.timezone: %w", err)
+	}
+	return loc, nil
+}
+
+// RetryConfig 指数退避重试，未配置的字段使用默认值（3 次，1s 起翻倍）
+type RetryConfig struct {
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	BaseDelay   time.Duration `mapstructure:"base_delay"`
+	MaxDelay    time.Duration `mapstructure:"max_delay"`
+	Jitter      float64       `mapstructure:"jitter"` // 0.2 = ±20%
 }
 
 type RAGConfig struct {
 	VectorsDir    string  `mapstructure:"vectors_dir"`
 	TopK          int     `mapstructure:"top_k"`
 	MinSimilarity float32 `mapstructure:"min_similarity"`
+	// StrongSimilarity 二次阈值：低于它的示例不放进 prompt（最相似的一条始终保留），0 = 关闭
+	StrongSimilarity float32 `mapstructure:"strong_similarity"`
+	// MinDocumentLength 写入向量库的对话最短字数，更短的跳过（data-importer -min-doc-len 的默认值）
+	MinDocumentLength int `mapstructure:"min_document_length"`
+	// Backend 向量库后端：chromem（默认，读 vectors_dir）| memory（内存、启动时为空，测试用）
+	Backend string `mapstructure:"backend"`
+
+	// StripEmoji 计算向量前去掉 emoji（@ 提及和多余空白总是去掉）；要与导入时 data-importer -strip-emoji 一致
+	StripEmoji bool `mapstructure:"strip_emoji"`
+
+	// SentimentBoost 每条消息先用模型判断情绪，检索时情绪标注相同的示例（导入时 -annotate-sentiment）加权 1.1 倍
+	SentimentBoost bool `mapstructure:"sentiment_boost"`
+
+	// RecencyHalfLifeDays 时间衰减的半衰期（天）：排序得分每过这么多天打 5 折，越新的对话越靠前（需重新导入写入对话时间），0 = 关闭
+	RecencyHalfLifeDays float64 `mapstructure:"recency_half_life_days"`
+
+	// MMRLambda 多样性重排：多取候选后按 lambda*相关度 - (1-lambda)*与已选示例的相似度 逐条挑选，越小越多样，0 = 关闭（直接取前 top_k）
+	MMRLambda float32 `mapstructure:"mmr_lambda"`
+
+	// QueryTurns 用最近几条消息（含刚收到的这条）拼检索文本，最新一条加权；<= 1 时只用这条消息
+	QueryTurns int `mapstructure:"query_turns"`
+	// QueryRewrite 先用模型把最近几条消息改写成一句检索语句（每条消息多一次模型调用），失败时退回拼接
+	QueryRewrite bool `mapstructure:"query_rewrite"`
+
+	// Rerank 多取 4 倍候选，用最便宜的聊天模型按话题和语气打 0-10 分，保留 rerank_min_score 以上最好的 top_k 条
+	Rerank         bool          `mapstructure:"rerank"`
+	RerankMinScore float32       `mapstructure:"rerank_min_score"`
+	RerankBudget   time.Duration `mapstructure:"rerank_budget"` // 单条消息重排的耗时上限，超时按相似度取，0 = 不限制
+
+	Short QueryTuning `mapstructure:"short"` // 短消息（寒暄）：更少、更严格的示例
+	Long  QueryTuning `mapstructure:"long"`  // 长消息和提问：更多、更宽松的示例
+
+	// Filter 只从满足条件的对话里检索示例（需重新导入写入对话时间和来源）
+	Filter RAGFilter `mapstructure:"filter"`
+}
+
+// RAGFilter 检索时按文档 metadata 过滤，零值不过滤
+type RAGFilter struct {
+	MinDate     string `mapstructure:"min_date"` // YYYY-MM-DD，只用这天及以后还在进行的对话
+	MaxDate     string `mapstructure:"max_date"` // YYYY-MM-DD，只用这天及以前开始的对话
+	MinMsgCount int    `mapstructure:"min_msg_count"`
+	Source      string `mapstructure:"source"` // data-importer -source-tag
+}
+
+// filterDateLayout rag.filter.min_date / max_date 的格式
+const filterDateLayout = "2006-01-02"
+
+// DateRange min_date 当天 0 点和 max_date 次日 0 点（本地时区），未设置的为零值；格式已在 Load 时校验
+func (f RAGFilter) DateRange() (from, until time.Time) {
+	if f.MinDate != "" {
+		from, _ = time.ParseInLocation(filterDateLayout, f.MinDate, time.Local)
+	}
+	if f.MaxDate != "" {
+		until, _ = time.ParseInLocation(filterDateLayout, f.MaxDate, time.Local)
+		until = until.AddDate(0, 0, 1)
+	}
+	return from, until
+}
+
+// QueryTuning 按消息长度覆盖检索参数；Runes 为 0 时不生效，TopK / MinSimilarity 为 0 时用 rag 的默认值
+type QueryTuning struct {
+	Runes         int     `mapstructure:"runes"` // short：不超过这么多字；long：至少这么多字
+	TopK          int     `mapstructure:"top_k"`
+	MinSimilarity float32 `mapstructure:"min_similarity"`
+}
+
+// WebhookConfig 通过 HTTP POST 收消息，listen_addr 为空时不启用
+type WebhookConfig struct {
+	ListenAddr string `mapstructure:"listen_addr"`
+	Secret     string `mapstructure:"secret"` // HMAC-SHA256 签名密钥
+}
+
+// AdminConfig 管理 HTTP 服务（/healthz、/metrics、/pause、/resume），listen 为空时不启用
+type AdminConfig struct {
+	Listen string `mapstructure:"listen"`
+	Token  string `mapstructure:"token"` // 请求头 Authorization: Bearer <token>
+}
+
+// LoggingConfig 日志级别：Level 是默认级别，Levels 按子系统（ai、rag、bot、parser、chat、coord、webhook）覆盖
+type LoggingConfig struct {
+	Level  string            `mapstructure:"level"`
+	Levels map[string]string `mapstructure:"levels"`
+
+	Format        string `mapstructure:"format"`         // text / json
+	File          string `mapstructure:"file"`           // 为空输出到 stdout
+	MaxSizeMB     int    `mapstructure:"max_size_mb"`    // 日志文件超过这个大小时轮转，保留 3 个旧文件；0 = 不轮转
+	RedactContent bool   `mapstructure:"redact_content"` // 日志里的聊天内容只记长度和哈希，原文只在审计日志里
+}
+
+type NATSConfig struct {
+	URL string `mapstructure:"url"` // 非空时启用多实例协调
 }
 
 type DataConfig struct {
 	SessionsDir string `mapstructure:"sessions_dir"`
 	PersonaFile string `mapstructure:"persona_file"`
+	LiveLog     string `mapstructure:"live_log"` // 每轮对话追加写入的 JSONL（导入器格式），为空不记录
+
+	// 审计日志：收发的每条消息按天写入 audit_dir，为空不记录
+	AuditDir string `mapstructure:"audit_dir"`
+	// 用 decrypt_key（与 data-importer 解密聊天记录的密码相同，也可用 DECRYPT_KEY 环境变量）加密审计日志
+	AuditEncrypt bool   `mapstructure:"audit_encrypt"`
+	DecryptKey   string `mapstructure:"decrypt_key"`
 }
 
 func Load(path string) (*Config, error) {
@@ -59,6 +322,7 @@ func Load(path string) (*Config, error) {
 	v.SetConfigFile(path)
 	v.AutomaticEnv()
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	setDefaults(v, Defaults())
 
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("read config: %w", err)
@@ -71,15 +335,126 @@ func Load(path string) (*Config, error) {
 	if token := os.Getenv("NAPCAT_ACCESS_TOKEN"); token != "" {
 		v.Set("napcat.access_token", token)
 	}
+	if secret := os.Getenv("WEBHOOK_SECRET"); secret != "" {
+		v.Set("webhook.secret", secret)
+	}
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		v.Set("admin.token", token)
+	}
+	if key := os.Getenv("DECRYPT_KEY"); key != "" {
+		v.Set("data.decrypt_key", key)
+	}
 
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("unmarshal config: %w", err)
 	}
 
-	if cfg.Gemini.APIKey == "" {
-		return nil, fmt.Errorf("gemini.api_key is required (set in config or GEMINI_API_KEY env)")
+	// api_key / GEMINI_API_KEY 可以是 JSON 数组（Docker secret 一个文件挂多个 key）
+	keys, err := ParseAPIKeys(cfg.Gemini.APIKey)
+	if err != nil {
+		return nil, fmt.Errorf("gemini.api_key: %w", err)
+	}
+	cfg.Gemini.APIKeys = MergeAPIKeys(keys, cfg.Gemini.APIKeys)
+	cfg.Gemini.APIKey = ""
+	if len(cfg.Gemini.APIKeys) > 0 {
+		cfg.Gemini.APIKey = cfg.Gemini.APIKeys[0]
+	}
+
+	for _, p := range cfg.Bot.BlockedTopics.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("bot.blocked_topics.patterns: %w", err)
+		}
+	}
+
+	switch cfg.Bot.OthersMode {
+	case "", "neutral", "canned", "persona":
+	default:
+		return nil, fmt.Errorf("bot.others_mode: unknown mode %q (want neutral, canned or persona)", cfg.Bot.OthersMode)
+	}
+
+	for name, d := range map[string]string{"min_date": cfg.RAG.Filter.MinDate, "max_date": cfg.RAG.Filter.MaxDate} {
+		if _, err := time.Parse(filterDateLayout, d); d != "" && err != nil {
+			return nil, fmt.Errorf("rag.filter.%s: want YYYY-MM-DD, got %q", name, d)
+		}
+	}
+
+	if cfg.RAG.MinDocumentLength < 0 {
+		return nil, fmt.Errorf("rag.min_document_length: must be >= 0, got %d", cfg.RAG.MinDocumentLength)
+	}
+
+	if t := cfg.Bot.Digest.Time; t != "" {
+		if _, err := time.Parse("15:04", t); err != nil {
+			return nil, fmt.Errorf("bot.digest.time: want HH:MM, got %q", t)
+		}
+	}
+
+	if _, err := cfg.Bot.Location(); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Bot.ReplyLanguage {
+	case "", "auto", "zh", "en", "mixed":
+	default:
+		return nil, fmt.Errorf("bot.reply_language: unknown language %q (want auto, zh, en or mixed)", cfg.Bot.ReplyLanguage)
+	}
+
+	for name, policy := range map[string]string{"friend_policy": cfg.Bot.Requests.FriendPolicy, "group_policy": cfg.Bot.Requests.GroupPolicy} {
+		switch policy {
+		case "", "ignore", "reject", "owner":
+		default:
+			return nil, fmt.Errorf("bot.requests.%s: unknown policy %q (want ignore, reject or owner)", name, policy)
+		}
+	}
+
+	if cfg.Webhook.ListenAddr != "" && cfg.Webhook.Secret == "" {
+		return nil, fmt.Errorf("webhook.secret is required when webhook.listen_addr is set (or WEBHOOK_SECRET env)")
+	}
+
+	if cfg.Admin.Listen != "" && cfg.Admin.Token == "" {
+		return nil, fmt.Errorf("admin.token is required when admin.listen is set (or ADMIN_TOKEN env)")
+	}
+
+	if cfg.Data.AuditEncrypt && cfg.Data.DecryptKey == "" {
+		return nil, fmt.Errorf("data.audit_encrypt requires data.decrypt_key (or DECRYPT_KEY env)")
+	}
+
+	if cfg.Gemini.APIKey == "" && cfg.Gemini.APIKeysFile == "" {
+		return nil, fmt.Errorf("gemini.api_key or gemini.api_keys_file is required (set in config or GEMINI_API_KEY env)")
 	}
 
 	return &cfg, nil
 }
+
+// ParseAPIKeys 解析 API key：普通字符串是单个 key，以 [ 开头时按 JSON 字符串数组解析
+func ParseAPIKeys(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(s, "[") {
+		return []string{s}, nil
+	}
+	var keys []string
+	if err := json.Unmarshal([]byte(s), &keys); err != nil {
+		return nil, fmt.Errorf("parse api keys JSON array: %w", err)
+	}
+	return MergeAPIKeys(keys), nil
+}
+
+// MergeAPIKeys 按顺序合并多组 key，去掉空值和重复
+func MergeAPIKeys(lists ...[]string) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, k := range list {
+			k = strings.TrimSpace(k)
+			if k == "" || seen[k] {
+				continue
+			}
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+// Defaults 返回填好默认值的配置，Load 时用户配置覆盖在它上面
+func Defaults() *Config {
+	return &Config{
+		Bot: BotConfig{
+			ReplyDelayMinMs:      500,
+			ReplyDelayMaxMs:      3000,
+			MaxContextTurns:      20,
+			SessionTimeoutM:      60,
+			SendRetries:          2,
+			OutboxMaxAgeSec:      600,
+			OutboxNotifyAfterSec: 300,
+			Digest:               DigestConfig{Time: "23:30"},
+		},
+		Gemini: GeminiConfig{
+			Temperature:     0.8,
+			MaxOutputTokens: 256,
+			RPMLimit:        15,
+			SentimentModel:  "gemini-2.0-flash-lite",
+			EmbedRetry:      RetryConfig{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second, Jitter: 0.2},
+		},
+		RAG: RAGConfig{
+			TopK:              5,
+			MinSimilarity:     0.3,
+			MinDocumentLength: 20,
+			StripEmoji:        true,
+			QueryTurns:        3,
+			RerankMinScore:    5,
+			RerankBudget:      2 * time.Second,
+			Short:             QueryTuning{Runes: 4, TopK: 2, MinSimilarity: 0.45},
+			Long:              QueryTuning{Runes: 30, TopK: 8, MinSimilarity: 0.25},
+		},
+		Logging: LoggingConfig{Level: "debug", Format: "text", MaxSizeMB: 100, RedactContent: true},
+	}
+}
+
+// YAML 按配置文件的键名（mapstructure tag）输出 YAML，包括零值字段，可作为配置文件模板
+func (c *Config) YAML() ([]byte, error) {
+	root := map[string]any{}
+	walkFields(reflect.ValueOf(*c), "", func(key string, v reflect.Value) {
+		m := root
+		parts := strings.Split(key, ".")
+		for _, p := range parts[:len(parts)-1] {
+			child, ok := m[p].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				m[p] = child
+			}
+			m = child
+		}
+		m[parts[len(parts)-1]] = yamlValue(v)
+	})
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return nil, fmt.Errorf("marshal config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// setDefaults 把 cfg 里的非零字段注册为 viper 默认值
+func setDefaults(v *viper.Viper, cfg *Config) {
+	walkFields(reflect.ValueOf(*cfg), "", func(key string, field reflect.Value) {
+		if !field.IsZero() {
+			v.SetDefault(key, field.Interface())
+		}
+	})
+}
+
+// walkFields 遍历结构体的叶子字段，key 为点分隔的 mapstructure 路径（如 rag.short.top_k）
+func walkFields(v reflect.Value, prefix string, fn func(key string, field reflect.Value)) {
+	t := v.Type()
+	for i := range t.NumField() {
+		name := t.Field(i).Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			walkFields(field, key+".", fn)
+			continue
+		}
+		fn(key, field)
+	}
+}
+
+// yamlValue 时长写成 "30s" 这样的字符串，空列表写成 []，空 map 写成 {}
+func yamlValue(v reflect.Value) any {
+	switch {
+	case v.Type() == reflect.TypeFor[time.Duration]():
+		return v.Interface().(time.Duration).String()
+	case v.Kind() == reflect.Slice && v.IsNil():
+		return []any{}
+	case v.Kind() == reflect.Map && v.IsNil():
+		return map[string]any{}
+	}
+	return v.Interface()
+}
@@ -0,0 +1,36 @@
+package coord
+
+import (
+	"context"
+	"time"
+
+	"github.com/liao/style-bot/internal/logging"
+)
+
+var logger = logging.For("coord")
+
+// DuplicateWindow 其他实例在此时间内回复过同一对象，则本实例放弃回复
+const DuplicateWindow = 5 * time.Second
+
+// ReplyEvent 一条已发送回复的广播事件
+type ReplyEvent struct {
+	Instance string    `json:"instance"`
+	PeerID   int64     `json:"peer_id"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// Coordinator 多实例协调，避免多台机器上的 bot 对同一个人重复回复
+type Coordinator interface {
+	// Announce 广播本实例刚给 peerID 发了消息
+	Announce(ctx context.Context, peerID int64) error
+	// OtherReplied 其他实例是否在 DuplicateWindow 内回复过 peerID
+	OtherReplied(peerID int64) bool
+	Close() error
+}
+
+// Noop 单实例部署时使用的空实现
+type Noop struct{}
+
+func (Noop) Announce(context.Context, int64) error { return nil }
+func (Noop) OtherReplied(int64) bool               { return false }
+func (Noop) Close() error                          { return nil }
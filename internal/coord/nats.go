@@ -0,0 +1,94 @@
+package coord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+)
+
+const subjectPrefix = "stylebot.reply."
+
+// NATS 基于 NATS 发布/订阅的协调器
+type NATS struct {
+	conn     *nats.Conn
+	sub      *nats.Subscription
+	instance string
+
+	mu       sync.Mutex
+	lastSeen map[int64]time.Time // peerID → 其他实例最近一次回复时间
+}
+
+// NewNATS 连接 NATS 并订阅所有回复事件
+func NewNATS(url string) (*NATS, error) {
+	conn, err := nats.Connect(url, nats.Name("style-bot"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("connect nats: %w", err)
+	}
+
+	c := &NATS{
+		conn:     conn,
+		instance: nuid.Next(),
+		lastSeen: make(map[int64]time.Time),
+	}
+	c.sub, err = conn.Subscribe(subjectPrefix+"*", c.onEvent)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("subscribe: %w", err)
+	}
+
+	logger.Info("nats coordinator ready", "url", url, "instance", c.instance)
+	return c, nil
+}
+
+func (c *NATS) onEvent(msg *nats.Msg) {
+	var ev ReplyEvent
+	if err := json.Unmarshal(msg.Data, &ev); err != nil {
+		logger.Warn("bad coord event", "subject", msg.Subject, "error", err)
+		return
+	}
+	if ev.Instance == c.instance {
+		return // 自己发的
+	}
+	// 用本地接收时间，避免多台机器时钟不一致
+	c.mu.Lock()
+	c.lastSeen[ev.PeerID] = time.Now()
+	c.mu.Unlock()
+}
+
+// Announce 发布到 stylebot.reply.<peerID>
+func (c *NATS) Announce(ctx context.Context, peerID int64) error {
+	data, err := json.Marshal(ReplyEvent{
+		Instance: c.instance,
+		PeerID:   peerID,
+		SentAt:   time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	if err := c.conn.Publish(subjectPrefix+strconv.FormatInt(peerID, 10), data); err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+	return nil
+}
+
+// OtherReplied 其他实例是否刚回复过
+func (c *NATS) OtherReplied(peerID int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.lastSeen[peerID]
+	return ok && time.Since(t) < DuplicateWindow
+}
+
+func (c *NATS) Close() error {
+	if c.sub != nil {
+		c.sub.Unsubscribe()
+	}
+	c.conn.Close()
+	return nil
+}
@@ -0,0 +1,29 @@
+// Package embedtask embedding 的用途（Gemini 的 TaskType）随 ctx 传递；rag 标明用途，ai 的 EmbeddingFunc 读取，两边都依赖这个叶子包
+package embedtask
+
+import "context"
+
+// Task embedding 的用途：Gemini embedding 是非对称的，文档和查询分开算检索效果更好
+type Task string
+
+const (
+	Document Task = "RETRIEVAL_DOCUMENT" // 写入向量库的对话
+	Query    Task = "RETRIEVAL_QUERY"    // 检索时对方的消息
+)
+
+// Scheme 当前的用途方案，记在向量库的 embedding.json 里；库里记录的不同（如旧库没有区分文档和查询）时检索效果会变差，需要重新导入
+const Scheme = "retrieval_document+retrieval_query"
+
+type taskKey struct{}
+
+// With 在 ctx 上标明这次 embedding 的用途。chromem 的写入路径只把 ctx 传给 EmbeddingFunc，
+// 所以用途随 ctx 传递，同一个 EmbeddingFunc 在 Add 和 Query 里各自拿到对的 TaskType
+func With(ctx context.Context, task Task) context.Context {
+	return context.WithValue(ctx, taskKey{}, task)
+}
+
+// From ctx 上的 embedding 用途，没有标明时为空（用模型默认）
+func From(ctx context.Context) Task {
+	task, _ := ctx.Value(taskKey{}).(Task)
+	return task
+}
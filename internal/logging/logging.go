@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// subsystemHandler 给日志加上 subsystem 字段，并按子系统自己的级别过滤
+type subsystemHandler struct {
+	parent slog.Handler
+	level  slog.Level
+}
+
+// NewSubsystemHandler 包装 parent：只输出不低于 level 的日志并带上 subsystem=name；
+// level 可以比 parent 的级别更低（如单独打开 ai 的 debug）
+func NewSubsystemHandler(parent slog.Handler, name string, level slog.Level) slog.Handler {
+	return &subsystemHandler{
+		parent: parent.WithAttrs([]slog.Attr{slog.String("subsystem", name)}),
+		level:  level,
+	}
+}
+
+func (h *subsystemHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level
+}
+
+// Handle 不再问 parent 的 Enabled，级别已经由子系统决定
+func (h *subsystemHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.parent.Handle(ctx, r)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &subsystemHandler{parent: h.parent.WithAttrs(attrs), level: h.level}
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return &subsystemHandler{parent: h.parent.WithGroup(name), level: h.level}
+}
+
+// config Configure 设置的全局状态，gen 变化时各子系统重新生成 handler
+var config struct {
+	mu     sync.Mutex
+	parent slog.Handler
+	level  slog.Level
+	levels map[string]slog.Level
+	gen    atomic.Int64
+}
+
+// Configure 设置输出 handler、默认级别和各子系统的级别（如 {"ai": "debug", "rag": "warn"}），
+// 在 main 里读完配置后调用；之前的日志按 slog.Default() 和 info 级别输出
+func Configure(parent slog.Handler, level string, levels map[string]string) error {
+	def, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	parsed := make(map[string]slog.Level, len(levels))
+	for name, s := range levels {
+		l, err := ParseLevel(s)
+		if err != nil {
+			return fmt.Errorf("logging level for %s: %w", name, err)
+		}
+		parsed[strings.ToLower(name)] = l
+	}
+
+	config.mu.Lock()
+	defer config.mu.Unlock()
+	config.parent, config.level, config.levels = parent, def, parsed
+	config.gen.Add(1)
+	return nil
+}
+
+// ParseLevel 解析 debug/info/warn/error，空字符串为 info
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+	return l, nil
+}
+
+// For 返回子系统的 logger，可以在包级变量里创建：Configure 之后自动使用新的 handler 和级别
+func For(name string) *slog.Logger {
+	return slog.New(&lazyHandler{name: name})
+}
+
+// lazyHandler 每次使用时检查 Configure 是否更新过，按需重建 subsystemHandler
+type lazyHandler struct {
+	name   string
+	cached atomic.Pointer[cachedHandler]
+}
+
+type cachedHandler struct {
+	gen int64
+	h   slog.Handler
+}
+
+func (h *lazyHandler) resolve() slog.Handler {
+	gen := config.gen.Load()
+	if c := h.cached.Load(); c != nil && c.gen == gen {
+		return c.h
+	}
+
+	config.mu.Lock()
+	parent, level := config.parent, config.level
+	if l, ok := config.levels[h.name]; ok {
+		level = l
+	}
+	config.mu.Unlock()
+	if parent == nil {
+		parent = slog.Default().Handler()
+	}
+
+	sh := NewSubsystemHandler(parent, h.name, level)
+	h.cached.Store(&cachedHandler{gen: gen, h: sh})
+	return sh
+}
+
+func (h *lazyHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.resolve().Enabled(ctx, l)
+}
+
+func (h *lazyHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.resolve().Handle(ctx, r)
+}
+
+func (h *lazyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.resolve().WithAttrs(attrs)
+}
+
+func (h *lazyHandler) WithGroup(name string) slog.Handler {
+	return h.resolve().WithGroup(name)
+}
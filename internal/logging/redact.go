@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// redactContent 为 true 时 Content 只输出长度和哈希
+var redactContent atomic.Bool
+
+// SetRedactContent 开关聊天内容脱敏（logging.redact_content），完整内容只留在审计日志里
+func SetRedactContent(on bool) {
+	redactContent.Store(on)
+}
+
+// Content 聊天内容（消息、回复、摘要等）的日志字段，所有带原文的日志都要经过它
+func Content(key, text string) slog.Attr {
+	return slog.Any(key, content(text))
+}
+
+// content 在输出时才判断是否脱敏，包级 logger 也能跟随配置
+type content string
+
+func (c content) LogValue() slog.Value {
+	if !redactContent.Load() {
+		return slog.StringValue(string(c))
+	}
+	return slog.StringValue(redact(string(c)))
+}
+
+// redact 如 "[redacted len=12 sha256=3f2a9c01]"，哈希可以和审计日志里的原文对上
+func redact(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return fmt.Sprintf("[redacted len=%d sha256=%s]", utf8.RuneCountInString(text), hex.EncodeToString(sum[:4]))
+}
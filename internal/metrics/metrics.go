@@ -0,0 +1,261 @@
+// Package metrics 进程内的 Prometheus 指标；ai、rag、chat、bot 各自在包级变量里注册，/metrics 统一输出
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets 耗时直方图的默认桶上界（秒）
+var LatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60}
+
+// collector 一个指标，按 Prometheus 文本格式输出自己
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry 一组指标
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry 创建空的 Registry
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// Default 包级构造函数注册到的 Registry
+var Default = NewRegistry()
+
+// register 同名指标重复注册时 panic（包级变量初始化阶段就能发现）
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[c.name()]; ok {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	r.collectors[c.name()] = c
+}
+
+// Write 按名字顺序以 Prometheus 文本格式输出全部指标
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	cs := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		cs = append(cs, c)
+	}
+	r.mu.Unlock()
+	sort.Slice(cs, func(i, j int) bool { return cs[i].name() < cs[j].name() })
+	for _, c := range cs {
+		c.write(w)
+	}
+}
+
+// Counter 单调递增的计数
+type Counter struct {
+	n, help string
+	v       atomic.Int64
+}
+
+// NewCounter 创建并注册到 Default
+func NewCounter(name, help string) *Counter {
+	c := &Counter{n: name, help: help}
+	Default.register(c)
+	return c
+}
+
+// Inc 加一
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add 加 n
+func (c *Counter) Add(n int64) { c.v.Add(n) }
+
+// Value 当前值
+func (c *Counter) Value() int64 { return c.v.Load() }
+
+func (c *Counter) name() string { return c.n }
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.n, "counter", c.help)
+	fmt.Fprintf(w, "%s %d\n", c.n, c.v.Load())
+}
+
+// CounterVec 带标签的计数，每组标签值一条序列
+type CounterVec struct {
+	n, help string
+	labels  []string
+
+	mu     sync.Mutex
+	series map[string]*atomic.Int64 // 键为 formatLabels 的结果
+}
+
+// NewCounterVec 创建并注册到 Default
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{n: name, help: help, labels: labels, series: make(map[string]*atomic.Int64)}
+	Default.register(c)
+	return c
+}
+
+// Inc 给这组标签值加一，values 与创建时的 labels 一一对应
+func (c *CounterVec) Inc(values ...string) {
+	c.counter(values).Add(1)
+}
+
+// Add 给这组标签值加 n
+func (c *CounterVec) Add(n int64, values ...string) {
+	c.counter(values).Add(n)
+}
+
+// Value 这组标签值的当前值
+func (c *CounterVec) Value(values ...string) int64 {
+	return c.counter(values).Load()
+}
+
+func (c *CounterVec) counter(values []string) *atomic.Int64 {
+	if len(values) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", c.n, len(c.labels), len(values)))
+	}
+	key := formatLabels(c.labels, values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.series[key]
+	if !ok {
+		v = new(atomic.Int64)
+		c.series[key] = v
+	}
+	return v
+}
+
+func (c *CounterVec) name() string { return c.n }
+
+func (c *CounterVec) write(w io.Writer) {
+	writeHeader(w, c.n, "counter", c.help)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.series))
+	for k := range c.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %d\n", c.n, k, c.series[k].Load())
+	}
+}
+
+// Gauge 可增可减的当前值
+type Gauge struct {
+	n, help string
+	v       atomic.Int64
+}
+
+// NewGauge 创建并注册到 Default
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{n: name, help: help}
+	Default.register(g)
+	return g
+}
+
+// Set 设为 n
+func (g *Gauge) Set(n int64) { g.v.Store(n) }
+
+// Value 当前值
+func (g *Gauge) Value() int64 { return g.v.Load() }
+
+func (g *Gauge) name() string { return g.n }
+
+func (g *Gauge) write(w io.Writer) {
+	writeHeader(w, g.n, "gauge", g.help)
+	fmt.Fprintf(w, "%s %d\n", g.n, g.v.Load())
+}
+
+// Histogram 耗时等数值的分布
+type Histogram struct {
+	n, help string
+	bounds  []float64
+
+	mu     sync.Mutex
+	counts []int64 // 与 bounds 对应，非累计
+	count  int64
+	sum    float64
+}
+
+// NewHistogram 创建并注册到 Default；bounds 为升序的桶上界
+func NewHistogram(name, help string, bounds []float64) *Histogram {
+	h := &Histogram{n: name, help: help, bounds: bounds, counts: make([]int64, len(bounds))}
+	Default.register(h)
+	return h
+}
+
+// Observe 记录一个值
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, le := range h.bounds {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// ObserveSince 记录从 start 到现在的秒数
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Count 已记录的次数
+func (h *Histogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) name() string { return h.n }
+
+func (h *Histogram) write(w io.Writer) {
+	writeHeader(w, h.n, "histogram", h.help)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cum int64
+	for i, le := range h.bounds {
+		cum += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.n, formatFloat(le), cum)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.n, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.n, formatFloat(h.sum), h.n, h.count)
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// formatLabels 如 {model="gemini-2.5-flash",code="200"}
+func formatLabels(labels, values []string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", l, values[i])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%g", v)
+}
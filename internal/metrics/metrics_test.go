@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRegistryWritesInNameOrder(t *testing.T) {
+	r := NewRegistry()
+	g := &Gauge{n: "test_b_gauge", help: "A gauge."}
+	c := &Counter{n: "test_a_total", help: "A counter."}
+	r.register(g)
+	r.register(c)
+	c.Add(3)
+	c.Inc()
+	g.Set(-2)
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	want := "# HELP test_a_total A counter.\n# TYPE test_a_total counter\ntest_a_total 4\n" +
+		"# HELP test_b_gauge A gauge.\n# TYPE test_b_gauge gauge\ntest_b_gauge -2\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestRegistryDuplicatePanics(t *testing.T) {
+	r := NewRegistry()
+	r.register(&Counter{n: "test_dup_total"})
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate registration did not panic")
+		}
+	}()
+	r.register(&Gauge{n: "test_dup_total"})
+}
+
+func TestCounterVecSeries(t *testing.T) {
+	c := &CounterVec{n: "test_requests_total", help: "Requests.", labels: []string{"model", "code"}, series: make(map[string]*atomic.Int64)}
+	c.Inc("flash", "200")
+	c.Inc("flash", "200")
+	c.Add(5, "pro", "429")
+	if got := c.Value("flash", "200"); got != 2 {
+		t.Errorf("flash/200 = %d, want 2", got)
+	}
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	out := buf.String()
+	for _, line := range []string{
+		`test_requests_total{model="flash",code="200"} 2`,
+		`test_requests_total{model="pro",code="429"} 5`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, out)
+		}
+	}
+	if strings.Index(out, `model="flash"`) > strings.Index(out, `model="pro"`) {
+		t.Errorf("series not sorted:\n%s", out)
+	}
+}
+
+func TestCounterVecWrongLabelCountPanics(t *testing.T) {
+	c := &CounterVec{n: "test_labels_total", labels: []string{"model"}, series: make(map[string]*atomic.Int64)}
+	defer func() {
+		if recover() == nil {
+			t.Error("wrong label count did not panic")
+		}
+	}()
+	c.Inc("flash", "200")
+}
+
+func TestHistogramCumulativeBuckets(t *testing.T) {
+	h := &Histogram{n: "test_latency_seconds", help: "Latency.", bounds: []float64{0.5, 1, 5}, counts: make([]int64, 3)}
+	for _, v := range []float64{0.1, 0.7, 0.9, 3, 100} {
+		h.Observe(v)
+	}
+	if h.Count() != 5 {
+		t.Errorf("count = %d, want 5", h.Count())
+	}
+
+	var buf bytes.Buffer
+	h.write(&buf)
+	want := `# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.5"} 1
+test_latency_seconds_bucket{le="1"} 3
+test_latency_seconds_bucket{le="5"} 4
+test_latency_seconds_bucket{le="+Inf"} 5
+test_latency_seconds_sum 104.7
+test_latency_seconds_count 5
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVColumns CSV 导出里时间、发送人、内容所在的列，从 0 开始
+type CSVColumns struct {
+	Time    int
+	Sender  int
+	Content int
+}
+
+// DefaultCSVColumns timestamp,sender,content
+var DefaultCSVColumns = CSVColumns{Time: 0, Sender: 1, Content: 2}
+
+// width 一行至少要有的列数
+func (c CSVColumns) width() int {
+	return max(c.Time, c.Sender, c.Content) + 1
+}
+
+// ParseCSVFile 解析 timestamp,sender,content 三列的 CSV 导出
+func ParseCSVFile(path string, myName string) ([]ChatMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	if data, err = DecodeText(data, EncodingAuto); err != nil {
+		return nil, err
+	}
+	return ParseCSV(bytes.NewReader(data), myName, DefaultCSVColumns)
+}
+
+// ParseCSV 按 cols 解析 CSV；第一行的时间列不是时间时当作表头跳过，之后时间解析不了的消息没有时间戳
+func ParseCSV(r io.Reader, myName string, cols CSVColumns) ([]ChatMessage, error) {
+	if cols.Time < 0 || cols.Sender < 0 || cols.Content < 0 {
+		return nil, fmt.Errorf("csv columns must not be negative: %+v", cols)
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	var messages []ChatMessage
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read csv: %w", err)
+		}
+		if first && len(record) > 0 {
+			record[0] = strings.TrimPrefix(record[0], "\ufeff") // Excel 导出带 BOM
+		}
+		if len(record) < cols.width() {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("csv line %d: %d columns, need at least %d", line, len(record), cols.width())
+		}
+
+		ts, err := parseCSVTimestamp(record[cols.Time])
+		if err != nil && first {
+			continue // 表头
+		}
+		content := strings.TrimSpace(record[cols.Content])
+		if content == "" {
+			continue
+		}
+		sender := strings.TrimSpace(record[cols.Sender])
+		messages = append(messages, ChatMessage{
+			Timestamp: ts,
+			Sender:    sender,
+			Content:   content,
+			IsMe:      isMe(sender, myName),
+		})
+	}
+	return messages, nil
+}
+
+// parseCSVTimestamp 支持 Text 格式的时间、RFC 3339、斜杠日期和 Unix 秒/毫秒
+func parseCSVTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := parseTimestamp(s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006/01/02 15:04:05", "2006/01/02 15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n > 0 {
+		if n >= 1e12 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown timestamp format: %s", s)
+}
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dingTalkMessage 钉钉导出 JSON 中的一条消息
+type dingTalkMessage struct {
+	StaffID    string          `json:"staffId"`
+	SenderNick string          `json:"senderNick"`
+	MsgType    string          `json:"msgType"` // text / image / file
+	Content    json.RawMessage `json:"content"` // 字符串，或 {"content": "..."}
+	Text       *struct {
+		Content string `json:"content"`
+	} `json:"text"`
+	CreateTime int64 `json:"createTime"` // 毫秒时间戳
+}
+
+// ParseDingTalkJSON 解析钉钉导出的 JSON（消息数组，或 {"messages": [...]}）
+// staffId 等于 myStaffID 的是我（必填，否则分不出哪边是我）；只保留文本消息，按时间排序
+func ParseDingTalkJSON(data []byte, myStaffID, targetName string) ([]ChatMessage, error) {
+	if myStaffID == "" {
+		return nil, errors.New("dingtalk export needs my staffId (-my-staff-id) to tell my messages apart")
+	}
+	var raw []dingTalkMessage
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var wrapped struct {
+			Messages []dingTalkMessage `json:"messages"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, fmt.Errorf("parse dingtalk JSON: %w", err)
+		}
+		raw = wrapped.Messages
+	} else if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse dingtalk JSON: %w", err)
+	}
+
+	var messages []ChatMessage
+	for _, m := range raw {
+		if m.MsgType != "" && m.MsgType != "text" {
+			continue // 跳过图片、文件等
+		}
+		content := strings.TrimSpace(m.text())
+		if content == "" {
+			continue
+		}
+
+		isMe := m.StaffID == myStaffID
+		sender := m.SenderNick
+		if sender == "" && !isMe {
+			sender = targetName
+		}
+
+		var ts time.Time
+		if m.CreateTime > 0 {
+			ts = time.UnixMilli(m.CreateTime)
+		}
+		messages = append(messages, ChatMessage{
+			Timestamp: ts,
+			Sender:    sender,
+			Content:   content,
+			IsMe:      isMe,
+		})
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Timestamp.Before(messages[j].Timestamp)
+	})
+	return messages, nil
+}
+
+// text 取文本内容：content 可能是字符串或对象，也可能放在 text.content
+func (m *dingTalkMessage) text() string {
+	if m.Text != nil && m.Text.Content != "" {
+		return m.Text.Content
+	}
+	if len(m.Content) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(m.Content, &s) == nil {
+		return s
+	}
+	var obj struct {
+		Content string `json:"content"`
+	}
+	if json.Unmarshal(m.Content, &obj) == nil {
+		return obj.Content
+	}
+	return ""
+}
@@ -0,0 +1,24 @@
+package parser
+
+import "testing"
+
+const dingTalkSample = `[
+	{"staffId": "u1", "senderNick": "我", "msgType": "text", "content": "在吗", "createTime": 1714564800000},
+	{"staffId": "u2", "senderNick": "小王", "msgType": "text", "text": {"content": "在"}, "createTime": 1714564860000}
+]`
+
+func TestParseDingTalkJSONMarksMyMessages(t *testing.T) {
+	msgs, err := ParseDingTalkJSON([]byte(dingTalkSample), "u1", "小王")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(msgs) != 2 || !msgs[0].IsMe || msgs[1].IsMe || msgs[1].Content != "在" {
+		t.Errorf("got %+v", msgs)
+	}
+}
+
+func TestParseDingTalkJSONRequiresStaffID(t *testing.T) {
+	if _, err := ParseDingTalkJSON([]byte(dingTalkSample), "", "小王"); err == nil {
+		t.Error("parsed without my staffId")
+	}
+}
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// Encoding Text / HTML / CSV 导出文件的字符编码
+type Encoding string
+
+const (
+	EncodingAuto Encoding = "auto" // 看 HTML 的 <meta charset>，没有时按非法 UTF-8 字节的比例判断是不是 GBK
+	EncodingUTF8 Encoding = "utf8"
+	EncodingGBK  Encoding = "gbk"
+)
+
+// ParseEncoding 解析 -encoding 参数，空字符串为 auto
+func ParseEncoding(s string) (Encoding, error) {
+	switch e := Encoding(strings.ToLower(s)); e {
+	case "", EncodingAuto:
+		return EncodingAuto, nil
+	case EncodingUTF8, "utf-8":
+		return EncodingUTF8, nil
+	case EncodingGBK, "gb2312", "gb18030":
+		return EncodingGBK, nil
+	default:
+		return "", fmt.Errorf("unknown encoding %q (want gbk, utf8 or auto)", s)
+	}
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// 匹配 <meta charset="gbk"> 和 <meta http-equiv="Content-Type" content="text/html; charset=gbk">
+var metaCharsetRe = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?([\w-]+)`)
+
+// gbkInvalidRatio 非 ASCII 字节里非法 UTF-8 字节超过这个比例才当作 GBK；
+// GBK 中文几乎每个字节都不是合法 UTF-8，UTF-8 文件里个别损坏的字节远低于它
+const gbkInvalidRatio = 0.3
+
+// DecodeText 转成 UTF-8 并去掉开头的 BOM；enc 为空时同 auto。按 UTF-8 读时个别非法字节换成 U+FFFD
+func DecodeText(data []byte, enc Encoding) ([]byte, error) {
+	if bytes.HasPrefix(data, utf8BOM) {
+		return data[len(utf8BOM):], nil
+	}
+	if enc == "" || enc == EncodingAuto {
+		enc = detectEncoding(data)
+	}
+	if enc != EncodingGBK {
+		if !utf8.Valid(data) {
+			data = bytes.ToValidUTF8(data, []byte("\uFFFD"))
+		}
+		return data, nil
+	}
+	// GB18030 兼容 GBK 和 GB2312
+	out, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode gbk: %w", err)
+	}
+	return out, nil
+}
+
+// detectEncoding 优先看 <meta charset>，否则非 ASCII 字节里非法 UTF-8 的超过 gbkInvalidRatio 时按 GBK
+func detectEncoding(data []byte) Encoding {
+	if m := metaCharsetRe.FindSubmatch(head(data)); m != nil {
+		if enc, err := ParseEncoding(string(m[1])); err == nil {
+			return enc
+		}
+	}
+	if utf8.Valid(data) {
+		return EncodingUTF8
+	}
+	var nonASCII, invalid int
+	for rest := data; len(rest) > 0; {
+		if rest[0] < utf8.RuneSelf {
+			rest = rest[1:]
+			continue
+		}
+		r, size := utf8.DecodeRune(rest)
+		nonASCII += size
+		if r == utf8.RuneError && size == 1 {
+			invalid++
+		}
+		rest = rest[size:]
+	}
+	if float64(invalid) > gbkInvalidRatio*float64(nonASCII) {
+		return EncodingGBK
+	}
+	return EncodingUTF8
+}
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func gbk(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatalf("encode gbk: %v", err)
+	}
+	return b
+}
+
+const sampleText = "2024-01-15 18:30:00 小王\n周末去爬山吗\n\n2024-01-15 18:31:00 我\n好啊，几点出发\n"
+
+func TestDecodeTextDetectsGBK(t *testing.T) {
+	out, err := DecodeText(gbk(t, sampleText), EncodingAuto)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if string(out) != sampleText {
+		t.Errorf("got %q, want %q", out, sampleText)
+	}
+}
+
+func TestDecodeTextKeepsUTF8WithCorruptByte(t *testing.T) {
+	data := []byte(sampleText)
+	i := bytes.Index(data, []byte("爬"))
+	data[i] = 0xff // 一个损坏的字节不应让整个文件按 GBK 解码
+	out, err := DecodeText(data, EncodingAuto)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !bytes.Contains(out, []byte("好啊，几点出发")) || !bytes.Contains(out, []byte("小王")) {
+		t.Errorf("valid UTF-8 text garbled: %q", out)
+	}
+}
+
+func TestDecodeTextHTMLMetaCharset(t *testing.T) {
+	html := `<html><head><meta charset="gbk"></head><body>在吗</body></html>`
+	out, err := DecodeText(gbk(t, html), EncodingAuto)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !bytes.Contains(out, []byte("在吗")) {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestParseTextGBKSample(t *testing.T) {
+	msgs, err := TextPlugin{}.Parse(gbk(t, sampleText), "我", "小王")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Sender != "小王" || msgs[1].Content != "好啊，几点出发" || !msgs[1].IsMe {
+		t.Errorf("got %+v", msgs)
+	}
+}
+
+func TestParseCSVGBKSample(t *testing.T) {
+	csv := "time,sender,content\n2024-01-15 18:30:00,小王,周末去爬山吗\n2024-01-15 18:31:00,我,好啊\n"
+	p := CSVPlugin{Columns: DefaultCSVColumns}
+	data := gbk(t, csv)
+	if !p.Detect(data) {
+		t.Fatal("GBK CSV not detected")
+	}
+	msgs, err := p.Parse(data, "我", "小王")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Content != "周末去爬山吗" || msgs[1].Sender != "我" {
+		t.Errorf("got %+v", msgs)
+	}
+}
@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -12,13 +14,19 @@ import (
 // ParseHTMLFile 解析 WechatExporter 导出的 HTML 格式文件
 // WechatExporter 的 HTML 结构可能因版本不同有差异，这里处理常见格式
 func ParseHTMLFile(path string, myName string) ([]ChatMessage, error) {
-	f, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("open file: %w", err)
+		return nil, fmt.Errorf("read file: %w", err)
 	}
-	defer f.Close()
+	if data, err = DecodeText(data, EncodingAuto); err != nil {
+		return nil, err
+	}
+	return ParseHTML(bytes.NewReader(data), myName)
+}
 
-	doc, err := goquery.NewDocumentFromReader(f)
+// ParseHTML 解析 WechatExporter 的 HTML 格式
+func ParseHTML(r io.Reader, myName string) ([]ChatMessage, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
 	if err != nil {
 		return nil, fmt.Errorf("parse HTML: %w", err)
 	}
@@ -79,33 +87,39 @@ func ParseHTMLFile(path string, myName string) ([]ChatMessage, error) {
 	return messages, nil
 }
 
-// SplitConversations 按时间间隔切分对话片段
-func SplitConversations(messages []ChatMessage, gapMinutes int) []Conversation {
+// SplitConversations 按时间间隔切分对话片段；先按时间稳定排序（不修改传入的切片），
+// 没有时间的消息跟在前一条后面，需要其他放置方式时先调用 SortMessages；不满足 min 的片段丢弃
+func SplitConversations(messages []ChatMessage, gapMinutes int, min MinConversation) []Conversation {
 	if len(messages) == 0 {
 		return nil
 	}
+	messages = append([]ChatMessage(nil), messages...)
+	SortMessages(messages, ZeroTimeInterleave)
 
 	gap := time.Duration(gapMinutes) * time.Minute
 	var conversations []Conversation
 	var current Conversation
 	current.StartAt = messages[0].Timestamp
 
-	for i, msg := range messages {
-		if i > 0 && !msg.Timestamp.IsZero() && !messages[i-1].Timestamp.IsZero() {
-			if msg.Timestamp.Sub(messages[i-1].Timestamp) > gap {
+	// 间隔按上一条有时间的消息算，中间夹着没有时间的消息也不影响切分
+	var last time.Time
+	for _, msg := range messages {
+		if !msg.Timestamp.IsZero() {
+			if !last.IsZero() && msg.Timestamp.Sub(last) > gap {
 				// 开始新对话
-				current.EndAt = messages[i-1].Timestamp
-				if len(current.Messages) >= 2 { // 至少2条消息才算对话
+				current.EndAt = last
+				if min.Keep(current) {
 					conversations = append(conversations, current)
 				}
 				current = Conversation{StartAt: msg.Timestamp}
 			}
+			last = msg.Timestamp
 		}
 		current.Messages = append(current.Messages, msg)
 	}
 
 	// 最后一段
-	if len(current.Messages) >= 2 {
+	if min.Keep(current) {
 		current.EndAt = current.Messages[len(current.Messages)-1].Timestamp
 		conversations = append(conversations, current)
 	}
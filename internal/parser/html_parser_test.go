@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func contents(msgs []ChatMessage) string {
+	var s []string
+	for _, m := range msgs {
+		s = append(s, m.Content)
+	}
+	return strings.Join(s, "/")
+}
+
+func TestSplitConversationsSortsShuffledInput(t *testing.T) {
+	base := time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)
+	at := func(min int, content string) ChatMessage {
+		return ChatMessage{Timestamp: base.Add(time.Duration(min) * time.Minute), Sender: "小王", Content: content}
+	}
+	ordered := []ChatMessage{
+		at(0, "在吗"), at(1, "周末去爬山吗"), at(2, "好啊"),
+		at(180, "到家了"), at(181, "早点睡"),
+	}
+	shuffled := append([]ChatMessage(nil), ordered...)
+	rand.New(rand.NewSource(1)).Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	if contents(shuffled) == contents(ordered) {
+		t.Fatal("shuffle left the input in order")
+	}
+	before := contents(shuffled)
+
+	convs := SplitConversations(shuffled, 30, MinConversation{})
+	if len(convs) != 2 {
+		t.Fatalf("got %d conversations, want 2", len(convs))
+	}
+	if got := contents(convs[0].Messages); got != "在吗/周末去爬山吗/好啊" {
+		t.Errorf("first conversation = %q", got)
+	}
+	if got := contents(convs[1].Messages); got != "到家了/早点睡" {
+		t.Errorf("second conversation = %q", got)
+	}
+	if !convs[0].StartAt.Equal(base) || !convs[1].EndAt.Equal(base.Add(181*time.Minute)) {
+		t.Errorf("bounds = %v..%v, %v..%v", convs[0].StartAt, convs[0].EndAt, convs[1].StartAt, convs[1].EndAt)
+	}
+	if contents(shuffled) != before {
+		t.Error("SplitConversations modified its input")
+	}
+}
+
+func TestSortMessagesZeroTimePolicies(t *testing.T) {
+	base := time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)
+	msgs := func() []ChatMessage {
+		return []ChatMessage{
+			{Timestamp: base.Add(2 * time.Minute), Content: "c"},
+			{Timestamp: base, Content: "a"},
+			{Content: "a 后面的表情"},
+			{Timestamp: base.Add(time.Minute), Content: "b"},
+			{Timestamp: base.Add(time.Minute), Content: "b2"},
+		}
+	}
+
+	interleave := msgs()
+	SortMessages(interleave, ZeroTimeInterleave)
+	if got := contents(interleave); got != "a/a 后面的表情/b/b2/c" {
+		t.Errorf("interleave = %q", got)
+	}
+
+	last := msgs()
+	SortMessages(last, ZeroTimeLast)
+	if got := contents(last); got != "a/b/b2/c/a 后面的表情" {
+		t.Errorf("last = %q", got)
+	}
+
+	// 开头没有时间的消息：interleave 跟着后面第一条有时间的，last 放到最后
+	leading := []ChatMessage{{Content: "开头"}, {Timestamp: base.Add(time.Minute), Content: "b"}, {Timestamp: base, Content: "a"}}
+	SortMessages(leading, ZeroTimeInterleave)
+	if got := contents(leading); got != "a/开头/b" {
+		t.Errorf("interleave with leading zero = %q", got)
+	}
+	leading = []ChatMessage{{Content: "开头"}, {Timestamp: base.Add(time.Minute), Content: "b"}, {Timestamp: base, Content: "a"}}
+	SortMessages(leading, ZeroTimeLast)
+	if got := contents(leading); got != "a/b/开头" {
+		t.Errorf("last with leading zero = %q", got)
+	}
+}
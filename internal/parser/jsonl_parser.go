@@ -7,6 +7,7 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -20,8 +21,9 @@ type jsonlEntry struct {
 }
 
 type jsonlMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp,omitzero"` // 可选，WriteJSONLConversations 写出时带上
 }
 
 // DecryptFile 解密 AES-256-GCM 加密的文件
@@ -100,7 +102,7 @@ func ParseJSONLBytes(data []byte, myName string, targetName string, userIsMe boo
 				}
 
 				allMessages = append(allMessages, ChatMessage{
-					Timestamp: time.Time{}, // JSONL 中没有时间戳
+					Timestamp: msg.Timestamp, // 没有时为零值
 					Sender:    sender,
 					Content:   part,
 					IsMe:      isMe,
@@ -114,8 +116,8 @@ func ParseJSONLBytes(data []byte, myName string, targetName string, userIsMe boo
 }
 
 // ParseJSONLToConversations 直接将 JSONL 解析为对话片段（更适合这个格式）
-// 每行 JSONL 天然就是一组对话
-func ParseJSONLToConversations(data []byte, myName string, targetName string, userIsMe bool) ([]Conversation, error) {
+// 每行 JSONL 天然就是一组对话，不满足 min 的行丢弃
+func ParseJSONLToConversations(data []byte, myName string, targetName string, userIsMe bool, min MinConversation) ([]Conversation, error) {
 	var conversations []Conversation
 
 	scanner := bufio.NewScanner(strings.NewReader(string(data)))
@@ -142,16 +144,41 @@ func ParseJSONLToConversations(data []byte, myName string, targetName string, us
 			}
 
 			conv.Messages = append(conv.Messages, ChatMessage{
-				Sender:  sender,
-				Content: msg.Content,
-				IsMe:    isMe,
+				Timestamp: msg.Timestamp,
+				Sender:    sender,
+				Content:   msg.Content,
+				IsMe:      isMe,
 			})
 		}
+		if n := len(conv.Messages); n > 0 {
+			conv.StartAt, conv.EndAt = conv.Messages[0].Timestamp, conv.Messages[n-1].Timestamp
+		}
 
-		if len(conv.Messages) >= 2 {
+		if min.Keep(conv) {
 			conversations = append(conversations, conv)
 		}
 	}
 
 	return conversations, nil
 }
+
+// WriteJSONLConversations 每段对话写成一行 JSONL，按 userIsMe=true 的约定（我是 "user"，对方是 "assistant"），
+// 可以再用 JSONL 格式导入；消息带时间戳时一并写出
+func WriteJSONLConversations(w io.Writer, conversations []Conversation) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, c := range conversations {
+		entry := jsonlEntry{Messages: make([]jsonlMessage, 0, len(c.Messages))}
+		for _, m := range c.Messages {
+			role := "assistant"
+			if m.IsMe {
+				role = "user"
+			}
+			entry.Messages = append(entry.Messages, jsonlMessage{Role: role, Content: m.Content, Timestamp: m.Timestamp})
+		}
+		if err := enc.Encode(entry); err != nil {
+			return fmt.Errorf("write conversation: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteJSONLConversationsKeepsTimestamps(t *testing.T) {
+	start := time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)
+	in := []Conversation{{
+		Messages: []ChatMessage{
+			{Timestamp: start, Sender: "我", Content: "在吗", IsMe: true},
+			{Timestamp: start.Add(time.Minute), Sender: "小王", Content: "在"},
+		},
+		StartAt: start,
+		EndAt:   start.Add(time.Minute),
+	}}
+
+	var buf bytes.Buffer
+	if err := WriteJSONLConversations(&buf, in); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out, err := ParseJSONLToConversations(buf.Bytes(), "我", "小王", true, MinConversation{})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(out) != 1 || len(out[0].Messages) != 2 {
+		t.Fatalf("got %+v", out)
+	}
+	for i, m := range out[0].Messages {
+		if want := in[0].Messages[i]; !m.Timestamp.Equal(want.Timestamp) || m.IsMe != want.IsMe {
+			t.Errorf("message %d = %+v, want %+v", i, m, want)
+		}
+	}
+	if !out[0].StartAt.Equal(in[0].StartAt) || !out[0].EndAt.Equal(in[0].EndAt) {
+		t.Errorf("conversation span = %v..%v", out[0].StartAt, out[0].EndAt)
+	}
+}
+
+func TestWriteJSONLConversationsOmitsMissingTimestamps(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteJSONLConversations(&buf, []Conversation{{Messages: []ChatMessage{{Content: "在吗", IsMe: true}}}})
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("timestamp")) {
+		t.Errorf("zero timestamp written: %s", buf.String())
+	}
+}
@@ -1,6 +1,12 @@
 package parser
 
-import "time"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
 // ChatMessage 单条聊天消息
 type ChatMessage struct {
@@ -29,3 +35,182 @@ func (c *Conversation) FormatAsExample(myName, targetName string) string {
 	}
 	return s
 }
+
+// Duration 对话持续时间；没有时间戳（如 JSONL）时为 0
+func (c *Conversation) Duration() time.Duration {
+	if c.StartAt.IsZero() || c.EndAt.IsZero() {
+		return 0
+	}
+	return c.EndAt.Sub(c.StartAt)
+}
+
+// MinConversation 一段对话要进向量库的最低要求：消息条数和总字数（字符），0 = 不限制
+type MinConversation struct {
+	Messages int
+	Runes    int
+}
+
+// DefaultMinConversation 至少 2 条消息才算对话
+var DefaultMinConversation = MinConversation{Messages: 2}
+
+// Keep 对话是否满足最低要求
+func (m MinConversation) Keep(c Conversation) bool {
+	if len(c.Messages) < m.Messages {
+		return false
+	}
+	if m.Runes <= 0 {
+		return true
+	}
+	n := 0
+	for _, msg := range c.Messages {
+		n += utf8.RuneCountInString(msg.Content)
+	}
+	return n >= m.Runes
+}
+
+// FilterConversations 去掉不满足 min 的对话（插件解析出的对话也走一遍）
+func FilterConversations(convs []Conversation, min MinConversation) []Conversation {
+	var kept []Conversation
+	for _, c := range convs {
+		if min.Keep(c) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// FilterByMinDuration 去掉持续时间短于 min 的对话；没有时间戳的对话总是保留
+func FilterByMinDuration(convs []Conversation, min time.Duration) []Conversation {
+	var kept []Conversation
+	for _, c := range convs {
+		if c.StartAt.IsZero() || c.EndAt.IsZero() || c.Duration() >= min {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// FilterByLength 去掉去首尾空白后少于 minChars 或多于 maxChars 个字的消息（"k"、"." 和整段粘贴的文章），maxChars <= 0 时不限上限
+func FilterByLength(messages []ChatMessage, minChars, maxChars int) []ChatMessage {
+	var kept []ChatMessage
+	for _, m := range messages {
+		n := utf8.RuneCountInString(strings.TrimSpace(m.Content))
+		if n < minChars || (maxChars > 0 && n > maxChars) {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// TruncateRunes 截断到最多 maxRunes 个字符，按 rune 边界切，不会切坏中文
+func TruncateRunes(s string, maxRunes int) string {
+	if maxRunes <= 0 {
+		return ""
+	}
+	if len(s) <= maxRunes {
+		return s // 字节数不超过上限时字符数一定不超过
+	}
+	n := 0
+	for i := range s {
+		if n == maxRunes {
+			return s[:i]
+		}
+		n++
+	}
+	return s
+}
+
+// ZeroTimePolicy 排序时没有时间戳的消息放在哪里
+type ZeroTimePolicy string
+
+const (
+	// ZeroTimeInterleave 跟在原顺序中前一条有时间的消息后面（默认）
+	ZeroTimeInterleave ZeroTimePolicy = "interleave"
+	// ZeroTimeLast 统一放到最后，保持相互之间的顺序
+	ZeroTimeLast ZeroTimePolicy = "last"
+)
+
+// ParseZeroTimePolicy 解析配置值，空字符串视为 interleave
+func ParseZeroTimePolicy(s string) (ZeroTimePolicy, error) {
+	switch p := ZeroTimePolicy(s); p {
+	case "":
+		return ZeroTimeInterleave, nil
+	case ZeroTimeInterleave, ZeroTimeLast:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown zero time policy %q (want interleave or last)", s)
+	}
+}
+
+// SortMessages 按时间稳定排序（原地），时间相同的保持原顺序，没有时间的按 policy 放置
+func SortMessages(messages []ChatMessage, policy ZeroTimePolicy) {
+	// 排序用的时间：interleave 时没有时间的消息借用前一条，开头的借用后面第一条
+	keys := make([]time.Time, len(messages))
+	var prev time.Time
+	for i, m := range messages {
+		if !m.Timestamp.IsZero() {
+			prev = m.Timestamp
+		}
+		keys[i] = m.Timestamp
+		if policy != ZeroTimeLast {
+			keys[i] = prev
+		}
+	}
+	if policy != ZeroTimeLast {
+		for i, m := range messages {
+			if !m.Timestamp.IsZero() {
+				for j := range i {
+					keys[j] = m.Timestamp
+				}
+				break
+			}
+		}
+	}
+
+	idx := make([]int, len(messages))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		ka, kb := keys[idx[a]], keys[idx[b]]
+		if ka.IsZero() || kb.IsZero() {
+			return !ka.IsZero() && kb.IsZero()
+		}
+		return ka.Before(kb)
+	})
+	sorted := make([]ChatMessage, len(messages))
+	for i, j := range idx {
+		sorted[i] = messages[j]
+	}
+	copy(messages, sorted)
+}
+
+// MergeMessages 合并多个文件解析出的消息并按时间排序，
+// 去掉时间、发送者、内容都相同的重复消息（相邻导出文件的重叠部分）
+func MergeMessages(policy ZeroTimePolicy, lists ...[]ChatMessage) []ChatMessage {
+	var all []ChatMessage
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	SortMessages(all, policy)
+
+	type key struct {
+		ts      int64
+		sender  string
+		content string
+	}
+	seen := make(map[key]bool)
+	out := all[:0]
+	for _, m := range all {
+		if !m.Timestamp.IsZero() {
+			k := key{m.Timestamp.UnixNano(), m.Sender, m.Content}
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+		}
+		out = append(out, m)
+	}
+	return out
+}
@@ -0,0 +1,32 @@
+package parser
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateRunes(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		max  int
+		want string
+	}{
+		// "你好世界" 每个字 3 字节，按字节截到 4 会切开第二个字
+		{"你好世界", 2, "你好"},
+		{"你好世界", 4, "你好世界"},
+		{"你好世界", 10, "你好世界"},
+		// s[:3] 是 "ab" 加 "你" 的第一个字节
+		{"ab你好", 3, "ab你"},
+		{"hello", 3, "hel"},
+		{"你好", 0, ""},
+		{"", 5, ""},
+	} {
+		got := TruncateRunes(tc.s, tc.max)
+		if got != tc.want {
+			t.Errorf("TruncateRunes(%q, %d) = %q, want %q", tc.s, tc.max, got, tc.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("TruncateRunes(%q, %d) returned invalid UTF-8 %q", tc.s, tc.max, got)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"plugin"
+	"strings"
+	"sync"
+)
+
+// Plugin 聊天记录格式解析器；内置格式和外部插件（Go plugin .so）都实现这个接口
+type Plugin interface {
+	Name() string
+	// Detect 判断 data 是否是这种格式
+	Detect(data []byte) bool
+	Parse(data []byte, myName, targetName string) ([]ChatMessage, error)
+}
+
+// ConversationParser 可选接口：格式本身带对话边界（如 JSONL 一行一段）时实现，否则按时间间隔切分
+type ConversationParser interface {
+	ParseConversations(data []byte, myName, targetName string) ([]Conversation, error)
+}
+
+var registry struct {
+	mu      sync.Mutex
+	plugins []Plugin
+}
+
+// Register 注册外部解析插件，通常在插件包的 init 中调用；重名时 panic
+func Register(p Plugin) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, q := range registry.plugins {
+		if q.Name() == p.Name() {
+			panic(fmt.Sprintf("parser: plugin %q registered twice", p.Name()))
+		}
+	}
+	registry.plugins = append(registry.plugins, p)
+}
+
+// Registered 返回已注册的外部插件，按注册顺序
+func Registered() []Plugin {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return append([]Plugin(nil), registry.plugins...)
+}
+
+// LoadPlugin 打开 Go plugin（.so），插件在自己的 init 中调用 Register
+func LoadPlugin(path string) error {
+	if _, err := plugin.Open(path); err != nil {
+		return fmt.Errorf("open parser plugin %s: %w", path, err)
+	}
+	return nil
+}
+
+// Detect 依次检测，返回第一个匹配的插件，都不匹配时返回 nil
+func Detect(data []byte, plugins ...Plugin) Plugin {
+	for _, p := range plugins {
+		if p.Detect(data) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Lookup 按名字查找插件
+func Lookup(name string, plugins ...Plugin) Plugin {
+	for _, p := range plugins {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// detectBytes Detect 只看开头这么多字节
+const detectBytes = 64 << 10
+
+func head(data []byte) []byte {
+	return data[:min(len(data), detectBytes)]
+}
+
+// JSONLPlugin 内置 JSONL 格式（每行 {"messages": [...]}），UserIsMe 表示 role=user 是我，
+// MinConversation 是对话的最低要求，通常用 DefaultMinConversation
+type JSONLPlugin struct {
+	UserIsMe        bool
+	MinConversation MinConversation
+}
+
+func (JSONLPlugin) Name() string { return "jsonl" }
+
+func (JSONLPlugin) Detect(data []byte) bool {
+	line, _, _ := bytes.Cut(bytes.TrimSpace(head(data)), []byte("\n"))
+	var e jsonlEntry
+	return json.Unmarshal(line, &e) == nil && len(e.Messages) > 0
+}
+
+func (p JSONLPlugin) Parse(data []byte, myName, targetName string) ([]ChatMessage, error) {
+	return ParseJSONLBytes(data, myName, targetName, p.UserIsMe)
+}
+
+func (p JSONLPlugin) ParseConversations(data []byte, myName, targetName string) ([]Conversation, error) {
+	return ParseJSONLToConversations(data, myName, targetName, p.UserIsMe, p.MinConversation)
+}
+
+// DingTalkPlugin 内置钉钉 JSON 导出格式，MyStaffID 是我的 staffId
+type DingTalkPlugin struct {
+	MyStaffID string
+}
+
+func (DingTalkPlugin) Name() string { return "dingtalk" }
+
+func (DingTalkPlugin) Detect(data []byte) bool {
+	h := bytes.TrimSpace(head(data))
+	return len(h) > 0 && (h[0] == '[' || h[0] == '{') &&
+		bytes.Contains(h, []byte(`"msgType"`)) && bytes.Contains(h, []byte(`"createTime"`))
+}
+
+func (p DingTalkPlugin) Parse(data []byte, myName, targetName string) ([]ChatMessage, error) {
+	return ParseDingTalkJSON(data, p.MyStaffID, targetName)
+}
+
+// HTMLPlugin 内置 WechatExporter HTML 格式，只保留文本消息；Encoding 为空时自动识别
+type HTMLPlugin struct {
+	Encoding Encoding
+}
+
+func (HTMLPlugin) Name() string { return "html" }
+
+func (HTMLPlugin) Detect(data []byte) bool {
+	h := bytes.ToLower(bytes.TrimSpace(bytes.TrimPrefix(head(data), utf8BOM)))
+	return bytes.HasPrefix(h, []byte("<!doctype html")) || bytes.HasPrefix(h, []byte("<html"))
+}
+
+func (p HTMLPlugin) Parse(data []byte, myName, targetName string) ([]ChatMessage, error) {
+	data, err := DecodeText(data, p.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := ParseHTML(bytes.NewReader(data), myName)
+	if err != nil {
+		return nil, err
+	}
+	return FilterTextOnly(messages), nil
+}
+
+// TextPlugin 内置 WechatExporter Text 格式，只保留文本消息；Encoding 为空时自动识别
+type TextPlugin struct {
+	Encoding Encoding
+}
+
+func (TextPlugin) Name() string { return "text" }
+
+func (TextPlugin) Detect(data []byte) bool {
+	for _, line := range bytes.SplitN(bytes.TrimPrefix(head(data), utf8BOM), []byte("\n"), 20) {
+		if headerRe.Match(bytes.TrimRight(line, "\r")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p TextPlugin) Parse(data []byte, myName, targetName string) ([]ChatMessage, error) {
+	data, err := DecodeText(data, p.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := ParseText(bytes.NewReader(data), myName)
+	if err != nil {
+		return nil, err
+	}
+	return FilterTextOnly(messages), nil
+}
+
+// CSVPlugin 内置 CSV 格式，Columns 为各列位置，通常用 DefaultCSVColumns；Encoding 为空时自动识别
+type CSVPlugin struct {
+	Columns  CSVColumns
+	Encoding Encoding
+}
+
+func (CSVPlugin) Name() string { return "csv" }
+
+// Detect 开头几行（跳过表头）列数够、时间列都能解析
+func (p CSVPlugin) Detect(data []byte) bool {
+	h := head(data)
+	if i := bytes.LastIndexByte(h, '\n'); i >= 0 && len(h) < len(data) {
+		h = h[:i] // 去掉截断的最后一行
+	}
+	cr := csv.NewReader(bytes.NewReader(h))
+	cr.FieldsPerRecord = -1
+	rows := 0
+	for i := 0; i < 10; i++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil || len(record) < p.Columns.width() {
+			return false
+		}
+		if _, err := parseCSVTimestamp(strings.TrimPrefix(record[p.Columns.Time], "\ufeff")); err != nil {
+			if i == 0 {
+				continue // 表头
+			}
+			return false
+		}
+		rows++
+	}
+	return rows > 0
+}
+
+func (p CSVPlugin) Parse(data []byte, myName, targetName string) ([]ChatMessage, error) {
+	data, err := DecodeText(data, p.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCSV(bytes.NewReader(data), myName, p.Columns)
+}
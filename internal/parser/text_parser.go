@@ -2,7 +2,9 @@ package parser
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"strings"
@@ -14,17 +16,23 @@ var headerRe = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}\s+\d{2}:\d{2}(?::\d{2})?)
 
 // ParseTextFile 解析 WechatExporter 导出的 Text 格式文件
 func ParseTextFile(path string, myName string) ([]ChatMessage, error) {
-	f, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("open file: %w", err)
+		return nil, fmt.Errorf("read file: %w", err)
 	}
-	defer f.Close()
+	if data, err = DecodeText(data, EncodingAuto); err != nil {
+		return nil, err
+	}
+	return ParseText(bytes.NewReader(data), myName)
+}
 
+// ParseText 解析 WechatExporter 的 Text 格式
+func ParseText(r io.Reader, myName string) ([]ChatMessage, error) {
 	var messages []ChatMessage
 	var current *ChatMessage
 	var contentBuf strings.Builder
 
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(r)
 	scanner.Buffer(make([]byte, 0, 1024*1024), 1024*1024) // 1MB buffer
 
 	for scanner.Scan() {
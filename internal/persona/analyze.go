@@ -0,0 +1,87 @@
+package persona
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/liao/style-bot/internal/parser"
+)
+
+// BuildAnalysisPrompt 生成风格分析的 prompt：按 strategy 采样我的消息（最多 500 条）+ 前 50 段对话
+func BuildAnalysisPrompt(messages []parser.ChatMessage, conversations []parser.Conversation, myName, targetName string, strategy SampleStrategy) string {
+	var mine []parser.ChatMessage
+	for _, m := range messages {
+		if m.IsMe {
+			mine = append(mine, m)
+		}
+	}
+	myMessages := make([]string, len(mine))
+	for i, m := range mine {
+		myMessages[i] = m.Content
+	}
+
+	sample := sampleMessages(mine, strategy)
+
+	var convSamples []string
+	for i, c := range conversations {
+		if i >= 50 {
+			break
+		}
+		convSamples = append(convSamples, c.FormatAsExample(myName, targetName))
+	}
+
+	return fmt.Sprintf(`分析以下聊天记录中"%s"的说话风格。这是%s和%s之间的微信聊天记录。
+
+## %s的消息样本（共%d条，采样%d条）：
+%s
+
+## 对话示例（%d段）：
+%s
+
+请输出严格的 JSON 格式（不要 markdown 代码块），包含以下字段：
+{
+  "style": {
+    "typical_length": "描述消息长度特征",
+    "catchphrases": ["口头禅1", "口头禅2"],
+    "emoji_patterns": ["常用表情1", "常用表情2"],
+    "punctuation_style": "标点使用特征",
+    "response_style": "回复风格描述",
+    "humor_style": "幽默风格描述",
+    "formality": "正式程度",
+    "multi_message": true/false,
+    "negative_patterns": ["不会做的事1", "不会做的事2"],
+    "greeting_examples": ["打招呼示例"],
+    "agreement_examples": ["同意示例"],
+    "refusal_examples": ["拒绝示例"]
+  },
+  "relationship": {
+    "relationship": "关系描述",
+    "shared_topics": ["共同话题1", "共同话题2"],
+    "inside_jokes": ["内部梗/共同经历"],
+    "tone": "对话语气特征",
+    "key_facts": {"事实类别": "事实内容"}
+  }
+}`,
+		myName, myName, targetName,
+		myName, len(myMessages), len(sample),
+		strings.Join(sample, "\n"),
+		len(convSamples),
+		strings.Join(convSamples, "\n---\n"),
+	)
+}
+
+// ParseAnalysis 解析模型返回的风格分析 JSON（容忍 markdown 代码块）
+func ParseAnalysis(text string) (*Persona, error) {
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimSuffix(text, "```")
+	text = strings.TrimSpace(text)
+
+	var p Persona
+	if err := json.Unmarshal([]byte(text), &p); err != nil {
+		return nil, fmt.Errorf("unmarshal analysis: %w", err)
+	}
+	return &p, nil
+}
@@ -0,0 +1,85 @@
+package persona
+
+// MergeStrategy 列表字段的合并方式
+type MergeStrategy int
+
+const (
+	UnionSlices   MergeStrategy = iota // 取并集，已有的在前，去重
+	ReplaceSlices                      // 新结果非空时整体替换
+)
+
+// Merge 把新分析出的 fresh 合并进 existing，返回新的 Persona，两者都不修改
+// 文本字段：fresh 非空时覆盖；key_facts：按 key 合并，fresh 优先
+func Merge(existing, fresh *Persona, strategy MergeStrategy) *Persona {
+	if existing == nil {
+		existing = &Persona{}
+	}
+	if fresh == nil {
+		fresh = &Persona{}
+	}
+	list := func(a, b []string) []string {
+		if strategy == ReplaceSlices {
+			if len(b) > 0 {
+				return append([]string(nil), b...)
+			}
+			return append([]string(nil), a...)
+		}
+		return union(a, b)
+	}
+
+	es, fs := existing.Style, fresh.Style
+	er, fr := existing.Relationship, fresh.Relationship
+	merged := &Persona{
+		Style: StyleProfile{
+			TypicalLength:     text(es.TypicalLength, fs.TypicalLength),
+			Catchphrases:      list(es.Catchphrases, fs.Catchphrases),
+			EmojiPatterns:     list(es.EmojiPatterns, fs.EmojiPatterns),
+			PunctuationStyle:  text(es.PunctuationStyle, fs.PunctuationStyle),
+			ResponseStyle:     text(es.ResponseStyle, fs.ResponseStyle),
+			HumorStyle:        text(es.HumorStyle, fs.HumorStyle),
+			Formality:         text(es.Formality, fs.Formality),
+			MultiMessage:      es.MultiMessage || fs.MultiMessage,
+			NegativePatterns:  list(es.NegativePatterns, fs.NegativePatterns),
+			GreetingExamples:  list(es.GreetingExamples, fs.GreetingExamples),
+			AgreementExamples: list(es.AgreementExamples, fs.AgreementExamples),
+			RefusalExamples:   list(es.RefusalExamples, fs.RefusalExamples),
+		},
+		Relationship: RelationshipMemory{
+			Relationship: text(er.Relationship, fr.Relationship),
+			SharedTopics: list(er.SharedTopics, fr.SharedTopics),
+			InsideJokes:  list(er.InsideJokes, fr.InsideJokes),
+			Tone:         text(er.Tone, fr.Tone),
+		},
+		TargetName: text(existing.TargetName, fresh.TargetName),
+	}
+	if len(er.KeyFacts)+len(fr.KeyFacts) > 0 {
+		merged.Relationship.KeyFacts = make(map[string]string, len(er.KeyFacts)+len(fr.KeyFacts))
+		for k, v := range er.KeyFacts {
+			merged.Relationship.KeyFacts[k] = v
+		}
+		for k, v := range fr.KeyFacts {
+			merged.Relationship.KeyFacts[k] = v
+		}
+	}
+	return merged
+}
+
+func text(existing, fresh string) string {
+	if fresh != "" {
+		return fresh
+	}
+	return existing
+}
+
+func union(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var out []string
+	for _, s := range append(append([]string(nil), a...), b...) {
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	return out
+}
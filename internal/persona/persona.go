@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
 type Persona struct {
 	Style        StyleProfile        `json:"style"`
 	Relationship RelationshipMemory  `json:"relationship"`
+	TargetName   string              `json:"target_name,omitempty"` // 分析时的对方名字（-target-multiple 按发送人生成），为空时用 bot.target_name
 }
 
 type StyleProfile struct {
@@ -47,6 +49,26 @@ func LoadFromFile(path string) (*Persona, error) {
 	return &p, nil
 }
 
+// SaveToFile 写入 persona 文件：先写 <path>.tmp 再 rename，进程中途被杀也不会留下半个文件
+func SaveToFile(path string, p *Persona) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal persona: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create persona dir: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write persona file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename persona file: %w", err)
+	}
+	return nil
+}
+
 // FormatStyleForPrompt 将风格档案格式化为 prompt 文本
 func (p *Persona) FormatStyleForPrompt() string {
 	s := p.Style
@@ -0,0 +1,108 @@
+package persona
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/liao/style-bot/internal/parser"
+)
+
+// SampleStrategy 风格分析时从我的消息里采样的方式
+type SampleStrategy string
+
+const (
+	// SampleByIndex 按条数等间隔采样，话多的时期占比更大
+	SampleByIndex SampleStrategy = "uniform-by-index"
+	// SampleByTime 按时间窗口分桶，每个窗口尽量采同样多的消息
+	SampleByTime SampleStrategy = "uniform-by-time"
+)
+
+// ParseSampleStrategy 解析 -sample-strategy 参数，空字符串为 uniform-by-index
+func ParseSampleStrategy(s string) (SampleStrategy, error) {
+	switch SampleStrategy(s) {
+	case "", SampleByIndex:
+		return SampleByIndex, nil
+	case SampleByTime:
+		return SampleByTime, nil
+	}
+	return "", fmt.Errorf("unknown sample strategy %q (want %s or %s)", s, SampleByIndex, SampleByTime)
+}
+
+// 采样上限和时间窗口数
+const (
+	maxStyleSamples = 500
+	sampleWindows   = 50
+)
+
+// sampleMessages 按 strategy 采样消息内容
+func sampleMessages(messages []parser.ChatMessage, strategy SampleStrategy) []string {
+	if strategy == SampleByTime {
+		if sample := sampleByTime(messages, maxStyleSamples); sample != nil {
+			return sample
+		}
+	}
+	return sampleByIndex(messages, maxStyleSamples)
+}
+
+// sampleByIndex 固定步长采样
+func sampleByIndex(messages []parser.ChatMessage, limit int) []string {
+	step := max(len(messages)/limit, 1)
+	var sample []string
+	for i := 0; i < len(messages); i += step {
+		sample = append(sample, messages[i].Content)
+	}
+	return sample
+}
+
+// sampleByTime 把首尾时间之间等分成 sampleWindows 个窗口，名额平均分给有消息的窗口，
+// 消息少的窗口用不完的名额再分给其他窗口；没有时间的消息算进前一条的窗口。
+// 所有消息都没有时间时返回 nil
+func sampleByTime(messages []parser.ChatMessage, limit int) []string {
+	var first, last int64
+	for _, m := range messages {
+		if m.Timestamp.IsZero() {
+			continue
+		}
+		ts := m.Timestamp.UnixNano()
+		if first == 0 || ts < first {
+			first = ts
+		}
+		last = max(last, ts)
+	}
+	if first == 0 {
+		return nil
+	}
+
+	width := (last-first)/sampleWindows + 1
+	buckets := make([][]string, sampleWindows)
+	idx := 0
+	for _, m := range messages {
+		if !m.Timestamp.IsZero() {
+			idx = int((m.Timestamp.UnixNano() - first) / width)
+		}
+		buckets[idx] = append(buckets[idx], m.Content)
+	}
+
+	// 按窗口大小从小到大分配名额
+	order := make([]int, 0, len(buckets))
+	for i, b := range buckets {
+		if len(b) > 0 {
+			order = append(order, i)
+		}
+	}
+	slices.SortFunc(order, func(a, b int) int { return len(buckets[a]) - len(buckets[b]) })
+	quota := make([]int, len(buckets))
+	remaining := limit
+	for i, bi := range order {
+		quota[bi] = min(len(buckets[bi]), remaining/(len(order)-i))
+		remaining -= quota[bi]
+	}
+
+	var sample []string
+	for i, b := range buckets {
+		for j := range quota[i] {
+			sample = append(sample, b[j*len(b)/quota[i]])
+		}
+	}
+	return sample
+}
@@ -0,0 +1,33 @@
+package persona
+
+// 完整度评分的权重
+const (
+	scoreString = 0.05 // 每个非空文本字段
+	scoreSlice  = 0.1  // 每个至少 scoreSliceMin 项的列表
+	scoreFacts  = 0.1  // KeyFacts 至少 2 条
+
+	scoreSliceMin = 3
+)
+
+// Score 人设完整度，0-1：空字段多的人设（分析失败、聊天记录太少）生成的回复不像本人
+func (p *Persona) Score() float32 {
+	if p == nil {
+		return 0
+	}
+	s, r := p.Style, p.Relationship
+	var score float32
+	for _, f := range []string{s.TypicalLength, s.PunctuationStyle, s.ResponseStyle, s.HumorStyle, s.Formality, r.Relationship, r.Tone} {
+		if f != "" {
+			score += scoreString
+		}
+	}
+	for _, l := range [][]string{s.Catchphrases, s.EmojiPatterns, s.NegativePatterns, s.GreetingExamples, s.AgreementExamples, s.RefusalExamples, r.SharedTopics, r.InsideJokes} {
+		if len(l) >= scoreSliceMin {
+			score += scoreSlice
+		}
+	}
+	if len(r.KeyFacts) >= 2 {
+		score += scoreFacts
+	}
+	return min(score, 1)
+}
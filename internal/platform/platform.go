@@ -0,0 +1,19 @@
+package platform
+
+import "context"
+
+// Message 平台收到的一条文本消息
+type Message struct {
+	From int64 // 发送者 ID（QQ 号或对接方自己的用户 ID）
+	Text string
+}
+
+// Handler 处理一条消息，返回要回复的文本；为空表示不回复
+type Handler func(ctx context.Context, msg Message) (string, error)
+
+// Platform 消息来源，QQ WebSocket 之外的接入方式实现这个接口
+type Platform interface {
+	Name() string
+	// Run 开始接收消息并交给 h 处理，阻塞直到 ctx 取消或出错
+	Run(ctx context.Context, h Handler) error
+}
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liao/style-bot/internal/logging"
+	"github.com/liao/style-bot/internal/platform"
+)
+
+var logger = logging.For("webhook")
+
+// 请求签名：TimestampHeader 为 Unix 秒，SignatureHeader 为 hex(HMAC-SHA256(secret, 时间戳 + "." + body))，可带 "sha256=" 前缀
+const (
+	SignatureHeader = "X-Signature"
+	TimestampHeader = "X-Timestamp"
+)
+
+// maxClockSkew 时间戳与本机时间相差超过这么多的请求拒绝，截获的请求过了这个时间就不能重放
+const maxClockSkew = 5 * time.Minute
+
+// maxBodyBytes 请求体上限
+const maxBodyBytes = 64 << 10
+
+// shutdownTimeout ctx 取消后等待进行中的请求完成的时间
+const shutdownTimeout = 10 * time.Second
+
+// request POST /message 的请求体
+type request struct {
+	From int64  `json:"from"`
+	Text string `json:"text"`
+}
+
+// response POST /message 的响应体，回复同步返回
+type response struct {
+	Reply string `json:"reply"`
+}
+
+// Webhook 通过 HTTP POST 收消息，用于跑不了常驻 WebSocket 的部署
+type Webhook struct {
+	addr   string
+	secret []byte
+
+	mu   sync.Mutex
+	seen map[string]time.Time // 时间窗内用过的签名 → 时间戳，同一个请求在窗口内也只能用一次
+}
+
+var _ platform.Platform = (*Webhook)(nil)
+
+// New 创建 webhook 平台；secret 不能为空
+func New(listenAddr, secret string) *Webhook {
+	return &Webhook{addr: listenAddr, secret: []byte(secret), seen: make(map[string]time.Time)}
+}
+
+func (w *Webhook) Name() string { return "webhook" }
+
+// Run 在 listenAddr 上启动 HTTP 服务，ctx 取消时停止接收新请求，等进行中的请求处理完（最多 shutdownTimeout）
+func (w *Webhook) Run(ctx context.Context, h platform.Handler) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /message", func(rw http.ResponseWriter, r *http.Request) {
+		w.handleMessage(rw, r, h)
+	})
+	srv := &http.Server{
+		Addr:              w.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	logger.Info("webhook listening", "addr", w.addr)
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("webhook server: %w", err)
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown webhook server: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("webhook server: %w", err)
+	}
+	return nil
+}
+
+func (w *Webhook) handleMessage(rw http.ResponseWriter, r *http.Request, h platform.Handler) {
+	body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(rw, "read body failed", http.StatusBadRequest)
+		return
+	}
+	if err := w.verify(body, r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader), time.Now()); err != nil {
+		logger.Warn("webhook request rejected", "remote", r.RemoteAddr, "error", err)
+		http.Error(rw, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(rw, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.From == 0 {
+		http.Error(rw, "missing from", http.StatusBadRequest)
+		return
+	}
+
+	reply, err := h(r.Context(), platform.Message{From: req.From, Text: req.Text})
+	if err != nil {
+		logger.Error("webhook handler failed", "from", req.From, "error", err)
+		http.Error(rw, "handle message failed", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(response{Reply: reply}); err != nil {
+		logger.Warn("write webhook response failed", "error", err)
+	}
+}
+
+// verify 校验时间戳和 HMAC-SHA256 签名（常数时间比较）：时间戳超出 maxClockSkew 或签名在时间窗内用过时拒绝
+func (w *Webhook) verify(body []byte, timestamp, signature string, now time.Time) error {
+	sec, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid %s", TimestampHeader)
+	}
+	ts := time.Unix(sec, 0)
+	if skew := now.Sub(ts); skew > maxClockSkew || skew < -maxClockSkew {
+		return fmt.Errorf("stale timestamp (%s off)", skew.Round(time.Second))
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(signature), "sha256="))
+	if err != nil || len(got) == 0 {
+		return fmt.Errorf("missing or invalid %s", SignatureHeader)
+	}
+	if !hmac.Equal(got, Sign(w.secret, sec, body)) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for sig, t := range w.seen {
+		if now.Sub(t) > maxClockSkew {
+			delete(w.seen, sig)
+		}
+	}
+	if _, dup := w.seen[string(got)]; dup {
+		return fmt.Errorf("replayed request")
+	}
+	w.seen[string(got)] = ts
+	return nil
+}
+
+// Sign 计算请求签名：HMAC-SHA256(secret, 时间戳 + "." + body)，发送方把 hex 编码后放进 SignatureHeader
+func Sign(secret []byte, timestamp int64, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liao/style-bot/internal/platform"
+)
+
+var testSecret = []byte("s3cret")
+
+func signedRequest(body string, ts time.Time, secret []byte) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/message", strings.NewReader(body))
+	r.Header.Set(TimestampHeader, strconv.FormatInt(ts.Unix(), 10))
+	r.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(Sign(secret, ts.Unix(), []byte(body))))
+	return r
+}
+
+func echo(_ context.Context, m platform.Message) (string, error) { return "收到：" + m.Text, nil }
+
+func serve(w *Webhook, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	w.handleMessage(rec, r, echo)
+	return rec
+}
+
+func TestWebhookAcceptsSignedRequest(t *testing.T) {
+	w := New("", string(testSecret))
+	rec := serve(w, signedRequest(`{"from":10001,"text":"在吗"}`, time.Now(), testSecret))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "收到：在吗") {
+		t.Errorf("got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestWebhookRejectsBadRequests(t *testing.T) {
+	body := `{"from":10001,"text":"在吗"}`
+	for name, r := range map[string]*http.Request{
+		"wrong secret": signedRequest(body, time.Now(), []byte("other")),
+		"stale":        signedRequest(body, time.Now().Add(-maxClockSkew-time.Minute), testSecret),
+		"future":       signedRequest(body, time.Now().Add(maxClockSkew+time.Minute), testSecret),
+		"no timestamp": func() *http.Request {
+			r := signedRequest(body, time.Now(), testSecret)
+			r.Header.Del(TimestampHeader)
+			return r
+		}(),
+	} {
+		w := New("", string(testSecret))
+		if rec := serve(w, r); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got %d, want 401", name, rec.Code)
+		}
+	}
+}
+
+func TestWebhookRejectsReplay(t *testing.T) {
+	w := New("", string(testSecret))
+	body := `{"from":10001,"text":"在吗"}`
+	now := time.Now()
+	if rec := serve(w, signedRequest(body, now, testSecret)); rec.Code != http.StatusOK {
+		t.Fatalf("first request: %d", rec.Code)
+	}
+	if rec := serve(w, signedRequest(body, now, testSecret)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed request: got %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,83 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/liao/style-bot/internal/embedtask"
+)
+
+// centroidProbe 取全部文档向量时用的查询文本，内容无所谓
+const centroidProbe = "你好"
+
+// ComputeCentroid 计算向量库所有示例的平均向量，作为"原本风格"的参照
+func (p *Pipeline) ComputeCentroid(ctx context.Context) ([]float32, error) {
+	if !p.Enabled() {
+		return nil, fmt.Errorf("vector store is empty")
+	}
+	// 后端没有遍历接口，用一次取全部结果的查询代替
+	results, err := p.store.Query(ctx, centroidProbe, p.store.Count(), -1, QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	vecs := make([][]float32, 0, len(results))
+	for _, r := range results {
+		vecs = append(vecs, r.Embedding)
+	}
+	if len(vecs) == 0 || vecs[0] == nil {
+		return nil, fmt.Errorf("vector store backend does not return embeddings")
+	}
+	return Centroid(vecs), nil
+}
+
+// Embed 计算文本向量，与向量库使用同一个 embedding 模型；按文档算，才能和库里的风格中心比较
+func (p *Pipeline) Embed(ctx context.Context, text string) ([]float32, error) {
+	e, ok := p.store.(Embedder)
+	if !ok {
+		return nil, fmt.Errorf("vector store backend cannot embed text")
+	}
+	return e.Embed(embedtask.With(ctx, embedtask.Document), text)
+}
+
+// Centroid 平均向量，维度不一致的向量跳过；没有向量时返回 nil
+func Centroid(vecs [][]float32) []float32 {
+	var sum []float32
+	n := 0
+	for _, v := range vecs {
+		if len(v) == 0 {
+			continue
+		}
+		if sum == nil {
+			sum = make([]float32, len(v))
+		}
+		if len(v) != len(sum) {
+			continue
+		}
+		for i, x := range v {
+			sum[i] += x
+		}
+		n++
+	}
+	for i := range sum {
+		sum[i] /= float32(n)
+	}
+	return sum
+}
+
+// CosineSimilarity 余弦相似度，维度不一致或零向量时返回 0
+func CosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(na) * math.Sqrt(nb)))
+}
@@ -0,0 +1,78 @@
+package rag
+
+import (
+	"strconv"
+	"time"
+)
+
+// 文档 metadata 里的对话信息，导入时写入，用于按条件过滤
+const (
+	MetaStartAt  = "start_at"  // 对话第一条消息的时间（RFC 3339）
+	MetaMsgCount = "msg_count" // 对话的消息数
+	MetaSource   = "source"    // 来源标签（data-importer -source-tag，默认为输入文件名）
+)
+
+// filterOverfetch 有日期 / 消息数过滤时先多取几倍候选，过滤后不够 topK 时按这个倍数继续放宽
+const filterOverfetch = 3
+
+// QueryOptions 检索时的 metadata 过滤，零值不过滤。SourceTag 交给 chromem 的 where 精确匹配，
+// 日期和消息数 chromem 不支持比较，检索后再过滤；设了某个条件时，缺少对应 metadata 的文档（旧库）一律去掉
+type QueryOptions struct {
+	MinDate     time.Time // 对话结束时间不早于它
+	MaxDate     time.Time // 对话开始时间早于它（没有开始时间时看结束时间）
+	MinMsgCount int
+	SourceTag   string
+}
+
+// where chromem 能直接过滤的条件
+func (o QueryOptions) where() map[string]string {
+	if o.SourceTag == "" {
+		return nil
+	}
+	return map[string]string{MetaSource: o.SourceTag}
+}
+
+// postFilter 是否有需要检索后再过滤的条件
+func (o QueryOptions) postFilter() bool {
+	return !o.MinDate.IsZero() || !o.MaxDate.IsZero() || o.MinMsgCount > 0
+}
+
+// match 文档 metadata 是否满足全部条件
+func (o QueryOptions) match(meta map[string]string) bool {
+	if o.SourceTag != "" && meta[MetaSource] != o.SourceTag {
+		return false
+	}
+	if o.MinMsgCount > 0 {
+		n, err := strconv.Atoi(meta[MetaMsgCount])
+		if err != nil || n < o.MinMsgCount {
+			return false
+		}
+	}
+	if !o.MinDate.IsZero() {
+		end, err := time.Parse(time.RFC3339, meta[MetaEndAt])
+		if err != nil || end.Before(o.MinDate) {
+			return false
+		}
+	}
+	if !o.MaxDate.IsZero() {
+		start, err := time.Parse(time.RFC3339, meta[MetaStartAt])
+		if err != nil {
+			start, err = time.Parse(time.RFC3339, meta[MetaEndAt])
+		}
+		if err != nil || !start.Before(o.MaxDate) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterResults 去掉不满足 opts 的结果，最多保留 topK 条
+func filterResults(results []Result, opts QueryOptions, topK int) []Result {
+	kept := results[:0]
+	for _, r := range results {
+		if opts.match(r.Metadata) {
+			kept = append(kept, r)
+		}
+	}
+	return kept[:min(topK, len(kept))]
+}
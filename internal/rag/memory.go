@@ -0,0 +1,104 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/philippgille/chromem-go"
+
+	"github.com/liao/style-bot/internal/embedtask"
+)
+
+// MemoryStore 内存向量库，不落盘；配合假的 embedding 函数可以在没有 Ollama 和向量文件时测试 Pipeline
+type MemoryStore struct {
+	mu    sync.RWMutex
+	embed chromem.EmbeddingFunc
+	docs  []memoryDoc
+}
+
+type memoryDoc struct {
+	Document
+	vec []float32
+}
+
+func NewMemoryStore(embedFunc chromem.EmbeddingFunc) *MemoryStore {
+	return &MemoryStore{embed: embedFunc}
+}
+
+// Add 逐条计算 embedding，ID 相同的覆盖
+func (s *MemoryStore) Add(ctx context.Context, docs []Document) error {
+	for _, d := range docs {
+		vec, err := s.Embed(embedtask.With(ctx, embedtask.Document), d.Content)
+		if err != nil {
+			return fmt.Errorf("add document %s: %w", d.ID, err)
+		}
+		s.mu.Lock()
+		i := sort.Search(len(s.docs), func(i int) bool { return s.docs[i].ID >= d.ID })
+		if i < len(s.docs) && s.docs[i].ID == d.ID {
+			s.docs[i] = memoryDoc{d, vec}
+		} else {
+			s.docs = append(s.docs, memoryDoc{})
+			copy(s.docs[i+1:], s.docs[i:])
+			s.docs[i] = memoryDoc{d, vec}
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Query 暴力计算余弦相似度
+func (s *MemoryStore) Query(ctx context.Context, text string, topK int, minSimilarity float32, opts QueryOptions) ([]Result, error) {
+	if s.Count() == 0 {
+		return nil, nil
+	}
+	vec, err := s.Embed(embedtask.With(ctx, embedtask.Query), text)
+	if err != nil {
+		return nil, fmt.Errorf("query vectors: %w", err)
+	}
+
+	s.mu.RLock()
+	if len(s.docs) > 0 && len(s.docs[0].vec) != len(vec) {
+		n := len(s.docs[0].vec)
+		s.mu.RUnlock()
+		return nil, fmt.Errorf("%w: vectors were built with a different embedding model (%d dimensions, query has %d)", ErrEmbeddingMismatch, n, len(vec))
+	}
+	results := make([]Result, 0, len(s.docs))
+	for _, d := range s.docs {
+		sim := CosineSimilarity(vec, d.vec)
+		if sim < minSimilarity || !opts.match(d.Metadata) {
+			continue
+		}
+		results = append(results, Result{ID: d.ID, Content: d.Content, Similarity: sim, Metadata: d.Metadata, Embedding: d.vec})
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Similarity > results[j].Similarity })
+	return results[:min(topK, len(results))], nil
+}
+
+func (s *MemoryStore) Embed(ctx context.Context, text string) ([]float32, error) {
+	vec, err := s.embed(ctx, text)
+	if err != nil {
+		return nil, fmt.Errorf("embed: %w", err)
+	}
+	return vec, nil
+}
+
+func (s *MemoryStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.docs)
+}
+
+func (s *MemoryStore) Remove(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := sort.Search(len(s.docs), func(i int) bool { return s.docs[i].ID >= id })
+	if i == len(s.docs) || s.docs[i].ID != id {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	s.docs = append(s.docs[:i], s.docs[i+1:]...)
+	return nil
+}
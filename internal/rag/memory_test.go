@@ -0,0 +1,117 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func memoryStore(t *testing.T, docs []Document) *MemoryStore {
+	t.Helper()
+	s := NewMemoryStore(axisEmbed)
+	if err := s.Add(context.Background(), docs); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	return s
+}
+
+func TestMemoryStoreQueryOrdersBySimilarity(t *testing.T) {
+	s := memoryStore(t, []Document{
+		{ID: "c", Content: "doc9"},
+		{ID: "a", Content: "doc0"},
+		{ID: "b", Content: "doc3"},
+	})
+	results, err := s.Query(context.Background(), "query", 2, 0, QueryOptions{})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if got := ids(results); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("got %v, want a then b", got)
+	}
+	if results[0].Similarity < results[1].Similarity || len(results[0].Embedding) != 2 {
+		t.Errorf("results = %+v", results)
+	}
+
+	// doc9 的相似度 cos(0.45) ≈ 0.90，低于 minSimilarity 的去掉
+	results, err = s.Query(context.Background(), "query", 10, 0.95, QueryOptions{})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if got := ids(results); len(got) != 2 {
+		t.Errorf("got %v, want c filtered out", got)
+	}
+}
+
+func TestMemoryStoreQueryAppliesFilter(t *testing.T) {
+	s := memoryStore(t, []Document{
+		{ID: "a", Content: "doc0", Metadata: map[string]string{MetaSource: "qq", MetaMsgCount: "2"}},
+		{ID: "b", Content: "doc1", Metadata: map[string]string{MetaSource: "wechat", MetaMsgCount: "8"}},
+		{ID: "c", Content: "doc2", Metadata: map[string]string{MetaSource: "qq", MetaMsgCount: "6"}},
+	})
+	results, err := s.Query(context.Background(), "query", 10, 0, QueryOptions{SourceTag: "qq", MinMsgCount: 5})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if got := ids(results); len(got) != 1 || got[0] != "c" {
+		t.Errorf("got %v, want only c", got)
+	}
+}
+
+func TestMemoryStoreAddReplacesSameID(t *testing.T) {
+	s := memoryStore(t, []Document{{ID: "a", Content: "doc5"}, {ID: "b", Content: "doc1"}})
+	if err := s.Add(context.Background(), []Document{{ID: "a", Content: "doc0"}}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if s.Count() != 2 {
+		t.Fatalf("count = %d, want 2", s.Count())
+	}
+	results, err := s.Query(context.Background(), "query", 1, 0, QueryOptions{})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "a" || results[0].Content != "doc0" {
+		t.Errorf("got %+v, want the replaced a", results)
+	}
+}
+
+func TestMemoryStoreRemove(t *testing.T) {
+	s := memoryStore(t, []Document{{ID: "a", Content: "doc0"}, {ID: "b", Content: "doc1"}})
+	if err := s.Remove(context.Background(), "a"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if s.Count() != 1 {
+		t.Errorf("count = %d, want 1", s.Count())
+	}
+	if err := s.Remove(context.Background(), "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second remove: %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreQueryDimensionMismatch(t *testing.T) {
+	s := memoryStore(t, []Document{{ID: "a", Content: "doc0"}})
+	s.embed = func(context.Context, string) ([]float32, error) { return []float32{1, 0, 0}, nil }
+	if _, err := s.Query(context.Background(), "query", 1, 0, QueryOptions{}); !errors.Is(err, ErrEmbeddingMismatch) {
+		t.Errorf("query: %v, want ErrEmbeddingMismatch", err)
+	}
+}
+
+func TestMemoryStoreEmptyQuery(t *testing.T) {
+	s := NewMemoryStore(axisEmbed)
+	results, err := s.Query(context.Background(), "query", 3, 0, QueryOptions{})
+	if err != nil || len(results) != 0 {
+		t.Errorf("got %v, %v; want no results", results, err)
+	}
+}
+
+func TestOpenStoreBackends(t *testing.T) {
+	s, err := OpenStore(BackendMemory, "", axisEmbed, "")
+	if err != nil {
+		t.Fatalf("open memory store: %v", err)
+	}
+	if _, ok := s.(*MemoryStore); !ok {
+		t.Errorf("memory backend returned %T", s)
+	}
+	if _, err := OpenStore("qdrant", "", axisEmbed, ""); err == nil {
+		t.Error("unknown backend accepted")
+	}
+}
@@ -0,0 +1,65 @@
+package rag
+
+// mmrOverfetch 开启 MMR 时先多取几倍候选，再从中挑出互相不重复的 topK 条
+const mmrOverfetch = 4
+
+// selectMMR 最大边际相关（Maximal Marginal Relevance）：每轮挑 lambda*得分 - (1-lambda)*与已选示例的最大相似度 最高的一条，
+// 避免选出的示例都是同一句"早安"；results 已按得分（Score）从高到低排序。lambda <= 0 或有候选没有向量时退回普通的前 k 条
+func selectMMR(results []Result, k int, lambda float32) []Result {
+	if len(results) <= k {
+		return results
+	}
+	if lambda <= 0 || !hasEmbeddings(results) {
+		return results[:k]
+	}
+
+	selected := make([]Result, 0, k)
+	// maxSim[i] 候选 i 与已选示例的最大相似度
+	maxSim := make([]float32, len(results))
+	used := make([]bool, len(results))
+	for len(selected) < k {
+		best, bestScore := -1, float32(0)
+		for i, r := range results {
+			if used[i] {
+				continue
+			}
+			score := lambda*r.Score - (1-lambda)*maxSim[i]
+			if best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		used[best] = true
+		selected = append(selected, results[best])
+		for i, r := range results {
+			if !used[i] {
+				maxSim[i] = max(maxSim[i], CosineSimilarity(r.Embedding, results[best].Embedding))
+			}
+		}
+	}
+	return selected
+}
+
+func hasEmbeddings(results []Result) bool {
+	for _, r := range results {
+		if len(r.Embedding) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// meanPairwiseSimilarity 示例两两之间的平均余弦相似度，越低越多样；没有向量或不足两条时返回 0
+func meanPairwiseSimilarity(results []Result) float32 {
+	if len(results) < 2 || !hasEmbeddings(results) {
+		return 0
+	}
+	var sum float32
+	n := 0
+	for i := range results {
+		for j := i + 1; j < len(results); j++ {
+			sum += CosineSimilarity(results[i].Embedding, results[j].Embedding)
+			n++
+		}
+	}
+	return sum / float32(n)
+}
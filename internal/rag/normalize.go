@@ -0,0 +1,53 @@
+package rag
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// mentionRe @昵称（行首或空白之后，不误伤邮箱；到空白或中文标点为止，不吞掉后面的话）和 OneBot 的 [CQ:at,...] 码
+var mentionRe = regexp.MustCompile(`(^|\s)@[^\s，。！？、；：“”‘’（）《》【】…～]+|\[CQ:at,[^\]]*\]`)
+
+// NormalizeQuery 清理检索文本：去掉 @ 提及和 emoji，合并空白
+func NormalizeQuery(s string) string {
+	return normalize(s, true)
+}
+
+// normalize stripEmoji 为 false 时保留 emoji
+func normalize(s string, stripEmoji bool) string {
+	s = mentionRe.ReplaceAllString(s, " ")
+	if stripEmoji {
+		s = strings.Map(func(r rune) rune {
+			if isEmoji(r) {
+				return ' '
+			}
+			return r
+		}, s)
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// isEmoji 粗略判断：符号类字符（绝大多数 emoji）及组合 emoji 用的连接符、变体选择符、肤色修饰
+func isEmoji(r rune) bool {
+	switch {
+	case r == 0x200D, r == 0xFE0F, r >= 0x1F3FB && r <= 0x1F3FF:
+		return true
+	case r < 0x2000:
+		return false // ASCII 和常见符号（©、° 等）不算
+	}
+	return unicode.Is(unicode.So, r)
+}
+
+// NormalizedEmbedding 包装 embedding 函数，先清理文本再计算向量；导入和检索都经过它，两边的文本空间一致
+func NormalizedEmbedding(embed chromem.EmbeddingFunc, stripEmoji bool) chromem.EmbeddingFunc {
+	return func(ctx context.Context, text string) ([]float32, error) {
+		if t := normalize(text, stripEmoji); t != "" {
+			text = t
+		}
+		return embed(ctx, text)
+	}
+}
@@ -0,0 +1,18 @@
+package rag
+
+import "testing"
+
+func TestNormalizeQueryStripsMentions(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"@小王 周末去爬山吗", "周末去爬山吗"},
+		{"@小王，周末去爬山吗", "，周末去爬山吗"},
+		{"@小王：在吗？", "：在吗？"},
+		{"好的 @小王。明天见", "好的 。明天见"},
+		{"[CQ:at,qq=10001] 在吗", "在吗"},
+		{"发到 a@b.com 了", "发到 a@b.com 了"},
+	} {
+		if got := NormalizeQuery(tc.in); got != tc.want {
+			t.Errorf("NormalizeQuery(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -2,40 +2,174 @@ package rag
 
 import (
 	"context"
-	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/liao/style-bot/internal/logging"
+	"github.com/liao/style-bot/internal/metrics"
+	"github.com/liao/style-bot/internal/parser"
+)
+
+var logger = logging.For("rag")
+
+var (
+	ragQueries      = metrics.NewCounter("stylebot_rag_queries_total", "Vector store queries for reply examples.")
+	ragEmptyResults = metrics.NewCounter("stylebot_rag_empty_results_total", "Vector store queries that returned no example above the similarity threshold.")
+	storeDocuments  = metrics.NewGauge("stylebot_store_documents", "Documents in the vector store.")
 )
 
 type Pipeline struct {
-	store         *Store
-	topK          int
-	minSimilarity float32
+	store            VectorStore
+	topK             int
+	minSimilarity    float32
+	strongSimilarity float32 // 0 = 不做二次过滤
+	stripEmoji       bool    // 检索前去掉 emoji，与导入时一致
+	recencyHalfLife  float64 // 时间衰减半衰期（天），0 = 不按时间衰减
+	mmrLambda        float32 // MMR 里与查询相关度的权重，0 = 不做多样性重排
+	rerank           reranker
+	filter           QueryOptions
 }
 
-func NewPipeline(store *Store, topK int, minSimilarity float32) *Pipeline {
+// NewPipeline store 为 nil 时 RAG 关闭；recencyHalfLifeDays > 0 时排序得分每过 recencyHalfLifeDays 天打 5 折；
+// mmrLambda > 0 时用 MMR 从多取的候选里挑互相不重复的示例
+func NewPipeline(store VectorStore, topK int, minSimilarity, strongSimilarity float32, stripEmoji bool, recencyHalfLifeDays float64, mmrLambda float32) *Pipeline {
+	if store != nil {
+		storeDocuments.Set(int64(store.Count()))
+	}
 	return &Pipeline{
-		store:         store,
-		topK:          topK,
-		minSimilarity: minSimilarity,
+		store:            store,
+		topK:             topK,
+		minSimilarity:    minSimilarity,
+		strongSimilarity: strongSimilarity,
+		stripEmoji:       stripEmoji,
+		recencyHalfLife:  recencyHalfLifeDays,
+		mmrLambda:        mmrLambda,
 	}
 }
 
-// Retrieve 根据用户消息检索相关的历史对话示例
-func (p *Pipeline) Retrieve(ctx context.Context, userMsg string) ([]string, error) {
-	if p.store == nil || p.store.Count() == 0 {
-		slog.Debug("no vectors in store, skipping RAG")
+// SetFilter 只从满足 opts 的文档里检索示例（rag.filter）
+func (p *Pipeline) SetFilter(opts QueryOptions) {
+	p.filter = opts
+}
+
+// Enabled 向量库可用且非空时返回 true
+func (p *Pipeline) Enabled() bool {
+	return p.store != nil && p.store.Count() > 0
+}
+
+// Retrieve 根据用户消息检索相关的历史对话示例（已按 minSimilarity 过滤）；
+// preferSentiment 非空时，情绪标注与之相同的示例相似度乘以 sentimentBoost 后重新排序
+func (p *Pipeline) Retrieve(ctx context.Context, userMsg, preferSentiment string) ([]Result, error) {
+	return p.RetrieveWith(ctx, userMsg, p.topK, p.minSimilarity, preferSentiment)
+}
+
+// RetrieveWith 同 Retrieve，但用本次指定的 topK 和 minSim
+func (p *Pipeline) RetrieveWith(ctx context.Context, userMsg string, topK int, minSim float32, preferSentiment string) ([]Result, error) {
+	if !p.Enabled() {
+		logger.Debug("no vectors in store, skipping RAG")
+		return nil, nil
+	}
+	// 清理后为空（纯表情、只有 @）时没有可检索的内容
+	query := normalize(userMsg, p.stripEmoji)
+	if query == "" {
+		logger.Debug("query empty after normalization, skipping RAG", logging.Content("text", userMsg))
 		return nil, nil
 	}
 
-	results, err := p.store.Query(ctx, userMsg, p.topK, p.minSimilarity)
+	storeDocuments.Set(int64(p.store.Count()))
+	ragQueries.Inc()
+	fetch := topK
+	if p.recencyHalfLife > 0 {
+		fetch = topK * recencyOverfetch
+	}
+	if p.mmrLambda > 0 {
+		fetch = max(fetch, topK*mmrOverfetch)
+	}
+	if p.rerank.score != nil {
+		fetch = max(fetch, topK*rerankOverfetch)
+	}
+	if preferSentiment != "" {
+		fetch = max(fetch, topK*sentimentOverfetch)
+	}
+	results, err := p.store.Query(ctx, query, fetch, minSim, p.filter)
 	if err != nil {
 		return nil, err
 	}
 
-	examples := make([]string, 0, len(results))
-	for _, r := range results {
-		examples = append(examples, r.Content)
+	for i := range results {
+		results[i].Score = results[i].Similarity
+	}
+	results = decayByAge(results, p.recencyHalfLife, time.Now())
+	results = boostSentiment(results, preferSentiment)
+	if reranked, ok := p.rerank.apply(ctx, query, results, topK); ok {
+		results = reranked
+	} else {
+		results = selectMMR(results, topK, p.mmrLambda)
+	}
+	results = filterStrong(results, p.strongSimilarity)
+	if len(results) == 0 {
+		ragEmptyResults.Inc()
 	}
 
-	slog.Debug("RAG retrieved examples", "query", userMsg, "count", len(examples))
-	return examples, nil
+	logger.Debug("RAG retrieved examples", logging.Content("query", query), "count", len(results), "top_k", topK, "min_similarity", minSim, "sentiment", preferSentiment, "pairwise_similarity", meanPairwiseSimilarity(results))
+	for i, r := range results {
+		logger.Debug("RAG example", "rank", i+1, "similarity", r.Similarity, "score", r.Score, logging.Content("content", truncate(r.Content, 80)), "metadata", r.Metadata)
+	}
+	return results, nil
+}
+
+// MetaSentiment 文档 metadata 里的对话情绪标注（导入时 -annotate-sentiment）
+const MetaSentiment = "sentiment"
+
+// sentimentBoost 情绪相同的示例得分的加权
+const sentimentBoost = 1.1
+
+// sentimentOverfetch 有情绪偏好时先多取几倍候选再加权截到 topK；否则加权只能给已经选中的示例换顺序
+const sentimentOverfetch = 3
+
+// boostSentiment 情绪标注为 sentiment 的示例得分加权，按加权后的得分从高到低重新排序
+func boostSentiment(results []Result, sentiment string) []Result {
+	if sentiment == "" {
+		return results
+	}
+	for i := range results {
+		if results[i].Metadata[MetaSentiment] == sentiment {
+			results[i].Score *= sentimentBoost
+		}
+	}
+	sortByScore(results)
+	return results
+}
+
+// sortByScore 按得分从高到低排序，得分相同时保持原顺序
+func sortByScore(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+}
+
+// truncate 按字符截断，用于日志
+func truncate(s string, n int) string {
+	if t := parser.TruncateRunes(s, n); t != s {
+		return t + "…"
+	}
+	return s
+}
+
+// filterStrong 去掉原始相似度低于 strong 阈值的示例，但至少保留最相似的一条
+func filterStrong(results []Result, strong float32) []Result {
+	if strong <= 0 || len(results) == 0 {
+		return results
+	}
+	best := 0
+	for i, r := range results {
+		if r.Similarity > results[best].Similarity {
+			best = i
+		}
+	}
+	kept := make([]Result, 0, len(results))
+	for i, r := range results {
+		if i == best || r.Similarity >= strong {
+			kept = append(kept, r)
+		}
+	}
+	return kept
 }
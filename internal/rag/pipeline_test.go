@@ -0,0 +1,62 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func sentimentStore(t *testing.T, playful int) *MemoryStore {
+	t.Helper()
+	s := NewMemoryStore(axisEmbed)
+	var docs []Document
+	for i := range 6 {
+		meta := map[string]string{MetaSentiment: "neutral"}
+		if i == playful {
+			meta[MetaSentiment] = "playful"
+		}
+		docs = append(docs, Document{ID: fmt.Sprintf("d%d", i), Content: fmt.Sprintf("doc%d", i), Metadata: meta})
+	}
+	if err := s.Add(context.Background(), docs); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	return s
+}
+
+func TestRetrieveSentimentBoostReachesBeyondTopK(t *testing.T) {
+	// 情绪相同的 d5 排第 6，只取 topK 条候选时加权够不着它
+	p := NewPipeline(sentimentStore(t, 5), 2, 0, 0, false, 0, 0)
+	results, err := p.Retrieve(context.Background(), "query", "playful")
+	if err != nil {
+		t.Fatalf("retrieve: %v", err)
+	}
+	if got := ids(results); len(got) != 2 || got[0] != "d5" || got[1] != "d0" {
+		t.Fatalf("got %v, want d5 then d0", got)
+	}
+	if results[0].Similarity >= results[0].Score {
+		t.Errorf("raw similarity %.4f not kept below boosted score %.4f", results[0].Similarity, results[0].Score)
+	}
+}
+
+func TestRetrieveWithoutSentimentKeepsSimilarityOrder(t *testing.T) {
+	p := NewPipeline(sentimentStore(t, 5), 2, 0, 0, false, 0, 0)
+	results, err := p.Retrieve(context.Background(), "query", "")
+	if err != nil {
+		t.Fatalf("retrieve: %v", err)
+	}
+	if got := ids(results); len(got) != 2 || got[0] != "d0" || got[1] != "d1" {
+		t.Errorf("got %v, want d0 and d1", got)
+	}
+}
+
+func TestRetrieveStrongFilterIgnoresSentimentBoost(t *testing.T) {
+	// d5 加权后排第一，但原始相似度低于 strong_similarity，不能因为加权混进 prompt
+	p := NewPipeline(sentimentStore(t, 5), 2, 0, 0.99, false, 0, 0)
+	results, err := p.Retrieve(context.Background(), "query", "playful")
+	if err != nil {
+		t.Fatalf("retrieve: %v", err)
+	}
+	if got := ids(results); len(got) != 1 || got[0] != "d0" {
+		t.Errorf("got %v, want only d0", got)
+	}
+}
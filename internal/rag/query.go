@@ -0,0 +1,25 @@
+package rag
+
+import "strings"
+
+// newestTurnRepeat 拼检索文本时最新一条重复的次数，让它在向量里占更大比重
+const newestTurnRepeat = 2
+
+// ContextQuery 用最近几轮对话（从旧到新）拼检索文本：像"好啊"这样的回复单独检索只会命中泛泛的附和，
+// 带上前文才能检索到同一话题的对话；最新一条重复 newestTurnRepeat 次加权，空行跳过
+func ContextQuery(turns []string) string {
+	var lines []string
+	for _, t := range turns {
+		if t = strings.TrimSpace(t); t != "" {
+			lines = append(lines, t)
+		}
+	}
+	if len(lines) <= 1 {
+		return strings.Join(lines, "")
+	}
+	newest := lines[len(lines)-1]
+	for range newestTurnRepeat - 1 {
+		lines = append(lines, newest)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,48 @@
+package rag
+
+import (
+	"math"
+	"time"
+)
+
+// MetaEndAt 文档 metadata 里对话最后一条消息的时间（RFC 3339），导入时写入，用于按时间衰减
+const MetaEndAt = "end_at"
+
+// recencyOverfetch 开启时间衰减时先多取几倍候选，衰减后重新排序再截到 topK；否则相似度稍低的新对话进不了候选
+const recencyOverfetch = 3
+
+// decayByAge 排序得分乘以 0.5^(距今天数 / halfLifeDays)，即每过 halfLifeDays 天打 5 折，按衰减后的得分从高到低重新排序；
+// 没有 MetaEndAt 的文档（旧库、JSONL 导入）乘以有时间的候选的平均衰减，不占新对话的便宜也不被压到最后。
+// 只改 Score，原始相似度 Similarity 不变；halfLifeDays <= 0 时原样返回
+func decayByAge(results []Result, halfLifeDays float64, now time.Time) []Result {
+	if halfLifeDays <= 0 {
+		return results
+	}
+	factors := make([]float64, len(results))
+	var sum float64
+	var dated int
+	for i := range results {
+		end, err := time.Parse(time.RFC3339, results[i].Metadata[MetaEndAt])
+		if err != nil {
+			factors[i] = -1
+			continue
+		}
+		ageDays := max(now.Sub(end).Hours()/24, 0)
+		factors[i] = math.Exp(-math.Ln2 * ageDays / halfLifeDays)
+		sum += factors[i]
+		dated++
+	}
+	neutral := 1.0
+	if dated > 0 {
+		neutral = sum / float64(dated)
+	}
+	for i := range results {
+		f := factors[i]
+		if f < 0 {
+			f = neutral
+		}
+		results[i].Score *= float32(f)
+	}
+	sortByScore(results)
+	return results
+}
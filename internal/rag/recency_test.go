@@ -0,0 +1,83 @@
+package rag
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func dated(id string, sim float32, end time.Time) Result {
+	r := Result{ID: id, Similarity: sim, Score: sim, Metadata: map[string]string{}}
+	if !end.IsZero() {
+		r.Metadata[MetaEndAt] = end.Format(time.RFC3339)
+	}
+	return r
+}
+
+func TestDecayByAgeHalvesEveryHalfLife(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	results := decayByAge([]Result{
+		dated("fresh", 0.8, now),
+		dated("onehalf", 0.8, now.AddDate(0, 0, -100)),
+		dated("twohalves", 0.8, now.AddDate(0, 0, -200)),
+	}, 100, now)
+
+	want := map[string]float64{"fresh": 0.8, "onehalf": 0.4, "twohalves": 0.2}
+	for _, r := range results {
+		if math.Abs(float64(r.Score)-want[r.ID]) > 1e-4 {
+			t.Errorf("%s score = %.4f, want %.4f", r.ID, r.Score, want[r.ID])
+		}
+		if r.Similarity != 0.8 {
+			t.Errorf("%s raw similarity changed to %.4f", r.ID, r.Similarity)
+		}
+	}
+}
+
+func TestDecayByAgeReordersByScore(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	results := decayByAge([]Result{
+		dated("old", 0.9, now.AddDate(-3, 0, 0)),
+		dated("recent", 0.7, now.AddDate(0, 0, -7)),
+	}, 365, now)
+	if got := ids(results); got[0] != "recent" || got[1] != "old" {
+		t.Errorf("order = %v, want recent first", got)
+	}
+}
+
+func TestDecayByAgeUndatedGetsAverageDecay(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	results := decayByAge([]Result{
+		dated("undated", 0.85, time.Time{}),
+		dated("recent", 0.8, now),
+		dated("old", 0.8, now.AddDate(0, 0, -730)),
+	}, 365, now)
+
+	// 有时间的候选平均衰减 (1 + 0.25) / 2，没有时间的文档不再压过刚聊过的对话
+	if got := ids(results); got[0] != "recent" || got[1] != "undated" || got[2] != "old" {
+		t.Errorf("order = %v, want recent, undated, old", got)
+	}
+	for _, r := range results {
+		if r.ID == "undated" && math.Abs(float64(r.Score)-0.85*0.625) > 1e-4 {
+			t.Errorf("undated score = %.4f, want %.4f", r.Score, 0.85*0.625)
+		}
+	}
+}
+
+func TestDecayByAgeAllUndatedKeepsScores(t *testing.T) {
+	results := decayByAge([]Result{dated("a", 0.9, time.Time{}), dated("b", 0.8, time.Time{})}, 30, time.Now())
+	if results[0].Score != 0.9 || results[1].Score != 0.8 {
+		t.Errorf("scores = %.2f, %.2f, want unchanged", results[0].Score, results[1].Score)
+	}
+}
+
+func TestFilterStrongUsesRawSimilarity(t *testing.T) {
+	// 衰减后的得分低于阈值，但原始相似度够高的示例要留下
+	results := filterStrong([]Result{
+		{ID: "a", Similarity: 0.9, Score: 0.9},
+		{ID: "b", Similarity: 0.85, Score: 0.3},
+		{ID: "c", Similarity: 0.5, Score: 0.5},
+	}, 0.8)
+	if got := ids(results); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("kept %v, want a and b", got)
+	}
+}
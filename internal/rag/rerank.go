@@ -0,0 +1,70 @@
+package rag
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/liao/style-bot/internal/parser"
+)
+
+// RerankFunc 给每段候选对话打 0-10 的相关分，结果与 snippets 一一对应（ai.Client.ScoreRelevance）
+type RerankFunc func(ctx context.Context, query string, snippets []string) ([]float32, error)
+
+// 重排：多取 rerankOverfetch 倍候选交给模型打分，每段最多 rerankSnippetRunes 个字
+const (
+	rerankOverfetch    = 4
+	rerankSnippetRunes = 300
+)
+
+// reranker 模型重排的配置，未设置时为零值（关闭）
+type reranker struct {
+	score    RerankFunc
+	minScore float32       // 低于该分的候选丢弃
+	budget   time.Duration // 单条消息重排的耗时上限，0 = 不限制
+}
+
+// SetReranker 开启模型重排：余弦相似度只看字面，模型再按话题和语气给候选打分，保留 minScore 分以上最好的 topK 条；
+// 候选不超过 topK 条、超出 budget 或调用失败时跳过重排。score 为 nil 时关闭
+func (p *Pipeline) SetReranker(score RerankFunc, minScore float32, budget time.Duration) {
+	p.rerank = reranker{score: score, minScore: minScore, budget: budget}
+}
+
+// apply 按模型分数从高到低取前 topK 条（同分保持原顺序），ok 为 false 时调用方按相似度截取
+func (r reranker) apply(ctx context.Context, query string, results []Result, topK int) (kept []Result, ok bool) {
+	if r.score == nil || len(results) <= topK {
+		return nil, false
+	}
+	if r.budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.budget)
+		defer cancel()
+	}
+	snippets := make([]string, len(results))
+	for i, res := range results {
+		snippets[i] = parser.TruncateRunes(res.Content, rerankSnippetRunes)
+	}
+	start := time.Now()
+	scores, err := r.score(ctx, query, snippets)
+	if err != nil {
+		logger.Warn("rerank failed, using similarity order", "candidates", len(results), "error", err)
+		return nil, false
+	}
+
+	idx := make([]int, 0, len(results))
+	for i := range results {
+		if scores[i] >= r.minScore {
+			idx = append(idx, i)
+		}
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return scores[idx[a]] > scores[idx[b]] })
+	if len(idx) > topK {
+		idx = idx[:topK]
+	}
+	kept = make([]Result, len(idx))
+	for i, j := range idx {
+		kept[i] = results[j]
+	}
+	logger.Debug("reranked RAG candidates", "candidates", len(results), "kept", len(kept), "min_score", r.minScore, "duration", time.Since(start).Round(time.Millisecond))
+	return kept, true
+}
@@ -2,67 +2,311 @@ package rag
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log/slog"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/philippgille/chromem-go"
+
+	"github.com/liao/style-bot/internal/embedtask"
 )
 
+// VectorStore 向量库后端：chromem（本地持久化，默认）、memory（内存，测试用）
+type VectorStore interface {
+	// Add 写入文档，由后端计算 embedding
+	Add(ctx context.Context, docs []Document) error
+	// Query 检索满足 opts 的最相似的 topK 条，去掉相似度低于 minSimilarity 的
+	Query(ctx context.Context, text string, topK int, minSimilarity float32, opts QueryOptions) ([]Result, error)
+	// Count 文档数量
+	Count() int
+	// Remove 删除一条文档，ID 不存在时返回 ErrNotFound
+	Remove(ctx context.Context, id string) error
+}
+
+// ErrNotFound 文档 ID 不存在
+var ErrNotFound = errors.New("document not found")
+
+// ErrEmbeddingMismatch 运行时的 embedding 模型或维度与建库时不一致
+var ErrEmbeddingMismatch = errors.New("embedding mismatch")
+
+// Embedder 可选接口：后端能直接计算文本向量时实现（风格漂移检查用）
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// Document 写入向量库的一段对话
+type Document struct {
+	ID       string
+	Content  string
+	Metadata map[string]string
+}
+
+type Result struct {
+	ID         string
+	Content    string
+	Similarity float32 // 向量库返回的原始相似度，minSimilarity / strongSimilarity 都按它比较
+	Score      float32 // Pipeline 排序用的得分：Similarity 经时间衰减、情绪加权后的值
+	Metadata   map[string]string
+	Embedding  []float32 // 后端不提供时为 nil
+}
+
+// 向量库后端名（rag.backend）
+const (
+	BackendChromem = "chromem"
+	BackendMemory  = "memory"
+)
+
+// OpenStore 按 backend 打开向量库，空字符串为 chromem；memory 后端不读写 vectorsDir，也不校验 embeddingModel
+func OpenStore(backend, vectorsDir string, embedFunc chromem.EmbeddingFunc, embeddingModel string) (VectorStore, error) {
+	switch backend {
+	case "", BackendChromem:
+		s, err := NewStore(vectorsDir, embedFunc, embeddingModel)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case BackendMemory:
+		return NewMemoryStore(embedFunc), nil
+	}
+	return nil, fmt.Errorf("unknown vector store backend %q (want %s or %s)", backend, BackendChromem, BackendMemory)
+}
+
+// AddDocuments 批量写入文档，内容短于 minContentLen 个字的跳过（太短的对话只会带来噪音）
+func AddDocuments(ctx context.Context, s VectorStore, docs []Document, minContentLen int) error {
+	kept := make([]Document, 0, len(docs))
+	for _, d := range docs {
+		if utf8.RuneCountInString(d.Content) < minContentLen {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	if skipped := len(docs) - len(kept); skipped > 0 {
+		logger.Info("skipped short documents", "skipped", skipped, "min_len", minContentLen)
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return s.Add(ctx, kept)
+}
+
+// Store chromem-go 持久化向量库
 type Store struct {
+	dir        string
+	meta       storeMeta // 只在打开和补做校验时读写
 	db         *chromem.DB
 	collection *chromem.Collection
+	embed      chromem.EmbeddingFunc
+
+	dimMu sync.Mutex
+	dim   int // 库里向量的维度，0 = 还不知道（空库）
+
+	verifyMu    sync.Mutex
+	unverified  string // 打开时 embedding 不可用、还没校验的模型，第一次检索时补做
+	verifyError error  // 补做校验发现不一致，之后的检索都返回它
 }
 
-// NewStore 创建或加载向量存储
-func NewStore(vectorsDir string, embedFunc chromem.EmbeddingFunc) (*Store, error) {
+// storeMeta 向量库目录里 embedding.json 记录的 embedding 信息，导入和运行时的 embedding 必须一致，否则相似度没有意义
+type storeMeta struct {
+	Model string `json:"embedding_model"`
+	Dim   int    `json:"embedding_dim"`
+	Tasks string `json:"embedding_tasks"` // embedtask.Scheme：文档和查询是否分开算
+}
+
+// embedProbeTimeout 打开向量库时试算一次 embedding 的超时
+const embedProbeTimeout = 30 * time.Second
+
+// NewStore 创建或加载向量存储。embeddingModel 非空时试算一次 embedding 得到维度：
+// 新建的库把模型和维度写进 embedding.json，已有的库与它（旧库没有时与已有向量的维度）比对，不一致时返回错误。
+// 试算失败时已有的库照样打开，比对推迟到第一次检索；新建库必须试算成功。
+// embeddingModel 为空时不校验（只读 / 删除文档的工具用）
+func NewStore(vectorsDir string, embedFunc chromem.EmbeddingFunc, embeddingModel string) (*Store, error) {
 	db, err := chromem.NewPersistentDB(vectorsDir, false)
 	if err != nil {
 		return nil, fmt.Errorf("open vector db: %w", err)
 	}
 
-	col, err := db.GetOrCreateCollection("conversations", nil, embedFunc)
+	meta, err := readStoreMeta(vectorsDir)
+	if err != nil {
+		return nil, err
+	}
+	dim := 0
+	if embeddingModel != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), embedProbeTimeout)
+		vec, err := embedFunc(ctx, "你好")
+		cancel()
+		if err != nil {
+			// embedding 服务暂时不可用（如 Ollama 还没起来）时已有的库照样打开，校验推迟到第一次检索，不让检索整个进程都关着
+			col := db.GetCollection(collectionName, embedFunc)
+			if col == nil {
+				return nil, fmt.Errorf("probe embedding model %s: %w", embeddingModel, err)
+			}
+			logger.Warn("embedding model unreachable, checking it on the first query", "model", embeddingModel, "error", err)
+			return &Store{dir: vectorsDir, meta: meta, db: db, collection: col, embed: embedFunc, dim: meta.Dim, unverified: embeddingModel}, nil
+		}
+		dim = len(vec)
+	}
+
+	col, err := db.GetOrCreateCollection(collectionName, nil, embedFunc)
 	if err != nil {
 		return nil, fmt.Errorf("get/create collection: %w", err)
 	}
+	s := &Store{dir: vectorsDir, meta: meta, db: db, collection: col, embed: embedFunc, dim: meta.Dim}
+	if embeddingModel != "" {
+		if err := s.checkEmbedding(embeddingModel, dim); err != nil {
+			return nil, err
+		}
+	}
 
-	slog.Info("vector store loaded", "dir", vectorsDir, "count", col.Count())
-	return &Store{db: db, collection: col}, nil
+	logger.Info("vector store loaded", "dir", vectorsDir, "count", col.Count(), "embedding_model", embeddingModel)
+	return s, nil
+}
+
+// checkEmbedding 比对运行时的 embedding 和 embedding.json 记录的（旧库没有记录时与已有向量的维度）模型、维度；
+// 空库还没有记录时把运行时的写进去
+func (s *Store) checkEmbedding(model string, dim int) error {
+	meta := s.meta
+	if meta.Model == "" {
+		if s.collection.Count() == 0 {
+			return s.writeMeta(storeMeta{Model: model, Dim: dim, Tasks: embedtask.Scheme})
+		}
+		// 拿一个该维度的向量查一条：维度和库里的不同时 chromem 返回错误
+		if _, err := s.collection.QueryEmbedding(context.Background(), unitVector(dim), 1, nil, nil); err != nil {
+			return fmt.Errorf("%w: vectors have a different dimension than %s returns (%d); re-import", ErrEmbeddingMismatch, model, dim)
+		}
+		s.setDim(dim)
+		logger.Warn("vector store has no embedding model recorded, re-import to enable the model check")
+		return nil
+	}
+	if meta.Model != model {
+		return fmt.Errorf("%w: vectors were built with %s but runtime uses %s; use the same model or re-import", ErrEmbeddingMismatch, meta.Model, model)
+	}
+	if meta.Dim > 0 && meta.Dim != dim {
+		return fmt.Errorf("%w: vectors have %d dimensions but %s returns %d; set gemini.embedding_dim to %d or re-import", ErrEmbeddingMismatch, meta.Dim, model, dim, meta.Dim)
+	}
+	// 用途方案不同不影响相似度的计算，只是检索效果变差，所以只提醒
+	if meta.Tasks != embedtask.Scheme {
+		logger.Warn("vector store was embedded with a different task type scheme, re-import for better retrieval", "stored", meta.Tasks, "runtime", embedtask.Scheme)
+	}
+	return nil
 }
 
 // Query 检索相似对话
-func (s *Store) Query(ctx context.Context, text string, topK int, minSimilarity float32) ([]Result, error) {
+func (s *Store) Query(ctx context.Context, text string, topK int, minSimilarity float32, opts QueryOptions) ([]Result, error) {
 	if s.collection.Count() == 0 {
 		return nil, nil
 	}
 
-	k := topK
-	if k > s.collection.Count() {
-		k = s.collection.Count()
-	}
-
-	docs, err := s.collection.Query(ctx, text, k, nil, nil)
+	// 自己算查询向量，维度和库里的对不上时给出明确的错误，而不是 chromem 的 "vectors must have the same length"
+	vec, err := s.Embed(embedtask.With(ctx, embedtask.Query), text)
 	if err != nil {
 		return nil, fmt.Errorf("query vectors: %w", err)
 	}
+	if err := s.verifyDeferred(len(vec)); err != nil {
+		return nil, err
+	}
+	if err := s.checkQueryDim(len(vec)); err != nil {
+		return nil, err
+	}
 
-	var results []Result
-	for _, d := range docs {
-		if d.Similarity < minSimilarity {
-			continue
+	// 有检索后再过滤的条件时先多取几倍候选；过滤后不够 topK 就继续放宽，直到取遍整个库
+	// 或最后一条已经低于 minSimilarity（再往后只会更不相似）
+	count := s.collection.Count()
+	k := min(topK, count)
+	if opts.postFilter() {
+		k = min(topK*filterOverfetch, count)
+	}
+	for {
+		docs, err := s.collection.QueryEmbedding(ctx, vec, k, opts.where(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("query vectors: %w", err)
+		}
+		var results []Result
+		for _, d := range docs {
+			if d.Similarity < minSimilarity {
+				continue
+			}
+			results = append(results, Result{
+				ID:         d.ID,
+				Content:    d.Content,
+				Similarity: d.Similarity,
+				Metadata:   d.Metadata,
+				Embedding:  d.Embedding,
+			})
+		}
+		kept := filterResults(results, opts, topK)
+		exhausted := len(docs) < k || k == count || (len(docs) > 0 && docs[len(docs)-1].Similarity < minSimilarity)
+		if len(kept) >= topK || !opts.postFilter() || exhausted {
+			return kept, nil
 		}
-		results = append(results, Result{
-			Content:    d.Content,
-			Similarity: d.Similarity,
-			Metadata:   d.Metadata,
-		})
+		k = min(k*filterOverfetch, count)
+	}
+}
+
+// Add 并发计算 embedding 并写入
+func (s *Store) Add(ctx context.Context, docs []Document) error {
+	cdocs := make([]chromem.Document, len(docs))
+	for i, d := range docs {
+		cdocs[i] = chromem.Document{ID: d.ID, Content: d.Content, Metadata: d.Metadata}
+	}
+	return s.collection.AddDocuments(embedtask.With(ctx, embedtask.Document), cdocs, runtime.NumCPU())
+}
+
+// verifyDeferred 打开时没能校验的 embedding 模型，第一次成功算出查询向量后补做 checkEmbedding；
+// 不一致时记住错误，之后的检索都返回它
+func (s *Store) verifyDeferred(dim int) error {
+	s.verifyMu.Lock()
+	defer s.verifyMu.Unlock()
+	if s.unverified == "" {
+		return s.verifyError
+	}
+	model := s.unverified
+	s.unverified = ""
+	if err := s.checkEmbedding(model, dim); err != nil {
+		logger.Error("vector store does not match the embedding model", "model", model, "error", err)
+		s.verifyError = err
+		return err
+	}
+	logger.Info("embedding model reachable again, vector store checked", "model", model)
+	return nil
+}
+
+// checkQueryDim 查询向量的维度与库里的不同时返回 ErrEmbeddingMismatch
+func (s *Store) checkQueryDim(n int) error {
+	if dim := s.storedDim(); dim > 0 && n != dim {
+		return fmt.Errorf("%w: vectors were built with a different embedding model (%d dimensions, query has %d); "+
+			"configure the model used at import time or re-import", ErrEmbeddingMismatch, dim, n)
 	}
-	return results, nil
+	return nil
 }
 
-// AddDocuments 批量写入文档
-func (s *Store) AddDocuments(ctx context.Context, docs []chromem.Document) error {
-	return s.collection.AddDocuments(ctx, docs, runtime.NumCPU())
+// storedDim 库里向量的维度：embedding.json 记录的，旧库是校验时得知的；0 = 不知道
+func (s *Store) storedDim() int {
+	s.dimMu.Lock()
+	defer s.dimMu.Unlock()
+	return s.dim
+}
+
+// setDim 记下校验时得知的库里向量的维度
+func (s *Store) setDim(dim int) {
+	s.dimMu.Lock()
+	defer s.dimMu.Unlock()
+	s.dim = dim
+}
+
+// Embed 用向量库的 embedding 函数计算文本向量
+func (s *Store) Embed(ctx context.Context, text string) ([]float32, error) {
+	vec, err := s.embed(ctx, text)
+	if err != nil {
+		return nil, fmt.Errorf("embed: %w", err)
+	}
+	return vec, nil
 }
 
 // Count 返回文档数量
@@ -70,8 +314,89 @@ func (s *Store) Count() int {
 	return s.collection.Count()
 }
 
-type Result struct {
-	Content    string
-	Similarity float32
-	Metadata   map[string]string
+// collectionName 向量库里唯一的 collection
+const collectionName = "conversations"
+
+// Get 按 ID 读取一条文档
+func (s *Store) Get(ctx context.Context, id string) (Document, error) {
+	d, err := s.collection.GetByID(ctx, id)
+	if err != nil {
+		return Document{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return Document{ID: d.ID, Content: d.Content, Metadata: d.Metadata}, nil
+}
+
+// Remove 删除一条文档（同时删除磁盘上的文件）
+func (s *Store) Remove(ctx context.Context, id string) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	if err := s.collection.Delete(ctx, nil, nil, id); err != nil {
+		return fmt.Errorf("delete document %s: %w", id, err)
+	}
+	return nil
+}
+
+// List 返回全部文档，按 ID 排序。chromem 没有遍历接口，用一个与库里同维度的向量取回全部文档
+func (s *Store) List(ctx context.Context) ([]Document, error) {
+	count := s.collection.Count()
+	if count == 0 {
+		return nil, nil
+	}
+	dim := s.storedDim()
+	if dim == 0 {
+		return nil, errors.New("vector store has no embedding dimension recorded; open it with the embedding model or re-import")
+	}
+	results, err := s.collection.QueryEmbedding(ctx, unitVector(dim), count, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("list documents: %w", err)
+	}
+	docs := make([]Document, 0, len(results))
+	for _, r := range results {
+		docs = append(docs, Document{ID: r.ID, Content: r.Content, Metadata: r.Metadata})
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	return docs, nil
+}
+
+// unitVector dim 维的单位向量（第一维为 1）
+func unitVector(dim int) []float32 {
+	vec := make([]float32, dim)
+	if dim > 0 {
+		vec[0] = 1
+	}
+	return vec
+}
+
+// storeMetaFile 向量库目录里记录 embedding 信息的文件
+const storeMetaFile = "embedding.json"
+
+// readStoreMeta 读取 vectorsDir 的 embedding.json，不存在时为零值（新库或旧库）
+func readStoreMeta(vectorsDir string) (storeMeta, error) {
+	var meta storeMeta
+	data, err := os.ReadFile(filepath.Join(vectorsDir, storeMetaFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return meta, nil
+	}
+	if err != nil {
+		return meta, fmt.Errorf("read %s: %w", storeMetaFile, err)
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("parse %s: %w", storeMetaFile, err)
+	}
+	return meta, nil
+}
+
+// writeMeta 写入 embedding.json
+func (s *Store) writeMeta(meta storeMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, storeMetaFile), data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", storeMetaFile, err)
+	}
+	s.meta = meta
+	s.setDim(meta.Dim)
+	return nil
 }
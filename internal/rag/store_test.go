@@ -0,0 +1,189 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// axisEmbed 假 embedding（单位向量，chromem 要求）：文本是 "doc<i>" 时离查询 "query" 越来越远，i 越大越不相似
+func axisEmbed(_ context.Context, text string) ([]float32, error) {
+	if text == "query" {
+		return []float32{1, 0}, nil
+	}
+	var i int
+	if _, err := fmt.Sscanf(text, "doc%d", &i); err != nil {
+		return nil, err
+	}
+	angle := float64(i) / 20
+	return []float32{float32(math.Cos(angle)), float32(math.Sin(angle))}, nil
+}
+
+func TestStoreQueryWidensUntilFilterIsSatisfied(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewStore(t.TempDir(), axisEmbed, "")
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	// 只有最不相似的两条满足 msg_count 条件，第一轮 topK*filterOverfetch 的候选里没有它们
+	var docs []Document
+	for i := range 30 {
+		n := 2
+		if i >= 28 {
+			n = 10
+		}
+		docs = append(docs, Document{ID: fmt.Sprintf("d%02d", i), Content: fmt.Sprintf("doc%d", i), Metadata: map[string]string{MetaMsgCount: strconv.Itoa(n)}})
+	}
+	if err := s.Add(ctx, docs); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	results, err := s.Query(ctx, "query", 2, 0, QueryOptions{MinMsgCount: 5})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "d28" || results[1].ID != "d29" {
+		t.Errorf("got %v, want d28 and d29", ids(results))
+	}
+}
+
+func TestStoreQueryStopsBelowMinSimilarity(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewStore(t.TempDir(), axisEmbed, "")
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	var docs []Document
+	for i := range 30 {
+		docs = append(docs, Document{ID: fmt.Sprintf("d%02d", i), Content: fmt.Sprintf("doc%d", i), Metadata: map[string]string{MetaMsgCount: "2"}})
+	}
+	if err := s.Add(ctx, docs); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	results, err := s.Query(ctx, "query", 2, 0.99, QueryOptions{MinMsgCount: 5})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("got %v, want none", ids(results))
+	}
+}
+
+func TestStoreOpensWhileEmbeddingIsDown(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	var down atomic.Bool
+	embed := func(ctx context.Context, text string) ([]float32, error) {
+		if down.Load() {
+			return nil, errors.New("connection refused")
+		}
+		if text == "你好" {
+			return []float32{1, 0}, nil
+		}
+		return axisEmbed(ctx, text)
+	}
+	s, err := NewStore(dir, embed, "m")
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	if err := s.Add(ctx, []Document{{ID: "d00", Content: "doc0"}}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	// 启动时 embedding 不可用：库照样打开，恢复后检索正常
+	down.Store(true)
+	s, err = NewStore(dir, embed, "m")
+	if err != nil {
+		t.Fatalf("reopen while down: %v", err)
+	}
+	if _, err := s.Query(ctx, "query", 1, 0, QueryOptions{}); err == nil {
+		t.Error("query succeeded while embedding is down")
+	}
+	down.Store(false)
+	results, err := s.Query(ctx, "query", 1, 0, QueryOptions{})
+	if err != nil || len(results) != 1 {
+		t.Errorf("query after recovery = %v, %v", ids(results), err)
+	}
+
+	// 推迟的校验照样发现模型不一致
+	down.Store(true)
+	s, err = NewStore(dir, embed, "other")
+	if err != nil {
+		t.Fatalf("reopen while down: %v", err)
+	}
+	down.Store(false)
+	for range 2 {
+		if _, err := s.Query(ctx, "query", 1, 0, QueryOptions{}); !errors.Is(err, ErrEmbeddingMismatch) {
+			t.Errorf("query with another model: err = %v, want ErrEmbeddingMismatch", err)
+		}
+	}
+}
+
+func TestNewStoreFailsWithoutEmbeddingForNewStore(t *testing.T) {
+	down := func(context.Context, string) ([]float32, error) { return nil, errors.New("connection refused") }
+	if _, err := NewStore(t.TempDir(), down, "m"); err == nil {
+		t.Error("new store created without knowing the embedding dimension")
+	}
+}
+
+func TestStoreListReturnsEveryDocument(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	embed := func(ctx context.Context, text string) ([]float32, error) {
+		if text == "你好" {
+			return []float32{1, 0}, nil
+		}
+		return axisEmbed(ctx, text)
+	}
+	s, err := NewStore(dir, embed, "m")
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	if err := s.Add(ctx, []Document{
+		{ID: "b", Content: "doc40", Metadata: map[string]string{MetaMsgCount: "3"}},
+		{ID: "a", Content: "doc1"},
+		{ID: "c", Content: "doc60"},
+	}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	// 只读工具不带 embedding 模型打开，维度从 embedding.json 读出
+	s, err = NewStore(dir, nil, "")
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	docs, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(docs) != 3 || docs[0].ID != "a" || docs[1].ID != "b" || docs[2].ID != "c" {
+		t.Fatalf("got %+v, want a, b, c", docs)
+	}
+	if docs[1].Content != "doc40" || docs[1].Metadata[MetaMsgCount] != "3" {
+		t.Errorf("document b = %+v", docs[1])
+	}
+}
+
+func TestAddDocumentsCountsCharacters(t *testing.T) {
+	store := NewMemoryStore(axisEmbed)
+	// "doc1" 加中文凑到 9 个字（27 字节以上），按字数算短于 10 被跳过
+	docs := []Document{{ID: "short", Content: "doc1周末去爬山"}, {ID: "long", Content: "doc2周末去爬山吧好啊"}}
+	if err := AddDocuments(context.Background(), store, docs, 10); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if store.Count() != 1 {
+		t.Errorf("stored %d documents, want only the long one", store.Count())
+	}
+}
+
+func ids(results []Result) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.ID
+	}
+	return out
+}
@@ -0,0 +1,46 @@
+package rag
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// warmUpConcurrency 预热时同时检索的条数
+const warmUpConcurrency = 4
+
+// WarmUp 并发检索一遍 queries 并丢弃结果，让向量库和 embedding 连接在第一条真实消息前就绪；返回第一个错误
+func (p *Pipeline) WarmUp(ctx context.Context, queries []string) error {
+	if !p.Enabled() || len(queries) == 0 {
+		return nil
+	}
+	start := time.Now()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		failed   int
+	)
+	sem := make(chan struct{}, warmUpConcurrency)
+	for _, q := range queries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(q string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, err := p.Retrieve(ctx, q, ""); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				failed++
+				mu.Unlock()
+			}
+		}(q)
+	}
+	wg.Wait()
+
+	logger.Info("RAG warm-up finished", "queries", len(queries), "failed", failed, "duration", time.Since(start).Round(time.Millisecond))
+	return firstErr
+}